@@ -66,6 +66,9 @@ func SplitArguments(source string) (cmd string, arguments []string) {
 	if results[len(results) - 1] == "" {
 		results = results[:len(results)-1]
 	}
+	if len(results) == 0 {
+		return
+	}
 
 	cmd = results[0]
 	arguments = results[1:]
@@ -76,6 +76,11 @@ func TestSplitArguments(t *testing.T) {
 			wantCmd: "\"C:\\Program Files\\Java\\bin\\java.exe\"",
 			wantArguments: []string{"-jar", "\"test this.jar\"", "noGui"},
 		},
+		{
+			args: "",
+			wantCmd: "",
+			wantArguments: nil,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -0,0 +1,167 @@
+/*
+ Copyright 2023 Padduck, LLC
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+  	http://www.apache.org/licenses/LICENSE-2.0
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+*/
+
+package pufferpanel
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+)
+
+// GenerateCertificateKey creates a key for a certificate. Only P-256 keys are used, the same as for tokens
+func GenerateCertificateKey() (*ecdsa.PrivateKey, error) {
+	return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+}
+
+func EncodePrivateKey(key *ecdsa.PrivateKey) ([]byte, error) {
+	data, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: data}), nil
+}
+
+func DecodePrivateKey(data []byte) (*ecdsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no key found")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	ecKey, ok := key.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("key is not an ECDSA key")
+	}
+	return ecKey, nil
+}
+
+func EncodeCertificate(cert *x509.Certificate) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+}
+
+func DecodeCertificate(data []byte) (*x509.Certificate, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, errors.New("no certificate found")
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+// CreateCertificateRequest creates the request a node sends to the panel to have its key signed
+func CreateCertificateRequest(key *ecdsa.PrivateKey, name string) ([]byte, error) {
+	data, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{Subject: pkix.Name{CommonName: name}}, key)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: data}), nil
+}
+
+func DecodeCertificateRequest(data []byte) (*x509.CertificateRequest, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE REQUEST" {
+		return nil, errors.New("no certificate request found")
+	}
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	return csr, csr.CheckSignature()
+}
+
+// CertificateFingerprint is the SHA-256 of the certificate, which is what the panel pins for each node
+func CertificateFingerprint(cert *x509.Certificate) string {
+	hash := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(hash[:])
+}
+
+// IsKeyFor checks the certificate was issued for the key
+func IsKeyFor(key *ecdsa.PrivateKey, cert *x509.Certificate) bool {
+	public, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		return false
+	}
+	certPublic, err := x509.MarshalPKIXPublicKey(cert.PublicKey)
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(public, certPublic)
+}
+
+// PinnedClientTLS is how the panel connects to a node. The node must have a certificate from the panel's CA, and it
+// must be the exact certificate pinned for the node. Host names are not checked, as the pin already says which node
+// it is and nodes are often reached by addresses a certificate could not list
+func PinnedClientTLS(ca *x509.CertPool, client func() (tls.Certificate, error), fingerprint string) *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			cert, err := client()
+			return &cert, err
+		},
+		InsecureSkipVerify: true,
+		VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			if len(rawCerts) == 0 {
+				return ErrCertificateNotTrusted
+			}
+
+			certs := make([]*x509.Certificate, len(rawCerts))
+			for k, v := range rawCerts {
+				cert, err := x509.ParseCertificate(v)
+				if err != nil {
+					return err
+				}
+				certs[k] = cert
+			}
+
+			intermediates := x509.NewCertPool()
+			for _, v := range certs[1:] {
+				intermediates.AddCert(v)
+			}
+
+			_, err := certs[0].Verify(x509.VerifyOptions{
+				Roots:         ca,
+				Intermediates: intermediates,
+				KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+			})
+			if err != nil {
+				return err
+			}
+
+			if CertificateFingerprint(certs[0]) != fingerprint {
+				return ErrCertificateNotTrusted
+			}
+			return nil
+		},
+	}
+}
+
+// MutualServerTLS is how a node accepts connections from the panel, which has to present a client certificate
+// from the panel's CA
+func MutualServerTLS(ca *x509.CertPool, getCertificate func(*tls.ClientHelloInfo) (*tls.Certificate, error)) *tls.Config {
+	return &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		ClientAuth:     tls.RequireAndVerifyClientCert,
+		ClientCAs:      ca,
+		GetCertificate: getCertificate,
+	}
+}
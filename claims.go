@@ -26,6 +26,10 @@ type Claim struct {
 
 type PanelClaims struct {
 	Scopes map[string][]Scope `json:"scopes,omitempty"`
+	//the client the token was issued to, if it was issued to one
+	ClientId string `json:"client_id,omitempty"`
+	//where a transfer is to fetch the server from, so the node receiving it only goes where the panel said
+	TransferSource string `json:"transfer_source,omitempty"`
 }
 
 type Token struct {
@@ -33,13 +37,20 @@ type Token struct {
 	Claims *Claim
 }
 
-func ParseToken(publicKey *ecdsa.PublicKey, token string) (*Token, error) {
-	if publicKey == nil {
-		return nil, errors.New("PUBLIC KEY NOT LOADED")
-	}
+// ParseToken validates the token, using the key with the id the token was signed with.
+// The key id is empty for tokens created before keys were rotated
+func ParseToken(getKey func(kid string) (*ecdsa.PublicKey, error), token string) (*Token, error) {
 	claim, err := jwt.ParseWithClaims(token, &Claim{PanelClaims: PanelClaims{Scopes: make(map[string][]Scope)}}, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		publicKey, err := getKey(kid)
+		if err != nil {
+			return nil, err
+		}
+		if publicKey == nil {
+			return nil, errors.New("PUBLIC KEY NOT LOADED")
+		}
 		return publicKey, nil
-	})
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodES256.Alg()}))
 
 	if err != nil {
 		return nil, err
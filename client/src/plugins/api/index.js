@@ -149,6 +149,18 @@ class ApiClient extends EventEmitter {
     })
   }
 
+  getAuthorizeRequest (query) {
+    return this.withErrorHandling(async ctx => {
+      return (await ctx.$http.get('/api/self/authorize', { params: query })).data
+    })
+  }
+
+  answerAuthorizeRequest (query, approve) {
+    return this.withErrorHandling(async ctx => {
+      return (await ctx.$http.post('/api/self/authorize', { ...query, approve })).data.redirectUri
+    })
+  }
+
   getSetting (key, options = {}) {
     return this.withErrorHandling(async ctx => {
       return (await ctx.$http.get(`/api/settings/${key}`)).data.value
@@ -281,6 +281,13 @@ export const ServersApi = {
     })
   },
 
+  switchServerEnvironment (id, type) {
+    return this.withErrorHandling(async ctx => {
+      await ctx.$http.post(`/proxy/daemon/server/${id}/environment`, { type })
+      return true
+    })
+  },
+
   updateServerData (id, data) {
     return this.withErrorHandling(async ctx => {
       await ctx.$http.post(`/proxy/daemon/server/${id}/data`, { data })
@@ -21,9 +21,9 @@ function route ({ path, view, name, meta }) {
   }
 }
 
-function checkLoginState (next) {
+function checkLoginState (to, next) {
   if (!Vue.prototype.hasAuth()) {
-    next('/auth/login')
+    next({ path: '/auth/login', query: to.name === 'Authorize' ? { redirect: to.fullPath } : {} })
   } else {
     next()
   }
@@ -56,7 +56,7 @@ router.beforeEach((to, from, next) => {
   if (to.matched.some(r => r.meta.noAuth)) {
     next()
   } else {
-    checkLoginState(next)
+    checkLoginState(to, next)
   }
 })
 
@@ -108,6 +108,16 @@ export default [
       noBase: true
     }
   },
+  {
+    path: '/auth/authorize',
+    name: 'Authorize',
+    view: 'Authorize',
+    meta: {
+      noSidebar: true,
+      noFooter: true,
+      noBase: true
+    }
+  },
   {
     path: '/auth/invite',
     name: 'Invite',
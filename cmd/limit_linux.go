@@ -0,0 +1,46 @@
+/*
+ Copyright 2023 Padduck, LLC
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+  	http://www.apache.org/licenses/LICENSE-2.0
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"github.com/pufferpanel/pufferpanel/v2/environments/tty"
+	"github.com/spf13/cobra"
+	"os"
+)
+
+var limitResources string
+var limitCgroup string
+
+var limitCmd = &cobra.Command{
+	Use:    "limit --resources <json> [--cgroup <path>] -- <command> [args...]",
+	Short:  "Run a server process with resource limits on behalf of the daemon",
+	Hidden: true,
+	Args:   cobra.MinimumNArgs(1),
+	Run:    executeLimit,
+}
+
+func init() {
+	limitCmd.Flags().StringVar(&limitResources, "resources", "", "Limits to apply")
+	limitCmd.Flags().StringVar(&limitCgroup, "cgroup", "", "Cgroup to run in")
+	_ = limitCmd.MarkFlagRequired("resources")
+	rootCmd.AddCommand(limitCmd)
+}
+
+func executeLimit(cmd *cobra.Command, args []string) {
+	//only returns if the process could not be started
+	err := tty.RunLimited(limitResources, limitCgroup, args)
+	fmt.Printf("Error applying limits: %s\n", err.Error())
+	os.Exit(1)
+}
@@ -60,6 +60,7 @@ func init() {
 		versionCmd,
 		userCmd,
 		shutdownCmd,
+		nodeCmd,
 	)
 }
 
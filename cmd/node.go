@@ -0,0 +1,172 @@
+/*
+ Copyright 2020 Padduck, LLC
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+  	http://www.apache.org/licenses/LICENSE-2.0
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"encoding/json"
+	"fmt"
+	"github.com/pufferpanel/pufferpanel/v2"
+	"github.com/pufferpanel/pufferpanel/v2/config"
+	"github.com/pufferpanel/pufferpanel/v2/models"
+	"github.com/pufferpanel/pufferpanel/v2/response"
+	daemonweb "github.com/pufferpanel/pufferpanel/v2/web/daemon"
+	"github.com/spf13/cobra"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var nodeCmd = &cobra.Command{
+	Use:   "node",
+	Short: "Manage this node",
+}
+
+var joinNodeCmd = &cobra.Command{
+	Use:   "join <panel-url> <token>",
+	Short: "Join a panel as one of its nodes",
+	Run:   executeJoinNode,
+	Args:  cobra.ExactArgs(2),
+}
+
+var joinPublicHost string
+var joinPrivateHost string
+
+func init() {
+	nodeCmd.AddCommand(joinNodeCmd)
+
+	joinNodeCmd.Flags().StringVar(&joinPublicHost, "host", "", "host the panel and users reach this node on, defaults to the hostname")
+	joinNodeCmd.Flags().StringVar(&joinPrivateHost, "private-host", "", "host the panel reaches this node on, if not the same as host")
+}
+
+func executeJoinNode(cmd *cobra.Command, args []string) {
+	panelUrl := strings.TrimSuffix(args[0], "/")
+
+	request := &models.NodeJoinRequest{
+		Token:       args[1],
+		PublicHost:  joinPublicHost,
+		PrivateHost: joinPrivateHost,
+		PublicPort:  portOf(config.WebHost.Value()),
+		SFTPPort:    portOf(config.SftpHost.Value()),
+	}
+	if request.PublicHost == "" {
+		//a bare hostname is not something the panel can be sure it can reach, so leave it as the panel has it
+		if hostname, err := os.Hostname(); err == nil && strings.Contains(hostname, ".") {
+			request.PublicHost = hostname
+		}
+	}
+
+	//the panel only signs this if it uses mutual TLS with its nodes
+	key, err := pufferpanel.GenerateCertificateKey()
+	if err == nil {
+		var csr []byte
+		csr, err = pufferpanel.CreateCertificateRequest(key, "node")
+		request.CertificateRequest = string(csr)
+		request.MTLSPort = portOf(config.DaemonMTLSHost.Value())
+	}
+	if err != nil {
+		fmt.Printf("Error creating certificate request: %s\n", err.Error())
+		os.Exit(1)
+		return
+	}
+
+	result, err := requestJoin(panelUrl, request)
+	if err != nil {
+		fmt.Printf("Error joining panel: %s\n", err.Error())
+		os.Exit(1)
+		return
+	}
+
+	if result.Certificate != "" {
+		if err = saveJoinCertificate(key, result); err != nil {
+			fmt.Printf("Error saving certificate: %s\n", err.Error())
+			os.Exit(1)
+			return
+		}
+		_ = config.DaemonMTLSEnabled.Set(true, false)
+	}
+
+	//the daemon authenticates with the panel using the node's credentials from here on
+	_ = config.PanelEnabled.Set(false, false)
+	_ = config.DaemonEnabled.Set(true, false)
+	_ = config.AuthUrl.Set(panelUrl, false)
+	_ = config.ClientId.Set(result.ClientId, false)
+	err = config.ClientSecret.Set(result.ClientSecret, true)
+	if err != nil {
+		fmt.Printf("Joined panel as node %d, but the config could not be saved: %s\n", result.NodeId, err.Error())
+		os.Exit(1)
+		return
+	}
+
+	fmt.Printf("Joined panel as node %d, restart PufferPanel to connect to it\n", result.NodeId)
+}
+
+func requestJoin(panelUrl string, request *models.NodeJoinRequest) (*models.NodeJoinResponse, error) {
+	data, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	res, err := client.Post(panelUrl+"/api/nodes/join", "application/json", bytes.NewReader(data))
+	defer pufferpanel.CloseResponse(res)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		msg := &response.Error{}
+		if json.NewDecoder(res.Body).Decode(msg) == nil && msg.Error != nil {
+			return nil, msg.Error
+		}
+		return nil, fmt.Errorf("panel responded with %s", res.Status)
+	}
+
+	result := &models.NodeJoinResponse{}
+	err = json.NewDecoder(res.Body).Decode(result)
+	return result, err
+}
+
+func saveJoinCertificate(key *ecdsa.PrivateKey, result *models.NodeJoinResponse) error {
+	cert, err := pufferpanel.DecodeCertificate([]byte(result.Certificate))
+	if err != nil {
+		return err
+	}
+	if !pufferpanel.IsKeyFor(key, cert) {
+		return pufferpanel.ErrCertificateMismatch
+	}
+
+	err = os.WriteFile(config.DaemonMTLSCA.Value(), []byte(result.CA), 0644)
+	if err != nil {
+		return err
+	}
+	return daemonweb.WriteCertificate(key, cert)
+}
+
+// portOf gets the port from a listen address, or 0 if there is not one
+func portOf(address string) uint16 {
+	_, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return 0
+	}
+	i, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return 0
+	}
+	return uint16(i)
+}
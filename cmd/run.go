@@ -14,6 +14,7 @@
 package main
 
 import (
+	"crypto/tls"
 	"encoding/hex"
 	"github.com/braintree/manners"
 	"github.com/gin-contrib/sessions"
@@ -29,6 +30,7 @@ import (
 	"github.com/pufferpanel/pufferpanel/v2/services"
 	"github.com/pufferpanel/pufferpanel/v2/sftp"
 	"github.com/pufferpanel/pufferpanel/v2/web"
+	daemonweb "github.com/pufferpanel/pufferpanel/v2/web/daemon"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 	"net"
@@ -49,6 +51,7 @@ var runCmd = &cobra.Command{
 }
 
 var webService *manners.GracefulServer
+var mtlsService *manners.GracefulServer
 
 func executeRun(cmd *cobra.Command, args []string) {
 	term := make(chan bool, 10)
@@ -64,6 +67,9 @@ func executeRun(cmd *cobra.Command, args []string) {
 	if webService != nil {
 		webService.Close()
 	}
+	if mtlsService != nil {
+		mtlsService.Close()
+	}
 
 	logging.Debug.Printf("stopping sftp server")
 	sftp.Stop()
@@ -71,6 +77,10 @@ func executeRun(cmd *cobra.Command, args []string) {
 	logging.Debug.Printf("stopping servers")
 	programs.ShutdownService()
 	for _, p := range programs.GetAll() {
+		//servers which can be picked back up are left running, so restarting the daemon does not restart them
+		if config.KeepRunningOnShutdown.Value() && p.CanReattach() {
+			continue
+		}
 		_ = p.Stop()
 		p.RunningEnvironment.WaitForMainProcessFor(time.Minute) //wait 60 seconds
 	}
@@ -151,11 +161,41 @@ func internalRun(terminate chan bool) {
 		}
 	}()
 
+	if config.DaemonEnabled.Value() && config.DaemonMTLSEnabled.Value() {
+		go func() {
+			err := serveMTLS(router)
+			if err != nil && err != http.ErrServerClosed {
+				logging.Error.Printf("error listening for mutual TLS requests: %s", err.Error())
+				terminate <- true
+			}
+		}()
+	}
+
 	return
 }
 
+// serveMTLS listens for the panel, which must connect with its client certificate
+func serveMTLS(router http.Handler) error {
+	tlsConfig, err := daemonweb.MTLSConfig()
+	if err != nil {
+		return err
+	}
+
+	l, err := net.Listen("tcp", config.DaemonMTLSHost.Value())
+	if err != nil {
+		return err
+	}
+
+	logging.Info.Printf("Listening for mutual TLS requests on %s", l.Addr().String())
+	mtlsService = manners.NewWithServer(&http.Server{Handler: router})
+	return mtlsService.Serve(tls.NewListener(l, tlsConfig))
+}
+
 func panel() {
 	services.LoadEmailService()
+	services.StartKeyRotation()
+	services.StartNodeHeartbeat()
+	services.StartCertificateRenewal()
 
 	//if we have the web, then let's use our sftp auth instead
 	sftp.SetAuthorization(&services.DatabaseSFTPAuthorization{})
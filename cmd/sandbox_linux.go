@@ -0,0 +1,54 @@
+/*
+ Copyright 2023 Padduck, LLC
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+  	http://www.apache.org/licenses/LICENSE-2.0
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"github.com/pufferpanel/pufferpanel/v2/environments/tty"
+	"github.com/spf13/cobra"
+	"os"
+)
+
+var sandboxSpec string
+var sandboxInit bool
+
+var sandboxCmd = &cobra.Command{
+	Use:    "sandbox --spec <json> -- <command> [args...]",
+	Short:  "Run a server process in a sandbox on behalf of the daemon",
+	Hidden: true,
+	Args:   cobra.MinimumNArgs(1),
+	Run:    executeSandbox,
+}
+
+func init() {
+	sandboxCmd.Flags().StringVar(&sandboxSpec, "spec", "", "How to build the sandbox")
+	sandboxCmd.Flags().BoolVar(&sandboxInit, "init", false, "Run as the first process in the sandbox")
+	_ = sandboxCmd.MarkFlagRequired("spec")
+	rootCmd.AddCommand(sandboxCmd)
+}
+
+func executeSandbox(cmd *cobra.Command, args []string) {
+	var code int
+	var err error
+	if sandboxInit {
+		code, err = tty.RunSandboxInit(sandboxSpec, args)
+	} else {
+		code, err = tty.RunSandbox(sandboxSpec, args)
+	}
+
+	if err != nil {
+		fmt.Printf("Error running sandbox: %s\n", err.Error())
+	}
+	os.Exit(code)
+}
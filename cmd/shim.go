@@ -0,0 +1,51 @@
+//go:build !windows
+// +build !windows
+
+/*
+ Copyright 2023 Padduck, LLC
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+  	http://www.apache.org/licenses/LICENSE-2.0
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"github.com/pufferpanel/pufferpanel/v2/environments/tty"
+	"github.com/spf13/cobra"
+	"os"
+)
+
+var shimSocket string
+var shimState string
+
+var shimCmd = &cobra.Command{
+	Use:    "shim --socket <path> --state <path> -- <command> [args...]",
+	Short:  "Run a server process on behalf of the daemon",
+	Hidden: true,
+	Args:   cobra.MinimumNArgs(1),
+	Run:    executeShim,
+}
+
+func init() {
+	shimCmd.Flags().StringVar(&shimSocket, "socket", "", "Socket to serve the console on")
+	shimCmd.Flags().StringVar(&shimState, "state", "", "File to save the shim's state to")
+	_ = shimCmd.MarkFlagRequired("socket")
+	_ = shimCmd.MarkFlagRequired("state")
+	rootCmd.AddCommand(shimCmd)
+}
+
+func executeShim(cmd *cobra.Command, args []string) {
+	err := tty.RunShim(shimSocket, shimState, args[0], args[1:])
+	if err != nil {
+		fmt.Printf("Error running process: %s\n", err.Error())
+		os.Exit(1)
+	}
+}
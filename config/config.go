@@ -44,3 +44,8 @@ func LoadConfigFile(workDir string) error {
 
 	return nil
 }
+
+// ConfigFile is the file the config was loaded from
+func ConfigFile() string {
+	return viper.ConfigFileUsed()
+}
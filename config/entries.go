@@ -30,6 +30,19 @@ var ThemeSettings = asString("panel.settings.themeSettings", "{}")
 var MasterUrl = asString("panel.settings.masterUrl", "http://localhost:8080")
 var SessionKey = asString("panel.sessionKey", "")
 var RegistrationEnabled = asBool("panel.registrationEnabled", true)
+var TokenRotationDays = asInt("panel.token.rotationDays", 30)
+var TokenOverlapHours = asInt("panel.token.overlapHours", 24)
+var NodeHeartbeatSeconds = asInt("panel.nodes.heartbeatSeconds", 30)
+var NodeOfflineAfter = asInt("panel.nodes.offlineAfter", 2)
+var NodeJoinTokenMinutes = asInt("panel.nodes.joinTokenMinutes", 15)
+var NodeMTLSEnabled = asBool("panel.nodes.mtls.enable", false)
+var NodeCACert = asString("panel.nodes.mtls.caCert", "ca.pem")
+var NodeCAKey = asString("panel.nodes.mtls.caKey", "ca.key")
+var NodeCertificateDays = asInt("panel.nodes.mtls.certificateDays", 90)
+var PlacementMode = asString("panel.placement.mode", "least-loaded")
+var PlacementOvercommitPercent = asInt("panel.placement.overcommitPercent", 100)
+var BulkConcurrency = asInt("panel.bulk.concurrency", 10)
+var BulkNodeConcurrency = asInt("panel.bulk.nodeConcurrency", 4)
 
 // Daemon options
 var DaemonEnabled = asBool("daemon.enable", true)
@@ -40,10 +53,21 @@ var SftpKey = asString("daemon.sftp.key", "sftp.key")
 var AuthUrl = asString("daemon.auth.url", "http://localhost:8080")
 var ClientId = asString("daemon.auth.clientId", "")
 var ClientSecret = asString("daemon.auth.clientSecret", "")
+var OfflineGraceMinutes = asInt("daemon.auth.offlineGraceMinutes", 60)
+var EventQueueSize = asInt("daemon.events.queueSize", 1000)
+var DaemonMTLSEnabled = asBool("daemon.mtls.enable", false)
+var DaemonMTLSHost = asString("daemon.mtls.host", "0.0.0.0:8444")
+var DaemonMTLSCert = asString("daemon.mtls.cert", "node.pem")
+var DaemonMTLSKey = asString("daemon.mtls.key", "node.key")
+var DaemonMTLSCA = asString("daemon.mtls.ca", "ca.pem")
 var CacheFolder = asString("daemon.data.cache", "cache")
 var ServersFolder = asString("daemon.data.servers", "servers")
+var SupervisorFolder = asString("daemon.data.supervisor", "supervisor")
 var BinariesFolder = asString("daemon.data.binaries", "binaries")
 var CrashLimit = asInt("daemon.data.crashLimit", 3)
+var KeepRunningOnShutdown = asBool("daemon.data.keepRunningOnShutdown", true)
+var PodmanSocket = asString("daemon.podman.socket", "")
+var ServerDockerfiles = asBool("daemon.docker.serverDockerfiles", false)
 var WebSocketFileLimit = asInt64("daemon.data.maxWSDownloadSize", 1024*1024*20)
 
 // Deprecated: Removed in v3
@@ -130,12 +130,28 @@ func Close() {
 func migrateModels() error {
 	dbObjects := []interface{}{
 		&models.Node{},
+		&models.Team{},
 		&models.Server{},
+		&models.PortPool{},
+		&models.PortAllocation{},
+		&models.JoinToken{},
 		&models.User{},
 		&models.Template{},
 		&models.Permissions{},
 		&models.Client{},
 		&models.UserSetting{},
+		&models.Role{},
+		&models.RoleAssignment{},
+		&models.TeamMember{},
+		&models.TeamInvite{},
+		&models.WebAuthnCredential{},
+		&models.RecoveryCode{},
+		&models.Session{},
+		&models.SigningKey{},
+		&models.Application{},
+		&models.ApplicationAuthorization{},
+		&models.ApplicationToken{},
+		&models.RevokedToken{},
 	}
 
 	for _, v := range dbObjects {
@@ -1,9 +1,14 @@
 package database
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"github.com/go-gormigrate/gormigrate/v2"
+	"github.com/pufferpanel/pufferpanel/v2"
 	"github.com/pufferpanel/pufferpanel/v2/models"
 	"gorm.io/gorm"
+	"sort"
+	"strings"
 )
 
 func migrate(dbConn *gorm.DB) error {
@@ -72,7 +77,128 @@ func migrate(dbConn *gorm.DB) error {
 				return err
 			},
 		},
+		{
+			ID: "1688131200",
+			Migrate: func(db *gorm.DB) error {
+				err := db.AutoMigrate(&models.Role{}, &models.RoleAssignment{})
+				if err != nil {
+					return err
+				}
+
+				//built in roles match what the permission flags have always granted, so existing
+				//grants can be expressed as roles from here on
+				admin := &models.Permissions{Admin: true, ViewServer: true}
+				serverId := "server"
+				owner := &models.Permissions{ServerIdentifier: &serverId}
+				owner.SetDefaults()
+
+				roles := []*models.Role{
+					{Name: models.RoleAdmin, Description: "Full access to the panel", BuiltIn: true, Scopes: admin.ToScopes()},
+					{Name: models.RoleServerOwner, Description: "Full access to a server", BuiltIn: true, Scopes: owner.ToScopes()},
+				}
+
+				for _, role := range roles {
+					var count int64
+					err = db.Model(&models.Role{}).Where(&models.Role{Name: role.Name}).Count(&count).Error
+					if err != nil {
+						return err
+					}
+					if count > 0 {
+						continue
+					}
+					err = db.Create(role).Error
+					if err != nil {
+						return err
+					}
+				}
+
+				return convertPermissionsToRoles(db)
+			},
+		},
 	})
 
 	return m.Migrate()
 }
+
+// convertPermissionsToRoles gives every user a role for each set of permission flags they have. Sets matching a
+// built in role use it, any other set gets a role of its own which is shared by every user with the same flags
+func convertPermissionsToRoles(db *gorm.DB) error {
+	var roles []*models.Role
+	err := db.Find(&roles).Error
+	if err != nil {
+		return err
+	}
+
+	byScopes := map[string]*models.Role{}
+	for _, v := range roles {
+		key := scopeKey(v.Scopes)
+		if _, exists := byScopes[key]; !exists || v.BuiltIn {
+			byScopes[key] = v
+		}
+	}
+
+	var perms []*models.Permissions
+	err = db.Where("user_id IS NOT NULL").Find(&perms).Error
+	if err != nil {
+		return err
+	}
+
+	for _, perm := range perms {
+		scopes := perm.ToScopes()
+		if len(scopes) == 0 {
+			continue
+		}
+
+		key := scopeKey(scopes)
+		role, exists := byScopes[key]
+		if !exists {
+			hash := sha256.Sum256([]byte(key))
+			role = &models.Role{
+				Name:        "legacy-" + hex.EncodeToString(hash[:4]),
+				Description: "Converted from permissions granted before roles existed",
+				Scopes:      scopes,
+			}
+			err = db.Create(role).Error
+			if err != nil {
+				return err
+			}
+			byScopes[key] = role
+		}
+
+		var count int64
+		query := db.Model(&models.RoleAssignment{}).Where("role_id = ? AND user_id = ?", role.ID, *perm.UserId)
+		if perm.ServerIdentifier == nil {
+			query = query.Where("server_identifier IS NULL")
+		} else {
+			query = query.Where("server_identifier = ?", *perm.ServerIdentifier)
+		}
+		err = query.Count(&count).Error
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			continue
+		}
+
+		err = db.Omit("Role", "User", "Server").Create(&models.RoleAssignment{
+			RoleId:           role.ID,
+			UserId:           *perm.UserId,
+			ServerIdentifier: perm.ServerIdentifier,
+			FromPermissions:  true,
+		}).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func scopeKey(scopes []pufferpanel.Scope) string {
+	keys := make([]string, len(scopes))
+	for i, v := range scopes {
+		keys[i] = string(v)
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, " ")
+}
@@ -0,0 +1,103 @@
+package database
+
+import (
+	"github.com/pufferpanel/pufferpanel/v2"
+	"github.com/pufferpanel/pufferpanel/v2/models"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"testing"
+)
+
+func TestMigrate_Permissions(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file:migrate.db?cache=shared&mode=memory"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+
+	//only the tables which existed before roles
+	err = db.AutoMigrate(&models.Node{}, &models.Server{}, &models.User{}, &models.Template{}, &models.Permissions{}, &models.Client{})
+	if err != nil {
+		t.Fatalf("AutoMigrate() error = %v", err)
+	}
+
+	admin := &models.User{Username: "admin", Email: "admin@test.com", HashedPassword: "x"}
+	moderator := &models.User{Username: "moderator", Email: "moderator@test.com", HashedPassword: "x"}
+	other := &models.User{Username: "other", Email: "other@test.com", HashedPassword: "x"}
+	for _, v := range []*models.User{admin, moderator, other} {
+		if err = db.Create(v).Error; err != nil {
+			t.Fatalf("Create() error = %v", err)
+		}
+	}
+
+	serverId := "abcd1234"
+	owner := &models.Permissions{UserId: &admin.ID, ServerIdentifier: &serverId}
+	owner.SetDefaults()
+
+	perms := []*models.Permissions{
+		{UserId: &admin.ID, Admin: true, ViewServer: true},
+		owner,
+		{UserId: &moderator.ID, ServerIdentifier: &serverId, ViewServer: true, ViewServerConsole: true, StartServer: true},
+		{UserId: &other.ID, ServerIdentifier: &serverId, ViewServer: true, ViewServerConsole: true, StartServer: true},
+		{UserId: &other.ID},
+	}
+	for _, v := range perms {
+		if err = db.Omit("User", "Client", "Server").Create(v).Error; err != nil {
+			t.Fatalf("Create() error = %v", err)
+		}
+	}
+
+	if err = migrate(db); err != nil {
+		t.Fatalf("migrate() error = %v", err)
+	}
+
+	roleFor := func(userId uint, serverId *string) []string {
+		var assignments []*models.RoleAssignment
+		query := db.Preload("Role").Where("user_id = ?", userId)
+		if serverId == nil {
+			query = query.Where("server_identifier IS NULL")
+		} else {
+			query = query.Where("server_identifier = ?", *serverId)
+		}
+		if err := query.Find(&assignments).Error; err != nil {
+			t.Fatalf("Find() error = %v", err)
+		}
+		names := make([]string, 0)
+		for _, v := range assignments {
+			if !v.FromPermissions {
+				t.Errorf("assignment %d is not marked as converted", v.ID)
+			}
+			names = append(names, v.Role.Name)
+		}
+		return names
+	}
+
+	if got := roleFor(admin.ID, nil); len(got) != 1 || got[0] != models.RoleAdmin {
+		t.Errorf("admin global roles = %v, want [%s]", got, models.RoleAdmin)
+	}
+	if got := roleFor(admin.ID, &serverId); len(got) != 1 || got[0] != models.RoleServerOwner {
+		t.Errorf("admin server roles = %v, want [%s]", got, models.RoleServerOwner)
+	}
+
+	modRoles := roleFor(moderator.ID, &serverId)
+	otherRoles := roleFor(other.ID, &serverId)
+	if len(modRoles) != 1 || len(otherRoles) != 1 || modRoles[0] != otherRoles[0] {
+		t.Errorf("moderator roles = %v, other roles = %v, want one shared role", modRoles, otherRoles)
+	}
+
+	if got := roleFor(other.ID, nil); len(got) != 0 {
+		t.Errorf("other global roles = %v, want none", got)
+	}
+
+	role := &models.Role{}
+	if err = db.Where("name = ?", modRoles[0]).First(role).Error; err != nil {
+		t.Fatalf("First() error = %v", err)
+	}
+	for _, v := range []pufferpanel.Scope{pufferpanel.ScopeServersView, pufferpanel.ScopeServersConsole, pufferpanel.ScopeServersStart} {
+		if !pufferpanel.ContainsScope(role.Scopes, v) {
+			t.Errorf("converted role scopes = %v, missing %s", role.Scopes, v)
+		}
+	}
+	if len(role.Scopes) != 3 {
+		t.Errorf("converted role scopes = %v, want 3", role.Scopes)
+	}
+}
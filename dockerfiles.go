@@ -0,0 +1,36 @@
+/*
+ Copyright 2023 Padduck, LLC
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+  	http://www.apache.org/licenses/LICENSE-2.0
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+*/
+
+package pufferpanel
+
+import (
+	"embed"
+	"io/fs"
+	"strings"
+)
+
+//go:embed dockerfiles
+var bundledDockerfiles embed.FS
+
+// GetBundledDockerfile is one of the Dockerfiles shipped with PufferPanel, by the name of its folder
+func GetBundledDockerfile(name string) ([]byte, error) {
+	if name == "" || strings.ContainsAny(name, "/\\.") {
+		return nil, ErrDockerfileNotFound(name)
+	}
+
+	data, err := fs.ReadFile(bundledDockerfiles, "dockerfiles/"+name+"/Dockerfile")
+	if err != nil {
+		return nil, ErrDockerfileNotFound(name)
+	}
+	return data, nil
+}
@@ -71,6 +71,20 @@ type Environment interface {
 	GetBase() *BaseEnvironment
 }
 
+// ReattachableEnvironment is an environment whose main process can outlive the daemon. Reattach picks up a process
+// left running by an earlier daemon, watching its health and calling back when it exits like ExecuteAsync would, and
+// says if there was one. CanReattach is if the process running now would survive the daemon stopping
+type ReattachableEnvironment interface {
+	Reattach(steps ExecutionData) (bool, error)
+	CanReattach() bool
+}
+
+// TeardownEnvironment is an environment which keeps things outside the server's folder, such as a container.
+// Teardown removes them but leaves the server's files, for when the server is moved to another environment
+type TeardownEnvironment interface {
+	Teardown() error
+}
+
 type BaseEnvironment struct {
 	Environment
 	Type              string
@@ -81,6 +95,7 @@ type BaseEnvironment struct {
 	ExecutionFunction ExecutionFunction  `json:"-"`
 	WaitFunction      func() (err error) `json:"-"`
 	ServerId          string             `json:"-"`
+	health            healthWatch
 }
 
 type ExecutionData struct {
@@ -88,6 +103,9 @@ type ExecutionData struct {
 	Arguments        []string
 	Environment      map[string]string
 	WorkingDirectory string
+	Variables        map[string]interface{}
+	HealthCheck      *HealthCheck
+	HealthCallback   func(status string)
 	Callback         func(graceful bool)
 }
 
@@ -0,0 +1,241 @@
+/*
+ Copyright 2023 Padduck, LLC
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+  	http://www.apache.org/licenses/LICENSE-2.0
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+*/
+
+package docker
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/jsonmessage"
+	"github.com/pufferpanel/pufferpanel/v2"
+	"github.com/pufferpanel/pufferpanel/v2/config"
+	"github.com/pufferpanel/pufferpanel/v2/logging"
+	"github.com/spf13/cast"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// prefix for the Dockerfiles shipped with PufferPanel, rather than in the server's folder
+const bundledPrefix = "bundled:"
+
+// name the Dockerfile has in the build context, so it does not clash with anything in the context
+const contextDockerfile = ".pufferpanel.Dockerfile"
+
+// ImageBuild is a Dockerfile to build the server's image from, rather than pulling one
+type ImageBuild struct {
+	//Dockerfile is bundled:<name> for one shipped with PufferPanel, otherwise a path in the server's folder
+	Dockerfile string `json:"dockerfile"`
+	//Context is a folder in the server's folder sent with the Dockerfile, for it to COPY from
+	Context string `json:"context,omitempty"`
+	//Args are build args, which can use the server's variables. Any ARG with the name of a variable is given it
+	Args map[string]string `json:"args,omitempty"`
+}
+
+// prepareImage makes sure the image for the server is available, building it if the server has a Dockerfile
+func (d *docker) prepareImage(client client.APIClient, ctx context.Context, variables map[string]interface{}) error {
+	if d.Build == nil {
+		d.builtImage = ""
+		return d.pullImage(client, ctx, false)
+	}
+	return d.buildImage(client, ctx, variables)
+}
+
+// buildImage builds the server's Dockerfile, tagged by a hash of everything going into it so a build is only done
+// once for the same Dockerfile, context and args
+func (d *docker) buildImage(client client.APIClient, ctx context.Context, variables map[string]interface{}) error {
+	if d.downloadingImage {
+		return pufferpanel.ErrImageDownloading
+	}
+
+	dockerfile, err := d.readDockerfile()
+	if err != nil {
+		return err
+	}
+
+	buildArgs := d.buildArgs(dockerfile, variables)
+
+	buildContext, hash, err := d.buildContext(dockerfile, buildArgs)
+	if err != nil {
+		return err
+	}
+	tag := "localhost/pufferpanel-build:" + hash[:16]
+
+	opts := types.ImageListOptions{Filters: filters.NewArgs()}
+	opts.Filters.Add("reference", tag)
+	images, err := client.ImageList(ctx, opts)
+	if err != nil {
+		return err
+	}
+	if len(images) > 0 {
+		d.Log(logging.Debug, "Using existing build %v", tag)
+		d.builtImage = tag
+		return nil
+	}
+
+	d.Log(logging.Debug, "Building image %v", tag)
+	d.DisplayToConsole(true, "Building image for container, please wait\n")
+
+	d.downloadingImage = true
+	defer func() {
+		d.downloadingImage = false
+	}()
+
+	response, err := client.ImageBuild(ctx, buildContext, types.ImageBuildOptions{
+		Tags:        []string{tag},
+		Dockerfile:  contextDockerfile,
+		BuildArgs:   buildArgs,
+		Remove:      true,
+		ForceRemove: true,
+	})
+	if err != nil {
+		return err
+	}
+	defer pufferpanel.Close(response.Body)
+
+	//the build failing is only reported in the output
+	err = jsonmessage.DisplayJSONMessagesStream(response.Body, d.CreateWrapper(), 0, false, nil)
+	if err != nil {
+		d.DisplayToConsole(true, "Failed to build image: %s\n", err.Error())
+		return err
+	}
+
+	d.Log(logging.Debug, "Built image %v", tag)
+	d.DisplayToConsole(true, "Built image for container\n")
+	d.builtImage = tag
+	return nil
+}
+
+func (d *docker) readDockerfile() ([]byte, error) {
+	if strings.HasPrefix(d.Build.Dockerfile, bundledPrefix) {
+		return pufferpanel.GetBundledDockerfile(strings.TrimPrefix(d.Build.Dockerfile, bundledPrefix))
+	}
+
+	//anyone who can edit the server's files could otherwise have the docker daemon run what they like while building
+	if !config.ServerDockerfiles.Value() {
+		return nil, pufferpanel.ErrServerDockerfilesDisabled
+	}
+
+	path := filepath.Join(d.RootDirectory, d.Build.Dockerfile)
+	if !pufferpanel.EnsureAccess(path, d.RootDirectory) {
+		return nil, pufferpanel.ErrIllegalFileAccess
+	}
+	return os.ReadFile(path)
+}
+
+// buildArgs are the args from the environment, and the server's variables for any ARG the Dockerfile has for them
+func (d *docker) buildArgs(dockerfile []byte, variables map[string]interface{}) map[string]*string {
+	args := make(map[string]*string)
+
+	scanner := bufio.NewScanner(bytes.NewReader(dockerfile))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || !strings.EqualFold(fields[0], "ARG") {
+			continue
+		}
+		name := strings.SplitN(fields[1], "=", 2)[0]
+		if value, exists := variables[name]; exists {
+			v := cast.ToString(value)
+			args[name] = &v
+		}
+	}
+
+	for k, v := range d.Build.Args {
+		value := pufferpanel.ReplaceTokens(v, variables)
+		args[k] = &value
+	}
+	return args
+}
+
+// buildContext is the tar sent to docker to build from, and a hash of it and the args
+func (d *docker) buildContext(dockerfile []byte, args map[string]*string) (io.Reader, string, error) {
+	hash := sha256.New()
+	buf := &bytes.Buffer{}
+	writer := tar.NewWriter(buf)
+
+	add := func(name string, mode int64, data []byte) error {
+		hashFields(hash, []byte(name), []byte(strconv.FormatInt(mode, 8)), data)
+		err := writer.WriteHeader(&tar.Header{Name: name, Mode: mode, Size: int64(len(data))})
+		if err != nil {
+			return err
+		}
+		_, err = writer.Write(data)
+		return err
+	}
+
+	if err := add(contextDockerfile, 0644, dockerfile); err != nil {
+		return nil, "", err
+	}
+
+	if d.Build.Context != "" {
+		root := filepath.Join(d.RootDirectory, d.Build.Context)
+		if !pufferpanel.EnsureAccess(root, d.RootDirectory) {
+			return nil, "", pufferpanel.ErrIllegalFileAccess
+		}
+
+		//walked in lexical order, so the hash is the same each time
+		err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil || !info.Mode().IsRegular() {
+				return err
+			}
+			name, err := filepath.Rel(root, path)
+			if err != nil {
+				return err
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			return add(filepath.ToSlash(name), int64(info.Mode().Perm()), data)
+		})
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	names := make([]string, 0, len(args))
+	for k := range args {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	for _, k := range names {
+		hashFields(hash, []byte(k), []byte(*args[k]))
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, "", err
+	}
+	return buf, hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// hashFields adds each field with its length in front, so moving bytes from one field to the next changes the hash
+func hashFields(digest hash.Hash, fields ...[]byte) {
+	for _, v := range fields {
+		var length [8]byte
+		binary.BigEndian.PutUint64(length[:], uint64(len(v)))
+		_, _ = digest.Write(length[:])
+		_, _ = digest.Write(v)
+	}
+}
@@ -0,0 +1,132 @@
+package docker
+
+import (
+	"archive/tar"
+	"github.com/pufferpanel/pufferpanel/v2"
+	"github.com/pufferpanel/pufferpanel/v2/config"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestDocker_buildArgs(t *testing.T) {
+	dockerfile := []byte("FROM alpine\nARG VERSION\n  arg PORT=25565\nARG UNUSED\nRUN echo $VERSION\n")
+	variables := map[string]interface{}{"VERSION": "1.20", "PORT": 25565, "OTHER": "x", "name": "test"}
+
+	tests := []struct {
+		name string
+		args map[string]string
+		want map[string]string
+	}{
+		{
+			name: "from variables",
+			want: map[string]string{"VERSION": "1.20", "PORT": "25565"},
+		},
+		{
+			name: "from environment",
+			args: map[string]string{"EXTRA": "${name}-server", "VERSION": "2.0"},
+			want: map[string]string{"VERSION": "2.0", "PORT": "25565", "EXTRA": "test-server"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &docker{Build: &ImageBuild{Args: tt.args}}
+			got := make(map[string]string)
+			for k, v := range d.buildArgs(dockerfile, variables) {
+				got[k] = *v
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("buildArgs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDocker_buildContext(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "context", "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "context", "start.sh"), []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "context", "sub", "config.txt"), []byte("config"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	d := &docker{BaseEnvironment: &pufferpanel.BaseEnvironment{RootDirectory: root}, Build: &ImageBuild{Context: "context"}}
+	dockerfile := []byte("FROM alpine\n")
+	hashOf := func(args map[string]string) string {
+		values := make(map[string]*string)
+		for k, v := range args {
+			value := v
+			values[k] = &value
+		}
+		_, hash, err := d.buildContext(dockerfile, values)
+		if err != nil {
+			t.Fatalf("buildContext() error = %v", err)
+		}
+		return hash
+	}
+
+	reader, hash, err := d.buildContext(dockerfile, nil)
+	if err != nil {
+		t.Fatalf("buildContext() error = %v", err)
+	}
+	files := make(map[string]int64)
+	archive := tar.NewReader(reader)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("reading context: %v", err)
+		}
+		files[header.Name] = header.Mode
+	}
+	want := map[string]int64{contextDockerfile: 0644, "start.sh": 0755, "sub/config.txt": 0644}
+	if !reflect.DeepEqual(files, want) {
+		t.Errorf("buildContext() files = %v, want %v", files, want)
+	}
+
+	if again := hashOf(nil); again != hash {
+		t.Errorf("buildContext() hash changed between builds, %s then %s", hash, again)
+	}
+
+	if hashOf(map[string]string{"A": "B=C"}) == hashOf(map[string]string{"A=B": "C"}) {
+		t.Errorf("buildContext() hash is the same for different args")
+	}
+
+	if err = os.Chmod(filepath.Join(root, "context", "start.sh"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if hashOf(nil) == hash {
+		t.Errorf("buildContext() hash did not change with the file mode")
+	}
+}
+
+func TestDocker_readDockerfile(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "Dockerfile"), []byte("FROM alpine\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	d := &docker{BaseEnvironment: &pufferpanel.BaseEnvironment{RootDirectory: root}, Build: &ImageBuild{Dockerfile: "Dockerfile"}}
+
+	allowed := config.ServerDockerfiles.Value()
+	defer func() {
+		_ = config.ServerDockerfiles.Set(allowed, false)
+	}()
+
+	_ = config.ServerDockerfiles.Set(false, false)
+	if _, err := d.readDockerfile(); err != pufferpanel.ErrServerDockerfilesDisabled {
+		t.Errorf("readDockerfile() error = %v, want %v", err, pufferpanel.ErrServerDockerfilesDisabled)
+	}
+
+	_ = config.ServerDockerfiles.Set(true, false)
+	if data, err := d.readDockerfile(); err != nil || string(data) != "FROM alpine\n" {
+		t.Errorf("readDockerfile() = %q, %v", data, err)
+	}
+}
@@ -19,7 +19,6 @@ package docker
 import (
 	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
@@ -38,22 +37,30 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"time"
 )
 
 type docker struct {
 	*pufferpanel.BaseEnvironment
-	ContainerId string              `json:"-"`
-	ImageName   string              `json:"image"`
-	Binds       map[string]string   `json:"bindings,omitempty"`
-	NetworkMode string              `json:"networkMode,omitempty"`
-	Network     string              `json:"networkName,omitempty"`
-	Ports       []string            `json:"portBindings,omitempty"`
-	Resources   container.Resources `json:"resources,omitempty"`
+	ContainerId          string              `json:"-"`
+	ImageName            string              `json:"image"`
+	Binds                map[string]string   `json:"bindings,omitempty"`
+	NetworkMode          string              `json:"networkMode,omitempty"`
+	Network              string              `json:"networkName,omitempty"`
+	NetworkScope         string              `json:"networkScope,omitempty"`
+	BlockPrivateNetworks bool                `json:"blockPrivateNetworks,omitempty"`
+	Ports                []string            `json:"portBindings,omitempty"`
+	Resources            container.Resources `json:"resources,omitempty"`
+	Persistent           bool                `json:"persistent,omitempty"`
+	Build                *ImageBuild         `json:"build,omitempty"`
 
 	connection       types.HijackedResponse
-	cli              *client.Client
+	cli              client.APIClient
 	downloadingImage bool
+	builtImage       string
+	host             string
+	usernsMode       container.UsernsMode
 }
 
 func (d *docker) dockerExecuteAsync(steps pufferpanel.ExecutionData) error {
@@ -72,22 +79,145 @@ func (d *docker) dockerExecuteAsync(steps pufferpanel.ExecutionData) error {
 	dockerClient, err := d.getClient()
 	ctx := context.Background()
 
-	//TODO: This logic may not work anymore, it's complicated to use an existing container with install/uninstall
 	exists, err := d.doesContainerExist(dockerClient, ctx)
 
 	if err != nil {
 		return err
 	}
 
-	if exists {
-		return errors.New("docker container already exists")
+	//the image has to be known before a container can be checked against it
+	err = d.prepareImage(dockerClient, ctx, steps.Variables)
+	if err != nil {
+		return err
+	}
+
+	reuse := false
+	if exists && d.Persistent {
+		reuse, err = d.canReuse(dockerClient, ctx, steps)
+		if err != nil {
+			return err
+		}
+	}
+
+	//a container that is not running is left over from before, and would stop this one being made
+	if exists && !reuse {
+		d.Log(logging.Debug, "Removing stopped container")
+		err = dockerClient.ContainerRemove(ctx, d.ContainerId, types.ContainerRemoveOptions{Force: true})
+		if err != nil && !client.IsErrNotFound(err) {
+			return err
+		}
+	}
+
+	if !reuse {
+		err = d.createContainer(dockerClient, ctx, d.ContainerId, steps)
+		if err != nil {
+			return err
+		}
+	} else if name := d.networkName(steps.Variables); name != "" {
+		//the firewall rules do not survive the host restarting, where the container does
+		err = d.ensureNetwork(dockerClient, ctx, name)
+		if err != nil {
+			return err
+		}
 	}
 
-	err = d.createContainer(dockerClient, ctx, steps.Command, steps.Arguments, steps.Environment, steps.WorkingDirectory)
+	//a container that auto-deletes is waited on until it is removed rather than stopped
+	condition := container.WaitConditionRemoved
+	if d.Persistent {
+		condition = container.WaitConditionNotRunning
+	}
+	err = d.attach(dockerClient, ctx, condition, steps.Callback)
+	if err != nil {
+		return err
+	}
+
+	startOpts := types.ContainerStartOptions{}
+
+	msg := messages.Status{Running: true}
+	_ = d.WSManager.WriteMessage(msg)
+
+	//watched before the container starts, so a container that exits straight away stops it
+	d.watchHealth(dockerClient, steps)
+
+	d.DisplayToConsole(true, "Starting container\n")
+	err = dockerClient.ContainerStart(ctx, d.ContainerId, startOpts)
 	if err != nil {
+		d.StopHealth()
 		return err
 	}
+	return err
+}
+
+// CanReattach is always true, containers are run by the docker daemon rather than this one
+func (d *docker) CanReattach() bool {
+	return true
+}
+
+// Reattach picks up the container for this server if it was left running, so the daemon can restart without
+// restarting the server. A stopped container is removed unless it is persistent, so the server can be started again
+func (d *docker) Reattach(steps pufferpanel.ExecutionData) (bool, error) {
+	dockerClient, err := d.getClient()
+	if err != nil {
+		return false, err
+	}
+	ctx := context.Background()
+
+	opts := types.ContainerListOptions{
+		All:     true,
+		Filters: filters.NewArgs(),
+	}
+	opts.Filters.Add("label", "pufferpanel.server="+d.ContainerId)
+
+	existingContainers, err := dockerClient.ContainerList(ctx, opts)
+	if err != nil {
+		return false, err
+	}
+
+	var existing *types.Container
+	for i, v := range existingContainers {
+		if isNamed(v, d.ContainerId) {
+			existing = &existingContainers[i]
+		}
+	}
+	if existing == nil {
+		return false, nil
+	}
+
+	info, err := dockerClient.ContainerInspect(ctx, existing.ID)
+	if err != nil {
+		return false, err
+	}
+
+	if !info.State.Running {
+		//a persistent container is kept, to be started again
+		if d.Persistent {
+			return false, nil
+		}
+		d.Log(logging.Debug, "Removing stopped container")
+		return false, dockerClient.ContainerRemove(ctx, info.ID, types.ContainerRemoveOptions{Force: true})
+	}
+
+	condition := container.WaitConditionNotRunning
+	if info.HostConfig != nil && info.HostConfig.AutoRemove {
+		condition = container.WaitConditionRemoved
+	}
 
+	//watched before attaching, so a container that exits straight away stops it
+	d.watchHealth(dockerClient, steps)
+
+	err = d.attach(dockerClient, ctx, condition, steps.Callback)
+	if err != nil {
+		d.StopHealth()
+		return false, err
+	}
+
+	_ = d.WSManager.WriteMessage(messages.Status{Running: true})
+	d.DisplayToConsole(true, "Reattached to running container\n")
+	return true, nil
+}
+
+// attach connects the console to the container, and waits on it in the background to call the callback once it exits
+func (d *docker) attach(dockerClient client.APIClient, ctx context.Context, condition container.WaitCondition, callback func(graceful bool)) (err error) {
 	config := types.ContainerAttachOptions{
 		Stdin:  true,
 		Stdout: true,
@@ -106,14 +236,8 @@ func (d *docker) dockerExecuteAsync(steps pufferpanel.ExecutionData) error {
 		defer d.connection.Close()
 		wrapper := d.CreateWrapper()
 		_, _ = io.Copy(wrapper, d.connection.Reader)
-		//because we use the auto-delete, we don't manually stop the container
-		//c, _ := d.getClient()
-		//err = c.ContainerStop(context.Background(), d.ContainerId, nil)
-		//if err != nil {
-		//	logging.Error.Printf("Error stopping container "+d.ContainerId, err)
-		//}
-
-		okChan, errChan := dockerClient.ContainerWait(ctx, d.ContainerId, container.WaitConditionRemoved)
+
+		okChan, errChan := dockerClient.ContainerWait(ctx, d.ContainerId, condition)
 		select {
 		case _ = <-okChan:
 		case chanErr := <-errChan:
@@ -122,27 +246,18 @@ func (d *docker) dockerExecuteAsync(steps pufferpanel.ExecutionData) error {
 			}
 		}
 
+		d.StopHealth()
 		d.Wait.Done()
 
 		msg := messages.Status{Running: false}
 		_ = d.WSManager.WriteMessage(msg)
 
-		if steps.Callback != nil {
-			steps.Callback(err == nil)
+		if callback != nil {
+			callback(err == nil)
 		}
 	}()
 
-	startOpts := types.ContainerStartOptions{}
-
-	msg := messages.Status{Running: true}
-	_ = d.WSManager.WriteMessage(msg)
-
-	d.DisplayToConsole(true, "Starting container\n")
-	err = dockerClient.ContainerStart(ctx, d.ContainerId, startOpts)
-	if err != nil {
-		return err
-	}
-	return err
+	return nil
 }
 
 func (d *docker) ExecuteInMainProcess(cmd string) (err error) {
@@ -277,17 +392,26 @@ func (d *docker) WaitForMainProcessFor(timeout time.Duration) (err error) {
 	return
 }
 
-func (d *docker) getClient() (*client.Client, error) {
+func (d *docker) getClient() (client.APIClient, error) {
 	var err error = nil
 	if d.cli == nil {
-		d.cli, err = client.NewClientWithOpts(client.FromEnv)
+		opts := []client.Opt{client.FromEnv}
+		if d.host != "" {
+			opts = append(opts, client.WithHost(d.host))
+		}
+		var cli *client.Client
+		cli, err = client.NewClientWithOpts(opts...)
+		if err != nil {
+			return nil, err
+		}
 		ctx := context.Background()
-		d.cli.NegotiateAPIVersion(ctx)
+		cli.NegotiateAPIVersion(ctx)
+		d.cli = cli
 	}
 	return d.cli, err
 }
 
-func (d *docker) doesContainerExist(client *client.Client, ctx context.Context) (bool, error) {
+func (d *docker) doesContainerExist(client client.APIClient, ctx context.Context) (bool, error) {
 	opts := types.ContainerListOptions{
 		Filters: filters.NewArgs(),
 	}
@@ -297,14 +421,25 @@ func (d *docker) doesContainerExist(client *client.Client, ctx context.Context)
 
 	existingContainers, err := client.ContainerList(ctx, opts)
 
-	if len(existingContainers) == 0 {
-		return false, err
-	} else {
-		return true, err
+	//the name filter matches on part of a name, which the containers for operations would match
+	for _, v := range existingContainers {
+		if isNamed(v, d.ContainerId) {
+			return true, err
+		}
+	}
+	return false, err
+}
+
+func isNamed(c types.Container, name string) bool {
+	for _, v := range c.Names {
+		if v == "/"+name {
+			return true
+		}
 	}
+	return false
 }
 
-func (d *docker) pullImage(client *client.Client, ctx context.Context, force bool) error {
+func (d *docker) pullImage(client client.APIClient, ctx context.Context, force bool) error {
 	if d.downloadingImage {
 		return pufferpanel.ErrImageDownloading
 	}
@@ -315,7 +450,7 @@ func (d *docker) pullImage(client *client.Client, ctx context.Context, force boo
 		All:     true,
 		Filters: filters.NewArgs(),
 	}
-	opts.Filters.Add("reference", d.ImageName)
+	opts.Filters.Add("reference", d.image())
 	images, err := client.ImageList(ctx, opts)
 
 	if err != nil {
@@ -342,7 +477,7 @@ func (d *docker) pullImage(client *client.Client, ctx context.Context, force boo
 		d.downloadingImage = false
 	}()
 
-	r, err := client.ImagePull(ctx, d.ImageName, op)
+	r, err := client.ImagePull(ctx, d.image(), op)
 	defer pufferpanel.Close(r)
 	if err != nil {
 		return err
@@ -360,22 +495,49 @@ func (d *docker) pullImage(client *client.Client, ctx context.Context, force boo
 	return err
 }
 
-func (d *docker) createContainer(client *client.Client, ctx context.Context, cmd string, args []string, env map[string]string, workDir string) error {
+func (d *docker) createContainer(client client.APIClient, ctx context.Context, name string, steps pufferpanel.ExecutionData) error {
 	d.Log(logging.Debug, "Creating container")
-	containerRoot := "/pufferpanel"
-	err := d.pullImage(client, ctx, false)
+	err := d.prepareImage(client, ctx, steps.Variables)
+	if err != nil {
+		return err
+	}
 
+	containerConfig, hostConfig, err := d.containerConfigs(steps)
 	if err != nil {
 		return err
 	}
 
+	networkName := d.networkName(steps.Variables)
+	if networkName != "" {
+		err = d.ensureNetwork(client, ctx, networkName)
+		if err != nil {
+			return err
+		}
+	}
+
+	//one-off containers are removed by whatever runs them, so they can be waited on
+	if name != d.ContainerId {
+		hostConfig.AutoRemove = false
+	}
+
+	//for now, default to linux across the board. This resolves problems that Windows has when you use it and docker
+	_, err = client.ContainerCreate(ctx, containerConfig, hostConfig, &network.NetworkingConfig{}, &v1.Platform{OS: "linux"}, name)
+	return err
+}
+
+// containerConfigs is how a container running the command is set up. A persistent container is labelled with a hash
+// of this, so it is only reused while it would be made the same way
+func (d *docker) containerConfigs(steps pufferpanel.ExecutionData) (*container.Config, *container.HostConfig, error) {
+	containerRoot := "/pufferpanel"
+
 	//newEnv := os.Environ()
 	newEnv := []string{"HOME=" + containerRoot}
 
-	for k, v := range env {
+	for k, v := range steps.Environment {
 		newEnv = append(newEnv, fmt.Sprintf("%s=%s", k, v))
 	}
 
+	workDir := steps.WorkingDirectory
 	if workDir == "" {
 		workDir = containerRoot
 	}
@@ -391,8 +553,8 @@ func (d *docker) createContainer(client *client.Client, ctx context.Context, cmd
 	}
 
 	cmdSlice := strslice.StrSlice{}
-	cmdSlice = append(cmdSlice, cmd)
-	for _, v := range args {
+	cmdSlice = append(cmdSlice, steps.Command)
+	for _, v := range steps.Arguments {
 		cmdSlice = append(cmdSlice, v)
 	}
 
@@ -405,10 +567,11 @@ func (d *docker) createContainer(client *client.Client, ctx context.Context, cmd
 		Tty:             true,
 		OpenStdin:       true,
 		NetworkDisabled: false,
-		Image:           d.ImageName,
+		Image:           d.image(),
 		WorkingDir:      workDir,
 		Env:             newEnv,
 		Entrypoint:      cmdSlice,
+		Healthcheck:     healthConfig(steps.HealthCheck),
 		Labels: map[string]string{
 			"pufferpanel.server": d.ContainerId,
 		},
@@ -424,7 +587,7 @@ func (d *docker) createContainer(client *client.Client, ctx context.Context, cmd
 	if !filepath.IsAbs(dir) {
 		pwd, err := os.Getwd()
 		if err != nil {
-			return err
+			return nil, nil, err
 		}
 		dir = filepath.Join(pwd, dir)
 	}
@@ -435,22 +598,26 @@ func (d *docker) createContainer(client *client.Client, ctx context.Context, cmd
 	}
 
 	hostConfig := &container.HostConfig{
-		AutoRemove:   true,
+		AutoRemove:   !d.Persistent,
+		UsernsMode:   d.usernsMode,
 		NetworkMode:  container.NetworkMode(d.NetworkMode),
 		Resources:    d.Resources,
 		Binds:        bindDirs,
 		PortBindings: nat.PortMap{},
 	}
 
+	//a network the daemon makes replaces the network mode
+	if networkName := d.networkName(steps.Variables); networkName != "" {
+		hostConfig.NetworkMode = container.NetworkMode(networkName)
+	}
+
 	for k, v := range d.Binds {
 		hostConfig.Binds = append(hostConfig.Binds, k+":"+v)
 	}
 
-	networkConfig := &network.NetworkingConfig{}
-
 	_, bindings, err := nat.ParsePortSpecs(d.Ports)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 	hostConfig.PortBindings = bindings
 
@@ -460,9 +627,17 @@ func (d *docker) createContainer(client *client.Client, ctx context.Context, cmd
 	}
 	containerConfig.ExposedPorts = exposedPorts
 
-	//for now, default to linux across the board. This resolves problems that Windows has when you use it and docker
-	_, err = client.ContainerCreate(ctx, containerConfig, hostConfig, networkConfig, &v1.Platform{OS: "linux"}, d.ContainerId)
-	return err
+	//maps give these in any order, which would change the hash
+	sort.Strings(containerConfig.Env)
+	sort.Strings(hostConfig.Binds)
+
+	hash, err := configHash(containerConfig, hostConfig)
+	if err != nil {
+		return nil, nil, err
+	}
+	containerConfig.Labels[configLabel] = hash
+
+	return containerConfig, hostConfig, nil
 }
 
 func (d *docker) SendCode(code int) error {
@@ -0,0 +1,232 @@
+package docker
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/errdefs"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pufferpanel/pufferpanel/v2"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClient is a docker daemon holding one container, only answering what running servers and operations ask for
+type fakeClient struct {
+	client.APIClient
+	name    string
+	running bool
+	health  string
+	labels  map[string]string
+	removed []string
+	conn    net.Conn
+	exited  chan container.WaitResponse
+	waited  []container.WaitCondition
+
+	created []*createdContainer
+	started []string
+
+	execs      []types.ExecConfig
+	execOutput string
+	execCode   int
+}
+
+type createdContainer struct {
+	name       string
+	config     *container.Config
+	hostConfig *container.HostConfig
+}
+
+func (fc *fakeClient) ContainerList(context.Context, types.ContainerListOptions) ([]types.Container, error) {
+	if fc.name == "" {
+		return nil, nil
+	}
+	return []types.Container{{ID: "container-" + fc.name, Names: []string{"/" + fc.name}}}, nil
+}
+
+func (fc *fakeClient) ContainerInspect(_ context.Context, id string) (types.ContainerJSON, error) {
+	if fc.name == "" {
+		return types.ContainerJSON{}, errdefs.NotFound(errors.New("no such container"))
+	}
+	return types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{
+			ID:         id,
+			State:      &types.ContainerState{Running: fc.running, Health: &types.Health{Status: fc.health}},
+			HostConfig: &container.HostConfig{},
+		},
+		Config: &container.Config{Labels: fc.labels},
+	}, nil
+}
+
+func (fc *fakeClient) ContainerRemove(_ context.Context, id string, _ types.ContainerRemoveOptions) error {
+	fc.removed = append(fc.removed, id)
+	return nil
+}
+
+func (fc *fakeClient) ContainerAttach(_ context.Context, name string, _ types.ContainerAttachOptions) (types.HijackedResponse, error) {
+	//a one-off container has nothing to say
+	if name != fc.name {
+		return hungUp(), nil
+	}
+	return types.HijackedResponse{Conn: fc.conn, Reader: bufio.NewReader(fc.conn)}, nil
+}
+
+func (fc *fakeClient) ContainerWait(_ context.Context, _ string, condition container.WaitCondition) (<-chan container.WaitResponse, <-chan error) {
+	fc.waited = append(fc.waited, condition)
+	return fc.exited, make(chan error)
+}
+
+func (fc *fakeClient) ContainerCreate(_ context.Context, config *container.Config, hostConfig *container.HostConfig, _ *network.NetworkingConfig, _ *v1.Platform, name string) (container.CreateResponse, error) {
+	fc.created = append(fc.created, &createdContainer{name: name, config: config, hostConfig: hostConfig})
+	return container.CreateResponse{ID: "container-" + name}, nil
+}
+
+func (fc *fakeClient) ContainerStart(_ context.Context, name string, _ types.ContainerStartOptions) error {
+	fc.started = append(fc.started, name)
+	return nil
+}
+
+func (fc *fakeClient) ContainerExecCreate(_ context.Context, _ string, config types.ExecConfig) (types.IDResponse, error) {
+	fc.execs = append(fc.execs, config)
+	return types.IDResponse{ID: "exec"}, nil
+}
+
+func (fc *fakeClient) ContainerExecAttach(context.Context, string, types.ExecStartCheck) (types.HijackedResponse, error) {
+	response := hungUp()
+	response.Reader = bufio.NewReader(strings.NewReader(fc.execOutput))
+	return response, nil
+}
+
+func (fc *fakeClient) ContainerExecInspect(context.Context, string) (types.ContainerExecInspect, error) {
+	return types.ContainerExecInspect{ExitCode: fc.execCode}, nil
+}
+
+// the image is always there, so nothing is pulled
+func (fc *fakeClient) ImageList(context.Context, types.ImageListOptions) ([]types.ImageSummary, error) {
+	return []types.ImageSummary{{ID: "image"}}, nil
+}
+
+// hungUp is a connection to a container which has already closed its end
+func hungUp() types.HijackedResponse {
+	local, remote := net.Pipe()
+	_ = remote.Close()
+	return types.HijackedResponse{Conn: local, Reader: bufio.NewReader(local)}
+}
+
+func createTestDocker(cli client.APIClient, persistent bool) *docker {
+	d := EnvironmentFactory{}.Create("abcdef12").(*docker)
+	d.ConsoleBuffer = pufferpanel.CreateCache()
+	d.WSManager = pufferpanel.CreateTracker()
+	d.Wait = &sync.WaitGroup{}
+	d.Persistent = persistent
+	d.cli = cli
+	return d
+}
+
+func TestDocker_Reattach(t *testing.T) {
+	t.Run("running container calls back on exit", func(t *testing.T) {
+		daemonSide, containerSide := net.Pipe()
+		cli := &fakeClient{name: "abcdef12", running: true, conn: daemonSide, exited: make(chan container.WaitResponse, 1)}
+		d := createTestDocker(cli, false)
+
+		exited := make(chan bool, 1)
+		attached, err := d.Reattach(pufferpanel.ExecutionData{Callback: func(graceful bool) {
+			exited <- graceful
+		}})
+		if err != nil || !attached {
+			t.Fatalf("Reattach() = %v, %v, want true", attached, err)
+		}
+
+		select {
+		case <-exited:
+			t.Fatalf("Reattach() called back while the container was running")
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		cli.exited <- container.WaitResponse{}
+		_ = containerSide.Close()
+
+		select {
+		case graceful := <-exited:
+			if !graceful {
+				t.Errorf("Reattach() callback graceful = false, want true")
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Reattach() never called back after the container exited")
+		}
+	})
+
+	t.Run("running container is watched for health", func(t *testing.T) {
+		daemonSide, containerSide := net.Pipe()
+		cli := &fakeClient{name: "abcdef12", running: true, health: types.Healthy, conn: daemonSide, exited: make(chan container.WaitResponse, 1)}
+		d := createTestDocker(cli, false)
+
+		health := make(chan string, 2)
+		attached, err := d.Reattach(pufferpanel.ExecutionData{
+			HealthCheck: &pufferpanel.HealthCheck{Type: "command", Command: "true", Interval: 1},
+			HealthCallback: func(status string) {
+				health <- status
+			},
+		})
+		if err != nil || !attached {
+			t.Fatalf("Reattach() = %v, %v, want true", attached, err)
+		}
+
+		for _, want := range []string{pufferpanel.HealthStarting, pufferpanel.HealthHealthy} {
+			select {
+			case status := <-health:
+				if status != want {
+					t.Errorf("Reattach() health = %v, want %v", status, want)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("Reattach() health never became %v", want)
+			}
+		}
+
+		cli.exited <- container.WaitResponse{}
+		_ = containerSide.Close()
+		d.Wait.Wait()
+		if status := d.GetHealth(); status != "" {
+			t.Errorf("GetHealth() = %v after the container exited, want none", status)
+		}
+	})
+
+	t.Run("no container", func(t *testing.T) {
+		d := createTestDocker(&fakeClient{}, false)
+		attached, err := d.Reattach(pufferpanel.ExecutionData{})
+		if err != nil || attached {
+			t.Errorf("Reattach() = %v, %v, want false", attached, err)
+		}
+	})
+
+	t.Run("stopped container is removed", func(t *testing.T) {
+		cli := &fakeClient{name: "abcdef12"}
+		d := createTestDocker(cli, false)
+		attached, err := d.Reattach(pufferpanel.ExecutionData{})
+		if err != nil || attached {
+			t.Errorf("Reattach() = %v, %v, want false", attached, err)
+		}
+		if len(cli.removed) != 1 || cli.removed[0] != "container-abcdef12" {
+			t.Errorf("Reattach() removed %v, want the stopped container", cli.removed)
+		}
+	})
+
+	t.Run("stopped persistent container is kept", func(t *testing.T) {
+		cli := &fakeClient{name: "abcdef12"}
+		d := createTestDocker(cli, true)
+		attached, err := d.Reattach(pufferpanel.ExecutionData{})
+		if err != nil || attached {
+			t.Errorf("Reattach() = %v, %v, want false", attached, err)
+		}
+		if len(cli.removed) != 0 {
+			t.Errorf("Reattach() removed %v, want a persistent container kept", cli.removed)
+		}
+	})
+}
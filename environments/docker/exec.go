@@ -0,0 +1,188 @@
+/*
+ Copyright 2023 Padduck, LLC
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+  	http://www.apache.org/licenses/LICENSE-2.0
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+*/
+
+package docker
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+	"github.com/pufferpanel/pufferpanel/v2"
+	"github.com/pufferpanel/pufferpanel/v2/logging"
+	"io"
+)
+
+// label holding the hash of how a container was made
+const configLabel = "pufferpanel.config"
+
+// Execute runs a command to completion, as operations do. While the server's container is running the command is run
+// in it, otherwise the command gets a container of its own from the server's image. Nothing is run on the host
+func (d *docker) Execute(steps pufferpanel.ExecutionData) error {
+	running, err := d.IsRunning()
+	if err != nil {
+		return err
+	}
+
+	dockerClient, err := d.getClient()
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+
+	if running {
+		return d.exec(dockerClient, ctx, steps)
+	}
+	return d.runOnce(dockerClient, ctx, steps)
+}
+
+// Delete removes the server's container along with its files, as a persistent one is otherwise left behind
+func (d *docker) Delete() error {
+	err := d.Teardown()
+	if err != nil {
+		return err
+	}
+	return d.BaseEnvironment.Delete()
+}
+
+// Teardown removes the server's container, and the networks made for it once nothing else is on them. The files are left
+func (d *docker) Teardown() error {
+	dockerClient, err := d.getClient()
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+
+	networks, err := containerNetworks(dockerClient, ctx, d.ContainerId)
+	if err != nil {
+		return err
+	}
+
+	err = dockerClient.ContainerRemove(ctx, d.ContainerId, types.ContainerRemoveOptions{Force: true})
+	if err != nil && !client.IsErrNotFound(err) {
+		return err
+	}
+	return removeUnusedNetworks(dockerClient, ctx, networks)
+}
+
+// exec runs the command in the server's running container
+func (d *docker) exec(dockerClient client.APIClient, ctx context.Context, steps pufferpanel.ExecutionData) error {
+	execConfig := types.ExecConfig{
+		Tty:          true,
+		AttachStdout: true,
+		AttachStderr: true,
+		WorkingDir:   steps.WorkingDirectory,
+		Cmd:          append([]string{steps.Command}, steps.Arguments...),
+	}
+	for k, v := range steps.Environment {
+		execConfig.Env = append(execConfig.Env, fmt.Sprintf("%s=%s", k, v))
+	}
+
+	d.Log(logging.Debug, "Executing in container: %s\n", execConfig.Cmd)
+	created, err := dockerClient.ContainerExecCreate(ctx, d.ContainerId, execConfig)
+	if err != nil {
+		return err
+	}
+
+	attached, err := dockerClient.ContainerExecAttach(ctx, created.ID, types.ExecStartCheck{Tty: true})
+	if err != nil {
+		return err
+	}
+	_, _ = io.Copy(d.CreateWrapper(), attached.Reader)
+	attached.Close()
+
+	result, err := dockerClient.ContainerExecInspect(ctx, created.ID)
+	if err != nil {
+		return err
+	}
+	if result.ExitCode != 0 {
+		return pufferpanel.ErrCommandFailed(result.ExitCode)
+	}
+	return nil
+}
+
+// runOnce runs the command in a container made for it from the server's image, which is removed once it exits
+func (d *docker) runOnce(dockerClient client.APIClient, ctx context.Context, steps pufferpanel.ExecutionData) error {
+	name := d.ContainerId + "_operation"
+
+	//left over from an operation the daemon did not see finish
+	err := dockerClient.ContainerRemove(ctx, name, types.ContainerRemoveOptions{Force: true})
+	if err != nil && !client.IsErrNotFound(err) {
+		return err
+	}
+
+	err = d.createContainer(dockerClient, ctx, name, steps)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = dockerClient.ContainerRemove(context.Background(), name, types.ContainerRemoveOptions{Force: true})
+	}()
+
+	attached, err := dockerClient.ContainerAttach(ctx, name, types.ContainerAttachOptions{Stdout: true, Stderr: true, Stream: true})
+	if err != nil {
+		return err
+	}
+	defer attached.Close()
+
+	okChan, errChan := dockerClient.ContainerWait(ctx, name, container.WaitConditionNextExit)
+
+	err = dockerClient.ContainerStart(ctx, name, types.ContainerStartOptions{})
+	if err != nil {
+		return err
+	}
+	_, _ = io.Copy(d.CreateWrapper(), attached.Reader)
+
+	select {
+	case result := <-okChan:
+		if result.StatusCode != 0 {
+			return pufferpanel.ErrCommandFailed(int(result.StatusCode))
+		}
+		return nil
+	case err = <-errChan:
+		return err
+	}
+}
+
+// canReuse is if the server's stopped container was made the way it would be made now, so it can be started again
+func (d *docker) canReuse(dockerClient client.APIClient, ctx context.Context, steps pufferpanel.ExecutionData) (bool, error) {
+	info, err := dockerClient.ContainerInspect(ctx, d.ContainerId)
+	if client.IsErrNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	containerConfig, _, err := d.containerConfigs(steps)
+	if err != nil {
+		return false, err
+	}
+
+	reuse := info.Config != nil && info.Config.Labels[configLabel] == containerConfig.Labels[configLabel]
+	d.Log(logging.Debug, "Can existing container be reused? %v", reuse)
+	return reuse, nil
+}
+
+func configHash(containerConfig *container.Config, hostConfig *container.HostConfig) (string, error) {
+	data, err := json.Marshal([]interface{}{containerConfig, hostConfig})
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:]), nil
+}
@@ -0,0 +1,232 @@
+package docker
+
+import (
+	"context"
+	"errors"
+	"github.com/docker/docker/api/types/container"
+	"github.com/pufferpanel/pufferpanel/v2"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDocker_Execute(t *testing.T) {
+	steps := pufferpanel.ExecutionData{
+		Command:          "echo",
+		Arguments:        []string{"hello"},
+		WorkingDirectory: "/pufferpanel",
+		Environment:      map[string]string{"KEY": "value"},
+	}
+
+	t.Run("running container runs it in the container", func(t *testing.T) {
+		cli := &fakeClient{name: "abcdef12", running: true, execOutput: "hello\n"}
+		d := createTestDocker(cli, false)
+
+		err := d.Execute(steps)
+		if err != nil {
+			t.Fatalf("Execute() error = %v", err)
+		}
+		if len(cli.execs) != 1 {
+			t.Fatalf("Execute() ran %d execs, want 1", len(cli.execs))
+		}
+		exec := cli.execs[0]
+		if !reflect.DeepEqual(exec.Cmd, []string{"echo", "hello"}) || exec.WorkingDir != "/pufferpanel" || !reflect.DeepEqual(exec.Env, []string{"KEY=value"}) {
+			t.Errorf("Execute() exec = %+v", exec)
+		}
+		if len(cli.created) != 0 {
+			t.Errorf("Execute() created %d containers, want none", len(cli.created))
+		}
+		output, _ := d.ConsoleBuffer.Read()
+		if !strings.Contains(strings.Join(output, ""), "hello") {
+			t.Errorf("Execute() output = %v, want hello", output)
+		}
+	})
+
+	t.Run("failing command in the container", func(t *testing.T) {
+		cli := &fakeClient{name: "abcdef12", running: true, execCode: 2}
+		d := createTestDocker(cli, false)
+
+		err := d.Execute(steps)
+		if !isCommandFailed(err) {
+			t.Errorf("Execute() error = %v, want ErrCommandFailed", err)
+		}
+	})
+
+	for _, persistent := range []bool{false, true} {
+		name := "stopped container runs it in a container of its own"
+		if persistent {
+			name = "stopped persistent container runs it in a container of its own"
+		}
+		t.Run(name, func(t *testing.T) {
+			cli := &fakeClient{name: "abcdef12", exited: make(chan container.WaitResponse, 1)}
+			cli.exited <- container.WaitResponse{}
+			d := createTestDocker(cli, persistent)
+
+			err := d.Execute(steps)
+			if err != nil {
+				t.Fatalf("Execute() error = %v", err)
+			}
+			if len(cli.execs) != 0 {
+				t.Errorf("Execute() ran %d execs, want none", len(cli.execs))
+			}
+			if len(cli.created) != 1 {
+				t.Fatalf("Execute() created %d containers, want 1", len(cli.created))
+			}
+			created := cli.created[0]
+			if created.name != "abcdef12_operation" {
+				t.Errorf("Execute() created %s, want abcdef12_operation", created.name)
+			}
+			if created.hostConfig.AutoRemove {
+				t.Errorf("Execute() created a container which removes itself")
+			}
+			if !reflect.DeepEqual([]string(created.config.Entrypoint), []string{"echo", "hello"}) {
+				t.Errorf("Execute() command = %v", created.config.Entrypoint)
+			}
+			if !reflect.DeepEqual(cli.started, []string{"abcdef12_operation"}) {
+				t.Errorf("Execute() started %v", cli.started)
+			}
+			if !reflect.DeepEqual(cli.waited, []container.WaitCondition{container.WaitConditionNextExit}) {
+				t.Errorf("Execute() waited on %v", cli.waited)
+			}
+			//once before in case one was left behind, and once after
+			if !reflect.DeepEqual(cli.removed, []string{"abcdef12_operation", "abcdef12_operation"}) {
+				t.Errorf("Execute() removed %v", cli.removed)
+			}
+		})
+	}
+
+	t.Run("failing command in a container of its own", func(t *testing.T) {
+		cli := &fakeClient{name: "abcdef12", exited: make(chan container.WaitResponse, 1)}
+		cli.exited <- container.WaitResponse{StatusCode: 3}
+		d := createTestDocker(cli, false)
+
+		err := d.Execute(steps)
+		if !isCommandFailed(err) {
+			t.Errorf("Execute() error = %v, want ErrCommandFailed", err)
+		}
+		if len(cli.removed) != 2 {
+			t.Errorf("Execute() removed %v, want the container removed after failing", cli.removed)
+		}
+	})
+}
+
+func TestDocker_canReuse(t *testing.T) {
+	steps := pufferpanel.ExecutionData{Command: "java", Arguments: []string{"-jar", "server.jar"}}
+
+	d := createTestDocker(nil, true)
+	config, _, err := d.containerConfigs(steps)
+	if err != nil {
+		t.Fatalf("containerConfigs() error = %v", err)
+	}
+	hash := config.Labels[configLabel]
+	if hash == "" {
+		t.Fatalf("containerConfigs() has no %s label", configLabel)
+	}
+
+	tests := []struct {
+		name  string
+		cli   *fakeClient
+		steps pufferpanel.ExecutionData
+		want  bool
+	}{
+		{name: "same config", cli: &fakeClient{name: "abcdef12", labels: map[string]string{configLabel: hash}}, steps: steps, want: true},
+		{name: "changed command", cli: &fakeClient{name: "abcdef12", labels: map[string]string{configLabel: hash}}, steps: pufferpanel.ExecutionData{Command: "java", Arguments: []string{"-jar", "other.jar"}}, want: false},
+		{name: "unlabelled container", cli: &fakeClient{name: "abcdef12"}, steps: steps, want: false},
+		{name: "no container", cli: &fakeClient{}, steps: steps, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := createTestDocker(tt.cli, true)
+			got, err := d.canReuse(tt.cli, context.Background(), tt.steps)
+			if err != nil {
+				t.Fatalf("canReuse() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("canReuse() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDocker_dockerExecuteAsync(t *testing.T) {
+	steps := pufferpanel.ExecutionData{Command: "java", Arguments: []string{"-jar", "server.jar"}}
+	hash := func() string {
+		config, _, err := createTestDocker(nil, true).containerConfigs(steps)
+		if err != nil {
+			t.Fatalf("containerConfigs() error = %v", err)
+		}
+		return config.Labels[configLabel]
+	}()
+
+	tests := []struct {
+		name       string
+		cli        *fakeClient
+		persistent bool
+		reused     bool
+		condition  container.WaitCondition
+	}{
+		{name: "persistent container made the same way is started again", cli: &fakeClient{name: "abcdef12", labels: map[string]string{configLabel: hash}}, persistent: true, reused: true, condition: container.WaitConditionNotRunning},
+		{name: "persistent container made differently is made again", cli: &fakeClient{name: "abcdef12", labels: map[string]string{configLabel: "old"}}, persistent: true, condition: container.WaitConditionNotRunning},
+		{name: "persistent container is made the first time", cli: &fakeClient{}, persistent: true, condition: container.WaitConditionNotRunning},
+		{name: "container left behind is made again", cli: &fakeClient{name: "abcdef12", labels: map[string]string{configLabel: hash}}, condition: container.WaitConditionRemoved},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			daemonSide, containerSide := net.Pipe()
+			tt.cli.conn = daemonSide
+			tt.cli.exited = make(chan container.WaitResponse, 1)
+			d := createTestDocker(tt.cli, tt.persistent)
+
+			exited := make(chan bool, 1)
+			s := steps
+			s.Callback = func(graceful bool) {
+				exited <- graceful
+			}
+			err := d.dockerExecuteAsync(s)
+			if err != nil {
+				t.Fatalf("dockerExecuteAsync() error = %v", err)
+			}
+
+			if tt.reused {
+				if len(tt.cli.created) != 0 || len(tt.cli.removed) != 0 {
+					t.Errorf("dockerExecuteAsync() created %d and removed %v, want the container reused", len(tt.cli.created), tt.cli.removed)
+				}
+			} else {
+				if len(tt.cli.created) != 1 || tt.cli.created[0].name != "abcdef12" {
+					t.Fatalf("dockerExecuteAsync() created %v, want abcdef12", tt.cli.created)
+				}
+				if tt.cli.created[0].hostConfig.AutoRemove == tt.persistent {
+					t.Errorf("dockerExecuteAsync() AutoRemove = %v, want %v", tt.cli.created[0].hostConfig.AutoRemove, !tt.persistent)
+				}
+				wantRemoved := 0
+				if tt.cli.name != "" {
+					wantRemoved = 1
+				}
+				if len(tt.cli.removed) != wantRemoved {
+					t.Errorf("dockerExecuteAsync() removed %v, want %d", tt.cli.removed, wantRemoved)
+				}
+			}
+			if !reflect.DeepEqual(tt.cli.started, []string{"abcdef12"}) {
+				t.Errorf("dockerExecuteAsync() started %v", tt.cli.started)
+			}
+
+			_ = containerSide.Close()
+			tt.cli.exited <- container.WaitResponse{}
+			select {
+			case <-exited:
+			case <-time.After(time.Second):
+				t.Fatal("callback not called after the container exited")
+			}
+			if !reflect.DeepEqual(tt.cli.waited, []container.WaitCondition{tt.condition}) {
+				t.Errorf("dockerExecuteAsync() waited on %v, want %v", tt.cli.waited, tt.condition)
+			}
+		})
+	}
+}
+
+func isCommandFailed(err error) bool {
+	var e *pufferpanel.Error
+	return errors.As(err, &e) && e.Code == "ErrCommandFailed"
+}
@@ -0,0 +1,109 @@
+//go:build linux
+// +build linux
+
+/*
+ Copyright 2023 Padduck, LLC
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+  	http://www.apache.org/licenses/LICENSE-2.0
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+*/
+
+package docker
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// ranges a blocked network cannot reach. Along with the host itself, this is the daemon and anything on the LAN
+var privateRanges = []string{"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "169.254.0.0/16", "100.64.0.0/10"}
+
+// blockPrivateNetworks stops containers on the bridge from opening connections to the host and private ranges. They
+// can still reach each other, answer connections made to them, and look up names.
+// The rules are in a chain of the bridge's own, so they can be put back as they were every time without duplicates
+func blockPrivateNetworks(bridge string) error {
+	chain := firewallChain(bridge)
+
+	//the chain may already be there from a container started before
+	_ = iptables("-N", chain)
+	if err := iptables("-F", chain); err != nil {
+		return err
+	}
+
+	rules := [][]string{
+		{"-o", bridge, "-j", "RETURN"},
+		{"-m", "conntrack", "--ctstate", "RELATED,ESTABLISHED", "-j", "RETURN"},
+		{"-p", "udp", "--dport", "53", "-j", "RETURN"},
+		{"-p", "tcp", "--dport", "53", "-j", "RETURN"},
+		{"-m", "addrtype", "--dst-type", "LOCAL", "-j", "DROP"},
+	}
+	for _, v := range privateRanges {
+		rules = append(rules, []string{"-d", v, "-j", "DROP"})
+	}
+	for _, v := range rules {
+		if err := iptables(append([]string{"-A", chain}, v...)...); err != nil {
+			return err
+		}
+	}
+
+	for _, v := range jumpChains() {
+		jump := []string{v, "-i", bridge, "-j", chain}
+		if iptables(append([]string{"-C"}, jump...)...) == nil {
+			continue
+		}
+		if err := iptables(append([]string{"-I"}, jump...)...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unblockPrivateNetworks removes the rules for a bridge, if there were any
+func unblockPrivateNetworks(bridge string) error {
+	chain := firewallChain(bridge)
+	if iptables("-n", "-L", chain) != nil {
+		return nil
+	}
+
+	for _, v := range jumpChains() {
+		jump := []string{v, "-i", bridge, "-j", chain}
+		for iptables(append([]string{"-C"}, jump...)...) == nil {
+			if err := iptables(append([]string{"-D"}, jump...)...); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := iptables("-F", chain); err != nil {
+		return err
+	}
+	return iptables("-X", chain)
+}
+
+func firewallChain(bridge string) string {
+	return strings.ToUpper(bridge)
+}
+
+// jumpChains are where traffic from a bridge is sent to its chain. Docker puts its own rules above anything else in
+// FORWARD when it starts, apart from DOCKER-USER, so that is used when it is there
+func jumpChains() []string {
+	if iptables("-n", "-L", "DOCKER-USER") == nil {
+		return []string{"DOCKER-USER", "INPUT"}
+	}
+	return []string{"FORWARD", "INPUT"}
+}
+
+func iptables(args ...string) error {
+	output, err := exec.Command("iptables", append([]string{"-w"}, args...)...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("iptables %s: %s", strings.Join(args, " "), strings.TrimSpace(string(output)))
+	}
+	return nil
+}
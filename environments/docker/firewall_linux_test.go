@@ -0,0 +1,102 @@
+package docker
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeIptables puts an iptables on the path that records what it was asked, and says nothing exists yet
+func fakeIptables(t *testing.T) string {
+	dir := t.TempDir()
+	log := filepath.Join(dir, "calls")
+	script := "#!/bin/sh\necho \"$@\" >> " + log + "\ncase \" $* \" in *\" -C \"*|*\" -L \"*|*\" -N \"*) exit 1;; esac\n"
+	if err := os.WriteFile(filepath.Join(dir, "iptables"), []byte(script), 0755); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	t.Setenv("PATH", dir)
+	return log
+}
+
+func readCalls(t *testing.T, log string) []string {
+	data, err := os.ReadFile(log)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	return strings.Split(strings.TrimSpace(string(data)), "\n")
+}
+
+func Test_firewallChain(t *testing.T) {
+	bridge := bridgeName("pufferpanel-server-abcdef12")
+	chain := firewallChain(bridge)
+	if chain != strings.ToUpper(bridge) {
+		t.Errorf("firewallChain(%s) = %s, want %s", bridge, chain, strings.ToUpper(bridge))
+	}
+	//iptables chain names are limited to 28 characters
+	if len(chain) > 28 {
+		t.Errorf("firewallChain(%s) = %s, longer than 28 characters", bridge, chain)
+	}
+}
+
+func Test_blockPrivateNetworks(t *testing.T) {
+	log := fakeIptables(t)
+
+	if err := blockPrivateNetworks("pp-0123456789ab"); err != nil {
+		t.Fatalf("blockPrivateNetworks() error = %v", err)
+	}
+
+	calls := readCalls(t, log)
+	want := []string{
+		"-w -F PP-0123456789AB",
+		"-w -A PP-0123456789AB -o pp-0123456789ab -j RETURN",
+		"-w -A PP-0123456789AB -m addrtype --dst-type LOCAL -j DROP",
+		"-w -I FORWARD -i pp-0123456789ab -j PP-0123456789AB",
+		"-w -I INPUT -i pp-0123456789ab -j PP-0123456789AB",
+	}
+	for _, v := range privateRanges {
+		want = append(want, "-w -A PP-0123456789AB -d "+v+" -j DROP")
+	}
+	for _, v := range want {
+		found := false
+		for _, call := range calls {
+			if call == v {
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.Errorf("blockPrivateNetworks() did not run iptables %s, ran %v", v, calls)
+		}
+	}
+
+	//the chain only lets traffic through before it drops anything
+	lastReturn, firstDrop := -1, len(calls)
+	for k, v := range calls {
+		if strings.HasSuffix(v, "-j RETURN") {
+			lastReturn = k
+		} else if strings.HasSuffix(v, "-j DROP") && k < firstDrop {
+			firstDrop = k
+		}
+	}
+	if lastReturn > firstDrop {
+		t.Errorf("blockPrivateNetworks() added a RETURN after a DROP: %v", calls)
+	}
+}
+
+func Test_unblockPrivateNetworks(t *testing.T) {
+	log := fakeIptables(t)
+
+	//without the chain there is nothing to remove
+	if err := unblockPrivateNetworks("pp-0123456789ab"); err != nil {
+		t.Fatalf("unblockPrivateNetworks() error = %v", err)
+	}
+
+	calls := readCalls(t, log)
+	if len(calls) != 1 || calls[0] != "-w -n -L PP-0123456789AB" {
+		t.Errorf("unblockPrivateNetworks() ran %v, want only the chain lookup", calls)
+	}
+}
@@ -0,0 +1,73 @@
+/*
+ Copyright 2023 Padduck, LLC
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+  	http://www.apache.org/licenses/LICENSE-2.0
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+*/
+
+package docker
+
+import (
+	"context"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+	"github.com/pufferpanel/pufferpanel/v2"
+)
+
+// healthConfig is the check docker runs in the container, for a health check that is a command
+func healthConfig(check *pufferpanel.HealthCheck) *container.HealthConfig {
+	if check == nil || check.Type != "command" {
+		return nil
+	}
+	return &container.HealthConfig{
+		Test:        []string{"CMD-SHELL", check.Command},
+		Interval:    check.IntervalDuration(),
+		Timeout:     check.TimeoutDuration(),
+		StartPeriod: check.StartPeriodDuration(),
+		Retries:     check.FailuresAllowed(),
+	}
+}
+
+// watchHealth follows the server's health. Docker runs a command itself so its result is read back, where ports are
+// checked by the daemon
+func (d *docker) watchHealth(dockerClient client.APIClient, steps pufferpanel.ExecutionData) {
+	check := steps.HealthCheck
+	if check == nil {
+		return
+	}
+
+	var status func() string
+	switch check.Type {
+	case "command":
+		status = func() string {
+			info, err := dockerClient.ContainerInspect(context.Background(), d.ContainerId)
+			if err != nil || info.State == nil || info.State.Health == nil {
+				return ""
+			}
+			switch info.State.Health.Status {
+			case types.Starting:
+				return pufferpanel.HealthStarting
+			case types.Healthy:
+				return pufferpanel.HealthHealthy
+			case types.Unhealthy:
+				return pufferpanel.HealthUnhealthy
+			}
+			return ""
+		}
+	case "tcp", "udp":
+		status = pufferpanel.ProbeHealth(check, func() error {
+			return pufferpanel.ProbePort(check.Type, check.Address, check.Payload, check.TimeoutDuration())
+		})
+	default:
+		return
+	}
+
+	d.WatchHealth(check.IntervalDuration(), status, steps.HealthCallback)
+}
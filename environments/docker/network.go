@@ -0,0 +1,165 @@
+/*
+ Copyright 2023 Padduck, LLC
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+  	http://www.apache.org/licenses/LICENSE-2.0
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+*/
+
+package docker
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/errdefs"
+	"github.com/pufferpanel/pufferpanel/v2"
+	"github.com/pufferpanel/pufferpanel/v2/logging"
+	"github.com/spf13/cast"
+)
+
+// scopes of the networks the daemon makes for servers. Containers on the same network can reach each other by the
+// server's id
+const (
+	networkScopeServer = "server"
+	networkScopeOwner  = "owner"
+	networkScopeShared = "shared"
+)
+
+// networkLabel marks the networks the daemon made, so they are removed when the last server on them is
+const networkLabel = "pufferpanel.network"
+
+// networkName is the network the daemon makes for the server, none if the server uses the network mode as it is
+func (d *docker) networkName(variables map[string]interface{}) string {
+	switch d.NetworkScope {
+	case networkScopeServer:
+		return "pufferpanel-server-" + d.ContainerId
+	case networkScopeOwner:
+		owner := cast.ToString(variables["owner"])
+		//servers from before the panel said who owns them only get their own network
+		if owner == "" {
+			return "pufferpanel-server-" + d.ContainerId
+		}
+		return "pufferpanel-owner-" + owner
+	case networkScopeShared:
+		if d.Network != "" {
+			return "pufferpanel-shared-" + d.Network
+		}
+	}
+	return ""
+}
+
+// bridgeName is the interface of the network on the host, named so the firewall rules for it are known without asking
+// docker. Interface names are limited to 15 characters
+func bridgeName(networkName string) string {
+	hash := sha256.Sum256([]byte(networkName))
+	return "pp-" + hex.EncodeToString(hash[:])[:12]
+}
+
+// ensureNetwork makes the network if it is not there yet, and blocks it from the host and private ranges if asked.
+// The firewall is for the network, so on a shared one this applies to every server on it
+func (d *docker) ensureNetwork(client client.APIClient, ctx context.Context, name string) error {
+	existing, err := findNetwork(client, ctx, name)
+	if err != nil {
+		return err
+	}
+
+	if existing == nil {
+		d.Log(logging.Debug, "Creating network %s", name)
+		_, err = client.NetworkCreate(ctx, name, types.NetworkCreate{
+			CheckDuplicate: true,
+			Driver:         "bridge",
+			Labels:         map[string]string{networkLabel: d.NetworkScope},
+			Options:        map[string]string{"com.docker.network.bridge.name": bridgeName(name)},
+		})
+		//another server on the network may have just made it
+		if err != nil && !errdefs.IsConflict(err) {
+			return err
+		}
+	}
+
+	if d.BlockPrivateNetworks {
+		//servers saved before this was refused for rootless podman
+		if d.usernsMode == "keep-id" {
+			return pufferpanel.ErrNetworkBlockNotSupported
+		}
+		return blockPrivateNetworks(bridgeName(name))
+	}
+	return nil
+}
+
+// removeUnusedNetworks removes the networks the daemon made which no longer have any containers, along with their
+// firewall rules
+func removeUnusedNetworks(client client.APIClient, ctx context.Context, names []string) error {
+	for _, name := range names {
+		existing, err := findNetwork(client, ctx, name)
+		if err != nil {
+			return err
+		}
+		if existing == nil || existing.Labels[networkLabel] == "" {
+			continue
+		}
+
+		//the list does not say which containers are on a network
+		resource, err := client.NetworkInspect(ctx, existing.ID, types.NetworkInspectOptions{})
+		if err != nil {
+			return err
+		}
+		if len(resource.Containers) > 0 {
+			continue
+		}
+
+		logging.Debug.Printf("Removing network %s", name)
+		err = client.NetworkRemove(ctx, existing.ID)
+		if err != nil && !errdefs.IsNotFound(err) {
+			return err
+		}
+		err = unblockPrivateNetworks(bridgeName(name))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// containerNetworks are the names of the networks a container is on
+func containerNetworks(client client.APIClient, ctx context.Context, id string) ([]string, error) {
+	inspect, err := client.ContainerInspect(ctx, id)
+	if err != nil {
+		if errdefs.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	names := make([]string, 0)
+	if inspect.NetworkSettings != nil {
+		for k := range inspect.NetworkSettings.Networks {
+			names = append(names, k)
+		}
+	}
+	return names, nil
+}
+
+func findNetwork(client client.APIClient, ctx context.Context, name string) (*types.NetworkResource, error) {
+	networks, err := client.NetworkList(ctx, types.NetworkListOptions{Filters: filters.NewArgs(filters.Arg("name", name))})
+	if err != nil {
+		return nil, err
+	}
+
+	//like containers, the name filter matches on part of a name
+	for _, v := range networks {
+		if v.Name == name {
+			return &v, nil
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,56 @@
+package docker
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDocker_networkName(t *testing.T) {
+	tests := []struct {
+		name      string
+		scope     string
+		network   string
+		variables map[string]interface{}
+		want      string
+	}{
+		{name: "no scope", want: ""},
+		{name: "server", scope: networkScopeServer, variables: map[string]interface{}{"owner": "team-1"}, want: "pufferpanel-server-abcdef12"},
+		{name: "owner", scope: networkScopeOwner, variables: map[string]interface{}{"owner": "team-1"}, want: "pufferpanel-owner-team-1"},
+		{name: "owner without owner", scope: networkScopeOwner, variables: map[string]interface{}{}, want: "pufferpanel-server-abcdef12"},
+		{name: "owner with empty owner", scope: networkScopeOwner, variables: map[string]interface{}{"owner": ""}, want: "pufferpanel-server-abcdef12"},
+		{name: "shared", scope: networkScopeShared, network: "lobby", want: "pufferpanel-shared-lobby"},
+		{name: "shared without network", scope: networkScopeShared, want: ""},
+		{name: "unknown scope", scope: "everyone", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := createTestDocker(nil, false)
+			d.NetworkScope = tt.scope
+			d.Network = tt.network
+			if got := d.networkName(tt.variables); got != tt.want {
+				t.Errorf("networkName() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDocker_bridgeName(t *testing.T) {
+	names := []string{"pufferpanel-server-abcdef12", "pufferpanel-owner-team-1", "pufferpanel-shared-" + strings.Repeat("x", 200)}
+	seen := make(map[string]string)
+	for _, v := range names {
+		bridge := bridgeName(v)
+		if len(bridge) > 15 {
+			t.Errorf("bridgeName(%s) = %s, longer than 15 characters", v, bridge)
+		}
+		if !strings.HasPrefix(bridge, "pp-") {
+			t.Errorf("bridgeName(%s) = %s, want pp- prefix", v, bridge)
+		}
+		if again := bridgeName(v); again != bridge {
+			t.Errorf("bridgeName(%s) = %s, then %s", v, bridge, again)
+		}
+		if other, exists := seen[bridge]; exists {
+			t.Errorf("bridgeName(%s) = bridgeName(%s) = %s", v, other, bridge)
+		}
+		seen[bridge] = v
+	}
+}
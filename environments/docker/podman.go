@@ -0,0 +1,69 @@
+/*
+ Copyright 2023 Padduck, LLC
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+  	http://www.apache.org/licenses/LICENSE-2.0
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+*/
+
+package docker
+
+import (
+	"github.com/pufferpanel/pufferpanel/v2"
+	"os"
+	"strings"
+)
+
+// PodmanEnvironmentFactory creates containers through Podman's Docker compatible API, for hosts without a docker daemon
+type PodmanEnvironmentFactory struct {
+	pufferpanel.EnvironmentFactory
+}
+
+func (ef PodmanEnvironmentFactory) Create(id string) pufferpanel.Environment {
+	d := EnvironmentFactory{}.Create(id).(*docker)
+	d.Type = "podman"
+	d.host = pufferpanel.GetPodmanHost()
+	//rootless podman maps the user to root in the container, keep-id keeps the server files owned by the user instead
+	if os.Geteuid() != 0 {
+		d.usernsMode = "keep-id"
+	}
+	return d
+}
+
+func (ef PodmanEnvironmentFactory) Key() string {
+	return "podman"
+}
+
+// image is the image to run, which is the one built for the server if it has a Dockerfile. Podman needs the registry
+// of any other
+func (d *docker) image() string {
+	if d.builtImage != "" {
+		return d.builtImage
+	}
+	if d.Type == "podman" {
+		return qualifyImage(d.ImageName)
+	}
+	return d.ImageName
+}
+
+// qualifyImage adds docker hub to image names without a registry, podman does not assume one
+func qualifyImage(image string) string {
+	name := image
+	if i := strings.LastIndex(name, "@"); i != -1 {
+		name = name[:i]
+	}
+
+	parts := strings.SplitN(name, "/", 2)
+	if len(parts) == 2 && (strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost") {
+		return image
+	}
+	if len(parts) == 1 {
+		return "docker.io/library/" + image
+	}
+	return "docker.io/" + image
+}
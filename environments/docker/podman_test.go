@@ -0,0 +1,28 @@
+package docker
+
+import "testing"
+
+func Test_qualifyImage(t *testing.T) {
+	tests := []struct {
+		image string
+		want  string
+	}{
+		{image: "ubuntu", want: "docker.io/library/ubuntu"},
+		{image: "ubuntu:22.04", want: "docker.io/library/ubuntu:22.04"},
+		{image: "pufferpanel/generic", want: "docker.io/pufferpanel/generic"},
+		{image: "pufferpanel/generic:latest", want: "docker.io/pufferpanel/generic:latest"},
+		{image: "registry:5000/generic", want: "registry:5000/generic"},
+		{image: "ghcr.io/pufferpanel/generic", want: "ghcr.io/pufferpanel/generic"},
+		{image: "localhost/generic", want: "localhost/generic"},
+		{image: "ubuntu@sha256:abc123", want: "docker.io/library/ubuntu@sha256:abc123"},
+		{image: "pufferpanel/generic@sha256:abc123", want: "docker.io/pufferpanel/generic@sha256:abc123"},
+		{image: "registry:5000/generic@sha256:abc123", want: "registry:5000/generic@sha256:abc123"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.image, func(t *testing.T) {
+			if got := qualifyImage(tt.image); got != tt.want {
+				t.Errorf("qualifyImage() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -18,11 +18,14 @@ package environments
 
 import (
 	"github.com/pufferpanel/pufferpanel/v2"
+	"github.com/pufferpanel/pufferpanel/v2/environments/docker"
 	"github.com/pufferpanel/pufferpanel/v2/environments/tty"
 )
 
 func loadAdditionalModules(mapping map[string]pufferpanel.EnvironmentFactory) {
 	mapping["standard"] = tty.EnvironmentFactory{}
 	mapping["tty"] = tty.EnvironmentFactory{}
+	mapping["podman"] = docker.PodmanEnvironmentFactory{}
+	mapping["sandbox"] = tty.SandboxEnvironmentFactory{}
 	//mapping["lxd"] = lxd.EnvironmentFactory{}
 }
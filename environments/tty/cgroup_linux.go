@@ -0,0 +1,195 @@
+/*
+ Copyright 2023 Padduck, LLC
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+  	http://www.apache.org/licenses/LICENSE-2.0
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+*/
+
+package tty
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const cgroupRoot = "/sys/fs/cgroup"
+
+// the limits a sandbox can have, if the host has them
+var cgroupControllers = []string{"memory", "cpu", "pids"}
+
+var cgroupBase string
+var cgroupErr error
+var cgroupOnce sync.Once
+
+// prepareCgroups finds where the cgroups for servers go, which is under the daemon's own. A cgroup can only hand its
+// controllers down when it has no processes of its own, so the daemon moves itself into a group of its own if needed
+func prepareCgroups() (string, error) {
+	cgroupOnce.Do(func() {
+		data, err := os.ReadFile("/proc/self/cgroup")
+		if err != nil {
+			cgroupErr = err
+			return
+		}
+
+		var path string
+		for _, line := range strings.Split(string(data), "\n") {
+			if strings.HasPrefix(line, "0::") {
+				path = strings.TrimPrefix(line, "0::")
+			}
+		}
+		//hosts with both versions of cgroups have the second mounted elsewhere, which is left alone
+		if _, err = os.Stat(filepath.Join(cgroupRoot, "cgroup.controllers")); path == "" || err != nil {
+			cgroupErr = errors.New("cgroup v2 is not available")
+			return
+		}
+
+		base := filepath.Join(cgroupRoot, path)
+		err = enableControllers(base)
+		if errors.Is(err, syscall.EBUSY) {
+			leaf := filepath.Join(base, "daemon")
+			if err = os.Mkdir(leaf, 0755); err != nil && !os.IsExist(err) {
+				cgroupErr = err
+				return
+			}
+			if err = writeCgroupFile(leaf, "cgroup.procs", strconv.Itoa(os.Getpid())); err != nil {
+				cgroupErr = err
+				return
+			}
+			err = enableControllers(base)
+		}
+
+		cgroupBase, cgroupErr = base, err
+	})
+	return cgroupBase, cgroupErr
+}
+
+func enableControllers(base string) error {
+	data, err := os.ReadFile(filepath.Join(base, "cgroup.controllers"))
+	if err != nil {
+		return err
+	}
+	available := strings.Fields(string(data))
+
+	for _, controller := range cgroupControllers {
+		for _, v := range available {
+			if v != controller {
+				continue
+			}
+			if err = writeCgroupFile(base, "cgroup.subtree_control", "+"+controller); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// createServerCgroup makes the cgroup a sandboxed server runs in, with its limits applied
+func createServerCgroup(serverId string, resources Resources) (string, error) {
+	base, err := prepareCgroups()
+	if err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(base, cgroupName(serverId))
+	if err = os.Mkdir(path, 0755); err != nil && !os.IsExist(err) {
+		return "", err
+	}
+
+	limits := map[string]string{"memory.max": "max", "cpu.max": "max", "pids.max": "max"}
+	if resources.Memory > 0 {
+		limits["memory.max"] = strconv.FormatInt(resources.Memory*1024*1024, 10)
+	}
+	if resources.Cpu > 0 {
+		limits["cpu.max"] = fmt.Sprintf("%d 100000", resources.Cpu*1000)
+	}
+	if resources.Pids > 0 {
+		limits["pids.max"] = strconv.FormatInt(resources.Pids, 10)
+	}
+
+	for file, value := range limits {
+		//a controller the host does not have has no files, and so no limit to set
+		if _, err = os.Stat(filepath.Join(path, file)); os.IsNotExist(err) {
+			continue
+		}
+		if err = writeCgroupFile(path, file, value); err != nil {
+			return "", err
+		}
+	}
+	return path, nil
+}
+
+// serverCgroup is the cgroup of a server that was left running, if it has one
+func (t *tty) serverCgroup() string {
+	base, err := prepareCgroups()
+	if err != nil {
+		return ""
+	}
+	path := filepath.Join(base, cgroupName(t.ServerId))
+	if _, err = os.Stat(path); err != nil {
+		return ""
+	}
+	return path
+}
+
+func cgroupName(serverId string) string {
+	return "server-" + serverId
+}
+
+// cgroupStats reads how much memory a cgroup is using, and how much of a core it used over the next second
+func cgroupStats(path string) (memory float64, cpu float64, err error) {
+	data, err := os.ReadFile(filepath.Join(path, "memory.current"))
+	if err != nil {
+		return
+	}
+	memory, err = strconv.ParseFloat(strings.TrimSpace(string(data)), 64)
+	if err != nil {
+		return
+	}
+
+	before, err := cgroupCpuUsage(path)
+	if err != nil {
+		return
+	}
+	time.Sleep(time.Second)
+	after, err := cgroupCpuUsage(path)
+	if err != nil {
+		return
+	}
+	cpu = float64(after-before) / float64(time.Second/time.Microsecond) * 100
+	return
+}
+
+func cgroupCpuUsage(path string) (int64, error) {
+	data, err := os.ReadFile(filepath.Join(path, "cpu.stat"))
+	if err != nil {
+		return 0, err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && fields[0] == "usage_usec" {
+			return strconv.ParseInt(fields[1], 10, 64)
+		}
+	}
+	return 0, errors.New("no cpu usage in cgroup")
+}
+
+func joinCgroup(path string, pid int) error {
+	return writeCgroupFile(path, "cgroup.procs", strconv.Itoa(pid))
+}
+
+func writeCgroupFile(path, file, value string) error {
+	return os.WriteFile(filepath.Join(path, file), []byte(value), 0644)
+}
@@ -0,0 +1,73 @@
+//go:build !windows
+// +build !windows
+
+/*
+ Copyright 2023 Padduck, LLC
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+  	http://www.apache.org/licenses/LICENSE-2.0
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+*/
+
+package tty
+
+import (
+	"github.com/pufferpanel/pufferpanel/v2"
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+// watchHealth starts the server's health check. A command is run in the server's folder the same way as the server
+// itself, so it is in the same sandbox and resource limits
+func (t *tty) watchHealth(steps pufferpanel.ExecutionData) {
+	check := steps.HealthCheck
+	if check == nil {
+		return
+	}
+
+	var probe func() error
+	switch check.Type {
+	case "command":
+		probe = func() error {
+			name, args := pufferpanel.SplitArguments(check.Command)
+			cmd := t.command(steps, name, args)
+			if wrap := t.commandWrapper(); wrap != nil {
+				wrapped, err := wrap(cmd, steps.WorkingDirectory)
+				if err != nil {
+					return err
+				}
+				cmd = wrapped
+			}
+			return runWithTimeout(cmd, check.TimeoutDuration())
+		}
+	case "tcp", "udp":
+		probe = func() error {
+			return pufferpanel.ProbePort(check.Type, check.Address, check.Payload, check.TimeoutDuration())
+		}
+	default:
+		return
+	}
+
+	t.WatchHealth(check.IntervalDuration(), pufferpanel.ProbeHealth(check, probe), steps.HealthCallback)
+}
+
+// runWithTimeout runs the command, killing it and anything it started if it takes too long
+func runWithTimeout(cmd *exec.Cmd, timeout time.Duration) error {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	err := cmd.Start()
+	if err != nil {
+		return err
+	}
+
+	timer := time.AfterFunc(timeout, func() {
+		_ = syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	})
+	defer timer.Stop()
+	return cmd.Wait()
+}
@@ -0,0 +1,39 @@
+//go:build !windows
+// +build !windows
+
+/*
+ Copyright 2023 Padduck, LLC
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+  	http://www.apache.org/licenses/LICENSE-2.0
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+*/
+
+package tty
+
+// Resources limit what a server can use. Memory, Cpu and Pids are enforced by a cgroup where the daemon has one
+// delegated to it, otherwise only Memory is, as a limit on the data segment
+type Resources struct {
+	//Memory is the most memory the server can use, in MB
+	Memory int64 `json:"memory,omitempty"`
+	//Cpu is how much cpu time the server can use, as a percent of a core
+	Cpu int64 `json:"cpu,omitempty"`
+	//Pids is how many processes the server can run
+	Pids int64 `json:"pids,omitempty"`
+	//Nice is the priority of the server, from -20 to 19 with higher being nicer to other processes
+	Nice int `json:"nice,omitempty"`
+	//IOPriority is the disk priority of the server, from 0 to 7 with 7 being the lowest
+	IOPriority *int `json:"ioPriority,omitempty"`
+	//CpuSet is the cpus the server can run on, such as 0-3,6
+	CpuSet string `json:"cpuSet,omitempty"`
+}
+
+// IsSet is if any limit is given
+func (r Resources) IsSet() bool {
+	return r.Memory > 0 || r.Cpu > 0 || r.Pids > 0 || r.Nice != 0 || r.IOPriority != nil || r.CpuSet != ""
+}
@@ -0,0 +1,247 @@
+/*
+ Copyright 2023 Padduck, LLC
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+  	http://www.apache.org/licenses/LICENSE-2.0
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+*/
+
+package tty
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/pufferpanel/pufferpanel/v2"
+	"github.com/pufferpanel/pufferpanel/v2/logging"
+	"golang.org/x/sys/unix"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// values for ioprio_get and ioprio_set, which have no wrapper
+const (
+	ioprioWhoProcess = 1
+	ioprioClassBE    = 2
+	ioprioClassShift = 13
+)
+
+// prepareCgroup makes the server's cgroup before its process starts. Without one, a sandbox runs without limits and
+// anything else falls back to rlimits
+func (t *tty) prepareCgroup() {
+	var err error
+	t.cgroup, err = createServerCgroup(t.ServerId, t.Resources)
+	if err == nil {
+		return
+	}
+	if t.sandboxed {
+		t.Log(logging.Error, "Cannot limit resources of sandbox, running without limits: %s", err)
+	} else {
+		t.Log(logging.Error, "Cannot limit resources with a cgroup, falling back to rlimits: %s", err)
+	}
+}
+
+// limitCommand wraps the command so that it runs with the server's resource limits, through the daemon's limit command
+func (t *tty) limitCommand(pr *exec.Cmd, _ string) (*exec.Cmd, error) {
+	data, err := json.Marshal(t.Resources)
+	if err != nil {
+		return nil, err
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+
+	args := []string{"limit", "--resources", string(data)}
+	if t.cgroup != "" {
+		args = append(args, "--cgroup", t.cgroup)
+	}
+	args = append(append(args, "--"), pr.Args...)
+
+	cmd := exec.Command(executable, args...)
+	cmd.Dir = pr.Dir
+	cmd.Env = pr.Env
+	return cmd, nil
+}
+
+// resourceLimits reads back the limits the server is running with, if it was given any
+func (t *tty) resourceLimits() *pufferpanel.ResourceLimits {
+	if !t.sandboxed && !t.Resources.IsSet() {
+		return nil
+	}
+
+	limits := &pufferpanel.ResourceLimits{Enforcement: "rlimit"}
+	pid := t.pid()
+
+	if t.cgroup != "" {
+		limits.Enforcement = "cgroup"
+		limits.Memory = readCgroupLimit(t.cgroup, "memory.max")
+		limits.Pids = readCgroupLimit(t.cgroup, "pids.max")
+		if data, err := os.ReadFile(filepath.Join(t.cgroup, "cpu.max")); err == nil {
+			fields := strings.Fields(string(data))
+			if len(fields) == 2 && fields[0] != "max" {
+				quota, _ := strconv.ParseInt(fields[0], 10, 64)
+				period, _ := strconv.ParseInt(fields[1], 10, 64)
+				if period > 0 {
+					limits.Cpu = quota * 100 / period
+				}
+			}
+		}
+	} else {
+		var rlimit unix.Rlimit
+		if err := unix.Prlimit(pid, unix.RLIMIT_DATA, nil, &rlimit); err == nil && rlimit.Cur != unix.RLIM_INFINITY {
+			limits.Memory = int64(rlimit.Cur)
+		}
+		//there is no rlimit for these which only counts the server
+		if t.Resources.Cpu > 0 {
+			limits.NotEnforced = append(limits.NotEnforced, "cpu")
+		}
+		if t.Resources.Pids > 0 {
+			limits.NotEnforced = append(limits.NotEnforced, "pids")
+		}
+	}
+
+	//the kernel gives priority as 20 less the nice value
+	if priority, err := unix.Getpriority(unix.PRIO_PROCESS, pid); err == nil {
+		limits.Nice = 20 - priority
+	}
+
+	if value, _, errno := syscall.Syscall(unix.SYS_IOPRIO_GET, ioprioWhoProcess, uintptr(pid), 0); errno == 0 {
+		if int(value)>>ioprioClassShift == ioprioClassBE {
+			level := int(value) & 0xff
+			limits.IOPriority = &level
+		}
+	}
+
+	var set unix.CPUSet
+	if err := unix.SchedGetaffinity(pid, &set); err == nil {
+		limits.CpuSet = formatCpuSet(set)
+	}
+	return limits
+}
+
+// RunLimited applies the resource limits to this process, then replaces it with the server, which keeps them
+func RunLimited(resourcesJson, cgroup string, args []string) error {
+	var resources Resources
+	if err := json.Unmarshal([]byte(resourcesJson), &resources); err != nil {
+		return err
+	}
+
+	//priority and affinity are set on a thread, so the server has to be started from the same one
+	runtime.LockOSThread()
+
+	if err := applyResources(resources, cgroup); err != nil {
+		return err
+	}
+
+	path, err := exec.LookPath(args[0])
+	if err != nil {
+		return err
+	}
+	return syscall.Exec(path, args, os.Environ())
+}
+
+// applyResources limits this thread, and anything it starts. Memory is limited with rlimits if there is no cgroup
+func applyResources(resources Resources, cgroup string) error {
+	if cgroup != "" {
+		if err := joinCgroup(cgroup, os.Getpid()); err != nil {
+			return err
+		}
+	} else if resources.Memory > 0 {
+		//the data segment rather than address space, which runtimes such as the jvm reserve far more of than they use
+		limit := uint64(resources.Memory) * 1024 * 1024
+		if err := unix.Setrlimit(unix.RLIMIT_DATA, &unix.Rlimit{Cur: limit, Max: limit}); err != nil {
+			return err
+		}
+	}
+
+	if resources.Nice != 0 {
+		if err := unix.Setpriority(unix.PRIO_PROCESS, 0, resources.Nice); err != nil {
+			return err
+		}
+	}
+
+	if resources.IOPriority != nil {
+		level := *resources.IOPriority
+		if level < 0 || level > 7 {
+			return errors.New("io priority must be from 0 to 7")
+		}
+		value := ioprioClassBE<<ioprioClassShift | level
+		if _, _, errno := syscall.Syscall(unix.SYS_IOPRIO_SET, ioprioWhoProcess, 0, uintptr(value)); errno != 0 {
+			return errno
+		}
+	}
+
+	if resources.CpuSet != "" {
+		set, err := parseCpuSet(resources.CpuSet)
+		if err != nil {
+			return err
+		}
+		if err = unix.SchedSetaffinity(0, &set); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readCgroupLimit(path, file string) int64 {
+	data, err := os.ReadFile(filepath.Join(path, file))
+	if err != nil {
+		return 0
+	}
+	value, _ := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+	return value
+}
+
+// parseCpuSet reads a list of cpus the way the kernel writes them, such as 0-3,6
+func parseCpuSet(list string) (unix.CPUSet, error) {
+	var set unix.CPUSet
+	for _, part := range strings.Split(list, ",") {
+		bounds := strings.SplitN(strings.TrimSpace(part), "-", 2)
+		first, err := strconv.Atoi(bounds[0])
+		if err != nil {
+			return set, fmt.Errorf("invalid cpu set %s", list)
+		}
+		last := first
+		if len(bounds) == 2 {
+			if last, err = strconv.Atoi(bounds[1]); err != nil || last < first {
+				return set, fmt.Errorf("invalid cpu set %s", list)
+			}
+		}
+		for cpu := first; cpu <= last; cpu++ {
+			set.Set(cpu)
+		}
+	}
+	return set, nil
+}
+
+func formatCpuSet(set unix.CPUSet) string {
+	var parts []string
+	for cpu := 0; cpu < len(set)*64; cpu++ {
+		if !set.IsSet(cpu) {
+			continue
+		}
+		last := cpu
+		for last+1 < len(set)*64 && set.IsSet(last+1) {
+			last++
+		}
+		if last == cpu {
+			parts = append(parts, strconv.Itoa(cpu))
+		} else {
+			parts = append(parts, fmt.Sprintf("%d-%d", cpu, last))
+		}
+		cpu = last
+	}
+	return strings.Join(parts, ",")
+}
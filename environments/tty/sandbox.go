@@ -0,0 +1,46 @@
+//go:build !windows
+// +build !windows
+
+/*
+ Copyright 2023 Padduck, LLC
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+  	http://www.apache.org/licenses/LICENSE-2.0
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+*/
+
+package tty
+
+// SandboxOptions are the settings of a sandbox environment
+type SandboxOptions struct {
+	//IsolateNetwork gives the server a network of its own, with only loopback
+	IsolateNetwork bool `json:"isolateNetwork,omitempty"`
+	//Bindings are host paths to make available in the sandbox, writable, with where they go in the sandbox
+	Bindings map[string]string `json:"bindings,omitempty"`
+}
+
+// sandboxSpec is what the daemon passes on to the sandbox command
+type sandboxSpec struct {
+	Root           string            `json:"root"`
+	Dir            string            `json:"dir"`
+	ReadOnly       []string          `json:"readOnly"`
+	Bindings       map[string]string `json:"bindings,omitempty"`
+	IsolateNetwork bool              `json:"isolateNetwork,omitempty"`
+	Cgroup         string            `json:"cgroup,omitempty"`
+	Resources      Resources         `json:"resources"`
+	NewRoot        string            `json:"newRoot,omitempty"`
+}
+
+// host paths a sandboxed server can read, which is what is needed to run most programs. Only the parts of /etc needed
+// to resolve names, trust certificates and look up users are included, the rest may hold secrets such as the daemon's
+// own config
+var sandboxSystemPaths = []string{
+	"/bin", "/sbin", "/lib", "/lib32", "/lib64", "/libx32", "/usr", "/opt",
+	"/etc/ssl", "/etc/ca-certificates", "/etc/resolv.conf", "/etc/hosts", "/etc/nsswitch.conf",
+	"/etc/passwd", "/etc/group", "/etc/ld.so.cache", "/etc/localtime",
+}
@@ -0,0 +1,200 @@
+/*
+ Copyright 2023 Padduck, LLC
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+  	http://www.apache.org/licenses/LICENSE-2.0
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+*/
+
+package tty
+
+import (
+	"encoding/json"
+	"github.com/pufferpanel/pufferpanel/v2"
+	"github.com/pufferpanel/pufferpanel/v2/config"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// signals passed on to the server by each stage of the sandbox
+var sandboxSignals = []os.Signal{syscall.SIGHUP, syscall.SIGINT, syscall.SIGQUIT, syscall.SIGTERM, syscall.SIGUSR1, syscall.SIGUSR2}
+
+// sandboxCommand wraps the command so that it runs in the sandbox, through the daemon's sandbox command
+func (t *tty) sandboxCommand(pr *exec.Cmd, workingDirectory string) (*exec.Cmd, error) {
+	root, err := filepath.Abs(t.RootDirectory)
+	if err != nil {
+		return nil, err
+	}
+	//the server's files are at the same path in the sandbox, so the command and its arguments do not change
+	root, err = filepath.EvalSymlinks(root)
+	if err != nil {
+		return nil, err
+	}
+
+	spec := sandboxSpec{
+		Root:           root,
+		Dir:            filepath.Join(root, workingDirectory),
+		ReadOnly:       append([]string{}, sandboxSystemPaths...),
+		Bindings:       t.Bindings,
+		IsolateNetwork: t.IsolateNetwork,
+		Resources:      t.Resources,
+	}
+	if binaries, err := filepath.Abs(config.BinariesFolder.Value()); err == nil {
+		spec.ReadOnly = append(spec.ReadOnly, binaries)
+	}
+	if err = checkDaemonHidden(spec.ReadOnly, spec.Bindings); err != nil {
+		return nil, err
+	}
+
+	spec.Cgroup = t.cgroup
+
+	data, err := json.Marshal(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := exec.Command(executable, append([]string{"sandbox", "--spec", string(data), "--"}, pr.Args...)...)
+	cmd.Dir = spec.Dir
+	cmd.Env = append(pr.Env, "HOME="+root)
+	return cmd, nil
+}
+
+// checkDaemonHidden refuses a sandbox which could read the daemon's config or working directory, which hold its
+// secrets and database. Paths bound writable are checked as well, as they can be read too
+func checkDaemonHidden(readOnly []string, bindings map[string]string) error {
+	exposed := append([]string{}, readOnly...)
+	for source := range bindings {
+		exposed = append(exposed, source)
+	}
+
+	daemonPaths := make([]string, 0, 2)
+	if file := config.ConfigFile(); file != "" {
+		daemonPaths = append(daemonPaths, filepath.Dir(file))
+	}
+	if wd, err := os.Getwd(); err == nil {
+		daemonPaths = append(daemonPaths, wd)
+	}
+
+	for _, daemonPath := range daemonPaths {
+		daemonPath = resolvePath(daemonPath)
+		for _, v := range exposed {
+			if isWithin(daemonPath, resolvePath(v)) {
+				return pufferpanel.ErrSandboxExposesDaemon(daemonPath)
+			}
+		}
+	}
+	return nil
+}
+
+// resolvePath is the absolute path with any links followed, as far as it exists
+func resolvePath(path string) string {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		return resolved
+	}
+	return path
+}
+
+func isWithin(path, parent string) bool {
+	rel, err := filepath.Rel(parent, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// sandboxStats are the stats of everything in the sandbox's cgroup, as the process the daemon started only waits on it
+func (t *tty) sandboxStats() (*pufferpanel.ServerStats, bool) {
+	if t.cgroup == "" {
+		return nil, false
+	}
+
+	memory, cpu, err := cgroupStats(t.cgroup)
+	if err != nil {
+		return nil, false
+	}
+	return &pufferpanel.ServerStats{Cpu: cpu, Memory: memory, Limits: t.resourceLimits()}, true
+}
+
+// RunSandbox joins the server's cgroup, then starts the server in new namespaces through RunSandboxInit. The code the
+// server exits with is returned
+func RunSandbox(specJson string, args []string) (int, error) {
+	var spec sandboxSpec
+	if err := json.Unmarshal([]byte(specJson), &spec); err != nil {
+		return 1, err
+	}
+
+	if spec.Cgroup != "" {
+		if err := joinCgroup(spec.Cgroup, os.Getpid()); err != nil {
+			return 1, err
+		}
+	}
+
+	//only holds the sandbox's root, which is a tmpfs that only the sandbox can see
+	newRoot, err := os.MkdirTemp("", "pufferpanel-sandbox-")
+	if err != nil {
+		return 1, err
+	}
+	defer os.Remove(newRoot)
+	spec.NewRoot = newRoot
+
+	data, err := json.Marshal(spec)
+	if err != nil {
+		return 1, err
+	}
+
+	flags := syscall.CLONE_NEWUSER | syscall.CLONE_NEWNS | syscall.CLONE_NEWPID | syscall.CLONE_NEWIPC
+	if spec.IsolateNetwork {
+		flags |= syscall.CLONE_NEWNET
+	}
+
+	init := exec.Command("/proc/self/exe", append([]string{"sandbox", "--init", "--spec", string(data), "--"}, args...)...)
+	init.Stdin, init.Stdout, init.Stderr = os.Stdin, os.Stdout, os.Stderr
+	init.SysProcAttr = &syscall.SysProcAttr{
+		Cloneflags: uintptr(flags),
+		//the server keeps the daemon's user, so the files it writes stay owned by it
+		UidMappings:                []syscall.SysProcIDMap{{ContainerID: os.Getuid(), HostID: os.Getuid(), Size: 1}},
+		GidMappings:                []syscall.SysProcIDMap{{ContainerID: os.Getgid(), HostID: os.Getgid(), Size: 1}},
+		GidMappingsEnableSetgroups: false,
+		//everything in the sandbox goes if this does, so killing it kills the server
+		Pdeathsig: syscall.SIGKILL,
+	}
+
+	if err = init.Start(); err != nil {
+		return 1, err
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, sandboxSignals...)
+	go func() {
+		for sig := range signals {
+			_ = init.Process.Signal(sig)
+		}
+	}()
+
+	_ = init.Wait()
+	signal.Stop(signals)
+	return exitCode(init.ProcessState.Sys().(syscall.WaitStatus)), nil
+}
+
+// exitCode is what a shell would say a process exited with
+func exitCode(status syscall.WaitStatus) int {
+	if status.Signaled() {
+		return 128 + int(status.Signal())
+	}
+	return status.ExitStatus()
+}
@@ -0,0 +1,39 @@
+//go:build linux
+// +build linux
+
+package tty
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_checkDaemonHidden(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Getwd() error = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		readOnly []string
+		bindings map[string]string
+		wantErr  bool
+	}{
+		{name: "system paths", readOnly: []string{"/bin", "/etc/ssl", "/etc/passwd"}, wantErr: false},
+		{name: "working directory", readOnly: []string{wd}, wantErr: true},
+		{name: "above working directory", readOnly: []string{filepath.Dir(wd)}, wantErr: true},
+		{name: "beside working directory", readOnly: []string{wd + "-other"}, wantErr: false},
+		{name: "bound elsewhere", bindings: map[string]string{"/tmp": "/data"}, wantErr: false},
+		{name: "working directory bound", bindings: map[string]string{wd: "/data"}, wantErr: true},
+		{name: "above working directory bound", bindings: map[string]string{filepath.Dir(wd): "/data"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := checkDaemonHidden(tt.readOnly, tt.bindings); (err != nil) != tt.wantErr {
+				t.Errorf("checkDaemonHidden() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
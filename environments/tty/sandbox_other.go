@@ -0,0 +1,46 @@
+//go:build !windows && !linux
+// +build !windows,!linux
+
+/*
+ Copyright 2023 Padduck, LLC
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+  	http://www.apache.org/licenses/LICENSE-2.0
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+*/
+
+package tty
+
+import (
+	"errors"
+	"github.com/pufferpanel/pufferpanel/v2"
+	"os/exec"
+)
+
+func (t *tty) sandboxCommand(pr *exec.Cmd, workingDirectory string) (*exec.Cmd, error) {
+	return nil, errors.New("sandbox is only supported on linux")
+}
+
+func (t *tty) limitCommand(pr *exec.Cmd, workingDirectory string) (*exec.Cmd, error) {
+	return nil, errors.New("resource limits are only supported on linux")
+}
+
+func (t *tty) prepareCgroup() {
+}
+
+func (t *tty) serverCgroup() string {
+	return ""
+}
+
+func (t *tty) resourceLimits() *pufferpanel.ResourceLimits {
+	return nil
+}
+
+func (t *tty) sandboxStats() (*pufferpanel.ServerStats, bool) {
+	return nil, false
+}
@@ -0,0 +1,35 @@
+/*
+ Copyright 2023 Padduck, LLC
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+  	http://www.apache.org/licenses/LICENSE-2.0
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+*/
+
+package tty
+
+import (
+	"github.com/pufferpanel/pufferpanel/v2"
+)
+
+// SandboxEnvironmentFactory creates tty environments which run the server isolated from the host, using namespaces
+// and cgroups rather than a container runtime
+type SandboxEnvironmentFactory struct {
+	pufferpanel.EnvironmentFactory
+}
+
+func (ef SandboxEnvironmentFactory) Create(id string) pufferpanel.Environment {
+	t := EnvironmentFactory{}.Create(id).(*tty)
+	t.Type = "sandbox"
+	t.sandboxed = true
+	return t
+}
+
+func (ef SandboxEnvironmentFactory) Key() string {
+	return "sandbox"
+}
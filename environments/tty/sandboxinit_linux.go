@@ -0,0 +1,307 @@
+/*
+ Copyright 2023 Padduck, LLC
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+  	http://www.apache.org/licenses/LICENSE-2.0
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+*/
+
+package tty
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"unsafe"
+)
+
+// flags of a mount which a user namespace cannot change, and so have to be kept when remounting it read only
+const (
+	stNoSuid     = 0x2
+	stNoDev      = 0x4
+	stNoExec     = 0x8
+	stNoAtime    = 0x400
+	stNoDirAtime = 0x800
+	stRelAtime   = 0x1000
+)
+
+// devices a sandboxed server can use
+var sandboxDevices = []string{"/dev/null", "/dev/zero", "/dev/full", "/dev/random", "/dev/urandom", "/dev/tty"}
+
+// RunSandboxInit builds the sandbox's filesystem and runs the server in it. This is the first process in the
+// sandbox, so it also reaps anything the server leaves behind. The code the server exits with is returned
+func RunSandboxInit(specJson string, args []string) (int, error) {
+	var spec sandboxSpec
+	if err := json.Unmarshal([]byte(specJson), &spec); err != nil {
+		return 1, err
+	}
+
+	if err := buildSandboxRoot(spec); err != nil {
+		return 1, err
+	}
+
+	if spec.IsolateNetwork {
+		if err := loopbackUp(); err != nil {
+			return 1, err
+		}
+	}
+
+	if err := os.Chdir(spec.Dir); err != nil {
+		return 1, err
+	}
+
+	//the rest of the limits are applied by the limit command, as this process cannot run under them itself
+	resources := spec.Resources
+	if spec.Cgroup != "" {
+		resources.Memory, resources.Cpu, resources.Pids = 0, 0, 0
+	}
+	if resources.IsSet() {
+		data, err := json.Marshal(resources)
+		if err != nil {
+			return 1, err
+		}
+		args = append([]string{"/proc/self/exe", "limit", "--resources", string(data), "--"}, args...)
+	}
+
+	path, err := exec.LookPath(args[0])
+	if err != nil {
+		return 1, err
+	}
+
+	server, err := os.StartProcess(path, args, &os.ProcAttr{
+		Dir:   spec.Dir,
+		Env:   os.Environ(),
+		Files: []*os.File{os.Stdin, os.Stdout, os.Stderr},
+	})
+	if err != nil {
+		return 1, err
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, sandboxSignals...)
+	go func() {
+		for sig := range signals {
+			_ = server.Signal(sig)
+		}
+	}()
+
+	for {
+		var status syscall.WaitStatus
+		pid, err := syscall.Wait4(-1, &status, 0, nil)
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil {
+			return 1, err
+		}
+		if pid == server.Pid {
+			return exitCode(status), nil
+		}
+	}
+}
+
+// buildSandboxRoot makes a root for the sandbox on a tmpfs, with the system paths read only and the server's own
+// writable, then switches to it
+func buildSandboxRoot(spec sandboxSpec) error {
+	//nothing mounted from here on is seen outside the sandbox
+	if err := syscall.Mount("", "/", "", syscall.MS_REC|syscall.MS_PRIVATE, ""); err != nil {
+		return err
+	}
+
+	root := spec.NewRoot
+	if err := syscall.Mount("tmpfs", root, "tmpfs", syscall.MS_NOSUID|syscall.MS_NODEV, "mode=0755"); err != nil {
+		return err
+	}
+
+	for _, v := range spec.ReadOnly {
+		if err := bindIntoSandbox(root, v, v, true); err != nil {
+			return err
+		}
+	}
+
+	if err := mountInSandbox(root, "/proc", "proc", syscall.MS_NOSUID|syscall.MS_NODEV|syscall.MS_NOEXEC, ""); err != nil {
+		return err
+	}
+	if err := mountInSandbox(root, "/tmp", "tmpfs", syscall.MS_NOSUID|syscall.MS_NODEV, "mode=1777"); err != nil {
+		return err
+	}
+	if err := buildSandboxDev(root); err != nil {
+		return err
+	}
+
+	//bound last, so the server's files are not hidden by anything mounted above them
+	if err := bindIntoSandbox(root, spec.Root, spec.Root, false); err != nil {
+		return err
+	}
+	for source, target := range spec.Bindings {
+		if err := bindIntoSandbox(root, source, target, false); err != nil {
+			return err
+		}
+	}
+
+	oldRoot := filepath.Join(root, ".oldroot")
+	if err := os.Mkdir(oldRoot, 0700); err != nil {
+		return err
+	}
+	if err := syscall.PivotRoot(root, oldRoot); err != nil {
+		return err
+	}
+	if err := os.Chdir("/"); err != nil {
+		return err
+	}
+	if err := syscall.Unmount("/.oldroot", syscall.MNT_DETACH); err != nil {
+		return err
+	}
+	if err := os.Remove("/.oldroot"); err != nil {
+		return err
+	}
+
+	//what is not mounted into the root cannot be written to either
+	return syscall.Mount("", "/", "", syscall.MS_REMOUNT|syscall.MS_RDONLY|syscall.MS_NOSUID|syscall.MS_NODEV, "")
+}
+
+func buildSandboxDev(root string) error {
+	if err := mountInSandbox(root, "/dev", "tmpfs", syscall.MS_NOSUID|syscall.MS_NOEXEC, "mode=0755"); err != nil {
+		return err
+	}
+	for _, v := range sandboxDevices {
+		if err := bindIntoSandbox(root, v, v, false); err != nil {
+			return err
+		}
+	}
+	if err := mountInSandbox(root, "/dev/shm", "tmpfs", syscall.MS_NOSUID|syscall.MS_NODEV, "mode=1777"); err != nil {
+		return err
+	}
+
+	links := map[string]string{
+		"/dev/fd":     "/proc/self/fd",
+		"/dev/stdin":  "/proc/self/fd/0",
+		"/dev/stdout": "/proc/self/fd/1",
+		"/dev/stderr": "/proc/self/fd/2",
+	}
+	for link, target := range links {
+		if err := os.Symlink(target, filepath.Join(root, link)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func mountInSandbox(root, target, fsType string, flags uintptr, data string) error {
+	dest := filepath.Join(root, target)
+	if err := os.MkdirAll(dest, 0755); err != nil {
+		return err
+	}
+	return syscall.Mount(fsType, dest, fsType, flags, data)
+}
+
+// bindIntoSandbox makes a host path available in the sandbox. Paths the host does not have are skipped, and links
+// to folders are copied as they are, as the paths they point to are bound on their own. Links to files, such as
+// /etc/resolv.conf, often point somewhere which is not, so the file itself is bound
+func bindIntoSandbox(root, source, target string, readOnly bool) error {
+	info, err := os.Lstat(source)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if info.Mode()&os.ModeSymlink != 0 {
+		if resolved, err := filepath.EvalSymlinks(source); err == nil {
+			if stat, err := os.Stat(resolved); err == nil && !stat.IsDir() {
+				source, info = resolved, stat
+			}
+		}
+	}
+
+	dest := filepath.Join(root, target)
+	if err = os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+
+	if info.Mode()&os.ModeSymlink != 0 {
+		link, err := os.Readlink(source)
+		if err != nil {
+			return err
+		}
+		return os.Symlink(link, dest)
+	}
+
+	if info.IsDir() {
+		err = os.MkdirAll(dest, 0755)
+	} else {
+		var file *os.File
+		file, err = os.OpenFile(dest, os.O_CREATE|os.O_WRONLY, 0644)
+		if err == nil {
+			err = file.Close()
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	if err = syscall.Mount(source, dest, "", syscall.MS_BIND|syscall.MS_REC, ""); err != nil {
+		return err
+	}
+	if !readOnly {
+		return nil
+	}
+
+	var stat syscall.Statfs_t
+	if err = syscall.Statfs(dest, &stat); err != nil {
+		return err
+	}
+	return syscall.Mount("", dest, "", syscall.MS_BIND|syscall.MS_REMOUNT|syscall.MS_RDONLY|lockedMountFlags(stat.Flags), "")
+}
+
+func lockedMountFlags(statFlags int64) uintptr {
+	var flags uintptr
+	mapping := map[int64]uintptr{
+		stNoSuid:     syscall.MS_NOSUID,
+		stNoDev:      syscall.MS_NODEV,
+		stNoExec:     syscall.MS_NOEXEC,
+		stNoAtime:    syscall.MS_NOATIME,
+		stNoDirAtime: syscall.MS_NODIRATIME,
+		stRelAtime:   syscall.MS_RELATIME,
+	}
+	for st, ms := range mapping {
+		if statFlags&st != 0 {
+			flags |= ms
+		}
+	}
+	return flags
+}
+
+// loopbackUp brings up the loopback interface, which is all a sandbox with its own network has
+func loopbackUp() error {
+	fd, err := syscall.Socket(syscall.AF_INET, syscall.SOCK_DGRAM, 0)
+	if err != nil {
+		return err
+	}
+	defer syscall.Close(fd)
+
+	var req struct {
+		name  [syscall.IFNAMSIZ]byte
+		flags uint16
+		_     [22]byte
+	}
+	copy(req.name[:], "lo")
+
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), syscall.SIOCGIFFLAGS, uintptr(unsafe.Pointer(&req))); errno != 0 {
+		return errno
+	}
+	req.flags |= syscall.IFF_UP
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), syscall.SIOCSIFFLAGS, uintptr(unsafe.Pointer(&req))); errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,200 @@
+//go:build !windows
+// +build !windows
+
+/*
+ Copyright 2023 Padduck, LLC
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+  	http://www.apache.org/licenses/LICENSE-2.0
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+*/
+
+package tty
+
+import (
+	"encoding/json"
+	"github.com/creack/pty"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// how much output a shim keeps for a daemon that connects later
+const shimBacklogSize = 64 * 1024
+
+// ShimState is what a shim saves about itself, so a daemon started later can find it again
+type ShimState struct {
+	Pid       int       `json:"pid"`
+	ChildPid  int       `json:"childPid"`
+	Socket    string    `json:"socket"`
+	StartedAt time.Time `json:"startedAt"`
+	Exited    bool      `json:"exited"`
+	ExitCode  int       `json:"exitCode"`
+	Error     string    `json:"error,omitempty"`
+}
+
+type shim struct {
+	ptmx    *os.File
+	client  net.Conn
+	backlog []byte
+	locker  sync.Mutex
+}
+
+// RunShim runs the command under a PTY it owns, so the process does not depend on the daemon that asked for it.
+// The console is served to one daemon at a time on the socket, and the state file says where to find it and how the
+// process exited
+func RunShim(socketPath, statePath string, command string, args []string) error {
+	//the daemon going away is not a reason to stop
+	signal.Ignore(syscall.SIGHUP)
+
+	_ = os.Remove(socketPath)
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return err
+	}
+	defer listener.Close()
+	_ = os.Chmod(socketPath, 0600)
+
+	state := &ShimState{Pid: os.Getpid(), Socket: socketPath, StartedAt: time.Now()}
+
+	pr := exec.Command(command, args...)
+	pr.SysProcAttr = &syscall.SysProcAttr{Setctty: true, Setsid: true}
+	ptmx, err := pty.Start(pr)
+	if err != nil {
+		state.Exited = true
+		state.ExitCode = -1
+		state.Error = err.Error()
+		_ = writeShimState(statePath, state)
+		return err
+	}
+
+	state.ChildPid = pr.Process.Pid
+	if err = writeShimState(statePath, state); err != nil {
+		_ = pr.Process.Kill()
+		return err
+	}
+
+	s := &shim{ptmx: ptmx}
+	go s.accept(listener)
+	pumped := make(chan struct{})
+	go func() {
+		s.pump()
+		close(pumped)
+	}()
+
+	//being told to stop is passed on, rather than leaving the process without a shim
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		for sig := range signals {
+			_ = pr.Process.Signal(sig)
+		}
+	}()
+
+	_ = pr.Wait()
+
+	//let the last of the output through before saying it has exited
+	select {
+	case <-pumped:
+	case <-time.After(time.Second):
+	}
+
+	state.Exited = true
+	state.ExitCode = pr.ProcessState.ExitCode()
+	err = writeShimState(statePath, state)
+	s.close()
+	return err
+}
+
+// accept takes connections from the daemon, a new one replaces the last
+func (s *shim) accept(listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+
+		s.locker.Lock()
+		if s.client != nil {
+			_ = s.client.Close()
+		}
+		_, _ = conn.Write(s.backlog)
+		s.client = conn
+		s.locker.Unlock()
+
+		go func(conn net.Conn) {
+			_, _ = io.Copy(s.ptmx, conn)
+		}(conn)
+	}
+}
+
+// pump sends what the process writes to the daemon, keeping the last of it for one that connects later
+func (s *shim) pump() {
+	buf := make([]byte, 4096)
+	for {
+		n, err := s.ptmx.Read(buf)
+		if n > 0 {
+			s.locker.Lock()
+			s.backlog = append(s.backlog, buf[:n]...)
+			if len(s.backlog) > shimBacklogSize {
+				s.backlog = s.backlog[len(s.backlog)-shimBacklogSize:]
+			}
+			if s.client != nil {
+				if _, e := s.client.Write(buf[:n]); e != nil {
+					_ = s.client.Close()
+					s.client = nil
+				}
+			}
+			s.locker.Unlock()
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (s *shim) close() {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+	if s.client != nil {
+		_ = s.client.Close()
+		s.client = nil
+	}
+	_ = s.ptmx.Close()
+}
+
+func readShimState(statePath string) (*ShimState, error) {
+	data, err := os.ReadFile(statePath)
+	if err != nil {
+		return nil, err
+	}
+	state := &ShimState{}
+	err = json.Unmarshal(data, state)
+	return state, err
+}
+
+// writeShimState replaces the state file in one go, so it is never read half written
+func writeShimState(statePath string, state *ShimState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	temp := filepath.Join(filepath.Dir(statePath), "."+filepath.Base(statePath))
+	err = os.WriteFile(temp, data, 0600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(temp, statePath)
+}
@@ -0,0 +1,217 @@
+//go:build !windows
+// +build !windows
+
+/*
+ Copyright 2023 Padduck, LLC
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+  	http://www.apache.org/licenses/LICENSE-2.0
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+*/
+
+package tty
+
+import (
+	"errors"
+	"github.com/pufferpanel/pufferpanel/v2"
+	"github.com/pufferpanel/pufferpanel/v2/config"
+	"github.com/pufferpanel/pufferpanel/v2/logging"
+	"github.com/pufferpanel/pufferpanel/v2/messages"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// how long a new shim has to start the process and be ready for the daemon
+const shimStartTimeout = 10 * time.Second
+
+// shimClient is the daemon's connection to the shim running a server
+type shimClient struct {
+	conn       net.Conn
+	state      *ShimState
+	socketPath string
+	statePath  string
+}
+
+// CanReattach is if the process running now is supervised, and so would keep running without the daemon
+func (t *tty) CanReattach() bool {
+	return t.shim != nil
+}
+
+// Reattach connects to the shim an earlier daemon left running this server, if it is still alive. A shim whose
+// process has exited is cleaned up, so the server can be started again
+func (t *tty) Reattach(steps pufferpanel.ExecutionData) (bool, error) {
+	socketPath, statePath, err := t.shimPaths()
+	if err != nil {
+		return false, err
+	}
+
+	state, err := readShimState(statePath)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil || state.Exited || !processAlive(state.Pid) {
+		removeShimFiles(socketPath, statePath)
+		return false, err
+	}
+
+	client, err := connectShim(socketPath, statePath, time.Second)
+	if err != nil {
+		return false, err
+	}
+
+	if t.sandboxed || t.Resources.IsSet() {
+		t.cgroup = t.serverCgroup()
+	}
+
+	//watched before attaching, so a process that exits straight away stops it
+	t.watchHealth(steps)
+
+	t.Wait.Add(1)
+	t.attachShim(client, t.CreateWrapper(), steps.Callback)
+	_ = t.WSManager.WriteMessage(messages.Status{Running: true})
+	t.DisplayToConsole(true, "Reattached to running process\n")
+	return true, nil
+}
+
+// startSupervised runs the command under a new shim, which is left to run on its own so the process outlives the daemon
+func (t *tty) startSupervised(pr *exec.Cmd, wrapper io.Writer, callback func(graceful bool)) error {
+	socketPath, statePath, err := t.shimPaths()
+	if err != nil {
+		return err
+	}
+	removeShimFiles(socketPath, statePath)
+
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	args := append([]string{"shim", "--socket", socketPath, "--state", statePath, "--", pr.Path}, pr.Args[1:]...)
+	shim := exec.Command(executable, args...)
+	shim.Dir = pr.Dir
+	shim.Env = pr.Env
+	shim.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	err = shim.Start()
+	if err != nil {
+		return err
+	}
+	//only reaps the shim if it exits while this daemon is still running
+	go func() {
+		_ = shim.Wait()
+	}()
+
+	client, err := connectShim(socketPath, statePath, shimStartTimeout)
+	if err != nil {
+		_ = shim.Process.Kill()
+		removeShimFiles(socketPath, statePath)
+		return err
+	}
+
+	t.mainProcess = nil
+	t.attachShim(client, wrapper, callback)
+	return nil
+}
+
+func (t *tty) attachShim(client *shimClient, wrapper io.Writer, callback func(graceful bool)) {
+	t.shim = client
+	t.stdInWriter = client.conn
+	go t.handleShimClose(client, wrapper, callback)
+}
+
+// handleShimClose passes on the console until the shim hangs up, which it does once the process exits
+func (t *tty) handleShimClose(client *shimClient, wrapper io.Writer, callback func(graceful bool)) {
+	_, _ = io.Copy(wrapper, client.conn)
+	_ = client.conn.Close()
+
+	var success bool
+	state, err := readShimState(client.statePath)
+	if err != nil {
+		t.Log(logging.Error, "Error reading shim state: %s\n", err)
+	} else if state.Exited {
+		success = state.ExitCode == 0
+		t.Log(logging.Debug, "exit status %d\n", state.ExitCode)
+	} else {
+		t.Log(logging.Error, "Lost connection to shim for process %d\n", state.ChildPid)
+	}
+
+	if state == nil || state.Exited || !processAlive(state.Pid) {
+		removeShimFiles(client.socketPath, client.statePath)
+	}
+
+	t.shim = nil
+	t.stdInWriter = nil
+	t.removeCgroup()
+	t.StopHealth()
+	t.Wait.Done()
+
+	msg := messages.Status{Running: false}
+	_ = t.WSManager.WriteMessage(msg)
+
+	if callback != nil {
+		callback(success)
+	}
+}
+
+// shimPaths are where this server's shim listens and saves its state. These are kept out of the servers folder, which
+// is only for server definitions, and are absolute so the shim does not depend on the daemon's working directory
+func (t *tty) shimPaths() (socketPath string, statePath string, err error) {
+	folder, err := filepath.Abs(config.SupervisorFolder.Value())
+	if err != nil {
+		return
+	}
+	err = os.MkdirAll(folder, 0700)
+	if err != nil {
+		return
+	}
+	socketPath = filepath.Join(folder, t.ServerId+".sock")
+	statePath = filepath.Join(folder, t.ServerId+".json")
+	return
+}
+
+// connectShim waits for the shim to have started the process, then connects to it
+func connectShim(socketPath, statePath string, timeout time.Duration) (*shimClient, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		state, err := readShimState(statePath)
+		if err == nil && state.Exited {
+			if state.Error != "" {
+				return nil, errors.New(state.Error)
+			}
+			return nil, errors.New("process exited before it could be attached to")
+		}
+		if err == nil {
+			var conn net.Conn
+			conn, err = net.Dial("unix", socketPath)
+			if err == nil {
+				return &shimClient{conn: conn, state: state, socketPath: socketPath, statePath: statePath}, nil
+			}
+		}
+
+		if time.Now().After(deadline) {
+			if err == nil || os.IsNotExist(err) {
+				err = errors.New("timed out waiting for shim")
+			}
+			return nil, err
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+func processAlive(pid int) bool {
+	return pid > 0 && syscall.Kill(pid, syscall.Signal(0)) == nil
+}
+
+func removeShimFiles(socketPath, statePath string) {
+	_ = os.Remove(socketPath)
+	_ = os.Remove(statePath)
+}
@@ -0,0 +1,243 @@
+//go:build !windows
+// +build !windows
+
+package tty
+
+import (
+	"bufio"
+	"github.com/pufferpanel/pufferpanel/v2"
+	"github.com/pufferpanel/pufferpanel/v2/config"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func createTestTty(t *testing.T) *tty {
+	folder := config.SupervisorFolder.Value()
+	_ = config.SupervisorFolder.Set(t.TempDir(), false)
+	t.Cleanup(func() {
+		_ = config.SupervisorFolder.Set(folder, false)
+	})
+
+	env := EnvironmentFactory{}.Create("abcdef12").(*tty)
+	env.ConsoleBuffer = pufferpanel.CreateCache()
+	env.WSManager = pufferpanel.CreateTracker()
+	env.Wait = &sync.WaitGroup{}
+	return env
+}
+
+// startShim runs a shim in this process, as the daemon would have in another
+func startShim(t *testing.T, socketPath, statePath string, script string) chan error {
+	done := make(chan error, 1)
+	go func() {
+		done <- RunShim(socketPath, statePath, "sh", []string{"-c", script})
+	}()
+	t.Cleanup(func() {
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Errorf("RunShim() did not return after the process exited")
+		}
+	})
+	return done
+}
+
+func TestShim_Exited(t *testing.T) {
+	folder := t.TempDir()
+	socketPath, statePath := filepath.Join(folder, "shim.sock"), filepath.Join(folder, "shim.json")
+	startShim(t, socketPath, statePath, "echo ready; read line; echo got $line; exit 3")
+
+	client, err := connectShim(socketPath, statePath, 5*time.Second)
+	if err != nil {
+		t.Fatalf("connectShim() error = %v", err)
+	}
+	reader := bufio.NewReader(client.conn)
+	waitForLine(t, reader, "ready")
+
+	_, _ = client.conn.Write([]byte("hello\n"))
+	waitForLine(t, reader, "got hello")
+
+	//the shim hangs up once the process exits, and has saved how it went by then
+	_, _ = reader.ReadString(0)
+	state, err := readShimState(statePath)
+	if err != nil {
+		t.Fatalf("readShimState() error = %v", err)
+	}
+	if !state.Exited || state.ExitCode != 3 {
+		t.Errorf("state = exited %v code %d, want exited with 3", state.Exited, state.ExitCode)
+	}
+
+	if _, err = connectShim(socketPath, statePath, time.Second); err == nil {
+		t.Errorf("connectShim() connected to a shim whose process exited")
+	}
+}
+
+func TestTty_Reattach(t *testing.T) {
+	env := createTestTty(t)
+	socketPath, statePath, err := env.shimPaths()
+	if err != nil {
+		t.Fatalf("shimPaths() error = %v", err)
+	}
+	startShim(t, socketPath, statePath, "read line; exit 0")
+
+	//the shim has to have started the process before there is anything to reattach to
+	first, err := connectShim(socketPath, statePath, 5*time.Second)
+	if err != nil {
+		t.Fatalf("connectShim() error = %v", err)
+	}
+	defer first.conn.Close()
+
+	exited := make(chan bool, 1)
+	attached, err := env.Reattach(pufferpanel.ExecutionData{Callback: func(graceful bool) {
+		exited <- graceful
+	}})
+	if err != nil || !attached {
+		t.Fatalf("Reattach() = %v, %v, want true", attached, err)
+	}
+	if !env.CanReattach() {
+		t.Errorf("CanReattach() = false while attached to a shim")
+	}
+
+	_, _ = env.stdInWriter.Write([]byte("stop\n"))
+	select {
+	case graceful := <-exited:
+		if !graceful {
+			t.Errorf("Reattach() callback graceful = false, want true")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Reattach() never called back after the process exited")
+	}
+
+	if _, err = os.Stat(statePath); !os.IsNotExist(err) {
+		t.Errorf("state file left behind after the process exited")
+	}
+}
+
+func TestTty_Reattach_Health(t *testing.T) {
+	env := createTestTty(t)
+	env.RootDirectory = t.TempDir()
+	socketPath, statePath, err := env.shimPaths()
+	if err != nil {
+		t.Fatalf("shimPaths() error = %v", err)
+	}
+	startShim(t, socketPath, statePath, "read line; exit 0")
+
+	first, err := connectShim(socketPath, statePath, 5*time.Second)
+	if err != nil {
+		t.Fatalf("connectShim() error = %v", err)
+	}
+	defer first.conn.Close()
+
+	//the check runs in the server's folder
+	marker := filepath.Join(env.RootDirectory, "healthy")
+	if err = os.WriteFile(marker, nil, 0600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	health := make(chan string, 3)
+	attached, err := env.Reattach(pufferpanel.ExecutionData{
+		HealthCheck: &pufferpanel.HealthCheck{Type: "command", Command: "test -f healthy", Interval: 1, Retries: 1},
+		HealthCallback: func(status string) {
+			health <- status
+		},
+	})
+	if err != nil || !attached {
+		t.Fatalf("Reattach() = %v, %v, want true", attached, err)
+	}
+
+	waitForHealth := func(want string) {
+		select {
+		case status := <-health:
+			if status != want {
+				t.Fatalf("Reattach() health = %v, want %v", status, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Reattach() health never became %v", want)
+		}
+	}
+	waitForHealth(pufferpanel.HealthStarting)
+	waitForHealth(pufferpanel.HealthHealthy)
+
+	if err = os.Remove(marker); err != nil {
+		t.Fatalf("Remove() error = %v", err)
+	}
+	waitForHealth(pufferpanel.HealthUnhealthy)
+
+	_, _ = env.stdInWriter.Write([]byte("stop\n"))
+	env.Wait.Wait()
+	if status := env.GetHealth(); status != "" {
+		t.Errorf("GetHealth() = %v after the process exited, want none", status)
+	}
+}
+
+func TestTty_Reattach_Stale(t *testing.T) {
+	//a process which has been reaped stands in for a shim which died with the host
+	dead := exec.Command("true")
+	if err := dead.Run(); err != nil {
+		t.Fatalf("running true: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		state *ShimState
+	}{
+		{
+			name:  "exited",
+			state: &ShimState{Pid: os.Getpid(), Exited: true},
+		},
+		{
+			name:  "shim gone",
+			state: &ShimState{Pid: dead.Process.Pid},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := createTestTty(t)
+			socketPath, statePath, err := env.shimPaths()
+			if err != nil {
+				t.Fatalf("shimPaths() error = %v", err)
+			}
+			tt.state.Socket = socketPath
+			if err = writeShimState(statePath, tt.state); err != nil {
+				t.Fatalf("writeShimState() error = %v", err)
+			}
+			if err = os.WriteFile(socketPath, nil, 0600); err != nil {
+				t.Fatalf("writing socket: %v", err)
+			}
+
+			attached, err := env.Reattach(pufferpanel.ExecutionData{})
+			if err != nil || attached {
+				t.Errorf("Reattach() = %v, %v, want false", attached, err)
+			}
+			for _, v := range []string{socketPath, statePath} {
+				if _, err = os.Stat(v); !os.IsNotExist(err) {
+					t.Errorf("%s left behind", filepath.Base(v))
+				}
+			}
+		})
+	}
+
+	t.Run("nothing left", func(t *testing.T) {
+		env := createTestTty(t)
+		attached, err := env.Reattach(pufferpanel.ExecutionData{})
+		if err != nil || attached {
+			t.Errorf("Reattach() = %v, %v, want false", attached, err)
+		}
+	})
+}
+
+func waitForLine(t *testing.T, reader *bufio.Reader, want string) {
+	for {
+		line, err := reader.ReadString('\n')
+		if strings.TrimSpace(line) == want {
+			return
+		}
+		if err != nil {
+			t.Fatalf("waiting for %q: %v", want, err)
+		}
+	}
+}
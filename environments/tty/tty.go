@@ -35,8 +35,14 @@ import (
 
 type tty struct {
 	*pufferpanel.BaseEnvironment
+	SandboxOptions
+	Resources   Resources `json:"resources,omitempty"`
+	Supervised  bool      `json:"supervised,omitempty"`
 	mainProcess *exec.Cmd
 	stdInWriter io.Writer
+	shim        *shimClient
+	sandboxed   bool
+	cgroup      string
 }
 
 func (t *tty) ttyExecuteAsync(steps pufferpanel.ExecutionData) (err error) {
@@ -49,17 +55,7 @@ func (t *tty) ttyExecuteAsync(steps pufferpanel.ExecutionData) (err error) {
 		return
 	}
 
-	pr := exec.Command(steps.Command, steps.Arguments...)
-	pr.Dir = path.Join(t.GetRootDirectory(), steps.WorkingDirectory)
-	for _, v := range os.Environ() {
-		if !strings.HasPrefix(v, "PUFFER_") {
-			pr.Env = append(pr.Env, v)
-		}
-	}
-	pr.Env = append(pr.Env, "HOME="+t.GetRootDirectory(), "TERM=xterm-256color")
-	for k, v := range steps.Environment {
-		pr.Env = append(pr.Env, fmt.Sprintf("%s=%s", k, v))
-	}
+	pr := t.command(steps, steps.Command, steps.Arguments)
 
 	wrapper := t.CreateWrapper()
 	t.Wait.Add(1)
@@ -68,11 +64,37 @@ func (t *tty) ttyExecuteAsync(steps pufferpanel.ExecutionData) (err error) {
 	t.DisplayToConsole(true, "Starting process: %s %s", t.mainProcess.Path, strings.Join(t.mainProcess.Args[1:], " "))
 	t.Log(logging.Info, "Starting process: %s %s", t.mainProcess.Path, strings.Join(t.mainProcess.Args[1:], " "))
 
+	if wrap := t.commandWrapper(); wrap != nil {
+		t.prepareCgroup()
+		pr, err = wrap(pr, steps.WorkingDirectory)
+		if err != nil {
+			t.mainProcess = nil
+			t.Wait.Done()
+			return
+		}
+		pr.SysProcAttr = &syscall.SysProcAttr{Setctty: true, Setsid: true}
+		t.mainProcess = pr
+	}
+
 	msg := messages.Status{Running: true}
 	_ = t.WSManager.WriteMessage(msg)
 
+	//watched before the process starts, so a process that exits straight away stops it
+	t.watchHealth(steps)
+
+	if t.Supervised {
+		err = t.startSupervised(pr, wrapper, steps.Callback)
+		if err != nil {
+			t.mainProcess = nil
+			t.StopHealth()
+			t.Wait.Done()
+		}
+		return
+	}
+
 	processTty, err := pty.Start(pr)
 	if err != nil {
+		t.StopHealth()
 		t.Wait.Done()
 		return
 	}
@@ -87,6 +109,32 @@ func (t *tty) ttyExecuteAsync(steps pufferpanel.ExecutionData) (err error) {
 	return
 }
 
+// command is how a command for the server is run, in the working directory and with the environment of the steps
+func (t *tty) command(steps pufferpanel.ExecutionData, name string, args []string) *exec.Cmd {
+	cmd := exec.Command(name, args...)
+	cmd.Dir = path.Join(t.GetRootDirectory(), steps.WorkingDirectory)
+	for _, v := range os.Environ() {
+		if !strings.HasPrefix(v, "PUFFER_") {
+			cmd.Env = append(cmd.Env, v)
+		}
+	}
+	cmd.Env = append(cmd.Env, "HOME="+t.GetRootDirectory(), "TERM=xterm-256color")
+	for k, v := range steps.Environment {
+		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", k, v))
+	}
+	return cmd
+}
+
+// commandWrapper puts a command in the server's sandbox or resource limits, nil if it has neither
+func (t *tty) commandWrapper() func(*exec.Cmd, string) (*exec.Cmd, error) {
+	if t.sandboxed {
+		return t.sandboxCommand
+	} else if t.Resources.IsSet() {
+		return t.limitCommand
+	}
+	return nil
+}
+
 func (t *tty) ExecuteInMainProcess(cmd string) (err error) {
 	running, err := t.IsRunning()
 	if err != nil {
@@ -109,13 +157,14 @@ func (t *tty) Kill() (err error) {
 	if !running {
 		return
 	}
-	return t.mainProcess.Process.Kill()
+	return syscall.Kill(t.pid(), syscall.SIGKILL)
 }
 
 func (t *tty) IsRunning() (isRunning bool, err error) {
-	isRunning = t.mainProcess != nil && t.mainProcess.Process != nil
+	pid := t.pid()
+	isRunning = pid != 0
 	if isRunning {
-		pr, pErr := os.FindProcess(t.mainProcess.Process.Pid)
+		pr, pErr := os.FindProcess(pid)
 		if pr == nil || pErr != nil {
 			isRunning = false
 		} else if pr.Signal(syscall.Signal(0)) != nil {
@@ -125,6 +174,17 @@ func (t *tty) IsRunning() (isRunning bool, err error) {
 	return
 }
 
+// pid is the process running the server, which is the shim's child when supervised, or 0 if there is none
+func (t *tty) pid() int {
+	if t.shim != nil {
+		return t.shim.state.ChildPid
+	}
+	if t.mainProcess != nil && t.mainProcess.Process != nil {
+		return t.mainProcess.Process.Pid
+	}
+	return 0
+}
+
 func (t *tty) GetStats() (*pufferpanel.ServerStats, error) {
 	running, err := t.IsRunning()
 	if err != nil {
@@ -133,7 +193,13 @@ func (t *tty) GetStats() (*pufferpanel.ServerStats, error) {
 	if !running {
 		return nil, pufferpanel.ErrServerOffline
 	}
-	pr, err := process.NewProcess(int32(t.mainProcess.Process.Pid))
+	if t.sandboxed {
+		if stats, ok := t.sandboxStats(); ok {
+			return stats, nil
+		}
+	}
+
+	pr, err := process.NewProcess(int32(t.pid()))
 	if err != nil {
 		return nil, err
 	}
@@ -144,6 +210,7 @@ func (t *tty) GetStats() (*pufferpanel.ServerStats, error) {
 	return &pufferpanel.ServerStats{
 		Cpu:    cpu,
 		Memory: cast.ToFloat64(memMap.RSS),
+		Limits: t.resourceLimits(),
 	}, nil
 }
 
@@ -181,7 +248,7 @@ func (t *tty) SendCode(code int) error {
 		return err
 	}
 
-	return t.mainProcess.Process.Signal(syscall.Signal(code))
+	return syscall.Kill(t.pid(), syscall.Signal(code))
 }
 
 func (t *tty) handleClose(callback func(graceful bool)) {
@@ -206,6 +273,8 @@ func (t *tty) handleClose(callback func(graceful bool)) {
 		_ = t.mainProcess.Process.Release()
 	}
 	t.mainProcess = nil
+	t.removeCgroup()
+	t.StopHealth()
 	t.Wait.Done()
 
 	msg := messages.Status{Running: false}
@@ -215,3 +284,11 @@ func (t *tty) handleClose(callback func(graceful bool)) {
 		callback(success)
 	}
 }
+
+// removeCgroup removes the cgroup of a sandbox that has exited, which can only be done once everything in it has
+func (t *tty) removeCgroup() {
+	if t.cgroup != "" {
+		_ = os.Remove(t.cgroup)
+		t.cgroup = ""
+	}
+}
@@ -39,6 +39,13 @@ var ErrFileNotFound = CreateError("file not found", "ErrFileNotFound")
 var ErrFileExists = CreateError("file exists where there should be none", "ErrFileExists")
 var ErrServerDisabled = CreateError("server is disabled", "ErrServerDisabled")
 var ErrContainerRunning = CreateError("container already running", "ErrContainerRunning")
+var ErrDockerfileNotFound = func(name string) *Error {
+	return CreateError("dockerfile ${name} not found", "ErrDockerfileNotFound").Metadata(map[string]interface{}{"name": name})
+}
+var ErrServerDockerfilesDisabled = CreateError("dockerfiles from the server folder are not allowed on this node", "ErrServerDockerfilesDisabled")
+var ErrCommandFailed = func(code int) *Error {
+	return CreateError("command exited with code ${code}", "ErrCommandFailed").Metadata(map[string]interface{}{"code": code})
+}
 var ErrImageDownloading = CreateError("image downloading", "ErrImageDownloading")
 var ErrProcessRunning = CreateError("process already running", "ErrProcessRunning")
 var ErrMissingFactory = CreateError("missing factory", "ErrMissingFactory")
@@ -56,11 +63,63 @@ var ErrSessionExpired = CreateError("session expired", "ErrSessionExpired")
 var ErrTaskNotFound = CreateError("task not found", "ErrTaskNotFound")
 var ErrNotImplemented = CreateError("not implemented", "ErrNotImplemented")
 var ErrDockerNotSupported = CreateError("docker not supported", "ErrDockerNotSupported")
+var ErrPodmanNotSupported = CreateError("podman not supported", "ErrPodmanNotSupported")
+var ErrNetworkBlockNotSupported = CreateError("blocking private networks is not supported on this node", "ErrNetworkBlockNotSupported")
+var ErrSandboxExposesDaemon = func(path string) *Error {
+	return CreateError("sandbox would let servers read ${path}, where the daemon keeps its files", "ErrSandboxExposesDaemon").Metadata(map[string]interface{}{"path": path})
+}
+var ErrEnvironmentNotSupported = func(environment string) *Error {
+	return CreateError("environment ${environment} not supported by this server", "ErrEnvironmentNotSupported").Metadata(map[string]interface{}{"environment": environment})
+}
+var ErrRoleNotFound = CreateError("role not found", "ErrRoleNotFound")
+var ErrRoleBuiltIn = CreateError("built in roles cannot be modified", "ErrRoleBuiltIn")
+var ErrRoleExists = CreateError("role with this name already exists", "ErrRoleExists")
+var ErrRoleNotAllowed = CreateError("role grants more than you have", "ErrRoleNotAllowed")
+var ErrTeamNotFound = CreateError("team not found", "ErrTeamNotFound")
+var ErrTeamExists = CreateError("team with this name already exists", "ErrTeamExists")
+var ErrTeamServerLimit = CreateError("team has reached its server limit", "ErrTeamServerLimit")
+var ErrTeamMemberLimit = CreateError("team has reached its member limit", "ErrTeamMemberLimit")
+var ErrInviteInvalid = CreateError("invite is invalid or has expired", "ErrInviteInvalid")
+var ErrWebAuthnInvalid = CreateError("security key response is invalid", "ErrWebAuthnInvalid")
+var ErrWebAuthnNotFound = CreateError("security key not found", "ErrWebAuthnNotFound")
+var ErrWebAuthnExists = CreateError("security key is already registered", "ErrWebAuthnExists")
+var ErrSecondFactorRequired = CreateError("a second factor must be enabled first", "ErrSecondFactorRequired")
+var ErrSessionNotFound = CreateError("session not found", "ErrSessionNotFound")
+var ErrApplicationNotFound = CreateError("application not found", "ErrApplicationNotFound")
+var ErrInvalidRedirectUri = CreateError("redirect uri is not registered for this application", "ErrInvalidRedirectUri")
+var ErrInvalidGrant = CreateError("authorization code or refresh token is invalid or has expired", "ErrInvalidGrant")
+var ErrUnsupportedResponseType = CreateError("only the code response type is supported", "ErrUnsupportedResponseType")
+var ErrPKCERequired = CreateError("a S256 code challenge is required", "ErrPKCERequired")
+var ErrAuthorizationNotFound = CreateError("authorized application not found", "ErrAuthorizationNotFound")
+var ErrNodeOffline = CreateError("node could not be reached", "ErrNodeOffline")
+var ErrServerRunning = CreateError("server must be stopped first", "ErrServerRunning")
+var ErrTransferRunning = CreateError("server is already being transferred", "ErrTransferRunning")
+var ErrTransferNotFound = CreateError("no transfer found for server", "ErrTransferNotFound")
+var ErrTransferSameNode = CreateError("server is already on this node", "ErrTransferSameNode")
+var ErrTransferChecksum = CreateError("transferred files did not match their checksum", "ErrTransferChecksum")
+var ErrNodeFull = CreateError("node does not have room for the server", "ErrNodeFull")
+var ErrNoNodeAvailable = CreateError("no node has room for the server", "ErrNoNodeAvailable")
+var ErrTransferIncomplete = CreateError("transfer is missing the server definition", "ErrTransferIncomplete")
+var ErrTransferSource = CreateError("transfer source was not given by the panel", "ErrTransferSource")
+var ErrPortPoolOverlap = CreateError("port pool overlaps another pool on the node", "ErrPortPoolOverlap")
+var ErrPortPoolNotFound = CreateError("port pool not found", "ErrPortPoolNotFound")
+var ErrCertificateNotTrusted = CreateError("certificate is not trusted", "ErrCertificateNotTrusted")
+var ErrCertificateMismatch = CreateError("certificate was not issued for this node's key", "ErrCertificateMismatch")
+var ErrMTLSRequired = CreateError("this can only be done over a mutual TLS connection", "ErrMTLSRequired")
+var ErrJoinTokenInvalid = CreateError("join token is invalid or has expired", "ErrJoinTokenInvalid")
+var ErrNoPortAvailable = CreateError("node has no free ports left", "ErrNoPortAvailable")
+var ErrBulkJobNotFound = CreateError("bulk job not found", "ErrBulkJobNotFound")
+var ErrBulkFilterRequired = CreateError("at least one server filter is required", "ErrBulkFilterRequired")
+var ErrNoServersMatched = CreateError("no servers matched the filter", "ErrNoServersMatched")
 
 func CreateErrMissingScope(scope Scope) *Error {
 	return CreateError(ErrMissingScope.Message, ErrMissingScope.Code).Metadata(map[string]interface{}{"scope": scope})
 }
 
+var ErrUnknownScope = func(scope Scope) *Error {
+	return CreateError("${scope} is not a valid scope", "ErrUnknownScope").Metadata(map[string]interface{}{"scope": scope})
+}
+
 var ErrSettingNotConfigured = func(name string) *Error {
 	return CreateError("${setting} is not configured", "ErrSettingNotConfigured").Metadata(map[string]interface{}{"setting": name})
 }
@@ -125,6 +184,26 @@ var ErrFactoryError = func(operatorName string, err error) *Error {
 	return CreateError("factory `${operatorName}` encountered an error: `${err}`", "ErrFactoryError").Metadata(map[string]interface{}{"operatorName": operatorName, "err": err.Error()})
 }
 
+var ErrTransferFailed = func(reason string) *Error {
+	return CreateError("transfer failed: ${reason}", "ErrTransferFailed").Metadata(map[string]interface{}{"reason": reason})
+}
+
+var ErrPortTaken = func(port uint16) *Error {
+	return CreateError("port ${port} is already given to another server on the node", "ErrPortTaken").Metadata(map[string]interface{}{"port": port})
+}
+
+var ErrPortInUse = func(ip string, port uint16) *Error {
+	return CreateError("port ${port} on ${ip} is already in use", "ErrPortInUse").Metadata(map[string]interface{}{"ip": ip, "port": port})
+}
+
+var ErrUnknownPlacement = func(mode string) *Error {
+	return CreateError("${mode} is not a valid placement mode", "ErrUnknownPlacement").Metadata(map[string]interface{}{"mode": mode})
+}
+
+var ErrUnknownBulkAction = func(action string) *Error {
+	return CreateError("${action} is not a valid bulk action", "ErrUnknownBulkAction").Metadata(map[string]interface{}{"action": action})
+}
+
 var ErrNodeInvalid = CreateError("node is invalid", "ErrNodeInvalid")
 
 var ErrUnsupportedOS = func(actual, expected string) *Error {
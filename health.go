@@ -0,0 +1,196 @@
+/*
+ Copyright 2023 Padduck, LLC
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+  	http://www.apache.org/licenses/LICENSE-2.0
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+*/
+
+package pufferpanel
+
+import (
+	"errors"
+	"github.com/pufferpanel/pufferpanel/v2/messages"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	HealthStarting  = "starting"
+	HealthHealthy   = "healthy"
+	HealthUnhealthy = "unhealthy"
+)
+
+// HealthCheck is how to tell a running server still works, as a hung server keeps running.
+// A command is run where the server is, and fails if it exits with anything but 0. A tcp or udp check connects to the
+// address, and a udp one with a payload expects a reply to it. Times are in seconds
+type HealthCheck struct {
+	Type        string `json:"type"`
+	Command     string `json:"command,omitempty"`
+	Address     string `json:"address,omitempty"`
+	Payload     string `json:"payload,omitempty"`
+	Interval    int    `json:"interval,omitempty"`
+	Timeout     int    `json:"timeout,omitempty"`
+	StartPeriod int    `json:"startPeriod,omitempty"`
+	Retries     int    `json:"retries,omitempty"`
+	//Restart kills and starts the server again once it is unhealthy
+	Restart bool `json:"restart,omitempty"`
+}
+
+func (h *HealthCheck) IntervalDuration() time.Duration {
+	if h.Interval <= 0 {
+		return 30 * time.Second
+	}
+	return time.Duration(h.Interval) * time.Second
+}
+
+func (h *HealthCheck) TimeoutDuration() time.Duration {
+	if h.Timeout <= 0 {
+		return 10 * time.Second
+	}
+	return time.Duration(h.Timeout) * time.Second
+}
+
+func (h *HealthCheck) StartPeriodDuration() time.Duration {
+	return time.Duration(h.StartPeriod) * time.Second
+}
+
+// FailuresAllowed is how many checks in a row can fail before the server is unhealthy
+func (h *HealthCheck) FailuresAllowed() int {
+	if h.Retries <= 0 {
+		return 3
+	}
+	return h.Retries
+}
+
+// ProbePort checks something is answering on the address. Without a payload, a udp port only fails when the host says
+// nothing is listening
+func ProbePort(network, address, payload string, timeout time.Duration) error {
+	conn, err := net.DialTimeout(network, address, timeout)
+	if err != nil {
+		return err
+	}
+	defer Close(conn)
+
+	if network != "udp" {
+		return nil
+	}
+
+	err = conn.SetDeadline(time.Now().Add(timeout))
+	if err != nil {
+		return err
+	}
+	_, err = conn.Write([]byte(payload))
+	if err != nil {
+		return err
+	}
+
+	_, err = conn.Read(make([]byte, 1))
+	var netErr net.Error
+	if payload == "" && errors.As(err, &netErr) && netErr.Timeout() {
+		return nil
+	}
+	return err
+}
+
+// ProbeHealth turns a check the daemon does itself into the server's health, counting the failures in a row
+func ProbeHealth(check *HealthCheck, probe func() error) func() string {
+	started := time.Now()
+	failures := 0
+	return func() string {
+		if probe() == nil {
+			failures = 0
+			return HealthHealthy
+		}
+		//failures while starting up do not count
+		if time.Since(started) < check.StartPeriodDuration() {
+			return HealthStarting
+		}
+		failures++
+		if failures >= check.FailuresAllowed() {
+			return HealthUnhealthy
+		}
+		return ""
+	}
+}
+
+type healthWatch struct {
+	status string
+	stop   chan struct{}
+	locker sync.Mutex
+}
+
+// WatchHealth asks for the server's health every interval until StopHealth, telling listeners and the callback when
+// it changes. An empty status leaves it as it was
+func (e *BaseEnvironment) WatchHealth(interval time.Duration, status func() string, callback func(status string)) {
+	e.StopHealth()
+
+	stop := make(chan struct{})
+	e.health.locker.Lock()
+	e.health.stop = stop
+	e.health.locker.Unlock()
+	e.setHealth(HealthStarting, callback)
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				if s := status(); s != "" {
+					select {
+					case <-stop:
+						return
+					default:
+						e.setHealth(s, callback)
+					}
+				}
+			}
+		}
+	}()
+}
+
+// StopHealth stops watching the server's health, for when it has stopped
+func (e *BaseEnvironment) StopHealth() {
+	e.health.locker.Lock()
+	defer e.health.locker.Unlock()
+	if e.health.stop != nil {
+		close(e.health.stop)
+		e.health.stop = nil
+	}
+	e.health.status = ""
+}
+
+// GetHealth is the health of the running server, empty if it has no health check
+func (e *BaseEnvironment) GetHealth() string {
+	e.health.locker.Lock()
+	defer e.health.locker.Unlock()
+	return e.health.status
+}
+
+func (e *BaseEnvironment) setHealth(status string, callback func(status string)) {
+	e.health.locker.Lock()
+	changed := e.health.status != status
+	e.health.status = status
+	e.health.locker.Unlock()
+
+	if !changed {
+		return
+	}
+
+	_ = e.WSManager.WriteMessage(messages.Status{Running: true, Health: status})
+	if status == HealthUnhealthy {
+		e.DisplayToConsole(true, "Server is unhealthy\n")
+	}
+	if callback != nil {
+		callback(status)
+	}
+}
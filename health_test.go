@@ -0,0 +1,55 @@
+package pufferpanel
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestProbeHealth(t *testing.T) {
+	failed := errors.New("failed")
+	tests := []struct {
+		name     string
+		check    HealthCheck
+		results  []error
+		expected []string
+	}{
+		{
+			name:     "Healthy",
+			check:    HealthCheck{},
+			results:  []error{nil, nil},
+			expected: []string{HealthHealthy, HealthHealthy},
+		},
+		{
+			name:     "Unhealthy after retries",
+			check:    HealthCheck{Retries: 2},
+			results:  []error{failed, failed, failed},
+			expected: []string{"", HealthUnhealthy, HealthUnhealthy},
+		},
+		{
+			name:     "Success resets failures",
+			check:    HealthCheck{Retries: 2},
+			results:  []error{failed, nil, failed, failed},
+			expected: []string{"", HealthHealthy, "", HealthUnhealthy},
+		},
+		{
+			name:     "Failures while starting",
+			check:    HealthCheck{Retries: 1, StartPeriod: 60},
+			results:  []error{failed, nil},
+			expected: []string{HealthStarting, HealthHealthy},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			i := 0
+			status := ProbeHealth(&tt.check, func() error {
+				err := tt.results[i]
+				i++
+				return err
+			})
+			for k, v := range tt.expected {
+				assert.Equalf(t, v, status(), "check %d", k)
+			}
+		})
+	}
+}
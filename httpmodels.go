@@ -13,13 +13,30 @@
 
 package pufferpanel
 
+import "time"
+
 type ServerIdResponse struct {
 	Id string `json:"id"`
 }
 
 type ServerStats struct {
-	Cpu    float64 `json:"cpu"`
-	Memory float64 `json:"memory"`
+	Cpu    float64         `json:"cpu"`
+	Memory float64         `json:"memory"`
+	Limits *ResourceLimits `json:"limits,omitempty"`
+}
+
+// ResourceLimits are the limits a server is running with, as read back from the host. Enforcement is how memory, cpu
+// and process limits are applied, either "cgroup" or "rlimit". A limit of 0 is no limit. NotEnforced lists the limits
+// the server asked for which the host could not apply, such as cpu and pids without a cgroup
+type ResourceLimits struct {
+	Enforcement string   `json:"enforcement"`
+	NotEnforced []string `json:"notEnforced,omitempty"`
+	Memory      int64    `json:"memory,omitempty"`
+	Cpu         int64    `json:"cpu,omitempty"`
+	Pids        int64    `json:"pids,omitempty"`
+	Nice        int      `json:"nice"`
+	IOPriority  *int     `json:"ioPriority,omitempty"`
+	CpuSet      string   `json:"cpuSet,omitempty"`
 }
 
 type ServerLogs struct {
@@ -28,7 +45,8 @@ type ServerLogs struct {
 }
 
 type ServerRunning struct {
-	Running bool `json:"running"`
+	Running bool   `json:"running"`
+	Health  string `json:"health,omitempty"`
 }
 
 type ServerData struct {
@@ -43,6 +61,85 @@ type ServerDataAdmin struct {
 	*Server
 }
 
+type ServerOwner struct {
+	Owner string `json:"owner"`
+}
+
 type DaemonRunning struct {
 	Message string `json:"message"`
 }
+
+type DaemonInfo struct {
+	Version string       `json:"version"`
+	OS      string       `json:"os"`
+	Arch    string       `json:"arch"`
+	Uptime  int64        `json:"uptime"`
+	Servers int          `json:"servers"`
+	Host    HostInfo     `json:"host"`
+	Panel   *PanelStatus `json:"panel,omitempty"`
+}
+
+// PanelStatus is how a node sees the panel it belongs to. While degraded, logins and tokens are checked against what
+// the node last heard from the panel, and events are held until it is back
+type PanelStatus struct {
+	Degraded      bool       `json:"degraded"`
+	DegradedSince *time.Time `json:"degradedSince,omitempty"`
+	LastContact   *time.Time `json:"lastContact,omitempty"`
+	Error         string     `json:"error,omitempty"`
+	QueuedEvents  int        `json:"queuedEvents"`
+}
+
+const (
+	PanelEventServerStarted = "server.started"
+	PanelEventServerStopped = "server.stopped"
+	PanelEventServerCrashed = "server.crashed"
+)
+
+// PanelEvent is something a node tells the panel about
+type PanelEvent struct {
+	Type   string    `json:"type"`
+	Server string    `json:"server,omitempty"`
+	At     time.Time `json:"at"`
+}
+
+type HostInfo struct {
+	CpuCount    int     `json:"cpuCount"`
+	CpuUsage    float64 `json:"cpuUsage"`
+	MemoryTotal uint64  `json:"memoryTotal"`
+	MemoryUsed  uint64  `json:"memoryUsed"`
+	DiskTotal   uint64  `json:"diskTotal"`
+	DiskUsed    uint64  `json:"diskUsed"`
+}
+
+// TransferChecksumHeader is the trailer the sending node puts the sha256 of the transfer stream in
+const TransferChecksumHeader = "X-Transfer-Checksum"
+
+const (
+	TransferStageStopping     = "stopping"
+	TransferStageTransferring = "transferring"
+	TransferStageFinalizing   = "finalizing"
+	TransferStageComplete     = "complete"
+	TransferStageFailed       = "failed"
+)
+
+type TransferRequest struct {
+	Source string `json:"source"`
+	Token  string `json:"token"`
+}
+
+type TransferProgress struct {
+	Stage string `json:"stage"`
+	Bytes int64  `json:"bytes"`
+	Error string `json:"error,omitempty"`
+}
+
+// CertificateRequest is a node asking the panel to sign its new key
+type CertificateRequest struct {
+	Request string `json:"request"`
+}
+
+// CertificateResponse is the signed certificate for a node, and the CA it has to trust connections from
+type CertificateResponse struct {
+	Certificate string `json:"certificate"`
+	CA          string `json:"ca"`
+}
@@ -14,7 +14,8 @@
 package messages
 
 type Status struct {
-	Running bool `json:"running"`
+	Running bool   `json:"running"`
+	Health  string `json:"health,omitempty"`
 }
 
 func (m Status) Key() string {
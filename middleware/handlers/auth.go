@@ -58,6 +58,24 @@ func AuthMiddleware(c *gin.Context) {
 		return
 	}
 
+	if len(token.Claims.Audience) != 1 || token.Claims.Audience[0] != "session" {
+		c.Header(WWWAuthenticateHeader, WWWAuthenticateHeaderContents)
+		response.HandleError(c, pufferpanel.ErrTokenInvalid, http.StatusUnauthorized)
+		return
+	}
+
+	ss := &services.Session{DB: db}
+	sessionId, err := ss.GetActiveSession(token)
+	if err == pufferpanel.ErrInvalidSession {
+		c.Header(WWWAuthenticateHeader, WWWAuthenticateHeaderContents)
+		response.HandleError(c, err, http.StatusUnauthorized)
+		return
+	}
+	if response.HandleError(c, err, http.StatusInternalServerError) {
+		return
+	}
+
 	c.Set("user", user)
+	c.Set("sessionId", sessionId)
 	c.Next()
 }
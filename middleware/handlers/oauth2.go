@@ -153,6 +153,18 @@ func OAuth2Handler(requiredScope pufferpanel.Scope, requireServer bool) gin.Hand
 		audience := ti.Audience[0]
 
 		if audience == "oauth2" {
+			//make sure the token was not revoked, and whoever it was issued to is still around
+			is := &services.Introspection{DB: db}
+			active, err := is.IsActive(jwtToken)
+			if response.HandleError(c, err, http.StatusInternalServerError) {
+				return
+			}
+			if !active {
+				c.Header(WWWAuthenticateHeader, WWWAuthenticateHeaderContents)
+				response.HandleError(c, pufferpanel.ErrTokenInvalid, http.StatusUnauthorized)
+				return
+			}
+
 			if requiredScope != pufferpanel.ScopeNone {
 				scopes := ti.PanelClaims.Scopes[serverId]
 				if scopes != nil && pufferpanel.ContainsScope(scopes, requiredScope) {
@@ -168,13 +180,26 @@ func OAuth2Handler(requiredScope pufferpanel.Scope, requireServer bool) gin.Hand
 				allowed = true
 			}
 		} else if audience == "session" {
+			//sessions can be revoked, so make sure this one is still around
+			sess := &services.Session{DB: db}
+			sessionId, err := sess.GetActiveSession(jwtToken)
+			if err == pufferpanel.ErrInvalidSession {
+				c.Header(WWWAuthenticateHeader, WWWAuthenticateHeaderContents)
+				response.HandleError(c, err, http.StatusUnauthorized)
+				return
+			}
+			if response.HandleError(c, err, http.StatusInternalServerError) {
+				return
+			}
+			c.Set("sessionId", sessionId)
+
 			//otherwise, we have to look at what the user has since session based
 			ps := &services.Permission{DB: db}
-			var perms *models.Permissions
+			var scopes []pufferpanel.Scope
 			if serverId == "" {
-				perms, err = ps.GetForUserAndServer(user.ID, nil)
+				scopes, err = ps.GetScopesForUserAndServer(user.ID, nil)
 			} else {
-				perms, err = ps.GetForUserAndServer(user.ID, &serverId)
+				scopes, err = ps.GetScopesForUserAndServer(user.ID, &serverId)
 			}
 
 			if response.HandleError(c, err, http.StatusInternalServerError) {
@@ -182,14 +207,14 @@ func OAuth2Handler(requiredScope pufferpanel.Scope, requireServer bool) gin.Hand
 			}
 
 			if requiredScope != pufferpanel.ScopeNone {
-				if pufferpanel.ContainsScope(perms.ToScopes(), requiredScope) {
+				if pufferpanel.ContainsScope(scopes, requiredScope) {
 					allowed = true
 				} else {
-					perms, err = ps.GetForUserAndServer(user.ID, nil)
+					isAdmin, err := ps.IsAdmin(user.ID)
 					if response.HandleError(c, err, http.StatusInternalServerError) {
 						return
 					}
-					if pufferpanel.ContainsScope(perms.ToScopes(), pufferpanel.ScopeServersAdmin) {
+					if isAdmin {
 						allowed = true
 					}
 				}
@@ -19,7 +19,10 @@ package middleware
 import (
 	"github.com/gin-gonic/gin"
 	"github.com/pufferpanel/pufferpanel/v2"
+	"github.com/pufferpanel/pufferpanel/v2/config"
+	"github.com/pufferpanel/pufferpanel/v2/database"
 	"github.com/pufferpanel/pufferpanel/v2/logging"
+	"github.com/pufferpanel/pufferpanel/v2/oauth2"
 	"github.com/pufferpanel/pufferpanel/v2/programs"
 	"github.com/pufferpanel/pufferpanel/v2/response"
 	"github.com/pufferpanel/pufferpanel/v2/services"
@@ -63,6 +66,15 @@ func OAuth2Handler(requiredScope pufferpanel.Scope, requireServer bool) gin.Hand
 			return
 		}
 
+		active, err := isTokenActive(token, authToken)
+		if response.HandleError(c, err, http.StatusInternalServerError) {
+			return
+		}
+		if !active {
+			response.HandleError(c, pufferpanel.ErrTokenInvalid, http.StatusForbidden)
+			return
+		}
+
 		serverId := c.Param("id")
 		scopes := make([]pufferpanel.Scope, 0)
 		if token.Claims.PanelClaims.Scopes[serverId] != nil {
@@ -92,3 +104,32 @@ func OAuth2Handler(requiredScope pufferpanel.Scope, requireServer bool) gin.Hand
 		failure = false
 	}
 }
+
+// isTokenActive checks the token was not revoked. If the panel is somewhere else, it is asked
+func isTokenActive(token *pufferpanel.Token, raw string) (bool, error) {
+	if config.PanelEnabled.Value() {
+		db, err := database.GetConnection()
+		if err != nil {
+			return false, err
+		}
+		is := &services.Introspection{DB: db}
+		return is.IsActive(token)
+	}
+
+	//tokens the panel issues for itself are made per request, after the panel has checked the user, so asking about
+	//them would only slow things down
+	if token.Claims.PanelClaims.ClientId == "" {
+		return token.Valid, nil
+	}
+
+	info, err := oauth2.Introspect(raw)
+	if err != nil {
+		//the token is signed by the panel, so trust it while the panel was last reached within the grace period
+		logging.Error.Printf("Error checking token with the panel: %s", err)
+		if !oauth2.WithinGracePeriod(oauth2.LastContact()) {
+			return false, nil
+		}
+		return token.Valid, nil
+	}
+	return info.Active, nil
+}
@@ -0,0 +1,162 @@
+/*
+ Copyright 2023 Padduck, LLC
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+  	http://www.apache.org/licenses/LICENSE-2.0
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+*/
+
+package models
+
+import (
+	"github.com/pufferpanel/pufferpanel/v2"
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/go-playground/validator.v9"
+	"gorm.io/gorm"
+	"strings"
+	"time"
+)
+
+// Application is a third-party app which users can let act for them through the authorization code flow
+type Application struct {
+	ID       uint   `gorm:"primaryKey,autoIncrement" json:"-"`
+	ClientId string `gorm:"NOT NULL;uniqueIndex;size:100" json:"-"`
+	//empty for public apps, such as mobile apps, which cannot keep a secret and rely on PKCE alone
+	HashedClientSecret string `gorm:"column:client_secret;NOT NULL;default:\"\"" json:"-"`
+
+	OwnerId uint `gorm:"NOT NULL;index" json:"-"`
+	Owner   User `gorm:"ASSOCIATION_SAVE_REFERENCE:false" json:"-" validate:"-"`
+
+	Name        string `gorm:"NOT NULL;size:100" json:"-" validate:"required,printascii,max=100"`
+	Description string `gorm:"NOT NULL;size:4000;default:\"\"" json:"-"`
+
+	RedirectUris    []string `gorm:"-" json:"-" validate:"required,min=1,dive,url"`
+	RawRedirectUris string   `gorm:"column:redirect_uris;NOT NULL;size:4000" json:"-" validate:"-"`
+
+	//the most the app can ask a user for
+	Scopes    []pufferpanel.Scope `gorm:"-" json:"-" validate:"-"`
+	RawScopes string              `gorm:"column:scopes;NOT NULL;size:4000" json:"-" validate:"-"`
+
+	CreatedAt time.Time `json:"-"`
+}
+
+type Applications []*Application
+
+// ApplicationAuthorization is a user's consent for an app to act for them with the given scopes
+type ApplicationAuthorization struct {
+	ID uint `gorm:"primaryKey,autoIncrement" json:"-"`
+
+	ApplicationId uint        `gorm:"NOT NULL;uniqueIndex:idx_application_user" json:"-"`
+	Application   Application `gorm:"ASSOCIATION_SAVE_REFERENCE:false" json:"-" validate:"-"`
+
+	UserId uint `gorm:"NOT NULL;uniqueIndex:idx_application_user" json:"-"`
+	User   User `gorm:"ASSOCIATION_SAVE_REFERENCE:false" json:"-" validate:"-"`
+
+	Scopes    []pufferpanel.Scope `gorm:"-" json:"-"`
+	RawScopes string              `gorm:"column:scopes;NOT NULL;size:4000" json:"-"`
+
+	CreatedAt time.Time  `json:"-"`
+	LastUsed  *time.Time `json:"-"`
+}
+
+type ApplicationAuthorizations []*ApplicationAuthorization
+
+// ApplicationToken is a refresh token given to an app. Only the hash is stored
+type ApplicationToken struct {
+	ID              uint `gorm:"primaryKey,autoIncrement" json:"-"`
+	AuthorizationId uint `gorm:"NOT NULL;index" json:"-"`
+
+	HashedToken string `gorm:"column:token;NOT NULL;uniqueIndex;size:64" json:"-"`
+
+	CreatedAt time.Time `json:"-"`
+	ExpiresAt time.Time `gorm:"NOT NULL;index" json:"-"`
+}
+
+func (a *Application) SetClientSecret(secret string) error {
+	res, err := bcrypt.GenerateFromPassword([]byte(secret), bcrypt.DefaultCost)
+
+	if err == nil {
+		a.HashedClientSecret = string(res)
+	}
+
+	return err
+}
+
+// IsPublic is if the app has no secret, so it must prove itself with PKCE alone
+func (a *Application) IsPublic() bool {
+	return a.HashedClientSecret == ""
+}
+
+func (a *Application) ValidateSecret(secret string) bool {
+	if a.IsPublic() {
+		return secret == ""
+	}
+	return bcrypt.CompareHashAndPassword([]byte(a.HashedClientSecret), []byte(secret)) == nil
+}
+
+// HasRedirectUri checks the uri is one the app registered. These must match exactly
+func (a *Application) HasRedirectUri(uri string) bool {
+	for _, v := range a.RedirectUris {
+		if v == uri {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *Application) IsValid() (err error) {
+	err = validator.New().Struct(a)
+
+	if err != nil {
+		err = pufferpanel.GenerateValidationMessage(err)
+	}
+
+	return
+}
+
+func (a *Application) BeforeSave(*gorm.DB) (err error) {
+	err = a.IsValid()
+
+	a.RawRedirectUris = strings.Join(a.RedirectUris, " ")
+	a.RawScopes = joinScopes(a.Scopes)
+
+	return
+}
+
+func (a *Application) AfterFind(*gorm.DB) (err error) {
+	a.RedirectUris = strings.Fields(a.RawRedirectUris)
+	a.Scopes = splitScopes(a.RawScopes)
+	return
+}
+
+func (a *ApplicationAuthorization) BeforeSave(*gorm.DB) (err error) {
+	a.RawScopes = joinScopes(a.Scopes)
+	return
+}
+
+func (a *ApplicationAuthorization) AfterFind(*gorm.DB) (err error) {
+	a.Scopes = splitScopes(a.RawScopes)
+	return
+}
+
+func joinScopes(scopes []pufferpanel.Scope) string {
+	result := make([]string, len(scopes))
+	for i, v := range scopes {
+		result[i] = string(v)
+	}
+	return strings.Join(result, " ")
+}
+
+func splitScopes(raw string) []pufferpanel.Scope {
+	split := strings.Fields(raw)
+	result := make([]pufferpanel.Scope, len(split))
+	for i, v := range split {
+		result[i] = pufferpanel.Scope(v)
+	}
+	return result
+}
@@ -0,0 +1,169 @@
+/*
+ Copyright 2023 Padduck, LLC
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+  	http://www.apache.org/licenses/LICENSE-2.0
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+*/
+
+package models
+
+import (
+	"github.com/pufferpanel/pufferpanel/v2"
+	"gopkg.in/go-playground/validator.v9"
+	"time"
+)
+
+type ApplicationView struct {
+	ClientId     string              `json:"clientId,omitempty"`
+	Name         string              `json:"name,omitempty"`
+	Description  string              `json:"description,omitempty"`
+	RedirectUris []string            `json:"redirectUris,omitempty"`
+	Scopes       []pufferpanel.Scope `json:"scopes,omitempty"`
+	//public apps get no secret, and must use PKCE alone
+	Public    bool      `json:"public"`
+	CreatedAt time.Time `json:"createdAt,omitempty"`
+}
+
+type ApplicationsView []*ApplicationView
+
+type CreatedApplication struct {
+	ClientId     string `json:"clientId"`
+	ClientSecret string `json:"clientSecret,omitempty"`
+}
+
+type ApplicationAuthorizationView struct {
+	Id          uint                `json:"id"`
+	ClientId    string              `json:"clientId"`
+	Name        string              `json:"name"`
+	Description string              `json:"description,omitempty"`
+	Scopes      []pufferpanel.Scope `json:"scopes"`
+	CreatedAt   time.Time           `json:"createdAt"`
+	LastUsed    *time.Time          `json:"lastUsed,omitempty"`
+}
+
+type ApplicationAuthorizationsView []*ApplicationAuthorizationView
+
+// AuthorizeRequest is what an app asks a user for. The fields match the query of an OAuth2 authorization request
+type AuthorizeRequest struct {
+	ResponseType        string `json:"response_type" form:"response_type"`
+	ClientId            string `json:"client_id" form:"client_id"`
+	RedirectUri         string `json:"redirect_uri" form:"redirect_uri"`
+	Scope               string `json:"scope" form:"scope"`
+	State               string `json:"state" form:"state"`
+	CodeChallenge       string `json:"code_challenge" form:"code_challenge"`
+	CodeChallengeMethod string `json:"code_challenge_method" form:"code_challenge_method"`
+	//if the user agreed to the request, only used when they answer it
+	Approve bool `json:"approve" form:"-"`
+}
+
+// ConsentView is what the user is shown before they agree to let the app act for them
+type ConsentView struct {
+	ClientId    string              `json:"clientId"`
+	Name        string              `json:"name"`
+	Description string              `json:"description,omitempty"`
+	Owner       string              `json:"owner"`
+	RedirectUri string              `json:"redirectUri"`
+	Scopes      []pufferpanel.Scope `json:"scopes"`
+	//if the user has already given the app everything it is asking for
+	Authorized bool `json:"authorized"`
+}
+
+type AuthorizeResponse struct {
+	RedirectUri string `json:"redirectUri"`
+}
+
+func FromApplication(a *Application) *ApplicationView {
+	return &ApplicationView{
+		ClientId:     a.ClientId,
+		Name:         a.Name,
+		Description:  a.Description,
+		RedirectUris: a.RedirectUris,
+		Scopes:       a.Scopes,
+		Public:       a.IsPublic(),
+		CreatedAt:    a.CreatedAt,
+	}
+}
+
+func FromApplications(a []*Application) *ApplicationsView {
+	result := make(ApplicationsView, len(a))
+
+	for k, v := range a {
+		result[k] = FromApplication(v)
+	}
+
+	return &result
+}
+
+func FromApplicationAuthorizations(a []*ApplicationAuthorization) *ApplicationAuthorizationsView {
+	result := make(ApplicationAuthorizationsView, len(a))
+
+	for k, v := range a {
+		result[k] = &ApplicationAuthorizationView{
+			Id:          v.ID,
+			ClientId:    v.Application.ClientId,
+			Name:        v.Application.Name,
+			Description: v.Application.Description,
+			Scopes:      v.Scopes,
+			CreatedAt:   v.CreatedAt,
+			LastUsed:    v.LastUsed,
+		}
+	}
+
+	return &result
+}
+
+func (a *ApplicationView) CopyToModel(newModel *Application) {
+	if a.Name != "" {
+		newModel.Name = a.Name
+	}
+
+	newModel.Description = a.Description
+
+	if a.RedirectUris != nil {
+		newModel.RedirectUris = a.RedirectUris
+	}
+
+	if a.Scopes != nil {
+		newModel.Scopes = a.Scopes
+	}
+}
+
+func (a *ApplicationView) Valid(allowEmpty bool) error {
+	validate := validator.New()
+
+	if !allowEmpty && validate.Var(a.Name, "required") != nil {
+		return pufferpanel.ErrFieldRequired("name")
+	}
+
+	if validate.Var(a.Name, "omitempty,printascii") != nil {
+		return pufferpanel.ErrFieldMustBePrintable("name")
+	}
+
+	if validate.Var(a.Name, "omitempty,max=100") != nil {
+		return pufferpanel.ErrFieldLength("name", 1, 100)
+	}
+
+	if !allowEmpty && len(a.RedirectUris) == 0 {
+		return pufferpanel.ErrFieldRequired("redirectUris")
+	}
+
+	for _, v := range a.RedirectUris {
+		if validate.Var(v, "url") != nil {
+			return pufferpanel.ErrInvalidRedirectUri
+		}
+	}
+
+	for _, v := range a.Scopes {
+		if !v.IsAssignable() {
+			return pufferpanel.ErrUnknownScope(v)
+		}
+	}
+
+	return nil
+}
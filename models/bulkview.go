@@ -0,0 +1,96 @@
+/*
+ Copyright 2023 Padduck, LLC
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+  	http://www.apache.org/licenses/LICENSE-2.0
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+*/
+
+package models
+
+import (
+	"github.com/pufferpanel/pufferpanel/v2"
+	"time"
+)
+
+const (
+	BulkActionStart   = "start"
+	BulkActionStop    = "stop"
+	BulkActionKill    = "kill"
+	BulkActionRestart = "restart"
+	BulkActionInstall = "install"
+	BulkActionCommand = "command"
+)
+
+const (
+	BulkStatusPending  = "pending"
+	BulkStatusRunning  = "running"
+	BulkStatusSuccess  = "success"
+	BulkStatusFailed   = "failed"
+	BulkStatusComplete = "complete"
+)
+
+// BulkActionScopes is what is needed on a server to run each action on it
+var BulkActionScopes = map[string][]pufferpanel.Scope{
+	BulkActionStart:   {pufferpanel.ScopeServersStart},
+	BulkActionStop:    {pufferpanel.ScopeServersStop},
+	BulkActionKill:    {pufferpanel.ScopeServersStop},
+	BulkActionRestart: {pufferpanel.ScopeServersStop, pufferpanel.ScopeServersStart},
+	BulkActionInstall: {pufferpanel.ScopeServersInstall},
+	BulkActionCommand: {pufferpanel.ScopeServersConsoleSend},
+}
+
+// BulkActionRequest runs an action on every server matching all the filters given
+type BulkActionRequest struct {
+	Servers []string `json:"servers,omitempty"`
+	NodeId  *uint    `json:"node,omitempty"`
+	Type    string   `json:"type,omitempty"`
+	//servers on nodes with this tag
+	Tag string `json:"tag,omitempty"`
+
+	Action  string `json:"action"`
+	Command string `json:"command,omitempty"`
+}
+
+type BulkJobView struct {
+	Id         string            `json:"id"`
+	Action     string            `json:"action"`
+	Status     string            `json:"status"`
+	Total      int               `json:"total"`
+	Succeeded  int               `json:"succeeded"`
+	Failed     int               `json:"failed"`
+	Skipped    int               `json:"skipped"`
+	Results    []*BulkResultView `json:"results"`
+	StartedAt  time.Time         `json:"startedAt"`
+	FinishedAt *time.Time        `json:"finishedAt,omitempty"`
+
+	//only who started the job, or an admin, can see it
+	UserId uint `json:"-"`
+}
+
+type BulkResultView struct {
+	ServerId string `json:"serverId"`
+	Name     string `json:"name"`
+	NodeId   uint   `json:"nodeId"`
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+}
+
+func (r *BulkActionRequest) Valid() error {
+	if _, exists := BulkActionScopes[r.Action]; !exists {
+		return pufferpanel.ErrUnknownBulkAction(r.Action)
+	}
+	if r.Action == BulkActionCommand && r.Command == "" {
+		return pufferpanel.ErrFieldRequired("command")
+	}
+	//acting on every server at once has to be asked for by at least one filter
+	if len(r.Servers) == 0 && r.NodeId == nil && r.Type == "" && r.Tag == "" {
+		return pufferpanel.ErrBulkFilterRequired
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+/*
+ Copyright 2023 Padduck, LLC
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+  	http://www.apache.org/licenses/LICENSE-2.0
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+*/
+
+package models
+
+import (
+	"time"
+)
+
+// JoinToken lets a daemon register itself as a node without copying the credentials by hand.
+// A token can only be used once, and only its hash is stored
+type JoinToken struct {
+	ID uint `gorm:"primaryKey,autoIncrement" json:"-"`
+
+	NodeID      uint   `gorm:"NOT NULL;index" json:"-"`
+	HashedToken string `gorm:"column:token;NOT NULL;uniqueIndex;size:64" json:"-"`
+
+	ExpiresAt time.Time `json:"-"`
+	CreatedAt time.Time `json:"-"`
+}
+
+func (jt *JoinToken) SetToken(token string) {
+	jt.HashedToken = HashInviteToken(token)
+}
+
+func (jt *JoinToken) IsExpired() bool {
+	return jt.ExpiresAt.Before(time.Now())
+}
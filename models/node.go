@@ -33,6 +33,25 @@ type Node struct {
 
 	Secret string `gorm:"size=36;NOT NULL" json:"-" validate:"required"`
 
+	//what the panel last heard from the node, these are only changed by the heartbeat
+	Online   bool       `gorm:"NOT NULL;DEFAULT:false" json:"-"`
+	LastSeen *time.Time `json:"-"`
+	Version  string     `gorm:"size:100" json:"-"`
+	OS       string     `gorm:"size:20" json:"-"`
+	Arch     string     `gorm:"size:20" json:"-"`
+
+	//what the node can hold, 0 is no limit. Memory and disk are in MB, cpu is in percent of a core
+	MaxMemory  uint64   `gorm:"NOT NULL;DEFAULT:0" json:"-"`
+	MaxCpu     uint64   `gorm:"NOT NULL;DEFAULT:0" json:"-"`
+	MaxDisk    uint64   `gorm:"NOT NULL;DEFAULT:0" json:"-"`
+	MaxServers uint64   `gorm:"NOT NULL;DEFAULT:0" json:"-"`
+	Tags       []string `gorm:"-" json:"-" validate:"-"`
+	RawTags    string   `gorm:"column:tags;NOT NULL;size:255;DEFAULT:''" json:"-" validate:"-"`
+
+	//the certificate the panel expects from the node. Nodes with one are only called over mutual TLS
+	CertFingerprint string     `gorm:"size:64;NOT NULL;DEFAULT:''" json:"-"`
+	CertExpiresAt   *time.Time `json:"-"`
+
 	CreatedAt time.Time `json:"-"`
 	UpdatedAt time.Time `json:"-"`
 }
@@ -47,9 +66,29 @@ func (n *Node) IsValid() (err error) {
 
 func (n *Node) BeforeSave(*gorm.DB) (err error) {
 	err = n.IsValid()
+	n.RawTags = strings.Join(n.Tags, " ")
+	return
+}
+
+func (n *Node) AfterFind(*gorm.DB) (err error) {
+	n.Tags = strings.Fields(n.RawTags)
 	return
 }
 
+// UsesMTLS is if the panel talks to the node over mutual TLS
+func (n *Node) UsesMTLS() bool {
+	return !n.IsLocal() && n.CertFingerprint != ""
+}
+
+func (n *Node) HasTag(tag string) bool {
+	for _, v := range n.Tags {
+		if v == tag {
+			return true
+		}
+	}
+	return false
+}
+
 func (n *Node) IsLocal() bool {
 	return n.ID == LocalNode.ID
 }
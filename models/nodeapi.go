@@ -13,8 +13,49 @@
 
 package models
 
+import (
+	"github.com/pufferpanel/pufferpanel/v2"
+	"gopkg.in/go-playground/validator.v9"
+	"time"
+)
+
 type Deployment struct {
 	ClientId     string `json:"clientId"`
 	ClientSecret string `json:"clientSecret"`
 	PublicKey    string `json:"publicKey"`
 }
+
+type JoinTokenResponse struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// NodeJoinRequest is sent by a daemon joining the panel, with where the panel can reach it
+type NodeJoinRequest struct {
+	Token       string `json:"token"`
+	PublicHost  string `json:"publicHost,omitempty" validate:"omitempty,ip|fqdn"`
+	PublicPort  uint16 `json:"publicPort,omitempty"`
+	PrivateHost string `json:"privateHost,omitempty" validate:"omitempty,ip|fqdn"`
+	PrivatePort uint16 `json:"privatePort,omitempty"`
+	SFTPPort    uint16 `json:"sftpPort,omitempty"`
+
+	//if the panel uses mutual TLS with its nodes, it signs this and calls the node on the mtls port from then on
+	CertificateRequest string `json:"certificateRequest,omitempty"`
+	MTLSPort           uint16 `json:"mtlsPort,omitempty"`
+}
+
+func (r *NodeJoinRequest) Valid() error {
+	err := validator.New().Struct(r)
+	if err != nil {
+		return pufferpanel.GenerateValidationMessage(err)
+	}
+	return nil
+}
+
+type NodeJoinResponse struct {
+	NodeId uint `json:"nodeId"`
+	Deployment
+
+	Certificate string `json:"certificate,omitempty"`
+	CA          string `json:"ca,omitempty"`
+}
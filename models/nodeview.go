@@ -17,6 +17,7 @@ import (
 	"github.com/pufferpanel/pufferpanel/v2"
 	"gopkg.in/go-playground/validator.v9"
 	"net/url"
+	"time"
 )
 
 type NodeView struct {
@@ -28,20 +29,62 @@ type NodeView struct {
 	PrivatePort uint16 `json:"privatePort,omitempty"`
 	SFTPPort    uint16 `json:"sftpPort,omitempty"`
 	Local       bool   `json:"isLocal"`
+
+	Online   bool       `json:"online"`
+	LastSeen *time.Time `json:"lastSeen,omitempty"`
+	Version  string     `json:"version,omitempty"`
+	OS       string     `json:"os,omitempty"`
+	Arch     string     `json:"arch,omitempty"`
+
+	MaxMemory  *uint64    `json:"maxMemory,omitempty"`
+	MaxCpu     *uint64    `json:"maxCpu,omitempty"`
+	MaxDisk    *uint64    `json:"maxDisk,omitempty"`
+	MaxServers *uint64    `json:"maxServers,omitempty"`
+	Tags       []string   `json:"tags,omitempty"`
+	Usage      *NodeUsage `json:"usage,omitempty"`
+
+	MTLS          bool       `json:"mtls"`
+	CertExpiresAt *time.Time `json:"certExpiresAt,omitempty"`
+}
+
+// Allocation is what a server takes from its node. Memory and disk are in MB, cpu is in percent of a core
+type Allocation struct {
+	Memory uint64 `json:"memory"`
+	Cpu    uint64 `json:"cpu"`
+	Disk   uint64 `json:"disk"`
+}
+
+type NodeUsage struct {
+	Allocation
+	Servers uint64 `json:"servers"`
 }
 
 type NodesView []*NodeView
 
 func FromNode(n *Node) *NodeView {
+	maxMemory, maxCpu, maxDisk, maxServers := n.MaxMemory, n.MaxCpu, n.MaxDisk, n.MaxServers
+
 	return &NodeView{
-		Id:          n.ID,
-		Name:        n.Name,
-		PublicHost:  n.PublicHost,
-		PrivateHost: n.PrivateHost,
-		PublicPort:  n.PublicPort,
-		PrivatePort: n.PrivatePort,
-		SFTPPort:    n.SFTPPort,
-		Local:       n.IsLocal(),
+		Id:            n.ID,
+		Name:          n.Name,
+		PublicHost:    n.PublicHost,
+		PrivateHost:   n.PrivateHost,
+		PublicPort:    n.PublicPort,
+		PrivatePort:   n.PrivatePort,
+		SFTPPort:      n.SFTPPort,
+		Local:         n.IsLocal(),
+		Online:        n.Online,
+		LastSeen:      n.LastSeen,
+		Version:       n.Version,
+		OS:            n.OS,
+		Arch:          n.Arch,
+		MaxMemory:     &maxMemory,
+		MaxCpu:        &maxCpu,
+		MaxDisk:       &maxDisk,
+		MaxServers:    &maxServers,
+		Tags:          n.Tags,
+		MTLS:          n.UsesMTLS(),
+		CertExpiresAt: n.CertExpiresAt,
 	}
 }
 
@@ -79,6 +122,27 @@ func (n *NodeView) CopyToModel(newModel *Node) {
 	if n.SFTPPort > 0 {
 		newModel.SFTPPort = n.SFTPPort
 	}
+
+	//capacity can be set back to 0 to remove the limit, so only what is missing is left alone
+	if n.MaxMemory != nil {
+		newModel.MaxMemory = *n.MaxMemory
+	}
+
+	if n.MaxCpu != nil {
+		newModel.MaxCpu = *n.MaxCpu
+	}
+
+	if n.MaxDisk != nil {
+		newModel.MaxDisk = *n.MaxDisk
+	}
+
+	if n.MaxServers != nil {
+		newModel.MaxServers = *n.MaxServers
+	}
+
+	if n.Tags != nil {
+		newModel.Tags = n.Tags
+	}
 }
 
 func (n *NodeView) Valid(allowEmpty bool) error {
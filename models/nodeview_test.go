@@ -33,6 +33,8 @@ func TestFromNodes(t *testing.T) {
 		PrivatePort: 5658,
 		SFTPPort:    5657,
 		Secret:      "somesecret",
+		MaxMemory:   4096,
+		Tags:        []string{"eu"},
 	}
 
 	desired := make(NodesView, 1)
@@ -44,6 +46,11 @@ func TestFromNodes(t *testing.T) {
 		PublicPort:  sourceNode[0].PublicPort,
 		PrivatePort: sourceNode[0].PrivatePort,
 		SFTPPort:    sourceNode[0].SFTPPort,
+		MaxMemory:   &sourceNode[0].MaxMemory,
+		MaxCpu:      &sourceNode[0].MaxCpu,
+		MaxDisk:     &sourceNode[0].MaxDisk,
+		MaxServers:  &sourceNode[0].MaxServers,
+		Tags:        sourceNode[0].Tags,
 	}
 
 	tests := []struct {
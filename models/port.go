@@ -0,0 +1,77 @@
+/*
+ Copyright 2023 Padduck, LLC
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+  	http://www.apache.org/licenses/LICENSE-2.0
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+*/
+
+package models
+
+import (
+	"github.com/pufferpanel/pufferpanel/v2"
+	"gopkg.in/go-playground/validator.v9"
+	"gorm.io/gorm"
+)
+
+// PortPool is a range of ports on an IP of a node which servers are given ports from.
+// The panel's own node is node 0
+type PortPool struct {
+	ID     uint   `gorm:"primaryKey,autoIncrement" json:"-"`
+	NodeID uint   `gorm:"NOT NULL;index" json:"-"`
+	IP     string `gorm:"NOT NULL;size:100" json:"-" validate:"required,ip|fqdn"`
+
+	PortStart uint16 `gorm:"NOT NULL" json:"-" validate:"required"`
+	PortEnd   uint16 `gorm:"NOT NULL" json:"-" validate:"required,gtefield=PortStart"`
+}
+
+type PortPools []*PortPool
+
+// PortAllocation is a port given to a server. A port can only be given out once on a node, no matter the IP,
+// as a server listening on every address would take it from all of them
+type PortAllocation struct {
+	ID uint `gorm:"primaryKey,autoIncrement" json:"-"`
+
+	NodeID uint   `gorm:"NOT NULL;uniqueIndex:idx_node_port" json:"-"`
+	Port   uint16 `gorm:"NOT NULL;uniqueIndex:idx_node_port" json:"-"`
+	IP     string `gorm:"NOT NULL;size:100" json:"-"`
+
+	ServerIdentifier string `gorm:"NOT NULL;size:8;uniqueIndex:idx_server_port_name" json:"-"`
+	Name             string `gorm:"NOT NULL;size:100;uniqueIndex:idx_server_port_name" json:"-" validate:"required,printascii"`
+}
+
+type PortAllocations []*PortAllocation
+
+func (p *PortPool) IsValid() (err error) {
+	err = validator.New().Struct(p)
+	if err != nil {
+		err = pufferpanel.GenerateValidationMessage(err)
+	}
+	return
+}
+
+func (p *PortPool) BeforeSave(*gorm.DB) error {
+	return p.IsValid()
+}
+
+// Overlaps checks if the pools share any port
+func (p *PortPool) Overlaps(other *PortPool) bool {
+	return p.PortStart <= other.PortEnd && other.PortStart <= p.PortEnd
+}
+
+func (p *PortAllocation) IsValid() (err error) {
+	err = validator.New().Struct(p)
+	if err != nil {
+		err = pufferpanel.GenerateValidationMessage(err)
+	}
+	return
+}
+
+func (p *PortAllocation) BeforeSave(*gorm.DB) error {
+	return p.IsValid()
+}
@@ -0,0 +1,85 @@
+/*
+ Copyright 2023 Padduck, LLC
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+  	http://www.apache.org/licenses/LICENSE-2.0
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+*/
+
+package models
+
+import (
+	"github.com/pufferpanel/pufferpanel/v2"
+	"gopkg.in/go-playground/validator.v9"
+)
+
+type PortPoolView struct {
+	Id        uint   `json:"id,omitempty"`
+	IP        string `json:"ip" validate:"required,ip|fqdn"`
+	PortStart uint16 `json:"portStart" validate:"required"`
+	PortEnd   uint16 `json:"portEnd" validate:"required,gtefield=PortStart"`
+}
+
+type PortPoolsView []*PortPoolView
+
+type PortAllocationView struct {
+	Name     string `json:"name"`
+	IP       string `json:"ip"`
+	Port     uint16 `json:"port"`
+	ServerId string `json:"serverId,omitempty"`
+}
+
+type PortAllocationsView []*PortAllocationView
+
+func FromPortPool(p *PortPool) *PortPoolView {
+	return &PortPoolView{
+		Id:        p.ID,
+		IP:        p.IP,
+		PortStart: p.PortStart,
+		PortEnd:   p.PortEnd,
+	}
+}
+
+func FromPortPools(p []*PortPool) *PortPoolsView {
+	result := make(PortPoolsView, len(p))
+
+	for k, v := range p {
+		result[k] = FromPortPool(v)
+	}
+
+	return &result
+}
+
+func FromPortAllocations(p []*PortAllocation) *PortAllocationsView {
+	result := make(PortAllocationsView, len(p))
+
+	for k, v := range p {
+		result[k] = &PortAllocationView{
+			Name:     v.Name,
+			IP:       v.IP,
+			Port:     v.Port,
+			ServerId: v.ServerIdentifier,
+		}
+	}
+
+	return &result
+}
+
+func (p *PortPoolView) CopyToModel(model *PortPool) {
+	model.IP = p.IP
+	model.PortStart = p.PortStart
+	model.PortEnd = p.PortEnd
+}
+
+func (p *PortPoolView) Valid() error {
+	err := validator.New().Struct(p)
+	if err != nil {
+		return pufferpanel.GenerateValidationMessage(err)
+	}
+	return nil
+}
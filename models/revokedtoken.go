@@ -0,0 +1,23 @@
+/*
+ Copyright 2023 Padduck, LLC
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+  	http://www.apache.org/licenses/LICENSE-2.0
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+*/
+
+package models
+
+import "time"
+
+// RevokedToken is an access token which was revoked before it expired. It is only kept until it would have expired
+type RevokedToken struct {
+	//the jti of the token
+	ID        string    `gorm:"primaryKey;size:64" json:"-"`
+	ExpiresAt time.Time `gorm:"NOT NULL;index" json:"-"`
+}
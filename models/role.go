@@ -0,0 +1,107 @@
+/*
+ Copyright 2023 Padduck, LLC
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+  	http://www.apache.org/licenses/LICENSE-2.0
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+*/
+
+package models
+
+import (
+	"github.com/pufferpanel/pufferpanel/v2"
+	"gopkg.in/go-playground/validator.v9"
+	"gorm.io/gorm"
+	"strings"
+)
+
+const RoleAdmin = "admin"
+const RoleServerOwner = "server-owner"
+
+// Role is a named bundle of scopes which can be assigned to users, either globally or for a single server
+type Role struct {
+	ID          uint   `gorm:"primaryKey,autoIncrement" json:"id"`
+	Name        string `gorm:"NOT NULL;uniqueIndex;size:100" json:"name" validate:"required,printascii,max=100"`
+	Description string `gorm:"NOT NULL;size:4000;default:\"\"" json:"description"`
+
+	//built in roles are managed by the panel and cannot be changed through the API
+	BuiltIn bool `gorm:"NOT NULL;DEFAULT:0" json:"builtIn"`
+
+	Scopes    []pufferpanel.Scope `gorm:"-" json:"scopes"`
+	RawScopes string              `gorm:"column:scopes;NOT NULL;size:4000" json:"-"`
+}
+
+type Roles []*Role
+
+// RoleAssignment grants a role to a user. If ServerIdentifier is nil, the role applies globally
+type RoleAssignment struct {
+	ID uint `gorm:"primaryKey,autoIncrement" json:"-"`
+
+	RoleId uint `gorm:"NOT NULL" json:"-"`
+	Role   Role `gorm:"ASSOCIATION_SAVE_REFERENCE:false" json:"-" validate:"-"`
+
+	UserId uint `gorm:"NOT NULL" json:"-"`
+	User   User `gorm:"ASSOCIATION_SAVE_REFERENCE:false" json:"-" validate:"-"`
+
+	ServerIdentifier *string `json:"-"`
+	Server           Server  `gorm:"ASSOCIATION_SAVE_REFERENCE:false" json:"-" validate:"-"`
+
+	//assignments converted from the permission flags are replaced when those flags are edited
+	FromPermissions bool `gorm:"NOT NULL;DEFAULT:0" json:"-"`
+}
+
+type RoleAssignments []*RoleAssignment
+
+func (r *Role) IsValid() (err error) {
+	err = validator.New().Struct(r)
+
+	if err != nil {
+		err = pufferpanel.GenerateValidationMessage(err)
+	}
+
+	return
+}
+
+func (r *Role) BeforeSave(*gorm.DB) (err error) {
+	err = r.IsValid()
+	if err != nil {
+		return
+	}
+
+	scopes := make([]string, 0)
+
+	for _, s := range r.Scopes {
+		scopes = append(scopes, string(s))
+	}
+	r.RawScopes = strings.Join(scopes, " ")
+
+	return
+}
+
+func (r *Role) AfterFind(*gorm.DB) (err error) {
+	if r.RawScopes == "" {
+		r.Scopes = make([]pufferpanel.Scope, 0)
+		return
+	}
+
+	split := strings.Split(r.RawScopes, " ")
+	r.Scopes = make([]pufferpanel.Scope, len(split))
+
+	for i, v := range split {
+		r.Scopes[i] = pufferpanel.Scope(v)
+	}
+
+	return
+}
+
+func (ra *RoleAssignment) BeforeSave(*gorm.DB) error {
+	if ra.ServerIdentifier != nil && *ra.ServerIdentifier == "" {
+		ra.ServerIdentifier = nil
+	}
+	return nil
+}
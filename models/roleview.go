@@ -0,0 +1,107 @@
+/*
+ Copyright 2023 Padduck, LLC
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+  	http://www.apache.org/licenses/LICENSE-2.0
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+*/
+
+package models
+
+import (
+	"github.com/pufferpanel/pufferpanel/v2"
+	"gopkg.in/go-playground/validator.v9"
+)
+
+type RoleView struct {
+	Id          uint                `json:"id"`
+	Name        string              `json:"name,omitempty"`
+	Description string              `json:"description,omitempty"`
+	BuiltIn     bool                `json:"builtIn"`
+	Scopes      []pufferpanel.Scope `json:"scopes"`
+}
+
+type RolesView []*RoleView
+
+type RoleAssignmentView struct {
+	Username         string `json:"username,omitempty"`
+	ServerIdentifier string `json:"serverIdentifier,omitempty"`
+}
+
+type RoleAssignmentsView []*RoleAssignmentView
+
+func FromRole(r *Role) *RoleView {
+	return &RoleView{
+		Id:          r.ID,
+		Name:        r.Name,
+		Description: r.Description,
+		BuiltIn:     r.BuiltIn,
+		Scopes:      r.Scopes,
+	}
+}
+
+func FromRoles(r []*Role) *RolesView {
+	result := make(RolesView, len(r))
+
+	for k, v := range r {
+		result[k] = FromRole(v)
+	}
+
+	return &result
+}
+
+func FromRoleAssignments(r []*RoleAssignment) *RoleAssignmentsView {
+	result := make(RoleAssignmentsView, len(r))
+
+	for k, v := range r {
+		result[k] = &RoleAssignmentView{
+			Username: v.User.Username,
+		}
+		if v.ServerIdentifier != nil {
+			result[k].ServerIdentifier = *v.ServerIdentifier
+		}
+	}
+
+	return &result
+}
+
+func (r *RoleView) CopyToModel(newModel *Role) {
+	if r.Name != "" {
+		newModel.Name = r.Name
+	}
+
+	newModel.Description = r.Description
+
+	if r.Scopes != nil {
+		newModel.Scopes = r.Scopes
+	}
+}
+
+func (r *RoleView) Valid(allowEmpty bool) error {
+	validate := validator.New()
+
+	if !allowEmpty && validate.Var(r.Name, "required") != nil {
+		return pufferpanel.ErrFieldRequired("name")
+	}
+
+	if validate.Var(r.Name, "omitempty,printascii") != nil {
+		return pufferpanel.ErrFieldMustBePrintable("name")
+	}
+
+	if validate.Var(r.Name, "omitempty,max=100") != nil {
+		return pufferpanel.ErrFieldLength("name", 1, 100)
+	}
+
+	for _, v := range r.Scopes {
+		if !v.IsAssignable() {
+			return pufferpanel.ErrUnknownScope(v)
+		}
+	}
+
+	return nil
+}
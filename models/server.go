@@ -33,6 +33,15 @@ type Server struct {
 
 	Type string `gorm:"NOT NULL;default='generic'" json:"-" validate:"required,printascii"`
 
+	//what the server was given on its node, in the same units as the node capacity
+	Memory uint64 `gorm:"NOT NULL;DEFAULT:0" json:"-"`
+	Cpu    uint64 `gorm:"NOT NULL;DEFAULT:0" json:"-"`
+	Disk   uint64 `gorm:"NOT NULL;DEFAULT:0" json:"-"`
+
+	//if owned by a team, members of the team get access through their team role
+	TeamId *uint `gorm:"column:team_id" json:"-"`
+	Team   *Team `gorm:"ASSOCIATION_SAVE_REFERENCE:false" json:"-" validate:"-"`
+
 	CreatedAt time.Time `json:"-"`
 	UpdatedAt time.Time `json:"-"`
 }
@@ -55,6 +64,10 @@ func (s *Server) BeforeSave(*gorm.DB) (err error) {
 	return
 }
 
+func (s *Server) GetAllocation() Allocation {
+	return Allocation{Memory: s.Memory, Cpu: s.Cpu, Disk: s.Disk}
+}
+
 func (s *Server) AfterFind(*gorm.DB) (err error) {
 	if s.Node.ID == 0 {
 		s.Node = *LocalNode
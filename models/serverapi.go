@@ -21,9 +21,15 @@ import (
 type ServerCreation struct {
 	pufferpanel.Server
 
-	NodeId uint     `json:"node"`
-	Users  []string `json:"users"`
-	Name   string   `json:"name"`
+	//if no node is given, one is chosen using the placement mode and tags
+	NodeId    *uint    `json:"node"`
+	Placement string   `json:"placement,omitempty"`
+	Tags      []string `json:"tags,omitempty"`
+	//names of the extra ports to give the server from the node's pools, such as query or rcon
+	PortNames []string `json:"portNames,omitempty"`
+	Users     []string `json:"users"`
+	Name      string   `json:"name"`
+	TeamId    uint     `json:"team,omitempty"`
 }
 
 type GetServerResponse struct {
@@ -28,6 +28,7 @@ type ServerView struct {
 	IP         string           `json:"ip,omitempty"`
 	Port       uint16           `json:"port,omitempty"`
 	Type       string           `json:"type"`
+	TeamId     *uint            `json:"teamId,omitempty"`
 }
 
 type ServerUserView struct {
@@ -43,6 +44,7 @@ func FromServer(server *Server) *ServerView {
 		IP:         server.IP,
 		Port:       server.Port,
 		Type:       server.Type,
+		TeamId:     server.TeamId,
 	}
 
 	model.Node = FromNode(&server.Node)
@@ -0,0 +1,53 @@
+/*
+ Copyright 2023 Padduck, LLC
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+  	http://www.apache.org/licenses/LICENSE-2.0
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+*/
+
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+)
+
+// Session is a login of a user. Session tokens carry the id of the session they were issued for, so removing the
+// session revokes them
+type Session struct {
+	ID     uint `gorm:"primaryKey,autoIncrement" json:"-"`
+	UserId uint `gorm:"NOT NULL;index" json:"-"`
+	User   User `gorm:"ASSOCIATION_SAVE_REFERENCE:false" json:"-" validate:"-"`
+
+	//sha256 of the refresh token, the token itself is only given to the client
+	HashedRefreshToken string `gorm:"column:refresh_token;NOT NULL;uniqueIndex;size:64" json:"-"`
+
+	UserAgent string `gorm:"NOT NULL;size:255;default:\"\"" json:"-"`
+	IpAddress string `gorm:"NOT NULL;size:64;default:\"\"" json:"-"`
+
+	CreatedAt time.Time `json:"-"`
+	LastUsed  time.Time `json:"-"`
+	ExpiresAt time.Time `gorm:"NOT NULL;index" json:"-"`
+}
+
+type Sessions []*Session
+
+func (s *Session) SetRefreshToken(token string) {
+	s.HashedRefreshToken = HashRefreshToken(token)
+}
+
+func (s *Session) IsExpired() bool {
+	return time.Now().After(s.ExpiresAt)
+}
+
+func HashRefreshToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
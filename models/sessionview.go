@@ -0,0 +1,49 @@
+/*
+ Copyright 2023 Padduck, LLC
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+  	http://www.apache.org/licenses/LICENSE-2.0
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+*/
+
+package models
+
+import (
+	"time"
+)
+
+type SessionView struct {
+	Id        uint      `json:"id"`
+	UserAgent string    `json:"userAgent,omitempty"`
+	IpAddress string    `json:"ipAddress,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	LastUsed  time.Time `json:"lastUsed"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	Current   bool      `json:"current"`
+}
+
+type SessionsView []*SessionView
+
+// FromSessions converts the sessions, flagging the one with the id of currentId
+func FromSessions(s []*Session, currentId uint) *SessionsView {
+	result := make(SessionsView, len(s))
+
+	for k, v := range s {
+		result[k] = &SessionView{
+			Id:        v.ID,
+			UserAgent: v.UserAgent,
+			IpAddress: v.IpAddress,
+			CreatedAt: v.CreatedAt,
+			LastUsed:  v.LastUsed,
+			ExpiresAt: v.ExpiresAt,
+			Current:   v.ID == currentId,
+		}
+	}
+
+	return &result
+}
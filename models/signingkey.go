@@ -0,0 +1,52 @@
+/*
+ Copyright 2023 Padduck, LLC
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+  	http://www.apache.org/licenses/LICENSE-2.0
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+*/
+
+package models
+
+import (
+	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"time"
+)
+
+// SigningKey is a key used to sign tokens. Once replaced by a newer key it is retired, but still accepted for a
+// while so tokens it signed do not suddenly stop working
+type SigningKey struct {
+	//the RFC 7638 thumbprint of the public key, used as the kid of tokens
+	ID         string `gorm:"primaryKey;size:64" json:"-"`
+	PrivateKey string `gorm:"NOT NULL;size:1024" json:"-"`
+
+	CreatedAt time.Time  `json:"-"`
+	RetiredAt *time.Time `gorm:"index" json:"-"`
+}
+
+type SigningKeys []*SigningKey
+
+func (s *SigningKey) SetKey(key *ecdsa.PrivateKey) error {
+	encoded, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+	s.PrivateKey = string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: encoded}))
+	return nil
+}
+
+func (s *SigningKey) GetKey() (*ecdsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(s.PrivateKey))
+	if block == nil {
+		return nil, errors.New("signing key is not valid pem")
+	}
+	return x509.ParseECPrivateKey(block.Bytes)
+}
@@ -0,0 +1,103 @@
+/*
+ Copyright 2023 Padduck, LLC
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+  	http://www.apache.org/licenses/LICENSE-2.0
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+*/
+
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/pufferpanel/pufferpanel/v2"
+	"gopkg.in/go-playground/validator.v9"
+	"gorm.io/gorm"
+	"time"
+)
+
+// Team owns servers, and grants its members access to them through the role each member holds
+type Team struct {
+	ID          uint   `gorm:"primaryKey,autoIncrement" json:"-"`
+	Name        string `gorm:"NOT NULL;uniqueIndex;size:100" json:"-" validate:"required,printascii,max=100"`
+	Description string `gorm:"NOT NULL;size:4000;default:\"\"" json:"-"`
+
+	//quotas, 0 means unlimited
+	MaxServers uint `gorm:"NOT NULL;DEFAULT:0" json:"-"`
+	MaxMembers uint `gorm:"NOT NULL;DEFAULT:0" json:"-"`
+
+	CreatedAt time.Time `json:"-"`
+	UpdatedAt time.Time `json:"-"`
+}
+
+type Teams []*Team
+
+type TeamMember struct {
+	ID uint `gorm:"primaryKey,autoIncrement" json:"-"`
+
+	TeamId uint `gorm:"NOT NULL;uniqueIndex:idx_team_member" json:"-"`
+	Team   Team `gorm:"ASSOCIATION_SAVE_REFERENCE:false" json:"-" validate:"-"`
+
+	UserId uint `gorm:"NOT NULL;uniqueIndex:idx_team_member" json:"-"`
+	User   User `gorm:"ASSOCIATION_SAVE_REFERENCE:false" json:"-" validate:"-"`
+
+	//the role this member has on every server the team owns
+	RoleId uint `gorm:"NOT NULL" json:"-"`
+	Role   Role `gorm:"ASSOCIATION_SAVE_REFERENCE:false" json:"-" validate:"-"`
+
+	//managers may change the members of the team
+	Manager bool `gorm:"NOT NULL;DEFAULT:0" json:"-"`
+}
+
+type TeamMembers []*TeamMember
+
+type TeamInvite struct {
+	ID uint `gorm:"primaryKey,autoIncrement" json:"-"`
+
+	TeamId uint `gorm:"NOT NULL" json:"-"`
+	Team   Team `gorm:"ASSOCIATION_SAVE_REFERENCE:false" json:"-" validate:"-"`
+
+	Email       string `gorm:"NOT NULL;size:255" json:"-" validate:"required,email"`
+	HashedToken string `gorm:"column:token;NOT NULL;uniqueIndex;size:64" json:"-"`
+
+	RoleId  uint `gorm:"NOT NULL" json:"-"`
+	Role    Role `gorm:"ASSOCIATION_SAVE_REFERENCE:false" json:"-" validate:"-"`
+	Manager bool `gorm:"NOT NULL;DEFAULT:0" json:"-"`
+
+	ExpiresAt time.Time `json:"-"`
+	CreatedAt time.Time `json:"-"`
+}
+
+type TeamInvites []*TeamInvite
+
+func (t *Team) IsValid() (err error) {
+	err = validator.New().Struct(t)
+	if err != nil {
+		err = pufferpanel.GenerateValidationMessage(err)
+	}
+	return
+}
+
+func (t *Team) BeforeSave(*gorm.DB) error {
+	return t.IsValid()
+}
+
+func (ti *TeamInvite) SetToken(token string) {
+	ti.HashedToken = HashInviteToken(token)
+}
+
+func (ti *TeamInvite) IsExpired() bool {
+	return ti.ExpiresAt.Before(time.Now())
+}
+
+// HashInviteToken hashes the token sent in an invite, so that the database does not hold usable tokens
+func HashInviteToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
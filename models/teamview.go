@@ -0,0 +1,142 @@
+/*
+ Copyright 2023 Padduck, LLC
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+  	http://www.apache.org/licenses/LICENSE-2.0
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+*/
+
+package models
+
+import (
+	"github.com/pufferpanel/pufferpanel/v2"
+	"gopkg.in/go-playground/validator.v9"
+	"time"
+)
+
+type TeamView struct {
+	Id          uint   `json:"id"`
+	Name        string `json:"name,omitempty"`
+	Description string `json:"description,omitempty"`
+	MaxServers  *uint  `json:"maxServers,omitempty"`
+	MaxMembers  *uint  `json:"maxMembers,omitempty"`
+}
+
+type TeamsView []*TeamView
+
+type TeamMemberView struct {
+	UserId   uint   `json:"userId"`
+	Username string `json:"username,omitempty"`
+	Email    string `json:"email,omitempty"`
+	RoleId   uint   `json:"roleId"`
+	Role     string `json:"role,omitempty"`
+	Manager  bool   `json:"manager"`
+}
+
+type TeamMembersView []*TeamMemberView
+
+type TeamInviteView struct {
+	Id        uint      `json:"id"`
+	Email     string    `json:"email"`
+	RoleId    uint      `json:"roleId"`
+	Manager   bool      `json:"manager"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+type TeamInvitesView []*TeamInviteView
+
+func FromTeam(t *Team) *TeamView {
+	maxServers := t.MaxServers
+	maxMembers := t.MaxMembers
+	return &TeamView{
+		Id:          t.ID,
+		Name:        t.Name,
+		Description: t.Description,
+		MaxServers:  &maxServers,
+		MaxMembers:  &maxMembers,
+	}
+}
+
+func FromTeams(t []*Team) *TeamsView {
+	result := make(TeamsView, len(t))
+
+	for k, v := range t {
+		result[k] = FromTeam(v)
+	}
+
+	return &result
+}
+
+func FromTeamMembers(m []*TeamMember) *TeamMembersView {
+	result := make(TeamMembersView, len(m))
+
+	for k, v := range m {
+		result[k] = &TeamMemberView{
+			UserId:   v.UserId,
+			Username: v.User.Username,
+			Email:    v.User.Email,
+			RoleId:   v.RoleId,
+			Role:     v.Role.Name,
+			Manager:  v.Manager,
+		}
+	}
+
+	return &result
+}
+
+func FromTeamInvites(i []*TeamInvite) *TeamInvitesView {
+	result := make(TeamInvitesView, len(i))
+
+	for k, v := range i {
+		result[k] = &TeamInviteView{
+			Id:        v.ID,
+			Email:     v.Email,
+			RoleId:    v.RoleId,
+			Manager:   v.Manager,
+			ExpiresAt: v.ExpiresAt,
+		}
+	}
+
+	return &result
+}
+
+func (t *TeamView) CopyToModel(newModel *Team) {
+	if t.Name != "" {
+		newModel.Name = t.Name
+	}
+
+	if t.Description != "" {
+		newModel.Description = t.Description
+	}
+
+	if t.MaxServers != nil {
+		newModel.MaxServers = *t.MaxServers
+	}
+
+	if t.MaxMembers != nil {
+		newModel.MaxMembers = *t.MaxMembers
+	}
+}
+
+func (t *TeamView) Valid(allowEmpty bool) error {
+	validate := validator.New()
+
+	if !allowEmpty && validate.Var(t.Name, "required") != nil {
+		return pufferpanel.ErrFieldRequired("name")
+	}
+
+	if validate.Var(t.Name, "omitempty,printascii") != nil {
+		return pufferpanel.ErrFieldMustBePrintable("name")
+	}
+
+	if validate.Var(t.Name, "omitempty,max=100") != nil {
+		return pufferpanel.ErrFieldLength("name", 1, 100)
+	}
+
+	return nil
+}
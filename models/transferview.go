@@ -0,0 +1,33 @@
+/*
+ Copyright 2023 Padduck, LLC
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+  	http://www.apache.org/licenses/LICENSE-2.0
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+*/
+
+package models
+
+import (
+	"time"
+)
+
+type TransferView struct {
+	ServerId     string     `json:"serverId"`
+	SourceNodeId uint       `json:"sourceNodeId"`
+	TargetNodeId uint       `json:"targetNodeId"`
+	Stage        string     `json:"stage"`
+	Bytes        int64      `json:"bytes"`
+	Error        string     `json:"error,omitempty"`
+	StartedAt    time.Time  `json:"startedAt"`
+	FinishedAt   *time.Time `json:"finishedAt,omitempty"`
+}
+
+type TransferRequest struct {
+	NodeId uint `json:"nodeId"`
+}
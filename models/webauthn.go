@@ -0,0 +1,56 @@
+/*
+ Copyright 2023 Padduck, LLC
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+  	http://www.apache.org/licenses/LICENSE-2.0
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+*/
+
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"time"
+)
+
+// WebAuthnCredential is a security key or passkey a user can use as their second factor
+type WebAuthnCredential struct {
+	ID     uint `gorm:"primaryKey,autoIncrement" json:"-"`
+	UserId uint `gorm:"NOT NULL;index" json:"-"`
+	User   User `gorm:"ASSOCIATION_SAVE_REFERENCE:false" json:"-" validate:"-"`
+
+	//base64url encoded credential id, as the browser reports it
+	CredentialId string `gorm:"NOT NULL;uniqueIndex;size:1024" json:"-"`
+	//COSE encoded public key
+	PublicKey []byte `gorm:"NOT NULL" json:"-"`
+	SignCount uint32 `gorm:"NOT NULL;DEFAULT:0" json:"-"`
+	Name      string `gorm:"NOT NULL;size:100;default:\"\"" json:"-"`
+
+	CreatedAt time.Time  `json:"-"`
+	LastUsed  *time.Time `json:"-"`
+}
+
+type WebAuthnCredentials []*WebAuthnCredential
+
+// RecoveryCode is a one-time code that can be used in place of a user's second factor. Only the hash is stored
+type RecoveryCode struct {
+	ID         uint   `gorm:"primaryKey,autoIncrement" json:"-"`
+	UserId     uint   `gorm:"NOT NULL;index" json:"-"`
+	HashedCode string `gorm:"column:code;NOT NULL;size:64" json:"-"`
+
+	CreatedAt time.Time `json:"-"`
+}
+
+// HashRecoveryCode hashes the code the way it is stored. Codes are compared ignoring case and separators
+func HashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	hash := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(hash[:])
+}
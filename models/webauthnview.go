@@ -0,0 +1,58 @@
+/*
+ Copyright 2023 Padduck, LLC
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+  	http://www.apache.org/licenses/LICENSE-2.0
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+*/
+
+package models
+
+import (
+	"github.com/go-webauthn/webauthn/protocol"
+	"time"
+)
+
+type WebAuthnCredentialView struct {
+	Id        uint       `json:"id"`
+	Name      string     `json:"name"`
+	CreatedAt time.Time  `json:"createdAt"`
+	LastUsed  *time.Time `json:"lastUsed,omitempty"`
+}
+
+type WebAuthnCredentialsView []*WebAuthnCredentialView
+
+func FromWebAuthnCredential(c *WebAuthnCredential) *WebAuthnCredentialView {
+	return &WebAuthnCredentialView{
+		Id:        c.ID,
+		Name:      c.Name,
+		CreatedAt: c.CreatedAt,
+		LastUsed:  c.LastUsed,
+	}
+}
+
+func FromWebAuthnCredentials(c []*WebAuthnCredential) *WebAuthnCredentialsView {
+	result := make(WebAuthnCredentialsView, len(c))
+
+	for k, v := range c {
+		result[k] = FromWebAuthnCredential(v)
+	}
+
+	return &result
+}
+
+// WebAuthnAttestationResponse is the credential returned by navigator.credentials.create, with a name for it
+type WebAuthnAttestationResponse struct {
+	protocol.CredentialCreationResponse
+	Name string `json:"name,omitempty"`
+}
+
+// WebAuthnAssertionResponse is the credential returned by navigator.credentials.get
+type WebAuthnAssertionResponse struct {
+	protocol.CredentialAssertionResponse
+}
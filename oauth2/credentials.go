@@ -0,0 +1,81 @@
+/*
+ Copyright 2023 Padduck, LLC
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+  	http://www.apache.org/licenses/LICENSE-2.0
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+*/
+
+package oauth2
+
+import (
+	"errors"
+	"github.com/pufferpanel/pufferpanel/v2/config"
+	"github.com/pufferpanel/pufferpanel/v2/logging"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/ssh"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type cachedCredential struct {
+	hash      []byte
+	serverId  string
+	validated time.Time
+}
+
+// keyed by username, only a hash of the password is kept
+var credentialCache = make(map[string]cachedCredential)
+var credentialLocker sync.Mutex
+
+// rememberCredential keeps a login the panel accepted, so it can still be used while the panel cannot be reached
+func rememberCredential(username, password, serverId string) {
+	if config.OfflineGraceMinutes.Value() <= 0 {
+		return
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		logging.Debug.Printf("Could not cache login for %s: %s", username, err)
+		return
+	}
+
+	credentialLocker.Lock()
+	defer credentialLocker.Unlock()
+	for k, v := range credentialCache {
+		if !WithinGracePeriod(v.validated) {
+			delete(credentialCache, k)
+		}
+	}
+	credentialCache[username] = cachedCredential{hash: hash, serverId: serverId, validated: time.Now()}
+}
+
+func forgetCredential(username string) {
+	credentialLocker.Lock()
+	defer credentialLocker.Unlock()
+	delete(credentialCache, username)
+}
+
+// validateCachedSSH lets in a login the panel accepted within the grace period
+func validateCachedSSH(username, password string) (*ssh.Permissions, error) {
+	credentialLocker.Lock()
+	cached, exists := credentialCache[username]
+	credentialLocker.Unlock()
+
+	if !exists || !WithinGracePeriod(cached.validated) || bcrypt.CompareHashAndPassword(cached.hash, []byte(password)) != nil {
+		return nil, errors.New("incorrect username or password")
+	}
+
+	logging.Info.Printf("Panel cannot be reached, letting %s in from a cached login", username)
+	sshPerms := &ssh.Permissions{}
+	sshPerms.Extensions = make(map[string]string)
+	sshPerms.Extensions["server_id"] = cached.serverId
+	sshPerms.Extensions["cached_validated"] = strconv.FormatInt(cached.validated.Unix(), 10)
+	return sshPerms, nil
+}
@@ -0,0 +1,152 @@
+/*
+ Copyright 2023 Padduck, LLC
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+  	http://www.apache.org/licenses/LICENSE-2.0
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+*/
+
+package oauth2
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/pufferpanel/pufferpanel/v2"
+	"github.com/pufferpanel/pufferpanel/v2/config"
+	"github.com/pufferpanel/pufferpanel/v2/logging"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// how many events are sent to the panel at once
+const eventBatchSize = 100
+
+type queuedEvent struct {
+	id    uint64
+	event pufferpanel.PanelEvent
+}
+
+var eventQueue = make([]queuedEvent, 0)
+var lastEventId uint64
+var eventsFlushing bool
+var eventLocker sync.Mutex
+
+// QueueEvent tells the panel about something that happened on this node. While the panel cannot be reached, events
+// are held until it is back, dropping the oldest once the queue is full
+func QueueEvent(eventType, serverId string) {
+	//the panel is running here, there is no one to tell
+	if config.PanelEnabled.Value() {
+		return
+	}
+
+	eventLocker.Lock()
+	lastEventId++
+	eventQueue = append(eventQueue, queuedEvent{
+		id:    lastEventId,
+		event: pufferpanel.PanelEvent{Type: eventType, Server: serverId, At: time.Now()},
+	})
+	if limit := config.EventQueueSize.Value(); limit > 0 && len(eventQueue) > limit {
+		logging.Debug.Printf("Event queue is full, dropping %d events", len(eventQueue)-limit)
+		eventQueue = eventQueue[len(eventQueue)-limit:]
+	}
+	eventLocker.Unlock()
+
+	if !IsDegraded() {
+		go flushEvents()
+	}
+}
+
+func queuedEvents() int {
+	eventLocker.Lock()
+	defer eventLocker.Unlock()
+	return len(eventQueue)
+}
+
+// flushEvents sends the queued events to the panel, stopping if it cannot be reached
+func flushEvents() {
+	eventLocker.Lock()
+	if eventsFlushing {
+		eventLocker.Unlock()
+		return
+	}
+	eventsFlushing = true
+	eventLocker.Unlock()
+
+	for {
+		eventLocker.Lock()
+		if len(eventQueue) == 0 || IsDegraded() {
+			eventsFlushing = false
+			eventLocker.Unlock()
+			return
+		}
+		count := len(eventQueue)
+		if count > eventBatchSize {
+			count = eventBatchSize
+		}
+		batch := make([]pufferpanel.PanelEvent, count)
+		for k, v := range eventQueue[:count] {
+			batch[k] = v.event
+		}
+		sent := eventQueue[count-1].id
+		eventLocker.Unlock()
+
+		err := sendEvents(batch, true)
+		if err != nil && IsDegraded() {
+			//these are sent once the panel is back
+			continue
+		}
+		if err != nil {
+			logging.Error.Printf("Panel did not accept %d events: %s", len(batch), err)
+		}
+
+		//the oldest may have been dropped while these were sent, so only remove what was sent
+		eventLocker.Lock()
+		for len(eventQueue) > 0 && eventQueue[0].id <= sent {
+			eventQueue = eventQueue[1:]
+		}
+		eventLocker.Unlock()
+	}
+}
+
+func sendEvents(events []pufferpanel.PanelEvent, recurse bool) error {
+	data, err := json.Marshal(events)
+	if err != nil {
+		return err
+	}
+
+	request, err := http.NewRequest(http.MethodPost, PanelUrl("/api/nodes/events"), bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+
+	RefreshIfStale()
+
+	atLocker.RLock()
+	request.Header.Add("Authorization", "Bearer "+daemonToken)
+	atLocker.RUnlock()
+	request.Header.Add("Content-Type", binding.MIMEJSON)
+
+	response, err := CallPanel(request)
+	defer pufferpanel.CloseResponse(response)
+	if err != nil {
+		return err
+	}
+
+	if response.StatusCode == http.StatusUnauthorized && recurse && RefreshToken() {
+		pufferpanel.CloseResponse(response)
+		return sendEvents(events, false)
+	}
+
+	if response.StatusCode != http.StatusNoContent && response.StatusCode != http.StatusOK {
+		return fmt.Errorf("panel responded with status %d", response.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+/*
+ Copyright 2023 Padduck, LLC
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+  	http://www.apache.org/licenses/LICENSE-2.0
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+*/
+
+package oauth2
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"github.com/pufferpanel/pufferpanel/v2"
+	"github.com/pufferpanel/pufferpanel/v2/logging"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// how long the node trusts what the panel said about a token before asking again
+const introspectionCacheDuration = 10 * time.Second
+
+type introspectionCacheEntry struct {
+	response  *TokenInfoResponse
+	expires   time.Time
+	validated time.Time
+}
+
+// keyed by the hash of the token, so tokens are not kept around
+var introspectionCache = make(map[string]introspectionCacheEntry)
+var introspectionLocker sync.RWMutex
+
+// Introspect asks the panel if the token is still active. The answer is remembered for a few seconds, so a revoked
+// token stops working on every node shortly after. While the panel cannot be reached, the last answer is used until
+// the offline grace period runs out
+func Introspect(token string) (*TokenInfoResponse, error) {
+	hash := sha256.Sum256([]byte(token))
+	key := hex.EncodeToString(hash[:])
+
+	introspectionLocker.RLock()
+	cached, exists := introspectionCache[key]
+	introspectionLocker.RUnlock()
+	if exists && time.Now().Before(cached.expires) {
+		return cached.response, nil
+	}
+
+	result, err := introspect(token, true)
+	if err != nil {
+		if exists && IsDegraded() && WithinGracePeriod(cached.validated) {
+			return cached.response, nil
+		}
+		return nil, err
+	}
+
+	introspectionLocker.Lock()
+	defer introspectionLocker.Unlock()
+	now := time.Now()
+	for k, v := range introspectionCache {
+		if now.After(v.expires) && !WithinGracePeriod(v.validated) {
+			delete(introspectionCache, k)
+		}
+	}
+	introspectionCache[key] = introspectionCacheEntry{response: result, expires: now.Add(introspectionCacheDuration), validated: now}
+	return result, nil
+}
+
+func introspect(token string, recurse bool) (*TokenInfoResponse, error) {
+	data := url.Values{}
+	data.Set("token", token)
+	data.Set("token_type_hint", "access_token")
+
+	request := createRequest(PanelUrl("/oauth2/introspect"), data)
+
+	response, err := CallPanel(request)
+	defer pufferpanel.CloseResponse(response)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.StatusCode != http.StatusOK {
+		if response.StatusCode == http.StatusUnauthorized && recurse && RefreshToken() {
+			pufferpanel.CloseResponse(response)
+			return introspect(token, false)
+		}
+
+		msg, _ := io.ReadAll(response.Body)
+		logging.Error.Printf("Error talking to auth server: [%d] [%s]", response.StatusCode, msg)
+		return nil, errors.New("invalid response from authorization server")
+	}
+
+	result := &TokenInfoResponse{}
+	err = json.NewDecoder(response.Body).Decode(result)
+	if err != nil {
+		return nil, err
+	}
+	if result.Error != "" {
+		return nil, errors.New(result.Error)
+	}
+	return result, nil
+}
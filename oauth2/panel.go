@@ -0,0 +1,134 @@
+/*
+ Copyright 2023 Padduck, LLC
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+  	http://www.apache.org/licenses/LICENSE-2.0
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+*/
+
+package oauth2
+
+import (
+	"fmt"
+	"github.com/pufferpanel/pufferpanel/v2"
+	"github.com/pufferpanel/pufferpanel/v2/config"
+	"github.com/pufferpanel/pufferpanel/v2/logging"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// how often a node that lost the panel checks if it is back
+const panelRetryInterval = 30 * time.Second
+
+var panelLocker sync.RWMutex
+var lastContact time.Time
+var degradedSince *time.Time
+var lastPanelError string
+
+// CallPanel sends the request to the panel, keeping track of if the panel can be reached. Only failing to connect
+// or a server error counts, as anything else is the panel answering
+func CallPanel(request *http.Request) (*http.Response, error) {
+	response, err := pufferpanel.Http().Do(request)
+	if err != nil {
+		panelUnreachable(err)
+	} else if response.StatusCode >= http.StatusInternalServerError {
+		panelUnreachable(fmt.Errorf("panel responded with status %d", response.StatusCode))
+	} else {
+		panelReached()
+	}
+	return response, err
+}
+
+// IsDegraded is true while the panel cannot be reached
+func IsDegraded() bool {
+	panelLocker.RLock()
+	defer panelLocker.RUnlock()
+	return degradedSince != nil
+}
+
+// WithinGracePeriod is true if something the panel said at the given time can still be trusted without asking again
+func WithinGracePeriod(at time.Time) bool {
+	grace := time.Duration(config.OfflineGraceMinutes.Value()) * time.Minute
+	return grace > 0 && !at.IsZero() && time.Since(at) < grace
+}
+
+// LastContact is when the panel last answered, zero if it never has
+func LastContact() time.Time {
+	panelLocker.RLock()
+	defer panelLocker.RUnlock()
+	return lastContact
+}
+
+// GetPanelStatus gets how the node currently sees the panel
+func GetPanelStatus() *pufferpanel.PanelStatus {
+	panelLocker.RLock()
+	status := &pufferpanel.PanelStatus{
+		Degraded: degradedSince != nil,
+		Error:    lastPanelError,
+	}
+	if degradedSince != nil {
+		since := *degradedSince
+		status.DegradedSince = &since
+	}
+	if !lastContact.IsZero() {
+		contact := lastContact
+		status.LastContact = &contact
+	}
+	panelLocker.RUnlock()
+
+	status.QueuedEvents = queuedEvents()
+	return status
+}
+
+func panelReached() {
+	panelLocker.Lock()
+	lastContact = time.Now()
+	recovered := degradedSince != nil
+	degradedSince = nil
+	lastPanelError = ""
+	panelLocker.Unlock()
+
+	if recovered {
+		logging.Info.Printf("Panel can be reached again, leaving degraded mode")
+		go flushEvents()
+	}
+}
+
+func panelUnreachable(err error) {
+	panelLocker.Lock()
+	lastPanelError = err.Error()
+	if degradedSince != nil {
+		panelLocker.Unlock()
+		return
+	}
+	now := time.Now()
+	degradedSince = &now
+	panelLocker.Unlock()
+
+	logging.Error.Printf("Panel cannot be reached, running in degraded mode: %s", err)
+	go waitForPanel()
+}
+
+// waitForPanel checks in with the panel until it answers again
+func waitForPanel() {
+	for IsDegraded() {
+		time.Sleep(panelRetryInterval)
+
+		request, err := http.NewRequest(http.MethodGet, PanelUrl("/.well-known/jwks.json"), nil)
+		if err != nil {
+			logging.Error.Printf("Error checking on the panel: %s", err)
+			return
+		}
+		response, err := CallPanel(request)
+		pufferpanel.CloseResponse(response)
+		if err == nil && !IsDegraded() {
+			RefreshToken()
+		}
+	}
+}
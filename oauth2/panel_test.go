@@ -0,0 +1,102 @@
+/*
+ Copyright 2023 Padduck, LLC
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+  	http://www.apache.org/licenses/LICENSE-2.0
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+*/
+
+package oauth2
+
+import (
+	"encoding/json"
+	"github.com/pufferpanel/pufferpanel/v2/config"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWebSSHAuthorization_Offline(t *testing.T) {
+	panel := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/oauth2/token":
+			if r.PostForm.Get("grant_type") == "password" && r.PostForm.Get("password") != "secret" {
+				_ = json.NewEncoder(w).Encode(&TokenResponse{Error: "invalid_grant"})
+				return
+			}
+			_ = json.NewEncoder(w).Encode(&TokenResponse{AccessToken: "token", ExpiresIn: 3600})
+		case "/oauth2/introspect":
+			_ = json.NewEncoder(w).Encode(&TokenInfoResponse{Active: true, Scope: "abcdef12:servers.sftp"})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+
+	authUrl, clientId, clientSecret, grace := config.AuthUrl.Value(), config.ClientId.Value(), config.ClientSecret.Value(), config.OfflineGraceMinutes.Value()
+	_ = config.AuthUrl.Set(panel.URL+"/oauth2/token", false)
+	_ = config.ClientId.Set(".node_1", false)
+	_ = config.ClientSecret.Set("secret", false)
+	defer func() {
+		_ = config.AuthUrl.Set(authUrl, false)
+		_ = config.ClientId.Set(clientId, false)
+		_ = config.ClientSecret.Set(clientSecret, false)
+		_ = config.OfflineGraceMinutes.Set(grace, false)
+	}()
+
+	ws := &WebSSHAuthorization{}
+	perms, err := ws.Validate("user@example.com", "secret")
+	if err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+	if perms.Extensions["server_id"] != "abcdef12" {
+		t.Errorf("Validate() server = %s, want abcdef12", perms.Extensions["server_id"])
+	}
+	if IsDegraded() {
+		t.Fatalf("IsDegraded() = true while the panel is up")
+	}
+
+	panel.Close()
+
+	if _, err = ws.Validate("user@example.com", "wrong"); err == nil {
+		t.Errorf("Validate() accepted the wrong password while offline")
+	}
+	if !IsDegraded() {
+		t.Fatalf("IsDegraded() = false after the panel went away")
+	}
+
+	perms, err = ws.Validate("user@example.com", "secret")
+	if err != nil {
+		t.Fatalf("Validate() from cache error = %v", err)
+	}
+	if perms.Extensions["server_id"] != "abcdef12" {
+		t.Errorf("Validate() from cache server = %s, want abcdef12", perms.Extensions["server_id"])
+	}
+	if !ws.IsActive(perms) {
+		t.Errorf("IsActive() = false for a cached login")
+	}
+
+	if _, err = ws.Validate("other@example.com", "secret"); err == nil {
+		t.Errorf("Validate() accepted a login that was never cached")
+	}
+
+	_ = config.OfflineGraceMinutes.Set(0, false)
+	if _, err = ws.Validate("user@example.com", "secret"); err == nil {
+		t.Errorf("Validate() used the cache with no grace period")
+	}
+	if ws.IsActive(perms) {
+		t.Errorf("IsActive() kept a cached login after the grace period")
+	}
+
+	_ = config.OfflineGraceMinutes.Set(grace, false)
+	panelReached()
+	if ws.IsActive(perms) {
+		t.Errorf("IsActive() kept a cached login once the panel was back")
+	}
+}
@@ -26,6 +26,7 @@ import (
 	"github.com/pufferpanel/pufferpanel/v2/logging"
 	"net/http"
 	"net/url"
+	"strings"
 	"sync"
 	"time"
 )
@@ -65,7 +66,7 @@ func RefreshToken() bool {
 	request, _ := http.NewRequest("POST", authUrl, bytes.NewBufferString(data.Encode()))
 	request.Header.Add("Content-Type", binding.MIMEPOSTForm)
 
-	response, err := pufferpanel.Http().Do(request)
+	response, err := CallPanel(request)
 	defer pufferpanel.CloseResponse(response)
 	if err != nil {
 		logging.Error.Printf("error talking to auth server: %s", err)
@@ -98,9 +99,16 @@ func RefreshIfStale() {
 	}
 }
 
-func createRequest(data url.Values) (request *http.Request) {
-	authUrl := config.AuthUrl.Value()
-	request, _ = http.NewRequest("POST", authUrl, bytes.NewBufferString(data.Encode()))
+// PanelUrl gets the address of a path on the panel. The auth url points to the token endpoint of the panel, so the
+// panel is found from that
+func PanelUrl(path string) string {
+	base := strings.TrimSuffix(config.AuthUrl.Value(), "/")
+	base = strings.TrimSuffix(base, "/oauth2/token")
+	return base + path
+}
+
+func createRequest(address string, data url.Values) (request *http.Request) {
+	request, _ = http.NewRequest("POST", address, bytes.NewBufferString(data.Encode()))
 
 	RefreshIfStale()
 
@@ -114,6 +122,10 @@ func createRequest(data url.Values) (request *http.Request) {
 type TokenInfoResponse struct {
 	Active           bool   `json:"active"`
 	Scope            string `json:"scope,omitempty"`
+	ClientId         string `json:"client_id,omitempty"`
+	ExpiresAt        int64  `json:"exp,omitempty"`
+	Subject          string `json:"sub,omitempty"`
+	TokenId          string `json:"jti,omitempty"`
 	Error            string `json:"error,omitempty"`
 	ErrorDescription string `json:"error_description,omitempty"`
 }
@@ -20,18 +20,49 @@ import (
 	"encoding/json"
 	"errors"
 	"github.com/pufferpanel/pufferpanel/v2"
+	"github.com/pufferpanel/pufferpanel/v2/config"
 	"github.com/pufferpanel/pufferpanel/v2/logging"
 	"golang.org/x/crypto/ssh"
 	"io"
 	"net/url"
+	"strconv"
 	"strings"
+	"time"
 )
 
 type WebSSHAuthorization struct {
 }
 
 func (ws *WebSSHAuthorization) Validate(username string, password string) (*ssh.Permissions, error) {
-	return validateSSH(username, password, true)
+	perms, err := validateSSH(username, password, true)
+	if err != nil && IsDegraded() {
+		return validateCachedSSH(username, password)
+	}
+	return perms, err
+}
+
+// IsActive checks the login has not been revoked since it was made. Once the token from the login expires, it is no
+// longer checked, as the panel can only say it has expired. A login let in from the cache has no token, so it only
+// lasts while the panel is gone and the grace period has not run out, after which it has to log in again
+func (ws *WebSSHAuthorization) IsActive(perms *ssh.Permissions) bool {
+	if cached, exists := perms.Extensions["cached_validated"]; exists {
+		validated, _ := strconv.ParseInt(cached, 10, 64)
+		return IsDegraded() && WithinGracePeriod(time.Unix(validated, 0))
+	}
+
+	token := perms.Extensions["token"]
+	expires, _ := strconv.ParseInt(perms.Extensions["token_expires"], 10, 64)
+	if token == "" || time.Now().Unix() >= expires {
+		return true
+	}
+
+	info, err := Introspect(token)
+	if err != nil {
+		//if the panel cannot be reached, leave the connection be until the grace period runs out
+		logging.Debug.Printf("error talking to auth server: %s", err)
+		return WithinGracePeriod(LastContact())
+	}
+	return info.Active
 }
 
 func validateSSH(username string, password string, recurse bool) (*ssh.Permissions, error) {
@@ -41,9 +72,9 @@ func validateSSH(username string, password string, recurse bool) (*ssh.Permissio
 	data.Set("password", password)
 	data.Set("scope", "sftp")
 
-	request := createRequest(data)
+	request := createRequest(config.AuthUrl.Value(), data)
 
-	response, err := pufferpanel.Http().Do(request)
+	response, err := CallPanel(request)
 	defer pufferpanel.CloseResponse(response)
 	if err != nil {
 		logging.Error.Printf("error talking to auth server: %s", err)
@@ -65,18 +96,28 @@ func validateSSH(username string, password string, recurse bool) (*ssh.Permissio
 		return nil, errors.New("invalid response from authorization server")
 	}
 
-	var respArr map[string]interface{}
-	err = json.NewDecoder(response.Body).Decode(&respArr)
+	var tokenResponse TokenResponse
+	err = json.NewDecoder(response.Body).Decode(&tokenResponse)
 	if err != nil {
 		return nil, err
 	}
-	if respArr["error"] != nil {
+	if tokenResponse.Error != "" || tokenResponse.AccessToken == "" {
+		forgetCredential(username)
+		return nil, errors.New("incorrect username or password")
+	}
+
+	//ask the panel what the token can do, the same way as for any other token
+	info, err := Introspect(tokenResponse.AccessToken)
+	if err != nil {
+		logging.Error.Printf("error talking to auth server: %s", err)
+		return nil, errors.New("invalid response from authorization server")
+	}
+	if !info.Active {
+		forgetCredential(username)
 		return nil, errors.New("incorrect username or password")
 	}
-	sshPerms := &ssh.Permissions{}
-	scopes := strings.Split(respArr["scope"].(string), " ")
-	for _, v := range scopes {
 
+	for _, v := range strings.Split(info.Scope, " ") {
 		t := strings.Split(v, ":")
 		if len(t) != 2 {
 			continue
@@ -85,10 +126,15 @@ func validateSSH(username string, password string, recurse bool) (*ssh.Permissio
 		scope := t[1]
 
 		if pufferpanel.ScopeServersSFTP.Matches(scope) {
+			sshPerms := &ssh.Permissions{}
 			sshPerms.Extensions = make(map[string]string)
 			sshPerms.Extensions["server_id"] = serverId
+			sshPerms.Extensions["token"] = tokenResponse.AccessToken
+			sshPerms.Extensions["token_expires"] = strconv.FormatInt(time.Now().Unix()+tokenResponse.ExpiresIn, 10)
+			rememberCredential(username, password, serverId)
 			return sshPerms, nil
 		}
 	}
+	forgetCredential(username)
 	return nil, errors.New("incorrect username or password")
 }
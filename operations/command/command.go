@@ -23,8 +23,9 @@ import (
 )
 
 type Command struct {
-	Commands []string
-	Env      map[string]string
+	Commands  []string
+	Env       map[string]string
+	Variables map[string]interface{}
 }
 
 func (c Command) Run(env pufferpanel.Environment) error {
@@ -36,6 +37,7 @@ func (c Command) Run(env pufferpanel.Environment) error {
 			Command: cmdToExec,
 			Arguments: args,
 			Environment: c.Env,
+			Variables: c.Variables,
 		})
 		if err != nil {
 			return err
@@ -27,7 +27,7 @@ type OperationFactory struct {
 
 func (of OperationFactory) Create(op pufferpanel.CreateOperation) (pufferpanel.Operation, error) {
 	cmds := cast.ToStringSlice(op.OperationArgs["commands"])
-	return Command{Commands: cmds, Env: op.EnvironmentVariables}, nil
+	return Command{Commands: cmds, Env: op.EnvironmentVariables, Variables: op.DataMap}, nil
 }
 
 func (of OperationFactory) Key() string {
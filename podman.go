@@ -0,0 +1,38 @@
+/*
+ Copyright 2023 Padduck, LLC
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+  	http://www.apache.org/licenses/LICENSE-2.0
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+*/
+
+package pufferpanel
+
+import (
+	"fmt"
+	"github.com/pufferpanel/pufferpanel/v2/config"
+	"os"
+)
+
+// GetPodmanHost is the address of Podman's Docker compatible API. Unless one is configured, this is the socket of the
+// system service when running as root, and of the user's own service otherwise
+func GetPodmanHost() string {
+	if socket := config.PodmanSocket.Value(); socket != "" {
+		return socket
+	}
+
+	if os.Geteuid() == 0 {
+		return "unix:///run/podman/podman.sock"
+	}
+
+	runtimeDir := os.Getenv("XDG_RUNTIME_DIR")
+	if runtimeDir == "" {
+		runtimeDir = fmt.Sprintf("/run/user/%d", os.Getuid())
+	}
+	return "unix://" + runtimeDir + "/podman/podman.sock"
+}
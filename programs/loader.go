@@ -82,6 +82,7 @@ func LoadFromFolder() {
 			logging.Error.Printf("Error starting server scheduler (%s): %s", element.Name(), err)
 			continue
 		}
+		program.Reattach()
 		logging.Info.Printf("Loaded server %s", program.Id())
 		allPrograms = append(allPrograms, program)
 	}
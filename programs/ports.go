@@ -0,0 +1,68 @@
+/*
+ Copyright 2023 Padduck, LLC
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+  	http://www.apache.org/licenses/LICENSE-2.0
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+*/
+
+package programs
+
+import (
+	"errors"
+	"github.com/pufferpanel/pufferpanel/v2"
+	"github.com/pufferpanel/pufferpanel/v2/logging"
+	"net"
+	"strconv"
+	"syscall"
+)
+
+// checkPorts makes sure nothing else is listening on the server's ports, so it fails now instead of part way
+// through starting
+func (p *Program) checkPorts() error {
+	for _, v := range p.Ports {
+		if err := checkPort(v.IP, v.Port); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkPort(ip string, port uint16) error {
+	address := net.JoinHostPort(ip, strconv.Itoa(int(port)))
+
+	err := tryListen(address)
+	if errors.Is(err, syscall.EADDRNOTAVAIL) {
+		//the address may only exist outside of this host, such as behind NAT, so check the port on every address
+		address = net.JoinHostPort("0.0.0.0", strconv.Itoa(int(port)))
+		err = tryListen(address)
+	}
+
+	if errors.Is(err, syscall.EADDRINUSE) {
+		return pufferpanel.ErrPortInUse(ip, port)
+	} else if err != nil {
+		//anything else, such as not being allowed to use low ports, is for the environment to deal with
+		logging.Debug.Printf("Unable to check port %s: %s", address, err)
+	}
+	return nil
+}
+
+// tryListen checks both TCP and UDP, as servers commonly use either
+func tryListen(address string) error {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	_ = listener.Close()
+
+	conn, err := net.ListenPacket("udp", address)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
@@ -0,0 +1,29 @@
+package programs
+
+import (
+	"github.com/pufferpanel/pufferpanel/v2"
+	"net"
+	"testing"
+)
+
+func TestProgram_checkPorts(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	defer listener.Close()
+	used := uint16(listener.Addr().(*net.TCPAddr).Port)
+
+	p := &Program{}
+	p.Ports = []pufferpanel.ServerPort{{Name: "port", IP: "127.0.0.1", Port: used}}
+
+	err = p.checkPorts()
+	if e, ok := err.(*pufferpanel.Error); !ok || !e.Is(pufferpanel.ErrPortInUse("", 0)) {
+		t.Errorf("checkPorts() error = %v, want ErrPortInUse", err)
+	}
+
+	_ = listener.Close()
+	if err = p.checkPorts(); err != nil {
+		t.Errorf("checkPorts() error = %v", err)
+	}
+}
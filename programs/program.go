@@ -23,8 +23,10 @@ import (
 	"github.com/mholt/archiver/v3"
 	"github.com/pufferpanel/pufferpanel/v2"
 	"github.com/pufferpanel/pufferpanel/v2/config"
+	"github.com/pufferpanel/pufferpanel/v2/environments"
 	"github.com/pufferpanel/pufferpanel/v2/logging"
 	"github.com/pufferpanel/pufferpanel/v2/messages"
+	"github.com/pufferpanel/pufferpanel/v2/oauth2"
 	"github.com/pufferpanel/pufferpanel/v2/operations"
 	"github.com/spf13/cast"
 	"io"
@@ -34,6 +36,7 @@ import (
 	"path"
 	"path/filepath"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -43,6 +46,8 @@ type Program struct {
 	CrashCounter       int                     `json:"-"`
 	RunningEnvironment pufferpanel.Environment `json:"-"`
 	Scheduler          Scheduler               `json:"-"`
+
+	restartUnhealthy atomic.Bool
 }
 
 var queue *list.List
@@ -152,6 +157,12 @@ func (p *Program) Start() (err error) {
 		return err
 	}
 
+	if err = p.checkPorts(); err != nil {
+		p.Log(logging.Error, "Cannot start server %s: %s", p.Id(), err)
+		p.RunningEnvironment.DisplayToConsole(true, "Cannot start server: %s\n", err)
+		return
+	}
+
 	p.Log(logging.Info, "Starting server %s", p.Id())
 	p.RunningEnvironment.DisplayToConsole(true, "Starting server\n")
 
@@ -171,11 +182,8 @@ func (p *Program) Start() (err error) {
 		return
 	}
 
-	commandLine := pufferpanel.ReplaceTokens(p.Execution.Command, data)
-	if p.Execution.WorkingDirectory == "${rootDir}" {
-		p.Execution.WorkingDirectory = ""
-	}
-	workDir := pufferpanel.ReplaceTokens(p.Execution.WorkingDirectory, data)
+	steps := p.executionData(data)
+	workDir := steps.WorkingDirectory
 
 	if !pufferpanel.EnsureAccess(path.Join(p.RunningEnvironment.GetRootDirectory(), workDir), p.RunningEnvironment.GetRootDirectory()) {
 		p.Log(logging.Error, "Working directory is invalid for server: %s", workDir)
@@ -183,18 +191,13 @@ func (p *Program) Start() (err error) {
 		return
 	}
 
-	cmd, args := pufferpanel.SplitArguments(commandLine)
-	err = p.RunningEnvironment.ExecuteAsync(pufferpanel.ExecutionData{
-		Command:          cmd,
-		Arguments:        args,
-		Environment:      pufferpanel.ReplaceTokensInMap(p.Execution.EnvironmentVariables, data),
-		WorkingDirectory: workDir,
-		Callback:         p.afterExit,
-	})
+	err = p.RunningEnvironment.ExecuteAsync(steps)
 
 	if err != nil {
 		p.Log(logging.Error, "error starting server %s: %s", p.Id(), err)
 		p.RunningEnvironment.DisplayToConsole(true, " Failed to start server\n")
+	} else {
+		oauth2.QueueEvent(pufferpanel.PanelEventServerStarted, p.Id())
 	}
 
 	return
@@ -365,6 +368,89 @@ func (p *Program) SetEnvironment(environment pufferpanel.Environment) (err error
 	return
 }
 
+// SwitchEnvironment moves a stopped server to another of its supported environments.
+// What the old environment kept outside the server's folder is removed, the files and variables are left as they are
+func (p *Program) SwitchEnvironment(environmentType string) (err error) {
+	running, err := p.IsRunning()
+	if err != nil {
+		return
+	}
+	if running {
+		return pufferpanel.ErrProcessRunning
+	}
+
+	var section map[string]interface{}
+	for _, v := range p.SupportedEnvironments {
+		var typeMap pufferpanel.Type
+		if pufferpanel.UnmarshalTo(v, &typeMap) == nil && typeMap.Type == environmentType {
+			err = pufferpanel.UnmarshalTo(v, &section)
+			if err != nil {
+				return
+			}
+			break
+		}
+	}
+	if section == nil {
+		return pufferpanel.ErrEnvironmentNotSupported(environmentType)
+	}
+
+	//the files stay where they are, even if the old environment had them somewhere else
+	var current map[string]interface{}
+	if pufferpanel.UnmarshalTo(p.Environment, &current) == nil {
+		if root, exists := current["root"]; exists {
+			if _, exists = section["root"]; !exists {
+				section["root"] = root
+			}
+		}
+	}
+
+	replacement := p.Server
+	replacement.Environment = section
+	err = p.Requirements.Test(replacement)
+	if err != nil {
+		return
+	}
+
+	env, err := environments.Create(environmentType, config.ServersFolder.Value(), p.Id(), section)
+	if err != nil {
+		return
+	}
+
+	//keep the console and anyone watching it
+	old := p.RunningEnvironment
+	env.GetBase().ConsoleBuffer = old.GetBase().ConsoleBuffer
+	env.GetBase().WSManager = old.GetBase().WSManager
+
+	//the server's folder is already there
+	err = env.Create()
+	if err != nil && !os.IsExist(err) {
+		return
+	}
+
+	p.Log(logging.Info, "Switching server %s to %s environment", p.Id(), environmentType)
+	previous := p.Environment
+	p.Environment = section
+	p.RunningEnvironment = env
+
+	err = p.Save()
+	if err != nil {
+		p.Environment = previous
+		p.RunningEnvironment = old
+		return
+	}
+
+	//only once the switch is saved, so a failed save leaves the old environment as it was. What is left behind now
+	//does not stop the server running in the new one
+	if teardown, ok := old.(pufferpanel.TeardownEnvironment); ok {
+		if e := teardown.Teardown(); e != nil {
+			p.Log(logging.Error, "Error removing what the old environment of server %s left: %s", p.Id(), e)
+		}
+	}
+
+	env.DisplayToConsole(true, "Server switched to %s environment\n", environmentType)
+	return
+}
+
 func (p *Program) Id() string {
 	return p.Identifier
 }
@@ -447,9 +533,33 @@ func (p *Program) GetNetwork() string {
 	return ip + ":" + port
 }
 
+// CanReattach is if the server can keep running without the daemon, and be picked back up by Reattach
+func (p *Program) CanReattach() bool {
+	env, ok := p.RunningEnvironment.(pufferpanel.ReattachableEnvironment)
+	return ok && env.CanReattach()
+}
+
+// Reattach picks the server back up if an earlier daemon left it running
+func (p *Program) Reattach() {
+	env, ok := p.RunningEnvironment.(pufferpanel.ReattachableEnvironment)
+	if !ok {
+		return
+	}
+
+	attached, err := env.Reattach(p.executionData(p.DataToMap()))
+	if err != nil {
+		p.Log(logging.Error, "Error reattaching to server %s: %s", p.Id(), err)
+	} else if attached {
+		p.Log(logging.Info, "Reattached to running server %s", p.Id())
+	}
+}
+
 func (p *Program) afterExit(graceful bool) {
 	if graceful {
 		p.CrashCounter = 0
+		oauth2.QueueEvent(pufferpanel.PanelEventServerStopped, p.Id())
+	} else {
+		oauth2.QueueEvent(pufferpanel.PanelEventServerCrashed, p.Id())
 	}
 
 	mapping := p.DataToMap()
@@ -471,6 +581,11 @@ func (p *Program) afterExit(graceful bool) {
 		return
 	}
 
+	if p.restartUnhealthy.CompareAndSwap(true, false) {
+		StartViaService(p)
+		return
+	}
+
 	if !p.Execution.AutoRestartFromCrash && !p.Execution.AutoRestartFromGraceful {
 		return
 	}
@@ -483,6 +598,59 @@ func (p *Program) afterExit(graceful bool) {
 	}
 }
 
+// executionData is how the server's main process is run, so a server that was left running is picked back up the
+// same way it was started
+func (p *Program) executionData(data map[string]interface{}) pufferpanel.ExecutionData {
+	commandLine := pufferpanel.ReplaceTokens(p.Execution.Command, data)
+	if p.Execution.WorkingDirectory == "${rootDir}" {
+		p.Execution.WorkingDirectory = ""
+	}
+
+	cmd, args := pufferpanel.SplitArguments(commandLine)
+	return pufferpanel.ExecutionData{
+		Command:          cmd,
+		Arguments:        args,
+		Environment:      pufferpanel.ReplaceTokensInMap(p.Execution.EnvironmentVariables, data),
+		WorkingDirectory: pufferpanel.ReplaceTokens(p.Execution.WorkingDirectory, data),
+		Variables:        data,
+		HealthCheck:      p.healthCheck(data),
+		HealthCallback:   p.onHealth,
+		Callback:         p.afterExit,
+	}
+}
+
+// healthCheck is the server's health check with the variables filled in, checking the server's own port unless told
+// otherwise
+func (p *Program) healthCheck(data map[string]interface{}) *pufferpanel.HealthCheck {
+	if p.Execution.HealthCheck == nil {
+		return nil
+	}
+
+	check := *p.Execution.HealthCheck
+	check.Command = pufferpanel.ReplaceTokens(check.Command, data)
+	check.Address = pufferpanel.ReplaceTokens(check.Address, data)
+	check.Payload = pufferpanel.ReplaceTokens(check.Payload, data)
+	if check.Address == "" {
+		check.Address = p.GetNetwork()
+	}
+	return &check
+}
+
+// onHealth restarts the server once it is unhealthy, if the health check asks for it. Killing it is what restarts
+// it, as a hung server would not stop when told
+func (p *Program) onHealth(status string) {
+	if status != pufferpanel.HealthUnhealthy || p.Execution.HealthCheck == nil || !p.Execution.HealthCheck.Restart {
+		return
+	}
+
+	p.Log(logging.Info, "Server %s is unhealthy, restarting", p.Id())
+	p.RunningEnvironment.DisplayToConsole(true, "Restarting unhealthy server\n")
+	p.restartUnhealthy.Store(true)
+	if err := p.Kill(); err != nil {
+		p.restartUnhealthy.Store(false)
+	}
+}
+
 func (p *Program) GetItem(name string) (*FileData, error) {
 	targetFile := pufferpanel.JoinPath(p.GetEnvironment().GetRootDirectory(), name)
 	if !pufferpanel.EnsureAccess(targetFile, p.GetEnvironment().GetRootDirectory()) {
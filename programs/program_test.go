@@ -1,6 +1,12 @@
 package programs
 
 import (
+	"github.com/pufferpanel/pufferpanel/v2"
+	"github.com/pufferpanel/pufferpanel/v2/config"
+	"github.com/pufferpanel/pufferpanel/v2/environments"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -34,3 +40,185 @@ func TestProgram_valid(t *testing.T) {
 		})
 	}
 }
+
+// reattachableEnvironment stands in for an environment which found its server still running
+type reattachableEnvironment struct {
+	pufferpanel.Environment
+	running bool
+	steps   *pufferpanel.ExecutionData
+	console []string
+}
+
+func (re *reattachableEnvironment) Reattach(steps pufferpanel.ExecutionData) (bool, error) {
+	if !re.running {
+		return false, nil
+	}
+	re.steps = &steps
+	return true, nil
+}
+
+func (re *reattachableEnvironment) CanReattach() bool {
+	return true
+}
+
+func (re *reattachableEnvironment) GetRootDirectory() string {
+	return ""
+}
+
+func (re *reattachableEnvironment) DisplayToConsole(_ bool, msg string, _ ...interface{}) {
+	re.console = append(re.console, msg)
+}
+
+func TestProgram_Reattach(t *testing.T) {
+	env := &reattachableEnvironment{running: true}
+	p := CreateProgram()
+	p.Identifier = "abcdef12"
+	p.RunningEnvironment = env
+	p.CrashCounter = 2
+	p.Execution.HealthCheck = &pufferpanel.HealthCheck{Type: "tcp", Address: "${ip}:25565"}
+	p.Variables = map[string]pufferpanel.Variable{"ip": {Value: "127.0.0.1"}}
+
+	if !p.CanReattach() {
+		t.Fatalf("CanReattach() = false, want true")
+	}
+
+	p.Reattach()
+	if env.steps == nil || env.steps.Callback == nil {
+		t.Fatalf("Reattach() did not hand the environment a callback")
+	}
+
+	//the health check is picked back up as the server was started with it
+	if check := env.steps.HealthCheck; check == nil || check.Address != "127.0.0.1:25565" || env.steps.HealthCallback == nil {
+		t.Errorf("Reattach() health check = %+v, want the server's check watched again", check)
+	}
+
+	env.steps.Callback(true)
+	if p.CrashCounter != 0 {
+		t.Errorf("CrashCounter = %d after a graceful exit, want 0", p.CrashCounter)
+	}
+	if len(env.console) == 0 || env.console[len(env.console)-1] != "Running post-execution steps\n" {
+		t.Errorf("console = %v, want post-execution steps run on exit", env.console)
+	}
+
+	stopped := &reattachableEnvironment{}
+	p.RunningEnvironment = stopped
+	p.Reattach()
+	if stopped.steps != nil {
+		t.Errorf("Reattach() kept a callback with nothing running")
+	}
+}
+
+// teardownEnvironment stands in for an environment which keeps things outside the server's folder
+type teardownEnvironment struct {
+	pufferpanel.Environment
+	base     *pufferpanel.BaseEnvironment
+	tornDown bool
+}
+
+func (te *teardownEnvironment) IsRunning() (bool, error) {
+	return false, nil
+}
+
+func (te *teardownEnvironment) GetBase() *pufferpanel.BaseEnvironment {
+	return te.base
+}
+
+func (te *teardownEnvironment) Teardown() error {
+	te.tornDown = true
+	return nil
+}
+
+func createSwitchableProgram(t *testing.T, root string) (*Program, *teardownEnvironment) {
+	environments.LoadModules()
+
+	p := CreateProgram()
+	p.Identifier = "abcdef12"
+	p.Type = pufferpanel.Type{Type: "java"}
+	p.Environment = map[string]interface{}{"type": "docker", "root": root}
+	p.SupportedEnvironments = []interface{}{
+		map[string]interface{}{"type": "docker"},
+		map[string]interface{}{"type": "tty"},
+	}
+	env := &teardownEnvironment{base: &pufferpanel.BaseEnvironment{
+		ConsoleBuffer: pufferpanel.CreateCache(),
+		WSManager:     pufferpanel.CreateTracker(),
+	}}
+	p.RunningEnvironment = env
+	return p, env
+}
+
+func TestProgram_SwitchEnvironment(t *testing.T) {
+	servers := config.ServersFolder.Value()
+	defer func() {
+		_ = config.ServersFolder.Set(servers, false)
+	}()
+
+	t.Run("switches and keeps root", func(t *testing.T) {
+		folder := t.TempDir()
+		_ = config.ServersFolder.Set(folder, false)
+		root := filepath.Join(t.TempDir(), "server")
+		p, old := createSwitchableProgram(t, root)
+
+		if err := p.SwitchEnvironment("tty"); err != nil {
+			t.Fatalf("SwitchEnvironment() error = %v", err)
+		}
+
+		section := p.Environment.(map[string]interface{})
+		if section["type"] != "tty" || section["root"] != root {
+			t.Errorf("Environment = %v, want tty with root %s", section, root)
+		}
+		if p.RunningEnvironment.GetRootDirectory() != root {
+			t.Errorf("RunningEnvironment root = %s, want %s", p.RunningEnvironment.GetRootDirectory(), root)
+		}
+		if !old.tornDown {
+			t.Errorf("SwitchEnvironment() did not tear down the old environment")
+		}
+
+		saved, err := os.ReadFile(filepath.Join(folder, p.Id()+".json"))
+		if err != nil || !strings.Contains(string(saved), `"type": "tty"`) {
+			t.Errorf("SwitchEnvironment() did not save the new environment, %v", err)
+		}
+	})
+
+	t.Run("failing requirements", func(t *testing.T) {
+		_ = config.ServersFolder.Set(t.TempDir(), false)
+		p, old := createSwitchableProgram(t, t.TempDir())
+		p.Requirements = pufferpanel.Requirements{OS: "plan9"}
+
+		err := p.SwitchEnvironment("tty")
+		if e, ok := err.(*pufferpanel.Error); !ok || !e.Is(pufferpanel.ErrUnsupportedOS("", "")) {
+			t.Errorf("SwitchEnvironment() error = %v, want %v", err, pufferpanel.ErrUnsupportedOS("", ""))
+		}
+		if p.RunningEnvironment != old || old.tornDown {
+			t.Errorf("SwitchEnvironment() changed the environment after failing requirements")
+		}
+	})
+
+	t.Run("not supported", func(t *testing.T) {
+		_ = config.ServersFolder.Set(t.TempDir(), false)
+		p, old := createSwitchableProgram(t, t.TempDir())
+
+		err := p.SwitchEnvironment("sandbox")
+		if e, ok := err.(*pufferpanel.Error); !ok || !e.Is(pufferpanel.ErrEnvironmentNotSupported("")) {
+			t.Errorf("SwitchEnvironment() error = %v, want %v", err, pufferpanel.ErrEnvironmentNotSupported(""))
+		}
+		if p.RunningEnvironment != old {
+			t.Errorf("SwitchEnvironment() changed the environment when not supported")
+		}
+	})
+
+	t.Run("failing save keeps old environment", func(t *testing.T) {
+		_ = config.ServersFolder.Set(filepath.Join(t.TempDir(), "missing"), false)
+		p, old := createSwitchableProgram(t, t.TempDir())
+
+		if err := p.SwitchEnvironment("tty"); err == nil {
+			t.Fatalf("SwitchEnvironment() saved to a folder which is not there")
+		}
+		if p.RunningEnvironment != old || p.Environment.(map[string]interface{})["type"] != "docker" {
+			t.Errorf("SwitchEnvironment() did not put the old environment back")
+		}
+		if old.tornDown {
+			t.Errorf("SwitchEnvironment() tore down the old environment before the switch was saved")
+		}
+	})
+}
@@ -0,0 +1,258 @@
+/*
+ Copyright 2023 Padduck, LLC
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+  	http://www.apache.org/licenses/LICENSE-2.0
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+*/
+
+package programs
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"github.com/pufferpanel/pufferpanel/v2"
+	"github.com/pufferpanel/pufferpanel/v2/config"
+	"github.com/pufferpanel/pufferpanel/v2/logging"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// a transfer is a tar with the server definition, followed by everything in the server's folder
+const transferDefinition = "server.json"
+const transferFiles = "files/"
+
+// WriteTransfer writes the server and all of its files as a tar stream, for another node to receive
+func (p *Program) WriteTransfer(w io.Writer) error {
+	tw := tar.NewWriter(w)
+
+	data, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+
+	err = tw.WriteHeader(&tar.Header{Name: transferDefinition, Mode: 0644, Size: int64(len(data)), Typeflag: tar.TypeReg})
+	if err != nil {
+		return err
+	}
+	if _, err = tw.Write(data); err != nil {
+		return err
+	}
+
+	root := p.GetEnvironment().GetRootDirectory()
+	if _, err = os.Lstat(root); os.IsNotExist(err) {
+		//never installed, so there is nothing else to send
+		return tw.Close()
+	}
+
+	err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil || rel == "." {
+			return err
+		}
+
+		link := ""
+		if info.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(path); err != nil {
+				return err
+			}
+		}
+
+		header, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		header.Name = transferFiles + filepath.ToSlash(rel)
+		if info.IsDir() {
+			header.Name += "/"
+		}
+
+		if err = tw.WriteHeader(header); err != nil {
+			return err
+		}
+
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer pufferpanel.Close(file)
+		_, err = io.Copy(tw, file)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	return tw.Close()
+}
+
+// ReceiveTransfer unpacks a transfer into a staging folder, so nothing is changed until it has been checked.
+// The folder is removed if the transfer could not be read
+func ReceiveTransfer(id string, stream io.Reader) (staging string, definition []byte, err error) {
+	staging = filepath.Join(config.ServersFolder.Value(), ".transfer-"+id)
+
+	defer func() {
+		if err != nil {
+			_ = os.RemoveAll(staging)
+		}
+	}()
+
+	if err = os.RemoveAll(staging); err != nil {
+		return
+	}
+
+	files := filepath.Join(staging, strings.TrimSuffix(transferFiles, "/"))
+	if err = os.MkdirAll(files, 0755); err != nil {
+		return
+	}
+
+	tr := tar.NewReader(stream)
+	var header *tar.Header
+	for {
+		header, err = tr.Next()
+		if err == io.EOF {
+			err = nil
+			break
+		}
+		if err != nil {
+			return
+		}
+
+		if header.Name == transferDefinition {
+			if definition, err = io.ReadAll(tr); err != nil {
+				return
+			}
+			continue
+		}
+
+		if !strings.HasPrefix(header.Name, transferFiles) {
+			continue
+		}
+
+		target := filepath.Join(files, filepath.FromSlash(strings.TrimPrefix(header.Name, transferFiles)))
+		if !pufferpanel.EnsureAccess(target, files) {
+			err = pufferpanel.ErrIllegalFileAccess
+			return
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(target, 0755)
+		case tar.TypeSymlink:
+			//only links which stay inside the server can be recreated
+			resolved := header.Linkname
+			if !filepath.IsAbs(resolved) {
+				resolved = filepath.Join(filepath.Dir(target), resolved)
+			}
+			if !pufferpanel.EnsureAccess(resolved, files) {
+				logging.Debug.Printf("Skipping link %s in transfer of %s as it leaves the server", header.Name, id)
+				continue
+			}
+			if err = os.MkdirAll(filepath.Dir(target), 0755); err == nil {
+				err = os.Symlink(header.Linkname, target)
+			}
+		case tar.TypeReg:
+			err = writeTransferFile(target, tr, header.FileInfo().Mode())
+		}
+		if err != nil {
+			return
+		}
+	}
+
+	if definition == nil {
+		err = pufferpanel.ErrTransferIncomplete
+	}
+	return
+}
+
+// CompleteTransfer creates the server from a transfer which has been received and checked
+func CompleteTransfer(id, staging string, definition []byte) (*Program, error) {
+	defer func() {
+		_ = os.RemoveAll(staging)
+	}()
+
+	if GetFromCache(id) != nil {
+		return nil, pufferpanel.ErrServerAlreadyExists
+	}
+
+	program, err := LoadFromData(id, definition)
+	if err != nil {
+		return nil, err
+	}
+
+	//the other node may keep its servers somewhere else, so let this one decide where the files go
+	if env, ok := program.Environment.(map[string]interface{}); ok {
+		delete(env, "root")
+	}
+
+	program.Scheduler = NewScheduler(program)
+	if err = Create(program); err != nil {
+		return nil, err
+	}
+
+	//the environment makes the folder for the server, so the files can only go in once it exists
+	err = moveTransferFiles(filepath.Join(staging, strings.TrimSuffix(transferFiles, "/")), program.GetEnvironment().GetRootDirectory())
+	if err == nil {
+		err = program.Scheduler.LoadMap(program.Tasks)
+	}
+	if err == nil {
+		err = program.Scheduler.Start()
+	}
+	if err != nil {
+		_ = Delete(program.Id())
+		return nil, err
+	}
+
+	return program, nil
+}
+
+func moveTransferFiles(source, destination string) error {
+	err := os.MkdirAll(destination, 0755)
+	if err != nil {
+		return err
+	}
+
+	entries, err := os.ReadDir(source)
+	if err != nil {
+		return err
+	}
+
+	for _, v := range entries {
+		err = os.Rename(filepath.Join(source, v.Name()), filepath.Join(destination, v.Name()))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeTransferFile(target string, source io.Reader, mode os.FileMode) error {
+	err := os.MkdirAll(filepath.Dir(target), 0755)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode)
+	if err != nil {
+		return err
+	}
+	defer pufferpanel.Close(file)
+
+	_, err = io.Copy(file, source)
+	return err
+}
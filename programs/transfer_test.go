@@ -0,0 +1,125 @@
+package programs
+
+import (
+	"archive/tar"
+	"bytes"
+	"github.com/pufferpanel/pufferpanel/v2"
+	"github.com/pufferpanel/pufferpanel/v2/config"
+	"github.com/pufferpanel/pufferpanel/v2/environments"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const transferTestServer = "{\n  \"type\": \"test\",\n  \"display\": \"Transfer\",\n  \"run\": {\n    \"command\": \"echo\"\n  },\n  \"environment\": {\n    \"type\": \"standard\"\n  }\n}"
+
+func TestProgram_Transfer(t *testing.T) {
+	environments.LoadModules()
+	source := t.TempDir()
+	if err := config.ServersFolder.Set(source, false); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+
+	p, err := LoadFromData("transfer", []byte(transferTestServer))
+	if err != nil {
+		t.Fatalf("LoadFromData() error = %v", err)
+	}
+
+	root := p.GetEnvironment().GetRootDirectory()
+	if err = os.MkdirAll(filepath.Join(root, "world"), 0755); err != nil {
+		t.Fatalf("MkdirAll() error = %v", err)
+	}
+	if err = os.WriteFile(filepath.Join(root, "world", "level.dat"), []byte("level"), 0644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	stream := &bytes.Buffer{}
+	if err = p.WriteTransfer(stream); err != nil {
+		t.Fatalf("WriteTransfer() error = %v", err)
+	}
+
+	//receive on what is pretending to be another node
+	if err = config.ServersFolder.Set(t.TempDir(), false); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+
+	staging, definition, err := ReceiveTransfer("transfer", stream)
+	if err != nil {
+		t.Fatalf("ReceiveTransfer() error = %v", err)
+	}
+	if len(definition) == 0 {
+		t.Errorf("ReceiveTransfer() gave no definition")
+	}
+
+	data, err := os.ReadFile(filepath.Join(staging, "files", "world", "level.dat"))
+	if err != nil || string(data) != "level" {
+		t.Errorf("received file = %q, %v, want %q", data, err, "level")
+	}
+
+	received, err := CompleteTransfer("transfer", staging, definition)
+	if err != nil {
+		t.Fatalf("CompleteTransfer() error = %v", err)
+	}
+	defer func() {
+		_ = Delete(received.Id())
+	}()
+
+	if received.GetEnvironment().GetRootDirectory() == root {
+		t.Errorf("CompleteTransfer() kept the root of the source node")
+	}
+	if _, err = os.Stat(filepath.Join(received.GetEnvironment().GetRootDirectory(), "world", "level.dat")); err != nil {
+		t.Errorf("CompleteTransfer() did not move files: %v", err)
+	}
+	if _, err = os.Stat(staging); !os.IsNotExist(err) {
+		t.Errorf("CompleteTransfer() left staging folder behind")
+	}
+}
+
+func TestReceiveTransfer_Invalid(t *testing.T) {
+	if err := config.ServersFolder.Set(t.TempDir(), false); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+
+	t.Run("escapingPath", func(t *testing.T) {
+		stream := transferTestTar(t, map[string]string{
+			transferDefinition:              transferTestServer,
+			transferFiles + "../../evil.sh": "rm -rf /",
+		})
+
+		staging, _, err := ReceiveTransfer("escape", stream)
+		if err != pufferpanel.ErrIllegalFileAccess {
+			t.Errorf("ReceiveTransfer() error = %v, want %v", err, pufferpanel.ErrIllegalFileAccess)
+		}
+		if _, err = os.Stat(staging); !os.IsNotExist(err) {
+			t.Errorf("ReceiveTransfer() left staging folder behind")
+		}
+	})
+
+	t.Run("missingDefinition", func(t *testing.T) {
+		stream := transferTestTar(t, map[string]string{
+			transferFiles + "server.jar": "jar",
+		})
+
+		if _, _, err := ReceiveTransfer("missing", stream); err != pufferpanel.ErrTransferIncomplete {
+			t.Errorf("ReceiveTransfer() error = %v, want %v", err, pufferpanel.ErrTransferIncomplete)
+		}
+	})
+}
+
+func transferTestTar(t *testing.T, files map[string]string) *bytes.Buffer {
+	buffer := &bytes.Buffer{}
+	tw := tar.NewWriter(buffer)
+	for name, content := range files {
+		err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg})
+		if err == nil {
+			_, err = tw.Write([]byte(content))
+		}
+		if err != nil {
+			t.Fatalf("writing tar error = %v", err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("writing tar error = %v", err)
+	}
+	return buffer
+}
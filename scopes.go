@@ -41,6 +41,7 @@ const (
 	ScopeServersSFTP        = Scope("servers.sftp")
 	ScopeServersFilesGet    = Scope("servers.files.get")
 	ScopeServersFilesPut    = Scope("servers.files.put")
+	ScopeServersTransfer    = Scope("servers.transfer")
 
 	//node
 	ScopeNodesView   = Scope("nodes.view")
@@ -58,6 +59,68 @@ const (
 	ScopeSettings = Scope("panel.settings")
 )
 
+// AssignableScopes are the scopes which may be granted to a user through a role
+var AssignableScopes = []Scope{
+	ScopeServersAdmin,
+	ScopeServersView,
+	ScopeServersEdit,
+	ScopeServersEditAdmin,
+	ScopeServersEditUsers,
+	ScopeServersCreate,
+	ScopeServersDelete,
+	ScopeServersInstall,
+	ScopeServersUpdate,
+	ScopeServersConsole,
+	ScopeServersConsoleSend,
+	ScopeServersStop,
+	ScopeServersStart,
+	ScopeServersStat,
+	ScopeServersSFTP,
+	ScopeServersFilesGet,
+	ScopeServersFilesPut,
+	ScopeServersTransfer,
+	ScopeNodesView,
+	ScopeNodesEdit,
+	ScopeNodesDeploy,
+	ScopeTemplatesView,
+	ScopeTemplatesEdit,
+	ScopeUsersView,
+	ScopeUsersEdit,
+	ScopeSettings,
+}
+
+// GlobalScopes are the scopes which give access to the panel itself rather than to a server
+var GlobalScopes = []Scope{
+	ScopeServersAdmin,
+	ScopeServersCreate,
+	ScopeNodesView,
+	ScopeNodesEdit,
+	ScopeNodesDeploy,
+	ScopeTemplatesView,
+	ScopeTemplatesEdit,
+	ScopeUsersView,
+	ScopeUsersEdit,
+	ScopeSettings,
+}
+
+func (s Scope) IsGlobal() bool {
+	for _, v := range GlobalScopes {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func (s Scope) IsAssignable() bool {
+	for _, v := range AssignableScopes {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
 func (s Scope) String() string {
 	return string(s)
 }
@@ -15,6 +15,7 @@ package pufferpanel
 
 import (
 	"context"
+	"os"
 	"os/exec"
 	"runtime"
 	"strings"
@@ -35,6 +36,15 @@ type Server struct {
 	Execution             Execution           `json:"run,omitempty"`
 	Tasks                 map[string]Task     `json:"tasks,omitempty"`
 	Requirements          Requirements        `json:"requirements,omitempty"`
+	Ports                 []ServerPort        `json:"ports,omitempty"`
+	Owner                 string              `json:"owner,omitempty"`
+}
+
+// ServerPort is a port the panel gave the server, which must be free before it can start
+type ServerPort struct {
+	Name string `json:"name"`
+	IP   string `json:"ip"`
+	Port uint16 `json:"port"`
 }
 
 type Task struct {
@@ -73,6 +83,7 @@ type Execution struct {
 	LegacyRun               string            `json:"program,omitempty"`
 	LegacyArguments         []string          `json:"arguments,omitempty"`
 	WorkingDirectory        string            `json:"workingDirectory,omitempty"`
+	HealthCheck             *HealthCheck      `json:"healthCheck,omitempty"`
 }
 
 type Type struct {
@@ -83,6 +94,11 @@ type Requirements struct {
 	Binaries []string `json:"binaries,omitempty"`
 	OS       string   `json:"os,omitempty"`
 	Arch     string   `json:"arch,omitempty"`
+
+	//what the server needs from the node it is placed on. Memory and disk are in MB, cpu is in percent of a core
+	Memory uint64 `json:"memory,omitempty"`
+	Cpu    uint64 `json:"cpu,omitempty"`
+	Disk   uint64 `json:"disk,omitempty"`
 }
 
 func (s *Server) CopyFrom(replacement *Server) {
@@ -135,10 +151,17 @@ func (r Requirements) Test(server Server) error {
 		return err
 	}
 
-	if envType.Type == "docker" {
-		d, err := client.NewClientWithOpts(client.FromEnv)
+	if envType.Type == "docker" || envType.Type == "podman" {
+		opts := []client.Opt{client.FromEnv}
+		notSupported := ErrDockerNotSupported
+		if envType.Type == "podman" {
+			opts = append(opts, client.WithHost(GetPodmanHost()))
+			notSupported = ErrPodmanNotSupported
+		}
+
+		d, err := client.NewClientWithOpts(opts...)
 		if err != nil {
-			return ErrDockerNotSupported
+			return notSupported
 		}
 
 		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
@@ -146,11 +169,16 @@ func (r Requirements) Test(server Server) error {
 
 		_, err = d.Ping(ctx)
 		if err != nil {
-			return ErrDockerNotSupported
+			return notSupported
+		}
+
+		err = CheckNetworkBlock(server.Environment)
+		if err != nil {
+			return err
 		}
 	} else {
-		//we cannot check in docker if the binary requirements are good, so we'll skip it for docker
-		//and check them now
+		//docker and podman run every command in the server's image, so only other environments need the binaries on
+		//the host
 
 		for _, v := range r.Binaries {
 			binaries := parseRequirementRow(v)
@@ -173,6 +201,24 @@ func (r Requirements) Test(server Server) error {
 	return nil
 }
 
+// CheckNetworkBlock checks the node can block private networks if the environment asks for it. This needs iptables,
+// which rootless podman cannot change, so the server is refused rather than failing every time it starts
+func CheckNetworkBlock(environment interface{}) error {
+	var section struct {
+		Type
+		BlockPrivateNetworks bool `json:"blockPrivateNetworks,omitempty"`
+	}
+	err := UnmarshalTo(environment, &section)
+	if err != nil || !section.BlockPrivateNetworks {
+		return err
+	}
+
+	if runtime.GOOS != "linux" || (section.Type.Type == "podman" && os.Geteuid() != 0) {
+		return ErrNetworkBlockNotSupported
+	}
+	return nil
+}
+
 func (s Server) DataToMap() map[string]interface{} {
 	var result = make(map[string]interface{})
 
@@ -180,6 +226,7 @@ func (s Server) DataToMap() map[string]interface{} {
 		result[k] = v.Value
 	}
 	result["serverId"] = s.Identifier
+	result["owner"] = s.Owner
 
 	return result
 }
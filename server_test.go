@@ -1,7 +1,9 @@
 package pufferpanel
 
 import (
+	"os"
 	"reflect"
+	"runtime"
 	"testing"
 )
 
@@ -24,3 +26,27 @@ func TestParseRequirementRow(t *testing.T) {
 		}
 	}
 }
+
+func TestCheckNetworkBlock(t *testing.T) {
+	blockable := runtime.GOOS == "linux"
+	rootless := os.Geteuid() != 0
+
+	tests := []struct {
+		name        string
+		environment map[string]interface{}
+		wantErr     bool
+	}{
+		{name: "not asked", environment: map[string]interface{}{"type": "podman"}, wantErr: false},
+		{name: "docker", environment: map[string]interface{}{"type": "docker", "blockPrivateNetworks": true}, wantErr: !blockable},
+		{name: "podman", environment: map[string]interface{}{"type": "podman", "blockPrivateNetworks": true}, wantErr: !blockable || rootless},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckNetworkBlock(tt.environment)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("CheckNetworkBlock() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,377 @@
+/*
+ Copyright 2023 Padduck, LLC
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+  	http://www.apache.org/licenses/LICENSE-2.0
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+*/
+
+package services
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"github.com/pufferpanel/pufferpanel/v2"
+	"github.com/pufferpanel/pufferpanel/v2/models"
+	uuid "github.com/satori/go.uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AuthorizationCodeExpiration is how long an app has to exchange a code for tokens
+const AuthorizationCodeExpiration = 10 * time.Minute
+
+// ApplicationTokenExpiration is how long an app's refresh token lasts without being used
+const ApplicationTokenExpiration = 30 * 24 * time.Hour
+
+type Application struct {
+	DB *gorm.DB
+}
+
+type authorizationCode struct {
+	applicationId   uint
+	authorizationId uint
+	redirectUri     string
+	challenge       string
+	expires         time.Time
+}
+
+// codes are keyed by their hash, and can only be used once
+var authorizationCodes = make(map[string]*authorizationCode)
+var authorizationCodesLocker sync.Mutex
+
+func (as *Application) GetForOwner(ownerId uint) ([]*models.Application, error) {
+	apps := &models.Applications{}
+	err := as.DB.Where(&models.Application{OwnerId: ownerId}).Order("name").Find(apps).Error
+	return *apps, err
+}
+
+func (as *Application) Get(clientId string) (*models.Application, error) {
+	app := &models.Application{}
+	err := as.DB.Where(&models.Application{ClientId: clientId}).First(app).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, pufferpanel.ErrApplicationNotFound
+	}
+	return app, err
+}
+
+// Create registers the app. Unless it is public, a secret is made for it, which is only returned here
+func (as *Application) Create(app *models.Application, public bool) (string, error) {
+	app.ClientId = uuid.NewV4().String()
+
+	var secret string
+	if !public {
+		var err error
+		secret, err = pufferpanel.GenerateRandomString(36)
+		if err != nil {
+			return "", err
+		}
+		err = app.SetClientSecret(secret)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return secret, as.DB.Omit(clause.Associations).Create(app).Error
+}
+
+func (as *Application) Update(app *models.Application) error {
+	return as.DB.Omit(clause.Associations).Save(app).Error
+}
+
+// Delete removes the app, along with every authorization users have given it
+func (as *Application) Delete(app *models.Application) error {
+	err := as.DB.Transaction(func(tx *gorm.DB) error {
+		authorizations := tx.Model(&models.ApplicationAuthorization{}).Select("id").Where("application_id = ?", app.ID)
+		err := tx.Delete(&models.ApplicationToken{}, "authorization_id IN (?)", authorizations).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Delete(&models.ApplicationAuthorization{}, "application_id = ?", app.ID).Error
+		if err != nil {
+			return err
+		}
+		return tx.Delete(app).Error
+	})
+	if err != nil {
+		return err
+	}
+	clearIntrospectionCache()
+	return nil
+}
+
+// ValidateRequest checks the request from an app can be shown to the user, and gets what it is asking for.
+// If no scopes are asked for, the app is asking for everything it is allowed. The app is only returned once the
+// redirect uri is known to be one it registered, as only then is it safe to send errors back to it
+func (as *Application) ValidateRequest(request *models.AuthorizeRequest) (*models.Application, []pufferpanel.Scope, error) {
+	app, err := as.Get(request.ClientId)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if !app.HasRedirectUri(request.RedirectUri) {
+		return nil, nil, pufferpanel.ErrInvalidRedirectUri
+	}
+
+	if request.ResponseType != "code" {
+		return app, nil, pufferpanel.ErrUnsupportedResponseType
+	}
+
+	//a S256 challenge is the base64url sha256 of the verifier, which is always 43 characters
+	if request.CodeChallengeMethod != "S256" || len(request.CodeChallenge) != 43 {
+		return app, nil, pufferpanel.ErrPKCERequired
+	}
+
+	requested := strings.Fields(request.Scope)
+	if len(requested) == 0 {
+		return app, app.Scopes, nil
+	}
+
+	scopes := make([]pufferpanel.Scope, 0, len(requested))
+	for _, v := range requested {
+		scope := pufferpanel.Scope(v)
+		if !containsExactScope(app.Scopes, scope) {
+			return app, nil, pufferpanel.ErrUnknownScope(scope)
+		}
+		if !containsExactScope(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	return app, scopes, nil
+}
+
+// GetAuthorization gets what the user has already let the app do, or nil if they have not authorized it
+func (as *Application) GetAuthorization(userId, applicationId uint) (*models.ApplicationAuthorization, error) {
+	authorization := &models.ApplicationAuthorization{}
+	err := as.DB.Where(&models.ApplicationAuthorization{UserId: userId, ApplicationId: applicationId}).First(authorization).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	return authorization, err
+}
+
+func (as *Application) GetAuthorizationsForUser(userId uint) ([]*models.ApplicationAuthorization, error) {
+	authorizations := &models.ApplicationAuthorizations{}
+	err := as.DB.Preload("Application").Where(&models.ApplicationAuthorization{UserId: userId}).Order("created_at").Find(authorizations).Error
+	return *authorizations, err
+}
+
+func (as *Application) GetAuthorizationForUser(userId, id uint) (*models.ApplicationAuthorization, error) {
+	authorization := &models.ApplicationAuthorization{}
+	err := as.DB.Where(&models.ApplicationAuthorization{ID: id, UserId: userId}).First(authorization).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, pufferpanel.ErrAuthorizationNotFound
+	}
+	return authorization, err
+}
+
+// Authorize records the user's consent for the app to use the scopes, replacing what they agreed to before.
+// The returned code can be exchanged once by the app for tokens, proving it with the verifier of the challenge
+func (as *Application) Authorize(userId uint, app *models.Application, scopes []pufferpanel.Scope, redirectUri, challenge string) (string, error) {
+	authorization, err := as.GetAuthorization(userId, app.ID)
+	if err != nil {
+		return "", err
+	}
+
+	if authorization == nil {
+		authorization = &models.ApplicationAuthorization{
+			ApplicationId: app.ID,
+			UserId:        userId,
+		}
+	}
+	authorization.Scopes = scopes
+
+	err = as.DB.Omit(clause.Associations).Save(authorization).Error
+	if err != nil {
+		return "", err
+	}
+
+	code, err := pufferpanel.GenerateRandomString(32)
+	if err != nil {
+		return "", err
+	}
+
+	authorizationCodesLocker.Lock()
+	defer authorizationCodesLocker.Unlock()
+
+	now := time.Now()
+	for k, v := range authorizationCodes {
+		if now.After(v.expires) {
+			delete(authorizationCodes, k)
+		}
+	}
+
+	authorizationCodes[models.HashRefreshToken(code)] = &authorizationCode{
+		applicationId:   app.ID,
+		authorizationId: authorization.ID,
+		redirectUri:     redirectUri,
+		challenge:       challenge,
+		expires:         now.Add(AuthorizationCodeExpiration),
+	}
+	return code, nil
+}
+
+// ExchangeCode trades a code for the authorization it was issued for, and a refresh token to keep using it
+func (as *Application) ExchangeCode(app *models.Application, code, redirectUri, verifier string) (*models.ApplicationAuthorization, string, error) {
+	authorizationCodesLocker.Lock()
+	pending, exists := authorizationCodes[models.HashRefreshToken(code)]
+	delete(authorizationCodes, models.HashRefreshToken(code))
+	authorizationCodesLocker.Unlock()
+
+	if !exists || time.Now().After(pending.expires) || pending.applicationId != app.ID || pending.redirectUri != redirectUri {
+		return nil, "", pufferpanel.ErrInvalidGrant
+	}
+
+	hash := sha256.Sum256([]byte(verifier))
+	expected := base64.RawURLEncoding.EncodeToString(hash[:])
+	if subtle.ConstantTimeCompare([]byte(expected), []byte(pending.challenge)) != 1 {
+		return nil, "", pufferpanel.ErrInvalidGrant
+	}
+
+	authorization := &models.ApplicationAuthorization{}
+	err := as.DB.Where(&models.ApplicationAuthorization{ID: pending.authorizationId}).First(authorization).Error
+	if err == gorm.ErrRecordNotFound {
+		//the user took back their consent before the app got here
+		return nil, "", pufferpanel.ErrInvalidGrant
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	token, err := as.issueToken(as.DB, authorization)
+	if err != nil {
+		return nil, "", err
+	}
+	return authorization, token, nil
+}
+
+// Refresh trades a refresh token for a new one. The old token can no longer be used
+func (as *Application) Refresh(app *models.Application, refreshToken string) (*models.ApplicationAuthorization, string, error) {
+	existing := &models.ApplicationToken{}
+	err := as.DB.Where(&models.ApplicationToken{HashedToken: models.HashRefreshToken(refreshToken)}).First(existing).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, "", pufferpanel.ErrInvalidGrant
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	if time.Now().After(existing.ExpiresAt) {
+		err = as.DB.Delete(existing).Error
+		if err != nil {
+			return nil, "", err
+		}
+		return nil, "", pufferpanel.ErrInvalidGrant
+	}
+
+	authorization := &models.ApplicationAuthorization{}
+	err = as.DB.Where(&models.ApplicationAuthorization{ID: existing.AuthorizationId}).First(authorization).Error
+	if err == gorm.ErrRecordNotFound || (err == nil && authorization.ApplicationId != app.ID) {
+		return nil, "", pufferpanel.ErrInvalidGrant
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	var token string
+	err = as.DB.Transaction(func(tx *gorm.DB) error {
+		//if two requests race with the same token, only one of them can remove it
+		res := tx.Delete(&models.ApplicationToken{}, "id = ? AND token = ?", existing.ID, existing.HashedToken)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected != 1 {
+			return pufferpanel.ErrInvalidGrant
+		}
+
+		var err error
+		token, err = as.issueToken(tx, authorization)
+		return err
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return authorization, token, nil
+}
+
+// Revoke removes the user's consent, so the app can no longer get tokens for them
+func (as *Application) Revoke(authorization *models.ApplicationAuthorization) error {
+	err := as.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Delete(&models.ApplicationToken{}, "authorization_id = ?", authorization.ID).Error
+		if err != nil {
+			return err
+		}
+		return tx.Delete(&models.ApplicationAuthorization{}, "id = ?", authorization.ID).Error
+	})
+	if err != nil {
+		return err
+	}
+	clearIntrospectionCache()
+	return nil
+}
+
+func (as *Application) issueToken(db *gorm.DB, authorization *models.ApplicationAuthorization) (string, error) {
+	token, err := pufferpanel.GenerateRandomString(48)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	err = db.Create(&models.ApplicationToken{
+		AuthorizationId: authorization.ID,
+		HashedToken:     models.HashRefreshToken(token),
+		ExpiresAt:       now.Add(ApplicationTokenExpiration),
+	}).Error
+	if err != nil {
+		return "", err
+	}
+
+	authorization.LastUsed = &now
+	err = db.Model(&models.ApplicationAuthorization{}).Where("id = ?", authorization.ID).Update("last_used", now).Error
+	return token, err
+}
+
+// AuthorizeRedirect builds where the user is sent back to the app, carrying the state the app gave us
+func AuthorizeRedirect(request *models.AuthorizeRequest, values url.Values) string {
+	if request.State != "" {
+		values.Set("state", request.State)
+	}
+
+	separator := "?"
+	if strings.Contains(request.RedirectUri, "?") {
+		separator = "&"
+	}
+	return request.RedirectUri + separator + values.Encode()
+}
+
+// AuthorizeErrorCode gets the OAuth2 error code to send back to the app for a request which was not valid
+func AuthorizeErrorCode(err error) string {
+	switch pufferpanel.FromError(err).GetCode() {
+	case pufferpanel.ErrUnsupportedResponseType.Code:
+		return "unsupported_response_type"
+	case "ErrUnknownScope":
+		return "invalid_scope"
+	default:
+		return "invalid_request"
+	}
+}
+
+// containsExactScope is like pufferpanel.ContainsScope, without servers.admin standing in for everything
+func containsExactScope(scopes []pufferpanel.Scope, scope pufferpanel.Scope) bool {
+	for _, v := range scopes {
+		if v == scope {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,128 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"github.com/pufferpanel/pufferpanel/v2"
+	"github.com/pufferpanel/pufferpanel/v2/models"
+	"testing"
+)
+
+func TestApplication_AuthorizationCode(t *testing.T) {
+	db := prepareTestDatabase(t, "applications", &models.User{}, &models.Application{},
+		&models.ApplicationAuthorization{}, &models.ApplicationToken{})
+
+	as := &Application{DB: db}
+
+	user := &models.User{Username: "apptest", Email: "app@test.com", HashedPassword: "x"}
+	if err := db.Create(user).Error; err != nil {
+		t.Fatalf("create user error = %v", err)
+	}
+
+	app := &models.Application{
+		OwnerId:      user.ID,
+		Name:         "test app",
+		RedirectUris: []string{"https://app.example.com/callback"},
+		Scopes:       []pufferpanel.Scope{pufferpanel.ScopeServersView, pufferpanel.ScopeServersConsole},
+	}
+	secret, err := as.Create(app, true)
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if secret != "" || !app.IsPublic() {
+		t.Errorf("Create() public app was given a secret")
+	}
+
+	verifier := "a-verifier-which-is-long-enough-to-be-used-for-pkce"
+	hash := sha256.Sum256([]byte(verifier))
+	request := &models.AuthorizeRequest{
+		ResponseType:        "code",
+		ClientId:            app.ClientId,
+		RedirectUri:         "https://app.example.com/callback",
+		Scope:               string(pufferpanel.ScopeServersView),
+		CodeChallenge:       base64.RawURLEncoding.EncodeToString(hash[:]),
+		CodeChallengeMethod: "S256",
+	}
+
+	t.Run("validate", func(t *testing.T) {
+		_, scopes, err := as.ValidateRequest(request)
+		if err != nil || len(scopes) != 1 || scopes[0] != pufferpanel.ScopeServersView {
+			t.Errorf("ValidateRequest() = %v, %v, want [%s]", scopes, err, pufferpanel.ScopeServersView)
+		}
+
+		bad := *request
+		bad.RedirectUri = "https://evil.example.com/callback"
+		if found, _, err := as.ValidateRequest(&bad); err != pufferpanel.ErrInvalidRedirectUri || found != nil {
+			t.Errorf("ValidateRequest() error = %v, want %v", err, pufferpanel.ErrInvalidRedirectUri)
+		}
+
+		bad = *request
+		bad.CodeChallengeMethod = "plain"
+		if _, _, err := as.ValidateRequest(&bad); err != pufferpanel.ErrPKCERequired {
+			t.Errorf("ValidateRequest() error = %v, want %v", err, pufferpanel.ErrPKCERequired)
+		}
+
+		bad = *request
+		bad.Scope = string(pufferpanel.ScopeUsersEdit)
+		if _, _, err := as.ValidateRequest(&bad); AuthorizeErrorCode(err) != "invalid_scope" {
+			t.Errorf("ValidateRequest() error = %v, want an unknown scope", err)
+		}
+	})
+
+	var refreshToken string
+	t.Run("exchange", func(t *testing.T) {
+		code, err := as.Authorize(user.ID, app, []pufferpanel.Scope{pufferpanel.ScopeServersView}, request.RedirectUri, request.CodeChallenge)
+		if err != nil {
+			t.Fatalf("Authorize() error = %v", err)
+		}
+
+		//a wrong verifier uses up the code, just like a right one
+		if _, _, err = as.ExchangeCode(app, code, request.RedirectUri, "wrong"); err != pufferpanel.ErrInvalidGrant {
+			t.Errorf("ExchangeCode() error = %v, want %v", err, pufferpanel.ErrInvalidGrant)
+		}
+		if _, _, err = as.ExchangeCode(app, code, request.RedirectUri, verifier); err != pufferpanel.ErrInvalidGrant {
+			t.Errorf("ExchangeCode() reused error = %v, want %v", err, pufferpanel.ErrInvalidGrant)
+		}
+
+		code, err = as.Authorize(user.ID, app, []pufferpanel.Scope{pufferpanel.ScopeServersView}, request.RedirectUri, request.CodeChallenge)
+		if err != nil {
+			t.Fatalf("Authorize() error = %v", err)
+		}
+		authorization, token, err := as.ExchangeCode(app, code, request.RedirectUri, verifier)
+		if err != nil {
+			t.Fatalf("ExchangeCode() error = %v", err)
+		}
+		if authorization.UserId != user.ID || len(authorization.Scopes) != 1 {
+			t.Errorf("ExchangeCode() = %+v, want the user's authorization", authorization)
+		}
+		refreshToken = token
+	})
+
+	t.Run("refresh", func(t *testing.T) {
+		_, token, err := as.Refresh(app, refreshToken)
+		if err != nil {
+			t.Fatalf("Refresh() error = %v", err)
+		}
+
+		//refresh tokens can only be used once
+		if _, _, err = as.Refresh(app, refreshToken); err != pufferpanel.ErrInvalidGrant {
+			t.Errorf("Refresh() reused error = %v, want %v", err, pufferpanel.ErrInvalidGrant)
+		}
+		refreshToken = token
+	})
+
+	t.Run("revoke", func(t *testing.T) {
+		authorizations, err := as.GetAuthorizationsForUser(user.ID)
+		if err != nil || len(authorizations) != 1 || authorizations[0].Application.ClientId != app.ClientId {
+			t.Fatalf("GetAuthorizationsForUser() = %v, %v, want 1 for the app", authorizations, err)
+		}
+
+		if err = as.Revoke(authorizations[0]); err != nil {
+			t.Fatalf("Revoke() error = %v", err)
+		}
+
+		if _, _, err = as.Refresh(app, refreshToken); err != pufferpanel.ErrInvalidGrant {
+			t.Errorf("Refresh() revoked error = %v, want %v", err, pufferpanel.ErrInvalidGrant)
+		}
+	})
+}
@@ -0,0 +1,264 @@
+/*
+ Copyright 2023 Padduck, LLC
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+  	http://www.apache.org/licenses/LICENSE-2.0
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+*/
+
+package services
+
+import (
+	"github.com/pufferpanel/pufferpanel/v2"
+	"github.com/pufferpanel/pufferpanel/v2/config"
+	"github.com/pufferpanel/pufferpanel/v2/database"
+	"github.com/pufferpanel/pufferpanel/v2/logging"
+	"github.com/pufferpanel/pufferpanel/v2/models"
+	uuid "github.com/satori/go.uuid"
+	"gorm.io/gorm/clause"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// how long a finished bulk job can still be looked up
+const bulkJobRetention = time.Hour
+
+// bulk jobs are only kept in memory, like transfers
+var bulkJobs = make(map[string]*models.BulkJobView)
+var bulkLocker sync.RWMutex
+
+// ServerFilter picks servers by what they are and where they run. Every field that is set has to match
+type ServerFilter struct {
+	Identifiers []string
+	NodeId      *uint
+	Type        string
+	NodeTag     string
+}
+
+func (ss *Server) Filter(filter ServerFilter) ([]*models.Server, error) {
+	query := ss.DB
+
+	if len(filter.Identifiers) > 0 {
+		query = query.Where("servers.identifier IN ?", filter.Identifiers)
+	}
+	if filter.NodeId != nil {
+		if *filter.NodeId == models.LocalNode.ID {
+			query = query.Where("servers.node_id IS NULL")
+		} else {
+			query = query.Where("servers.node_id = ?", *filter.NodeId)
+		}
+	}
+	if filter.Type != "" {
+		query = query.Where("servers.type = ?", filter.Type)
+	}
+
+	records := make([]*models.Server, 0)
+	err := query.Preload(clause.Associations).Order("servers.name").Find(&records).Error
+	if err != nil {
+		return nil, err
+	}
+
+	if filter.NodeTag == "" {
+		return records, nil
+	}
+
+	result := make([]*models.Server, 0)
+	for _, v := range records {
+		if v.Node.HasTag(filter.NodeTag) {
+			result = append(result, v)
+		}
+	}
+	return result, nil
+}
+
+// StartBulkAction runs the action on every server in the background, a few at a time on each node.
+// GetBulkJob reports how it is going
+func (ss *Server) StartBulkAction(userId uint, servers []*models.Server, skipped int, request *models.BulkActionRequest) *models.BulkJobView {
+	job := &models.BulkJobView{
+		Id:        uuid.NewV4().String(),
+		Action:    request.Action,
+		Status:    models.BulkStatusRunning,
+		Total:     len(servers),
+		Skipped:   skipped,
+		Results:   make([]*models.BulkResultView, len(servers)),
+		StartedAt: time.Now(),
+		UserId:    userId,
+	}
+	for k, v := range servers {
+		job.Results[k] = &models.BulkResultView{
+			ServerId: v.Identifier,
+			Name:     v.Name,
+			NodeId:   v.NodeID,
+			Status:   models.BulkStatusPending,
+		}
+	}
+
+	bulkLocker.Lock()
+	for k, v := range bulkJobs {
+		if v.FinishedAt != nil && time.Since(*v.FinishedAt) > bulkJobRetention {
+			delete(bulkJobs, k)
+		}
+	}
+	bulkJobs[job.Id] = job
+	result := copyBulkJob(job)
+	bulkLocker.Unlock()
+
+	go runBulkJob(job, servers, *request)
+
+	return result
+}
+
+// GetBulkJob gets the progress of a bulk job
+func (ss *Server) GetBulkJob(id string) (*models.BulkJobView, error) {
+	bulkLocker.RLock()
+	defer bulkLocker.RUnlock()
+
+	job, exists := bulkJobs[id]
+	if !exists {
+		return nil, pufferpanel.ErrBulkJobNotFound
+	}
+	return copyBulkJob(job), nil
+}
+
+func runBulkJob(job *models.BulkJobView, servers []*models.Server, request models.BulkActionRequest) {
+	defer pufferpanel.Recover()
+
+	db, err := database.GetConnection()
+	if err != nil {
+		logging.Error.Printf("Error running bulk job %s: %s", job.Id, err)
+		for _, v := range job.Results {
+			setBulkResult(job, v, err)
+		}
+		finishBulkJob(job)
+		return
+	}
+	ns := &Node{DB: db}
+
+	limit := config.BulkConcurrency.Value()
+	if limit < 1 {
+		limit = 1
+	}
+	nodeLimit := config.BulkNodeConcurrency.Value()
+	if nodeLimit < 1 || nodeLimit > limit {
+		nodeLimit = limit
+	}
+
+	//a node slot is taken first, so servers waiting on a busy node do not hold up the others
+	slots := make(chan struct{}, limit)
+	nodeSlots := make(map[uint]chan struct{})
+
+	wg := sync.WaitGroup{}
+	for k, server := range servers {
+		nodeSlot, exists := nodeSlots[server.NodeID]
+		if !exists {
+			nodeSlot = make(chan struct{}, nodeLimit)
+			nodeSlots[server.NodeID] = nodeSlot
+		}
+
+		wg.Add(1)
+		go func(server *models.Server, result *models.BulkResultView, nodeSlot chan struct{}) {
+			defer wg.Done()
+			nodeSlot <- struct{}{}
+			slots <- struct{}{}
+			defer func() {
+				<-slots
+				<-nodeSlot
+			}()
+
+			setBulkStatus(result, models.BulkStatusRunning)
+			err := runBulkAction(ns, server, request)
+			if err != nil {
+				logging.Error.Printf("Error running %s on server %s: %s", request.Action, server.Identifier, err)
+			}
+			setBulkResult(job, result, err)
+		}(server, job.Results[k], nodeSlot)
+	}
+	wg.Wait()
+
+	finishBulkJob(job)
+}
+
+func runBulkAction(ns *Node, server *models.Server, request models.BulkActionRequest) (err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			err = pufferpanel.ErrUnknownError
+			logging.Error.Printf("Error running %s on server %s: %s", request.Action, server.Identifier, e)
+		}
+	}()
+
+	token, err := GenerateOAuthForServer(server.Identifier, models.BulkActionScopes[request.Action]...)
+	if err != nil {
+		return err
+	}
+	headers := http.Header{}
+	headers.Set("Authorization", "Bearer "+token)
+
+	node := &server.Node
+	path := "/daemon/server/" + server.Identifier
+
+	switch request.Action {
+	case models.BulkActionStart:
+		return callNodeFor(ns, node, http.MethodPost, path+"/start?wait", nil, headers, http.StatusNoContent, nil)
+	case models.BulkActionStop:
+		return callNodeFor(ns, node, http.MethodPost, path+"/stop?wait", nil, headers, http.StatusNoContent, nil)
+	case models.BulkActionKill:
+		return callNodeFor(ns, node, http.MethodPost, path+"/kill", nil, headers, http.StatusNoContent, nil)
+	case models.BulkActionRestart:
+		err = callNodeFor(ns, node, http.MethodPost, path+"/stop?wait", nil, headers, http.StatusNoContent, nil)
+		if err != nil {
+			return err
+		}
+		return callNodeFor(ns, node, http.MethodPost, path+"/start?wait", nil, headers, http.StatusNoContent, nil)
+	case models.BulkActionInstall:
+		return callNodeFor(ns, node, http.MethodPost, path+"/install?wait", nil, headers, http.StatusNoContent, nil)
+	case models.BulkActionCommand:
+		body := io.NopCloser(strings.NewReader(request.Command))
+		return callNodeFor(ns, node, http.MethodPost, path+"/console", body, headers, http.StatusNoContent, nil)
+	}
+	return pufferpanel.ErrUnknownBulkAction(request.Action)
+}
+
+func copyBulkJob(job *models.BulkJobView) *models.BulkJobView {
+	result := *job
+	result.Results = make([]*models.BulkResultView, len(job.Results))
+	for k, v := range job.Results {
+		r := *v
+		result.Results[k] = &r
+	}
+	return &result
+}
+
+func setBulkStatus(result *models.BulkResultView, status string) {
+	bulkLocker.Lock()
+	defer bulkLocker.Unlock()
+	result.Status = status
+}
+
+func setBulkResult(job *models.BulkJobView, result *models.BulkResultView, err error) {
+	bulkLocker.Lock()
+	defer bulkLocker.Unlock()
+	if err != nil {
+		result.Status = models.BulkStatusFailed
+		result.Error = err.Error()
+		job.Failed++
+	} else {
+		result.Status = models.BulkStatusSuccess
+		job.Succeeded++
+	}
+}
+
+func finishBulkJob(job *models.BulkJobView) {
+	bulkLocker.Lock()
+	defer bulkLocker.Unlock()
+	now := time.Now()
+	job.FinishedAt = &now
+	job.Status = models.BulkStatusComplete
+}
@@ -0,0 +1,79 @@
+/*
+ Copyright 2023 Padduck, LLC
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+  	http://www.apache.org/licenses/LICENSE-2.0
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+*/
+
+package services
+
+import (
+	"github.com/pufferpanel/pufferpanel/v2/models"
+	"testing"
+)
+
+func TestServer_Filter(t *testing.T) {
+	db := prepareTestDatabase(t, "bulk", &models.Node{}, &models.Server{}, &models.Team{})
+
+	eu := &models.Node{Name: "eu", PublicHost: "10.0.0.1", PrivateHost: "10.0.0.1", PublicPort: 8080, PrivatePort: 8080,
+		SFTPPort: 5657, Secret: "secret", Tags: []string{"eu"}}
+	us := &models.Node{Name: "us", PublicHost: "10.0.0.2", PrivateHost: "10.0.0.2", PublicPort: 8080, PrivatePort: 8080,
+		SFTPPort: 5657, Secret: "secret", Tags: []string{"us"}}
+	for _, v := range []*models.Node{eu, us} {
+		if err := db.Create(v).Error; err != nil {
+			t.Fatalf("Create() error = %v", err)
+		}
+	}
+
+	servers := []*models.Server{
+		{Name: "lobby", Identifier: "bulk0001", NodeID: eu.ID, Type: "minecraft-java"},
+		{Name: "survival", Identifier: "bulk0002", NodeID: us.ID, Type: "minecraft-java"},
+		{Name: "proxy", Identifier: "bulk0003", NodeID: eu.ID, Type: "bungeecord"},
+	}
+	for _, v := range servers {
+		if err := db.Create(v).Error; err != nil {
+			t.Fatalf("Create() error = %v", err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		filter ServerFilter
+		want   []string
+	}{
+		{name: "ids", filter: ServerFilter{Identifiers: []string{"bulk0001", "bulk0003"}}, want: []string{"bulk0001", "bulk0003"}},
+		{name: "node", filter: ServerFilter{NodeId: &us.ID}, want: []string{"bulk0002"}},
+		{name: "type", filter: ServerFilter{Type: "minecraft-java"}, want: []string{"bulk0001", "bulk0002"}},
+		{name: "tag", filter: ServerFilter{NodeTag: "eu"}, want: []string{"bulk0001", "bulk0003"}},
+		{name: "combined", filter: ServerFilter{Type: "minecraft-java", NodeTag: "eu"}, want: []string{"bulk0001"}},
+		{name: "none", filter: ServerFilter{NodeTag: "asia"}, want: []string{}},
+	}
+
+	ss := &Server{DB: db}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := ss.Filter(tt.filter)
+			if err != nil {
+				t.Fatalf("Filter() error = %v", err)
+			}
+			got := make(map[string]bool)
+			for _, v := range result {
+				got[v.Identifier] = true
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("Filter() matched %d servers, want %d", len(got), len(tt.want))
+			}
+			for _, v := range tt.want {
+				if !got[v] {
+					t.Errorf("Filter() did not match %s", v)
+				}
+			}
+		})
+	}
+}
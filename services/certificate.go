@@ -0,0 +1,364 @@
+/*
+ Copyright 2023 Padduck, LLC
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+  	http://www.apache.org/licenses/LICENSE-2.0
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+*/
+
+package services
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"github.com/go-co-op/gocron"
+	"github.com/pufferpanel/pufferpanel/v2"
+	"github.com/pufferpanel/pufferpanel/v2/config"
+	"github.com/pufferpanel/pufferpanel/v2/database"
+	"github.com/pufferpanel/pufferpanel/v2/logging"
+	"github.com/pufferpanel/pufferpanel/v2/models"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// the CA outlives any certificate it signs by a wide margin, so it never has to be replaced
+const caLifetime = 10 * 365 * 24 * time.Hour
+
+// CertificateAuthority is the panel's own CA, which signs the certificates the panel and its nodes use to talk to
+// each other
+type CertificateAuthority struct {
+	Certificate *x509.Certificate
+	key         *ecdsa.PrivateKey
+	pool        *x509.CertPool
+
+	client       *tls.Certificate
+	clientLocker sync.Mutex
+}
+
+var certificateAuthority *CertificateAuthority
+var certificateAuthorityLocker sync.Mutex
+
+// GetCertificateAuthority loads the CA from disk, creating it the first time it is needed
+func GetCertificateAuthority() (*CertificateAuthority, error) {
+	certificateAuthorityLocker.Lock()
+	defer certificateAuthorityLocker.Unlock()
+
+	if certificateAuthority != nil {
+		return certificateAuthority, nil
+	}
+
+	ca, err := LoadCertificateAuthority(config.NodeCACert.Value(), config.NodeCAKey.Value())
+	if err != nil {
+		return nil, err
+	}
+	certificateAuthority = ca
+	return ca, nil
+}
+
+// LoadCertificateAuthority reads the CA from the given files, and creates it if the key does not exist yet
+func LoadCertificateAuthority(certFile, keyFile string) (*CertificateAuthority, error) {
+	if _, err := os.Stat(keyFile); os.IsNotExist(err) {
+		logging.Info.Printf("Generating new certificate authority for nodes")
+		if err = createCertificateAuthority(certFile, keyFile); err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	key, err := pufferpanel.DecodePrivateKey(data)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err = os.ReadFile(certFile)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := pufferpanel.DecodeCertificate(data)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return &CertificateAuthority{Certificate: cert, key: key, pool: pool}, nil
+}
+
+func createCertificateAuthority(certFile, keyFile string) error {
+	key, err := pufferpanel.GenerateCertificateKey()
+	if err != nil {
+		return err
+	}
+
+	serial, err := newSerialNumber()
+	if err != nil {
+		return err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "PufferPanel Node CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(caLifetime),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+
+	data, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		return err
+	}
+
+	keyData, err := pufferpanel.EncodePrivateKey(key)
+	if err != nil {
+		return err
+	}
+	if err = os.WriteFile(keyFile, keyData, 0600); err != nil {
+		return err
+	}
+
+	cert, err := x509.ParseCertificate(data)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(certFile, pufferpanel.EncodeCertificate(cert), 0644)
+}
+
+func (ca *CertificateAuthority) Pool() *x509.CertPool {
+	return ca.pool
+}
+
+// SignNode signs the node's certificate request. The certificate can only be used to serve connections, so a node
+// can never pass itself off as the panel
+func (ca *CertificateAuthority) SignNode(node *models.Node, request []byte) (*x509.Certificate, error) {
+	csr, err := pufferpanel.DecodeCertificateRequest(request)
+	if err != nil {
+		return nil, err
+	}
+
+	serial, err := newSerialNumber()
+	if err != nil {
+		return nil, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: NodeClientId(node.ID)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(certificateLifetime()),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+
+	for _, host := range []string{node.PrivateHost, node.PublicHost} {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else if host != "" && !pufferpanel.ContainsString(template.DNSNames, host) {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+
+	return ca.sign(template, csr.PublicKey)
+}
+
+// ClientCertificate is what the panel presents to nodes. It is never written to disk, a new one is made when the
+// panel starts, and again when it gets old
+func (ca *CertificateAuthority) ClientCertificate() (tls.Certificate, error) {
+	ca.clientLocker.Lock()
+	defer ca.clientLocker.Unlock()
+
+	if ca.client != nil && time.Until(ca.client.Leaf.NotAfter) > certificateLifetime()/2 {
+		return *ca.client, nil
+	}
+
+	key, err := pufferpanel.GenerateCertificateKey()
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	serial, err := newSerialNumber()
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	cert, err := ca.sign(&x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: "panel"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(certificateLifetime()),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, key.Public())
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	ca.client = &tls.Certificate{Certificate: [][]byte{cert.Raw}, PrivateKey: key, Leaf: cert}
+	return *ca.client, nil
+}
+
+// ClientTLS is how the panel connects to a node with the given pinned certificate
+func (ca *CertificateAuthority) ClientTLS(fingerprint string) (*tls.Config, error) {
+	//make sure one can be made now, rather than failing on every connection
+	if _, err := ca.ClientCertificate(); err != nil {
+		return nil, err
+	}
+	return pufferpanel.PinnedClientTLS(ca.pool, ca.ClientCertificate, fingerprint), nil
+}
+
+func (ca *CertificateAuthority) sign(template *x509.Certificate, publicKey interface{}) (*x509.Certificate, error) {
+	data, err := x509.CreateCertificate(rand.Reader, template, ca.Certificate, publicKey, ca.key)
+	if err != nil {
+		return nil, err
+	}
+	return x509.ParseCertificate(data)
+}
+
+func certificateLifetime() time.Duration {
+	return time.Duration(config.NodeCertificateDays.Value()) * 24 * time.Hour
+}
+
+func newSerialNumber() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+}
+
+// pinCertificate records the certificate as the one the node must present from now on
+func (ns *Node) pinCertificate(node *models.Node, cert *x509.Certificate) error {
+	node.CertFingerprint = pufferpanel.CertificateFingerprint(cert)
+	expires := cert.NotAfter
+	node.CertExpiresAt = &expires
+
+	err := ns.DB.Model(node).UpdateColumns(map[string]interface{}{
+		"cert_fingerprint": node.CertFingerprint,
+		"cert_expires_at":  node.CertExpiresAt,
+	}).Error
+	if err == nil {
+		clearNodeClient(node.ID)
+	}
+	return err
+}
+
+// IssueCertificate signs the node's certificate request and pins the certificate, so the panel only talks to the
+// node over mutual TLS on the given port from now on
+func (ns *Node) IssueCertificate(node *models.Node, request []byte, port uint16) (*x509.Certificate, error) {
+	ca, err := GetCertificateAuthority()
+	if err != nil {
+		return nil, err
+	}
+
+	cert, err := ca.SignNode(node, request)
+	if err != nil {
+		return nil, err
+	}
+
+	if port != 0 && port != node.PrivatePort {
+		node.PrivatePort = port
+		if err = ns.DB.Model(node).UpdateColumn("private_port", port).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	return cert, ns.pinCertificate(node, cert)
+}
+
+// RenewCertificate has the node make a new key, and pins the certificate signed for it. The node keeps serving with
+// its old certificate until the new one is installed
+func (ns *Node) RenewCertificate(node *models.Node) error {
+	ca, err := GetCertificateAuthority()
+	if err != nil {
+		return err
+	}
+
+	token, err := GenerateOAuthForPanel(pufferpanel.ScopeNodesDeploy)
+	if err != nil {
+		return err
+	}
+	headers := http.Header{}
+	headers.Set("Authorization", "Bearer "+token)
+
+	request := &pufferpanel.CertificateRequest{}
+	err = callNodeFor(ns, node, http.MethodPost, "/daemon/certificate/request", nil, headers, http.StatusOK, request)
+	if err != nil {
+		return err
+	}
+
+	cert, err := ca.SignNode(node, []byte(request.Request))
+	if err != nil {
+		return err
+	}
+
+	data, _ := json.Marshal(&pufferpanel.CertificateResponse{
+		Certificate: string(pufferpanel.EncodeCertificate(cert)),
+		CA:          string(pufferpanel.EncodeCertificate(ca.Certificate)),
+	})
+	headers.Set("Content-Type", "application/json")
+	err = callNodeFor(ns, node, http.MethodPut, "/daemon/certificate", io.NopCloser(bytes.NewReader(data)), headers, http.StatusNoContent, nil)
+	if err != nil {
+		return err
+	}
+
+	return ns.pinCertificate(node, cert)
+}
+
+// StartCertificateRenewal renews the certificates of nodes once a third of their lifetime is left
+func StartCertificateRenewal() {
+	if !config.NodeMTLSEnabled.Value() {
+		return
+	}
+
+	s := gocron.NewScheduler(time.UTC)
+	s.SingletonModeAll()
+	_, err := s.Every(1).Hour().Do(renewCertificates)
+	if err != nil {
+		logging.Error.Printf("Error scheduling certificate renewal: %s", err)
+		return
+	}
+	s.StartAsync()
+}
+
+func renewCertificates() {
+	db, err := database.GetConnection()
+	if err != nil {
+		logging.Error.Printf("Error renewing node certificates: %s", err)
+		return
+	}
+
+	var nodes []*models.Node
+	renewBefore := time.Now().Add(certificateLifetime() / 3)
+	err = db.Where("cert_fingerprint <> '' AND cert_expires_at < ?", renewBefore).Find(&nodes).Error
+	if err != nil {
+		logging.Error.Printf("Error renewing node certificates: %s", err)
+		return
+	}
+
+	ns := &Node{DB: db}
+	for _, node := range nodes {
+		if err = ns.RenewCertificate(node); err != nil {
+			logging.Error.Printf("Error renewing certificate for node %d: %s", node.ID, err)
+		} else {
+			logging.Info.Printf("Renewed certificate for node %d", node.ID)
+		}
+	}
+}
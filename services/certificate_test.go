@@ -0,0 +1,104 @@
+package services
+
+import (
+	"crypto/tls"
+	"github.com/pufferpanel/pufferpanel/v2"
+	"github.com/pufferpanel/pufferpanel/v2/config"
+	"github.com/pufferpanel/pufferpanel/v2/models"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestNode_CallNode_MTLS(t *testing.T) {
+	dir := t.TempDir()
+	_ = config.NodeCACert.Set(filepath.Join(dir, "ca.pem"), false)
+	_ = config.NodeCAKey.Set(filepath.Join(dir, "ca.key"), false)
+	certificateAuthority = nil
+	defer func() {
+		certificateAuthority = nil
+	}()
+
+	ca, err := GetCertificateAuthority()
+	if err != nil {
+		t.Fatalf("GetCertificateAuthority() error = %v", err)
+	}
+
+	node := &models.Node{ID: 5, Name: "mtls", PrivateHost: "127.0.0.1", PublicHost: "127.0.0.1"}
+	nodeCert := issueTestCertificate(t, ca, node)
+
+	//stands in for the daemon's listener, which only lets the panel in
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.TLS.PeerCertificates) == 0 || r.TLS.PeerCertificates[0].Subject.CommonName != "panel" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	server.TLS = pufferpanel.MutualServerTLS(ca.Pool(), func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+		return &nodeCert, nil
+	})
+	server.TLS.Certificates = []tls.Certificate{nodeCert}
+	server.StartTLS()
+	defer server.Close()
+
+	_, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+	p, _ := strconv.Atoi(port)
+	node.PrivatePort = uint16(p)
+	node.CertFingerprint = pufferpanel.CertificateFingerprint(nodeCert.Leaf)
+	defer clearNodeClient(node.ID)
+
+	ns := &Node{}
+
+	t.Run("pinned", func(t *testing.T) {
+		res, err := ns.CallNode(node, http.MethodGet, "/daemon", nil, http.Header{})
+		if err != nil {
+			t.Fatalf("CallNode() error = %v", err)
+		}
+		defer pufferpanel.CloseResponse(res)
+		if res.StatusCode != http.StatusNoContent {
+			t.Errorf("CallNode() status = %d, want %d", res.StatusCode, http.StatusNoContent)
+		}
+	})
+
+	t.Run("wrongPin", func(t *testing.T) {
+		//another certificate from the same CA is still not the node's
+		other := issueTestCertificate(t, ca, node)
+		wrong := *node
+		wrong.CertFingerprint = pufferpanel.CertificateFingerprint(other.Leaf)
+
+		res, err := ns.CallNode(&wrong, http.MethodGet, "/daemon", nil, http.Header{})
+		pufferpanel.CloseResponse(res)
+		if err == nil {
+			t.Errorf("CallNode() connected to a node with a different certificate")
+		}
+	})
+
+	t.Run("noClientCertificate", func(t *testing.T) {
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+		res, err := client.Get(server.URL + "/daemon")
+		pufferpanel.CloseResponse(res)
+		if err == nil {
+			t.Errorf("daemon accepted a connection without a client certificate")
+		}
+	})
+}
+
+func issueTestCertificate(t *testing.T, ca *CertificateAuthority, node *models.Node) tls.Certificate {
+	key, err := pufferpanel.GenerateCertificateKey()
+	if err != nil {
+		t.Fatalf("GenerateCertificateKey() error = %v", err)
+	}
+	request, err := pufferpanel.CreateCertificateRequest(key, "node")
+	if err != nil {
+		t.Fatalf("CreateCertificateRequest() error = %v", err)
+	}
+	cert, err := ca.SignNode(node, request)
+	if err != nil {
+		t.Fatalf("SignNode() error = %v", err)
+	}
+	return tls.Certificate{Certificate: [][]byte{cert.Raw}, PrivateKey: key, Leaf: cert}
+}
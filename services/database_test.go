@@ -0,0 +1,23 @@
+package services
+
+import (
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"testing"
+)
+
+// prepareTestDatabase opens a shared in-memory database, with tables for the given models. Each test file uses its
+// own name, so tests do not see each other's rows
+func prepareTestDatabase(t *testing.T, name string, tables ...interface{}) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open("file:"+name+".db?cache=shared&mode=memory"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("prepareTestDatabase() error = %v", err)
+	}
+
+	err = db.AutoMigrate(tables...)
+	if err != nil {
+		t.Fatalf("prepareTestDatabase() error = %v", err)
+	}
+
+	return db
+}
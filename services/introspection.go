@@ -0,0 +1,218 @@
+/*
+ Copyright 2023 Padduck, LLC
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+  	http://www.apache.org/licenses/LICENSE-2.0
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+*/
+
+package services
+
+import (
+	"github.com/pufferpanel/pufferpanel/v2"
+	"github.com/pufferpanel/pufferpanel/v2/models"
+	"gorm.io/gorm"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// IntrospectionCacheDuration is how long a token is trusted to still be active before it is looked at again
+const IntrospectionCacheDuration = 10 * time.Second
+
+type Introspection struct {
+	DB *gorm.DB
+}
+
+type introspectionCacheEntry struct {
+	active  bool
+	expires time.Time
+}
+
+// keyed by the jti of the token, or the raw token if it has none
+var introspectionCache = make(map[string]introspectionCacheEntry)
+var introspectionCacheLocker sync.RWMutex
+
+// IsActive checks a valid token has not been revoked, and that whoever it was issued to is still allowed to use it
+func (is *Introspection) IsActive(token *pufferpanel.Token) (bool, error) {
+	key := token.Claims.ID
+	if key == "" {
+		key = token.Raw
+	}
+
+	introspectionCacheLocker.RLock()
+	cached, exists := introspectionCache[key]
+	introspectionCacheLocker.RUnlock()
+	if exists && time.Now().Before(cached.expires) {
+		return cached.active, nil
+	}
+
+	active, err := is.isActive(token)
+	if err != nil {
+		return false, err
+	}
+
+	introspectionCacheLocker.Lock()
+	defer introspectionCacheLocker.Unlock()
+	now := time.Now()
+	for k, v := range introspectionCache {
+		if now.After(v.expires) {
+			delete(introspectionCache, k)
+		}
+	}
+	introspectionCache[key] = introspectionCacheEntry{active: active, expires: now.Add(IntrospectionCacheDuration)}
+	return active, nil
+}
+
+func (is *Introspection) isActive(token *pufferpanel.Token) (bool, error) {
+	if len(token.Claims.Audience) != 1 {
+		return false, nil
+	}
+
+	if token.Claims.Audience[0] == "session" {
+		ss := &Session{DB: is.DB}
+		_, err := ss.GetActiveSession(token)
+		if err == pufferpanel.ErrInvalidSession {
+			return false, nil
+		}
+		return err == nil, err
+	}
+
+	if token.Claims.Audience[0] != "oauth2" {
+		return false, nil
+	}
+
+	if token.Claims.ID != "" {
+		var count int64
+		err := is.DB.Model(&models.RevokedToken{}).Where("id = ?", token.Claims.ID).Count(&count).Error
+		if err != nil || count > 0 {
+			return false, err
+		}
+	}
+
+	clientId := token.Claims.PanelClaims.ClientId
+	if clientId == "" {
+		//issued by the panel itself, and only revoked by its jti
+		return true, nil
+	}
+
+	if strings.HasPrefix(clientId, ".node_") {
+		id, ok := NodeIdFromClientId(clientId)
+		if !ok {
+			return false, nil
+		}
+		var count int64
+		err := is.DB.Model(&models.Node{}).Where("id = ?", id).Count(&count).Error
+		return count > 0, err
+	}
+
+	as := &Application{DB: is.DB}
+	app, err := as.Get(clientId)
+	if err == nil {
+		userId, err := strconv.ParseUint(token.Claims.Subject, 10, 32)
+		if err != nil {
+			return false, nil
+		}
+		authorization, err := as.GetAuthorization(uint(userId), app.ID)
+		return authorization != nil, err
+	} else if err != pufferpanel.ErrApplicationNotFound {
+		return false, err
+	}
+
+	var count int64
+	err = is.DB.Model(&models.Client{}).Where("client_id = ?", clientId).Count(&count).Error
+	return count > 0, err
+}
+
+// Revoke stops the token from being used. This can be an access token, or a refresh token given to an app.
+// Unless trusted, the token must have been issued to the client asking. Tokens which are not valid are ignored
+func (is *Introspection) Revoke(raw, clientId string, trusted bool) error {
+	as := &Application{DB: is.DB}
+	refreshToken := &models.ApplicationToken{}
+	err := is.DB.Where(&models.ApplicationToken{HashedToken: models.HashRefreshToken(raw)}).First(refreshToken).Error
+	if err == nil {
+		authorization := &models.ApplicationAuthorization{}
+		err = is.DB.Preload("Application").Where(&models.ApplicationAuthorization{ID: refreshToken.AuthorizationId}).First(authorization).Error
+		if err == gorm.ErrRecordNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !trusted && authorization.Application.ClientId != clientId {
+			return pufferpanel.ErrNoPermission
+		}
+		//revoking a refresh token ends the grant, along with the access tokens issued from it
+		return as.Revoke(authorization)
+	} else if err != gorm.ErrRecordNotFound {
+		return err
+	}
+
+	token, err := ParseToken(raw)
+	if err != nil || !token.Valid {
+		return nil
+	}
+
+	if !trusted && token.Claims.PanelClaims.ClientId != clientId {
+		return pufferpanel.ErrNoPermission
+	}
+
+	if len(token.Claims.Audience) == 1 && token.Claims.Audience[0] == "session" {
+		ss := &Session{DB: is.DB}
+		sessionId, err := ss.GetActiveSession(token)
+		if err == pufferpanel.ErrInvalidSession {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return ss.Revoke(&models.Session{ID: sessionId})
+	}
+
+	//tokens from before tokens had ids cannot be revoked, but they do not last long
+	if token.Claims.ID == "" || token.Claims.ExpiresAt == nil {
+		return nil
+	}
+
+	now := time.Now()
+	err = is.DB.Delete(&models.RevokedToken{}, "expires_at < ?", now).Error
+	if err != nil {
+		return err
+	}
+	err = is.DB.Create(&models.RevokedToken{ID: token.Claims.ID, ExpiresAt: token.Claims.ExpiresAt.Time}).Error
+	if err != nil {
+		return err
+	}
+
+	clearIntrospectionCache()
+	return nil
+}
+
+// FormatScopes writes the scopes of a token as an OAuth2 scope string. Scopes for a server are prefixed with its id
+func FormatScopes(scopes map[string][]pufferpanel.Scope) string {
+	result := make([]string, 0)
+	for serverId, v := range scopes {
+		for _, scope := range v {
+			if serverId == "" {
+				result = append(result, string(scope))
+			} else {
+				result = append(result, serverId+":"+string(scope))
+			}
+		}
+	}
+	sort.Strings(result)
+	return strings.Join(result, " ")
+}
+
+func clearIntrospectionCache() {
+	introspectionCacheLocker.Lock()
+	defer introspectionCacheLocker.Unlock()
+	introspectionCache = make(map[string]introspectionCacheEntry)
+}
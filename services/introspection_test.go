@@ -0,0 +1,95 @@
+package services
+
+import (
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/pufferpanel/pufferpanel/v2"
+	"github.com/pufferpanel/pufferpanel/v2/models"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestIntrospection_IsActive(t *testing.T) {
+	db := prepareTestDatabase(t, "introspection", &models.User{}, &models.Client{}, &models.Node{},
+		&models.Application{}, &models.ApplicationAuthorization{}, &models.RevokedToken{})
+
+	is := &Introspection{DB: db}
+
+	user := &models.User{Username: "introspecttest", Email: "introspect@test.com", HashedPassword: "x"}
+	if err := db.Create(user).Error; err != nil {
+		t.Fatalf("create user error = %v", err)
+	}
+
+	client := &models.Client{ClientId: "introspect-client", UserId: user.ID, Name: "test"}
+	if err := db.Create(client).Error; err != nil {
+		t.Fatalf("create client error = %v", err)
+	}
+
+	t.Run("revoked", func(t *testing.T) {
+		token := oauth2Token(user.ID, "revoked-token", "")
+		active, err := is.IsActive(token)
+		if err != nil || !active {
+			t.Fatalf("IsActive() = %v, %v, want true", active, err)
+		}
+
+		err = db.Create(&models.RevokedToken{ID: "revoked-token", ExpiresAt: time.Now().Add(time.Hour)}).Error
+		if err != nil {
+			t.Fatalf("create revoked token error = %v", err)
+		}
+		clearIntrospectionCache()
+
+		if active, err = is.IsActive(token); err != nil || active {
+			t.Errorf("IsActive() = %v, %v, want false", active, err)
+		}
+	})
+
+	t.Run("deletedClient", func(t *testing.T) {
+		token := oauth2Token(user.ID, "client-token", client.ClientId)
+		active, err := is.IsActive(token)
+		if err != nil || !active {
+			t.Fatalf("IsActive() = %v, %v, want true", active, err)
+		}
+
+		os := &OAuth2{DB: db}
+		if err = os.Delete(client); err != nil {
+			t.Fatalf("Delete() error = %v", err)
+		}
+
+		if active, err = is.IsActive(token); err != nil || active {
+			t.Errorf("IsActive() = %v, %v, want false", active, err)
+		}
+	})
+
+	t.Run("unknownClient", func(t *testing.T) {
+		active, err := is.IsActive(oauth2Token(user.ID, "other-token", "does-not-exist"))
+		if err != nil || active {
+			t.Errorf("IsActive() = %v, %v, want false", active, err)
+		}
+	})
+}
+
+func TestFormatScopes(t *testing.T) {
+	got := FormatScopes(map[string][]pufferpanel.Scope{
+		"":         {pufferpanel.ScopeServersView},
+		"abcd1234": {pufferpanel.ScopeServersSFTP},
+	})
+	want := "abcd1234:servers.sftp servers.view"
+	if got != want {
+		t.Errorf("FormatScopes() = %s, want %s", got, want)
+	}
+}
+
+func oauth2Token(userId uint, id, clientId string) *pufferpanel.Token {
+	return &pufferpanel.Token{
+		Claims: &pufferpanel.Claim{
+			RegisteredClaims: jwt.RegisteredClaims{
+				Audience: jwt.ClaimStrings{"oauth2"},
+				Subject:  strconv.Itoa(int(userId)),
+				ID:       id,
+			},
+			PanelClaims: pufferpanel.PanelClaims{
+				ClientId: clientId,
+			},
+		},
+	}
+}
@@ -0,0 +1,107 @@
+/*
+ Copyright 2023 Padduck, LLC
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+  	http://www.apache.org/licenses/LICENSE-2.0
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+*/
+
+package services
+
+import (
+	"fmt"
+	"github.com/pufferpanel/pufferpanel/v2"
+	"github.com/pufferpanel/pufferpanel/v2/config"
+	"github.com/pufferpanel/pufferpanel/v2/models"
+	"gorm.io/gorm"
+	"time"
+)
+
+// CreateJoinToken creates a token a daemon can use once to register itself as the node.
+// The returned token is only given out here, the database only has its hash
+func (ns *Node) CreateJoinToken(node *models.Node) (*models.JoinToken, string, error) {
+	if node.IsLocal() {
+		return nil, "", pufferpanel.ErrNodeInvalid
+	}
+
+	//tokens which were never used are of no use to anyone
+	err := ns.DB.Where("expires_at < ?", time.Now()).Delete(&models.JoinToken{}).Error
+	if err != nil {
+		return nil, "", err
+	}
+
+	token, err := pufferpanel.GenerateRandomString(32)
+	if err != nil {
+		return nil, "", err
+	}
+
+	joinToken := &models.JoinToken{
+		NodeID:    node.ID,
+		ExpiresAt: time.Now().Add(time.Duration(config.NodeJoinTokenMinutes.Value()) * time.Minute),
+	}
+	joinToken.SetToken(token)
+
+	err = ns.DB.Create(joinToken).Error
+	return joinToken, token, err
+}
+
+// Join uses up the token, and updates the node with where the daemon says it can be reached
+func (ns *Node) Join(request *models.NodeJoinRequest) (*models.Node, error) {
+	joinToken := &models.JoinToken{}
+	err := ns.DB.Where("token = ?", models.HashInviteToken(request.Token)).First(joinToken).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, pufferpanel.ErrJoinTokenInvalid
+	} else if err != nil {
+		return nil, err
+	}
+
+	//the delete has to be what claims the token, so two daemons racing each other cannot both use it
+	res := ns.DB.Delete(joinToken)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 || joinToken.IsExpired() {
+		return nil, pufferpanel.ErrJoinTokenInvalid
+	}
+
+	node := &models.Node{}
+	err = ns.DB.First(node, joinToken.NodeID).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, pufferpanel.ErrJoinTokenInvalid
+	} else if err != nil {
+		return nil, err
+	}
+
+	if request.PublicHost != "" {
+		node.PublicHost = request.PublicHost
+		node.PrivateHost = request.PublicHost
+	}
+	if request.PrivateHost != "" {
+		node.PrivateHost = request.PrivateHost
+	}
+	if request.PublicPort != 0 {
+		node.PublicPort = request.PublicPort
+		node.PrivatePort = request.PublicPort
+	}
+	if request.PrivatePort != 0 {
+		node.PrivatePort = request.PrivatePort
+	}
+	if request.SFTPPort != 0 {
+		node.SFTPPort = request.SFTPPort
+	}
+
+	return node, ns.Update(node)
+}
+
+// GetDeployment gets the credentials the daemon uses to talk to the panel
+func (ns *Node) GetDeployment(node *models.Node) *models.Deployment {
+	return &models.Deployment{
+		ClientId:     fmt.Sprintf(".node_%d", node.ID),
+		ClientSecret: node.Secret,
+	}
+}
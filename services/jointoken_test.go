@@ -0,0 +1,56 @@
+package services
+
+import (
+	"github.com/pufferpanel/pufferpanel/v2"
+	"github.com/pufferpanel/pufferpanel/v2/models"
+	"testing"
+	"time"
+)
+
+func TestNode_Join(t *testing.T) {
+	db := prepareTestDatabase(t, "jointoken", &models.Node{}, &models.JoinToken{})
+
+	ns := &Node{DB: db}
+
+	node := &models.Node{
+		Name:        "joining",
+		PublicHost:  "127.0.0.1",
+		PrivateHost: "127.0.0.1",
+		PublicPort:  8080,
+		PrivatePort: 8080,
+		SFTPPort:    5657,
+		Secret:      "secret",
+	}
+	if err := ns.Create(node); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	_, token, err := ns.CreateJoinToken(node)
+	if err != nil {
+		t.Fatalf("CreateJoinToken() error = %v", err)
+	}
+
+	joined, err := ns.Join(&models.NodeJoinRequest{Token: token, PublicHost: "node.example.com", PublicPort: 8443, SFTPPort: 5658})
+	if err != nil {
+		t.Fatalf("Join() error = %v", err)
+	}
+	if joined.ID != node.ID || joined.PublicHost != "node.example.com" || joined.PrivateHost != "node.example.com" ||
+		joined.PublicPort != 8443 || joined.PrivatePort != 8443 || joined.SFTPPort != 5658 {
+		t.Errorf("Join() = %+v, want the hosts and ports from the request", joined)
+	}
+
+	if _, err = ns.Join(&models.NodeJoinRequest{Token: token}); err != pufferpanel.ErrJoinTokenInvalid {
+		t.Errorf("Join() with a used token error = %v, want %v", err, pufferpanel.ErrJoinTokenInvalid)
+	}
+
+	expired, token, err := ns.CreateJoinToken(node)
+	if err != nil {
+		t.Fatalf("CreateJoinToken() error = %v", err)
+	}
+	if err = db.Model(expired).Update("expires_at", time.Now().Add(-time.Minute)).Error; err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if _, err = ns.Join(&models.NodeJoinRequest{Token: token}); err != pufferpanel.ErrJoinTokenInvalid {
+		t.Errorf("Join() with an expired token error = %v, want %v", err, pufferpanel.ErrJoinTokenInvalid)
+	}
+}
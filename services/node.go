@@ -15,6 +15,7 @@ package services
 
 import (
 	"bytes"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"github.com/gorilla/websocket"
@@ -30,6 +31,7 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+	"sync"
 )
 
 var wsupgrader = websocket.Upgrader{
@@ -40,6 +42,16 @@ var wsupgrader = websocket.Upgrader{
 	},
 }
 
+// nodes using mutual TLS each need a client which only trusts the certificate pinned for them
+type nodeClient struct {
+	fingerprint string
+	client      *http.Client
+	tls         *tls.Config
+}
+
+var nodeClients = make(map[uint]*nodeClient)
+var nodeClientLocker sync.Mutex
+
 func init() {
 	SyncNodeToConfig()
 }
@@ -133,8 +145,23 @@ func (ns *Node) Delete(id uint) error {
 		return pufferpanel.ErrNodeHasServers
 	}
 
+	err := ns.DB.Delete(&models.PortPool{}, "node_id = ?", model.ID).Error
+	if err != nil {
+		return err
+	}
+
+	err = ns.DB.Delete(&models.JoinToken{}, "node_id = ?", model.ID).Error
+	if err != nil {
+		return err
+	}
+
 	res := ns.DB.Delete(model)
-	return res.Error
+	if res.Error != nil {
+		return res.Error
+	}
+	clearIntrospectionCache()
+	clearNodeClient(model.ID)
+	return nil
 }
 
 func (ns *Node) Create(node *models.Node) error {
@@ -177,7 +204,16 @@ func (ns *Node) CallNode(node *models.Node, method string, path string, body io.
 		return w.Result(), err
 	}
 
-	response, err := pufferpanel.Http().Do(request)
+	client := pufferpanel.Http()
+	if node.UsesMTLS() {
+		nc, err := getNodeClient(node)
+		if err != nil {
+			return nil, err
+		}
+		client = nc.client
+	}
+
+	response, err := client.Do(request)
 	return response, err
 }
 
@@ -199,7 +235,16 @@ func (ns *Node) OpenSocket(node *models.Node, path string, writer http.ResponseW
 	header := http.Header{}
 	header.Set("Authorization", request.Header.Get("Authorization"))
 
-	c, _, err := websocket.DefaultDialer.Dial(u.String(), header)
+	dialer := websocket.DefaultDialer
+	if node.UsesMTLS() {
+		nc, err := getNodeClient(node)
+		if err != nil {
+			return err
+		}
+		dialer = &websocket.Dialer{Proxy: http.ProxyFromEnvironment, HandshakeTimeout: websocket.DefaultDialer.HandshakeTimeout, TLSClientConfig: nc.tls}
+	}
+
+	c, _, err := dialer.Dial(u.String(), header)
 	if err != nil {
 		return err
 	}
@@ -233,8 +278,15 @@ func doesDaemonUseSSL(node *models.Node) (bool, error) {
 	if node.IsLocal() {
 		return false, nil
 	}
+	if node.UsesMTLS() {
+		return true, nil
+	}
+
+	return probeDaemonSSL(node.PrivateHost, node.PrivatePort)
+}
 
-	path := fmt.Sprintf("://%s/daemon", net.JoinHostPort(node.PrivateHost, strconv.Itoa(int(node.PrivatePort))))
+func probeDaemonSSL(host string, port uint16) (bool, error) {
+	path := fmt.Sprintf("://%s/daemon", net.JoinHostPort(host, strconv.Itoa(int(port))))
 
 	//we want to do options so we can avoid auth
 	u, err := url.Parse("https" + path)
@@ -281,6 +333,46 @@ func createNodeURL(node *models.Node, path string) (string, error) {
 	return fmt.Sprintf("%s://%s/%s", protocol, net.JoinHostPort(node.PrivateHost, strconv.Itoa(int(node.PrivatePort))), path), nil
 }
 
+func getNodeClient(node *models.Node) (*nodeClient, error) {
+	nodeClientLocker.Lock()
+	defer nodeClientLocker.Unlock()
+
+	existing, exists := nodeClients[node.ID]
+	if exists && existing.fingerprint == node.CertFingerprint {
+		return existing, nil
+	}
+
+	ca, err := GetCertificateAuthority()
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig, err := ca.ClientTLS(node.CertFingerprint)
+	if err != nil {
+		return nil, err
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+
+	nc := &nodeClient{
+		fingerprint: node.CertFingerprint,
+		client:      &http.Client{Transport: transport},
+		tls:         tlsConfig,
+	}
+	nodeClients[node.ID] = nc
+	return nc, nil
+}
+
+func clearNodeClient(nodeId uint) {
+	nodeClientLocker.Lock()
+	defer nodeClientLocker.Unlock()
+
+	if existing, exists := nodeClients[nodeId]; exists {
+		existing.client.CloseIdleConnections()
+		delete(nodeClients, nodeId)
+	}
+}
+
 func proxyRead(source, dest *websocket.Conn, ch chan error) {
 	for {
 		messageType, data, err := source.ReadMessage()
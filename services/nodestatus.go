@@ -0,0 +1,253 @@
+/*
+ Copyright 2023 Padduck, LLC
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+  	http://www.apache.org/licenses/LICENSE-2.0
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+*/
+
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/go-co-op/gocron"
+	"github.com/pufferpanel/pufferpanel/v2"
+	"github.com/pufferpanel/pufferpanel/v2/config"
+	"github.com/pufferpanel/pufferpanel/v2/database"
+	"github.com/pufferpanel/pufferpanel/v2/logging"
+	"github.com/pufferpanel/pufferpanel/v2/models"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// how long to wait on a node before counting the heartbeat as missed
+const nodeHeartbeatTimeout = 10 * time.Second
+
+// NodeEvent is sent when a node goes online or offline
+type NodeEvent struct {
+	Node   *models.Node
+	Online bool
+	At     time.Time
+}
+
+type NodeListener func(event NodeEvent)
+
+var nodeListeners = make([]NodeListener, 0)
+var nodeListenerLocker sync.RWMutex
+
+// missed heartbeats in a row for each node, and which nodes are still being asked
+var nodeFailures = make(map[uint]int)
+var nodeChecking = make(map[uint]bool)
+var nodeStatusLocker sync.Mutex
+
+// AddNodeListener registers a function to be called when a node goes online or offline
+func AddNodeListener(listener NodeListener) {
+	nodeListenerLocker.Lock()
+	defer nodeListenerLocker.Unlock()
+	nodeListeners = append(nodeListeners, listener)
+}
+
+// StartNodeHeartbeat checks in with every node on a schedule, tracking which can be reached
+func StartNodeHeartbeat() {
+	interval := config.NodeHeartbeatSeconds.Value()
+	if interval <= 0 {
+		return
+	}
+
+	AddNodeListener(logNodeEvent)
+
+	s := gocron.NewScheduler(time.UTC)
+	s.SingletonModeAll()
+	_, err := s.Every(interval).Seconds().Do(checkNodes)
+	if err != nil {
+		logging.Error.Printf("Error scheduling node heartbeat: %s", err)
+		return
+	}
+	s.StartAsync()
+}
+
+func checkNodes() {
+	db, err := database.GetConnection()
+	if err != nil {
+		logging.Error.Printf("Error checking nodes: %s", err)
+		return
+	}
+
+	ns := &Node{DB: db}
+	nodes, err := ns.GetAll()
+	if err != nil {
+		logging.Error.Printf("Error checking nodes: %s", err)
+		return
+	}
+
+	wg := sync.WaitGroup{}
+	for _, v := range nodes {
+		if !startCheck(v.ID) {
+			//still waiting on the last one, which counts as a miss
+			_ = ns.RecordHeartbeat(v, nil, fmt.Errorf("node did not respond within %s", nodeHeartbeatTimeout))
+			continue
+		}
+
+		wg.Add(1)
+		go func(node *models.Node) {
+			defer wg.Done()
+			result := make(chan error, 1)
+			var info *pufferpanel.DaemonInfo
+
+			go func() {
+				defer finishCheck(node.ID)
+				var e error
+				info, e = ns.GetInfo(node)
+				result <- e
+			}()
+
+			select {
+			case err := <-result:
+				err = ns.RecordHeartbeat(node, info, err)
+				if err != nil {
+					logging.Error.Printf("Error saving status of node %d: %s", node.ID, err)
+				}
+			case <-time.After(nodeHeartbeatTimeout):
+				_ = ns.RecordHeartbeat(node, nil, fmt.Errorf("node did not respond within %s", nodeHeartbeatTimeout))
+			}
+		}(v)
+	}
+	wg.Wait()
+}
+
+// GetInfo asks the node for its version and how loaded it is
+func (ns *Node) GetInfo(node *models.Node) (*pufferpanel.DaemonInfo, error) {
+	token, err := GenerateOAuthForPanel(pufferpanel.ScopeNodesView)
+	if err != nil {
+		return nil, err
+	}
+
+	headers := http.Header{}
+	headers.Set("Authorization", "Bearer "+token)
+
+	res, err := ns.CallNode(node, http.MethodGet, "/daemon/info", nil, headers)
+	defer pufferpanel.CloseResponse(res)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("node responded with status %d", res.StatusCode)
+	}
+
+	info := &pufferpanel.DaemonInfo{}
+	err = json.NewDecoder(res.Body).Decode(info)
+	if err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// RecordHeartbeat saves the result of asking a node about itself. A node is only marked offline after it has missed
+// enough heartbeats in a row, so one slow response does not flag it
+func (ns *Node) RecordHeartbeat(node *models.Node, info *pufferpanel.DaemonInfo, heartbeatErr error) error {
+	wasOnline := node.Online
+	now := time.Now()
+
+	nodeStatusLocker.Lock()
+	if heartbeatErr == nil {
+		delete(nodeFailures, node.ID)
+	} else {
+		nodeFailures[node.ID]++
+	}
+	failures := nodeFailures[node.ID]
+	nodeStatusLocker.Unlock()
+
+	if heartbeatErr != nil {
+		logging.Debug.Printf("Node %d missed heartbeat: %s", node.ID, heartbeatErr)
+		if wasOnline && failures < config.NodeOfflineAfter.Value() {
+			return nil
+		}
+	}
+
+	updates := map[string]interface{}{"online": heartbeatErr == nil}
+	if heartbeatErr == nil {
+		updates["last_seen"] = now
+		if info != nil {
+			updates["version"] = info.Version
+			updates["os"] = info.OS
+			updates["arch"] = info.Arch
+		}
+	}
+
+	//the local node is not in the database, so it only lives as long as the panel does
+	if !node.IsLocal() {
+		err := ns.DB.Model(&models.Node{}).Where("id = ?", node.ID).UpdateColumns(updates).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	node.Online = heartbeatErr == nil
+	if heartbeatErr == nil {
+		node.LastSeen = &now
+		if info != nil {
+			node.Version = info.Version
+			node.OS = info.OS
+			node.Arch = info.Arch
+		}
+	}
+
+	if wasOnline != node.Online {
+		fireNodeEvent(NodeEvent{Node: node, Online: node.Online, At: now})
+	}
+	return nil
+}
+
+// RecordEvents takes the events a node sent in. Hearing from a node also means it is up, so it is marked as seen
+func (ns *Node) RecordEvents(nodeId uint, events []pufferpanel.PanelEvent) error {
+	for _, v := range events {
+		if v.Server != "" {
+			logging.Info.Printf("Node %d: server %s %s at %s", nodeId, v.Server, strings.TrimPrefix(v.Type, "server."), v.At.Format(time.RFC3339))
+		} else {
+			logging.Info.Printf("Node %d: %s at %s", nodeId, v.Type, v.At.Format(time.RFC3339))
+		}
+	}
+
+	return ns.DB.Model(&models.Node{}).Where("id = ?", nodeId).UpdateColumn("last_seen", time.Now()).Error
+}
+
+func startCheck(nodeId uint) bool {
+	nodeStatusLocker.Lock()
+	defer nodeStatusLocker.Unlock()
+	if nodeChecking[nodeId] {
+		return false
+	}
+	nodeChecking[nodeId] = true
+	return true
+}
+
+func finishCheck(nodeId uint) {
+	nodeStatusLocker.Lock()
+	defer nodeStatusLocker.Unlock()
+	delete(nodeChecking, nodeId)
+}
+
+func fireNodeEvent(event NodeEvent) {
+	nodeListenerLocker.RLock()
+	defer nodeListenerLocker.RUnlock()
+	for _, v := range nodeListeners {
+		v(event)
+	}
+}
+
+func logNodeEvent(event NodeEvent) {
+	if event.Online {
+		logging.Info.Printf("Node %s (%d) is online", event.Node.Name, event.Node.ID)
+	} else {
+		logging.Error.Printf("Node %s (%d) is offline", event.Node.Name, event.Node.ID)
+	}
+}
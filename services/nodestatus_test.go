@@ -0,0 +1,74 @@
+package services
+
+import (
+	"errors"
+	"github.com/pufferpanel/pufferpanel/v2"
+	"github.com/pufferpanel/pufferpanel/v2/models"
+	"testing"
+)
+
+func TestNode_RecordHeartbeat(t *testing.T) {
+	db := prepareTestDatabase(t, "nodestatus", &models.Node{})
+
+	ns := &Node{DB: db}
+
+	node := &models.Node{
+		Name:        "heartbeat",
+		PublicHost:  "127.0.0.1",
+		PrivateHost: "127.0.0.1",
+		PublicPort:  8080,
+		PrivatePort: 8080,
+		SFTPPort:    5657,
+		Secret:      "secret",
+	}
+	if err := ns.Create(node); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	events := make([]NodeEvent, 0)
+	AddNodeListener(func(event NodeEvent) {
+		if event.Node.ID == node.ID {
+			events = append(events, event)
+		}
+	})
+
+	info := &pufferpanel.DaemonInfo{Version: "2.7.0", OS: "linux", Arch: "amd64"}
+	if err := ns.RecordHeartbeat(node, info, nil); err != nil {
+		t.Fatalf("RecordHeartbeat() error = %v", err)
+	}
+
+	stored, err := ns.Get(node.ID)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if !stored.Online || stored.LastSeen == nil || stored.Version != "2.7.0" || stored.OS != "linux" {
+		t.Errorf("stored node = %+v, want online with version", stored)
+	}
+	if len(events) != 1 || !events[0].Online {
+		t.Fatalf("events = %+v, want one online event", events)
+	}
+
+	//the first miss is forgiven
+	missed := errors.New("connection refused")
+	if err = ns.RecordHeartbeat(stored, nil, missed); err != nil {
+		t.Fatalf("RecordHeartbeat() error = %v", err)
+	}
+	if !stored.Online || len(events) != 1 {
+		t.Errorf("node went offline after one missed heartbeat")
+	}
+
+	if err = ns.RecordHeartbeat(stored, nil, missed); err != nil {
+		t.Fatalf("RecordHeartbeat() error = %v", err)
+	}
+
+	stored, err = ns.Get(node.ID)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if stored.Online || stored.Version != "2.7.0" {
+		t.Errorf("stored node = %+v, want offline keeping its version", stored)
+	}
+	if len(events) != 2 || events[1].Online {
+		t.Errorf("events = %+v, want an offline event", events)
+	}
+}
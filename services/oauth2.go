@@ -62,5 +62,10 @@ func (o *OAuth2) Update(client *models.Client) error {
 }
 
 func (o *OAuth2) Delete(client *models.Client) error {
-	return o.DB.Where(client).Delete(client).Error
+	err := o.DB.Where(client).Delete(client).Error
+	if err != nil {
+		return err
+	}
+	clearIntrospectionCache()
+	return nil
 }
@@ -14,6 +14,7 @@
 package services
 
 import (
+	"github.com/pufferpanel/pufferpanel/v2"
 	"github.com/pufferpanel/pufferpanel/v2/models"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
@@ -92,11 +93,150 @@ func (ps *Permission) UpdatePermissions(perms *models.Permissions) error {
 		return ps.DB.Save(perms).Error
 	}*/
 
-	return ps.DB.Save(perms).Error
+	err := ps.DB.Save(perms).Error
+	if err != nil {
+		return err
+	}
+
+	return ps.removeConverted(perms)
 }
 
 func (ps *Permission) Remove(perms *models.Permissions) error {
 	//update oauth2 with new information
 
-	return ps.DB.Delete(perms).Error
+	err := ps.DB.Delete(perms).Error
+	if err != nil {
+		return err
+	}
+
+	return ps.removeConverted(perms)
+}
+
+// removeConverted drops the roles that were converted from these flags, as the flags now say what the user has
+func (ps *Permission) removeConverted(perms *models.Permissions) error {
+	if perms.UserId == nil {
+		return nil
+	}
+
+	query := ps.DB.Where("user_id = ? AND from_permissions = ?", *perms.UserId, true)
+	if perms.ServerIdentifier == nil || *perms.ServerIdentifier == "" {
+		query = query.Where("server_identifier IS NULL")
+	} else {
+		query = query.Where("server_identifier = ?", *perms.ServerIdentifier)
+	}
+
+	return query.Delete(&models.RoleAssignment{}).Error
+}
+
+// GetScopesForUserAndServer gets the effective scopes for a user, which is what the user was directly granted
+// plus what is granted by the roles assigned to them and the team which owns the server.
+// If serverId is nil, this is the global scopes
+func (ps *Permission) GetScopesForUserAndServer(userId uint, serverId *string) ([]pufferpanel.Scope, error) {
+	perms, err := ps.GetForUserAndServer(userId, serverId)
+	if err != nil {
+		return nil, err
+	}
+
+	rs := &Role{DB: ps.DB}
+	assignments, err := rs.GetAssignmentsForUser(userId, serverId)
+	if err != nil {
+		return nil, err
+	}
+
+	scopes := perms.ToScopes()
+	for _, v := range assignments {
+		scopes = mergeScopes(scopes, v.Role.Scopes)
+	}
+
+	if serverId != nil && *serverId != "" {
+		ts := &Team{DB: ps.DB}
+		teamScopes, err := ts.GetScopesForServer(userId, *serverId)
+		if err != nil {
+			return nil, err
+		}
+		scopes = mergeScopes(scopes, teamScopes)
+	}
+
+	return scopes, nil
+}
+
+// GetScopesForUser gets the effective scopes for a user on every server they have access to.
+// The global scopes are stored with an empty key
+func (ps *Permission) GetScopesForUser(userId uint) (map[string][]pufferpanel.Scope, error) {
+	result := map[string][]pufferpanel.Scope{}
+
+	perms, err := ps.GetForUser(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, perm := range perms {
+		key := ""
+		if perm.ServerIdentifier != nil {
+			key = *perm.ServerIdentifier
+		}
+		result[key] = mergeScopes(result[key], perm.ToScopes())
+	}
+
+	rs := &Role{DB: ps.DB}
+	assignments, err := rs.GetAllAssignmentsForUser(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, v := range assignments {
+		key := ""
+		if v.ServerIdentifier != nil {
+			key = *v.ServerIdentifier
+		}
+		result[key] = mergeScopes(result[key], v.Role.Scopes)
+	}
+
+	ts := &Team{DB: ps.DB}
+	teamScopes, err := ts.GetScopesForUser(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	for k, v := range teamScopes {
+		result[k] = mergeScopes(result[k], v)
+	}
+
+	return result, nil
+}
+
+// IsAdmin checks if the user has been granted admin rights globally, either directly or through a role
+func (ps *Permission) IsAdmin(userId uint) (bool, error) {
+	scopes, err := ps.GetScopesForUserAndServer(userId, nil)
+	if err != nil {
+		return false, err
+	}
+
+	for _, v := range scopes {
+		if v == pufferpanel.ScopeServersAdmin {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func mergeScopes(existing []pufferpanel.Scope, additional []pufferpanel.Scope) []pufferpanel.Scope {
+	if existing == nil {
+		existing = make([]pufferpanel.Scope, 0)
+	}
+
+	for _, v := range additional {
+		found := false
+		for _, e := range existing {
+			if e == v {
+				found = true
+				break
+			}
+		}
+		if !found {
+			existing = append(existing, v)
+		}
+	}
+
+	return existing
 }
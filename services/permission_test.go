@@ -0,0 +1,118 @@
+package services
+
+import (
+	"github.com/pufferpanel/pufferpanel/v2"
+	"github.com/pufferpanel/pufferpanel/v2/models"
+	"testing"
+)
+
+func TestPermission_GetScopesForUserAndServer(t *testing.T) {
+	db := prepareTestDatabase(t, "permissions", &models.Node{}, &models.Team{}, &models.Server{}, &models.User{},
+		&models.Permissions{}, &models.Role{}, &models.RoleAssignment{}, &models.TeamMember{})
+
+	user := &models.User{Username: "roletest", Email: "role@test.com", HashedPassword: "x"}
+	if err := db.Create(user).Error; err != nil {
+		t.Fatalf("create user error = %v", err)
+	}
+
+	serverId := "abcd1234"
+	otherServerId := "efgh5678"
+
+	ps := &Permission{DB: db}
+	rs := &Role{DB: db}
+
+	perms, err := ps.GetForUserAndServer(user.ID, nil)
+	if err != nil {
+		t.Fatalf("GetForUserAndServer() error = %v", err)
+	}
+	perms.ViewServer = true
+	if err = ps.UpdatePermissions(perms); err != nil {
+		t.Fatalf("UpdatePermissions() error = %v", err)
+	}
+
+	moderator := &models.Role{Name: "moderator", Scopes: []pufferpanel.Scope{pufferpanel.ScopeServersConsole, pufferpanel.ScopeServersStart}}
+	if err = rs.Create(moderator); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if err = rs.Create(&models.Role{Name: "moderator"}); err != pufferpanel.ErrRoleExists {
+		t.Errorf("Create() duplicate name error = %v, want %v", err, pufferpanel.ErrRoleExists)
+	}
+
+	if err = rs.Assign(moderator.ID, user.ID, &serverId); err != nil {
+		t.Fatalf("Assign() error = %v", err)
+	}
+	//assigning twice should not duplicate
+	if err = rs.Assign(moderator.ID, user.ID, &serverId); err != nil {
+		t.Fatalf("Assign() error = %v", err)
+	}
+
+	t.Run("server", func(t *testing.T) {
+		scopes, err := ps.GetScopesForUserAndServer(user.ID, &serverId)
+		if err != nil {
+			t.Fatalf("GetScopesForUserAndServer() error = %v", err)
+		}
+		if !pufferpanel.ContainsExactScope(scopes, pufferpanel.ScopeServersConsole) || !pufferpanel.ContainsExactScope(scopes, pufferpanel.ScopeServersStart) {
+			t.Errorf("GetScopesForUserAndServer() = %v, missing role scopes", scopes)
+		}
+	})
+
+	t.Run("otherServer", func(t *testing.T) {
+		scopes, err := ps.GetScopesForUserAndServer(user.ID, &otherServerId)
+		if err != nil {
+			t.Fatalf("GetScopesForUserAndServer() error = %v", err)
+		}
+		if len(scopes) != 0 {
+			t.Errorf("GetScopesForUserAndServer() = %v, want none", scopes)
+		}
+	})
+
+	t.Run("global", func(t *testing.T) {
+		scopes, err := ps.GetScopesForUser(user.ID)
+		if err != nil {
+			t.Fatalf("GetScopesForUser() error = %v", err)
+		}
+		if !pufferpanel.ContainsExactScope(scopes[""], pufferpanel.ScopeServersView) {
+			t.Errorf("GetScopesForUser() global = %v, missing direct scope", scopes[""])
+		}
+		if len(scopes[serverId]) != 2 {
+			t.Errorf("GetScopesForUser() server = %v, want 2 scopes", scopes[serverId])
+		}
+	})
+
+	t.Run("admin", func(t *testing.T) {
+		isAdmin, err := ps.IsAdmin(user.ID)
+		if err != nil || isAdmin {
+			t.Fatalf("IsAdmin() = %v, %v, want false", isAdmin, err)
+		}
+
+		admin := &models.Role{Name: models.RoleAdmin, BuiltIn: true, Scopes: []pufferpanel.Scope{pufferpanel.ScopeServersAdmin}}
+		if err = rs.Create(admin); err != nil {
+			t.Fatalf("Create() error = %v", err)
+		}
+		if err = rs.Assign(admin.ID, user.ID, nil); err != nil {
+			t.Fatalf("Assign() error = %v", err)
+		}
+
+		isAdmin, err = ps.IsAdmin(user.ID)
+		if err != nil || !isAdmin {
+			t.Errorf("IsAdmin() = %v, %v, want true", isAdmin, err)
+		}
+
+		if err = rs.Delete(admin); err != pufferpanel.ErrRoleBuiltIn {
+			t.Errorf("Delete() error = %v, want %v", err, pufferpanel.ErrRoleBuiltIn)
+		}
+	})
+
+	t.Run("unassign", func(t *testing.T) {
+		if err := rs.Unassign(moderator.ID, user.ID, &serverId); err != nil {
+			t.Fatalf("Unassign() error = %v", err)
+		}
+		scopes, err := ps.GetScopesForUserAndServer(user.ID, &serverId)
+		if err != nil {
+			t.Fatalf("GetScopesForUserAndServer() error = %v", err)
+		}
+		if len(scopes) != 0 {
+			t.Errorf("GetScopesForUserAndServer() = %v, want none", scopes)
+		}
+	})
+}
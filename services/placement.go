@@ -0,0 +1,204 @@
+/*
+ Copyright 2023 Padduck, LLC
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+  	http://www.apache.org/licenses/LICENSE-2.0
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+*/
+
+package services
+
+import (
+	"github.com/docker/docker/api/types/container"
+	"github.com/pufferpanel/pufferpanel/v2"
+	"github.com/pufferpanel/pufferpanel/v2/config"
+	"github.com/pufferpanel/pufferpanel/v2/models"
+	"gorm.io/gorm"
+)
+
+const (
+	// PlacementLeastLoaded puts the server on the node which will be the least full afterwards
+	PlacementLeastLoaded = "least-loaded"
+	// PlacementPack fills up nodes before using the next, leaving whole nodes free for larger servers
+	PlacementPack = "pack"
+	// PlacementAffinity prefers nodes with the most of the requested tags, and the least loaded of those
+	PlacementAffinity = "affinity"
+)
+
+type Placement struct {
+	DB *gorm.DB
+}
+
+// AllocationFor works out what a server takes from its node. Docker limits are used if the server has them,
+// otherwise what the template says it needs
+func AllocationFor(server *pufferpanel.Server) models.Allocation {
+	allocation := models.Allocation{
+		Memory: server.Requirements.Memory,
+		Cpu:    server.Requirements.Cpu,
+		Disk:   server.Requirements.Disk,
+	}
+
+	var env struct {
+		Resources container.Resources `json:"resources"`
+	}
+	if server.Environment == nil || pufferpanel.UnmarshalTo(server.Environment, &env) != nil {
+		return allocation
+	}
+
+	if env.Resources.Memory > 0 {
+		allocation.Memory = uint64(env.Resources.Memory / 1024 / 1024)
+	}
+
+	//1e9 NanoCPUs is a whole core, which is 100%
+	if env.Resources.NanoCPUs > 0 {
+		allocation.Cpu = uint64(env.Resources.NanoCPUs / 1e7)
+	} else if env.Resources.CPUQuota > 0 && env.Resources.CPUPeriod > 0 {
+		allocation.Cpu = uint64(env.Resources.CPUQuota * 100 / env.Resources.CPUPeriod)
+	}
+
+	return allocation
+}
+
+// GetUsage adds up what has been given to the servers on the node
+func (ps *Placement) GetUsage(node *models.Node) (*models.NodeUsage, error) {
+	query := ps.DB.Model(&models.Server{})
+	if node.IsLocal() {
+		query = query.Where("node_id IS NULL")
+	} else {
+		query = query.Where("node_id = ?", node.ID)
+	}
+
+	var result struct {
+		Servers uint64
+		Memory  uint64
+		Cpu     uint64
+		Disk    uint64
+	}
+	err := query.Select("COUNT(*) AS servers, COALESCE(SUM(memory), 0) AS memory, COALESCE(SUM(cpu), 0) AS cpu, COALESCE(SUM(disk), 0) AS disk").Scan(&result).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.NodeUsage{
+		Allocation: models.Allocation{Memory: result.Memory, Cpu: result.Cpu, Disk: result.Disk},
+		Servers:    result.Servers,
+	}, nil
+}
+
+// CanFit checks the node has room for another server with the allocation
+func (ps *Placement) CanFit(node *models.Node, allocation models.Allocation) error {
+	usage, err := ps.GetUsage(node)
+	if err != nil {
+		return err
+	}
+
+	if !fits(node, usage, allocation) {
+		return pufferpanel.ErrNodeFull
+	}
+	return nil
+}
+
+// ChooseNode picks the node for a server when one was not given. Only nodes which are online and have room are
+// considered. Unless the mode is affinity, nodes must have every tag asked for
+func (ps *Placement) ChooseNode(allocation models.Allocation, mode string, tags []string) (*models.Node, error) {
+	if mode == "" {
+		mode = config.PlacementMode.Value()
+	}
+	if mode != PlacementLeastLoaded && mode != PlacementPack && mode != PlacementAffinity {
+		return nil, pufferpanel.ErrUnknownPlacement(mode)
+	}
+
+	ns := &Node{DB: ps.DB}
+	nodes, err := ns.GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	var best *models.Node
+	var bestLoad float64
+	var bestTags int
+	for _, node := range nodes {
+		if node.IsLocal() && !config.DaemonEnabled.Value() {
+			continue
+		}
+		if !node.IsLocal() && !node.Online {
+			continue
+		}
+
+		matched := 0
+		for _, tag := range tags {
+			if node.HasTag(tag) {
+				matched++
+			}
+		}
+		if mode != PlacementAffinity && matched < len(tags) {
+			continue
+		}
+
+		usage, err := ps.GetUsage(node)
+		if err != nil {
+			return nil, err
+		}
+		if !fits(node, usage, allocation) {
+			continue
+		}
+
+		nodeLoad := load(node, usage, allocation)
+		better := best == nil
+		if !better {
+			switch mode {
+			case PlacementLeastLoaded:
+				better = nodeLoad < bestLoad
+			case PlacementPack:
+				better = nodeLoad > bestLoad
+			case PlacementAffinity:
+				better = matched > bestTags || (matched == bestTags && nodeLoad < bestLoad)
+			}
+		}
+
+		if better {
+			best, bestLoad, bestTags = node, nodeLoad, matched
+		}
+	}
+
+	if best == nil {
+		return nil, pufferpanel.ErrNoNodeAvailable
+	}
+	return best, nil
+}
+
+func fits(node *models.Node, usage *models.NodeUsage, allocation models.Allocation) bool {
+	if node.MaxServers > 0 && usage.Servers+1 > node.MaxServers {
+		return false
+	}
+
+	ratio := float64(config.PlacementOvercommitPercent.Value()) / 100
+	within := func(used, capacity uint64) bool {
+		return capacity == 0 || float64(used) <= float64(capacity)*ratio
+	}
+
+	return within(usage.Memory+allocation.Memory, node.MaxMemory) &&
+		within(usage.Cpu+allocation.Cpu, node.MaxCpu) &&
+		within(usage.Disk+allocation.Disk, node.MaxDisk)
+}
+
+// load is how full the node would be with the allocation added, going by whichever limit is closest to being hit
+func load(node *models.Node, usage *models.NodeUsage, allocation models.Allocation) float64 {
+	result := 0.0
+	check := func(used, capacity uint64) {
+		if capacity > 0 && float64(used)/float64(capacity) > result {
+			result = float64(used) / float64(capacity)
+		}
+	}
+
+	check(usage.Memory+allocation.Memory, node.MaxMemory)
+	check(usage.Cpu+allocation.Cpu, node.MaxCpu)
+	check(usage.Disk+allocation.Disk, node.MaxDisk)
+	check(usage.Servers+1, node.MaxServers)
+	return result
+}
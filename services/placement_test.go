@@ -0,0 +1,97 @@
+package services
+
+import (
+	"github.com/pufferpanel/pufferpanel/v2"
+	"github.com/pufferpanel/pufferpanel/v2/config"
+	"github.com/pufferpanel/pufferpanel/v2/models"
+	"testing"
+)
+
+func TestPlacement(t *testing.T) {
+	db := prepareTestDatabase(t, "placement", &models.Node{}, &models.Server{})
+
+	//only the remote nodes should be considered
+	panelEnabled := config.PanelEnabled.Value()
+	_ = config.PanelEnabled.Set(false, false)
+	defer func() {
+		_ = config.PanelEnabled.Set(panelEnabled, false)
+		_ = config.PlacementOvercommitPercent.Set(100, false)
+	}()
+
+	busy := &models.Node{Name: "busy", PublicHost: "10.0.0.1", PrivateHost: "10.0.0.1", PublicPort: 8080, PrivatePort: 8080,
+		SFTPPort: 5657, Secret: "secret", Online: true, MaxMemory: 4096, Tags: []string{"eu"}}
+	quiet := &models.Node{Name: "quiet", PublicHost: "10.0.0.2", PrivateHost: "10.0.0.2", PublicPort: 8080, PrivatePort: 8080,
+		SFTPPort: 5657, Secret: "secret", Online: true, MaxMemory: 4096, Tags: []string{"us"}}
+	offline := &models.Node{Name: "offline", PublicHost: "10.0.0.3", PrivateHost: "10.0.0.3", PublicPort: 8080, PrivatePort: 8080,
+		SFTPPort: 5657, Secret: "secret", MaxMemory: 65536, Tags: []string{"eu"}}
+	for _, v := range []*models.Node{busy, quiet, offline} {
+		if err := db.Create(v).Error; err != nil {
+			t.Fatalf("Create() error = %v", err)
+		}
+	}
+
+	server := &models.Server{Name: "busy", Identifier: "placemen", NodeID: busy.ID, Type: "generic", Memory: 3072, Cpu: 100}
+	if err := db.Create(server).Error; err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	pls := &Placement{DB: db}
+
+	t.Run("GetUsage", func(t *testing.T) {
+		usage, err := pls.GetUsage(busy)
+		if err != nil {
+			t.Fatalf("GetUsage() error = %v", err)
+		}
+		if usage.Servers != 1 || usage.Memory != 3072 || usage.Cpu != 100 {
+			t.Errorf("GetUsage() = %+v, want one server with 3072 memory and 100 cpu", usage)
+		}
+	})
+
+	t.Run("CanFit", func(t *testing.T) {
+		if err := pls.CanFit(busy, models.Allocation{Memory: 2048}); err != pufferpanel.ErrNodeFull {
+			t.Errorf("CanFit() error = %v, want %v", err, pufferpanel.ErrNodeFull)
+		}
+
+		_ = config.PlacementOvercommitPercent.Set(150, false)
+		defer func() {
+			_ = config.PlacementOvercommitPercent.Set(100, false)
+		}()
+		if err := pls.CanFit(busy, models.Allocation{Memory: 2048}); err != nil {
+			t.Errorf("CanFit() with overcommit error = %v", err)
+		}
+	})
+
+	t.Run("ChooseNode", func(t *testing.T) {
+		tests := []struct {
+			name string
+			mode string
+			tags []string
+			want uint
+		}{
+			{name: "leastLoaded", mode: PlacementLeastLoaded, want: quiet.ID},
+			{name: "pack", mode: PlacementPack, want: busy.ID},
+			{name: "tags", mode: PlacementLeastLoaded, tags: []string{"eu"}, want: busy.ID},
+			{name: "affinity", mode: PlacementAffinity, tags: []string{"us"}, want: quiet.ID},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				node, err := pls.ChooseNode(models.Allocation{Memory: 512}, tt.mode, tt.tags)
+				if err != nil {
+					t.Fatalf("ChooseNode() error = %v", err)
+				}
+				if node.ID != tt.want {
+					t.Errorf("ChooseNode() = %s, want node %d", node.Name, tt.want)
+				}
+			})
+		}
+
+		//the only eu node with room is offline
+		if _, err := pls.ChooseNode(models.Allocation{Memory: 2048}, PlacementLeastLoaded, []string{"eu"}); err != pufferpanel.ErrNoNodeAvailable {
+			t.Errorf("ChooseNode() error = %v, want %v", err, pufferpanel.ErrNoNodeAvailable)
+		}
+
+		if _, err := pls.ChooseNode(models.Allocation{}, "random", nil); err == nil {
+			t.Errorf("ChooseNode() accepted an unknown mode")
+		}
+	})
+}
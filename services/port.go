@@ -0,0 +1,191 @@
+/*
+ Copyright 2023 Padduck, LLC
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+  	http://www.apache.org/licenses/LICENSE-2.0
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+*/
+
+package services
+
+import (
+	"github.com/pufferpanel/pufferpanel/v2"
+	"github.com/pufferpanel/pufferpanel/v2/models"
+	"gorm.io/gorm"
+)
+
+type Port struct {
+	DB *gorm.DB
+}
+
+func (ps *Port) GetPools(nodeId uint) ([]*models.PortPool, error) {
+	pools := &models.PortPools{}
+	err := ps.DB.Where("node_id = ?", nodeId).Order("port_start").Find(pools).Error
+	return *pools, err
+}
+
+func (ps *Port) GetPool(nodeId, id uint) (*models.PortPool, error) {
+	model := &models.PortPool{}
+	err := ps.DB.Where("node_id = ? AND id = ?", nodeId, id).First(model).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, pufferpanel.ErrPortPoolNotFound
+	}
+	return model, err
+}
+
+// CreatePool adds a pool to the node. Pools on a node may not share ports, so that each port is only handed out once
+func (ps *Port) CreatePool(model *models.PortPool) error {
+	existing, err := ps.GetPools(model.NodeID)
+	if err != nil {
+		return err
+	}
+
+	for _, v := range existing {
+		if v.Overlaps(model) {
+			return pufferpanel.ErrPortPoolOverlap
+		}
+	}
+
+	return ps.DB.Create(model).Error
+}
+
+// DeletePool removes the pool. Servers keep the ports they were already given from it
+func (ps *Port) DeletePool(model *models.PortPool) error {
+	return ps.DB.Delete(model).Error
+}
+
+func (ps *Port) GetForNode(nodeId uint) ([]*models.PortAllocation, error) {
+	allocations := &models.PortAllocations{}
+	err := ps.DB.Where("node_id = ?", nodeId).Order("port").Find(allocations).Error
+	return *allocations, err
+}
+
+func (ps *Port) GetForServer(serverId string) ([]*models.PortAllocation, error) {
+	allocations := &models.PortAllocations{}
+	err := ps.DB.Where("server_identifier = ?", serverId).Order("id").Find(allocations).Error
+	return *allocations, err
+}
+
+// Reserve gives the server a specific port on the node, as long as no other server has it
+func (ps *Port) Reserve(nodeId uint, serverId, name, ip string, port uint16) (*models.PortAllocation, error) {
+	var count int64
+	err := ps.DB.Model(&models.PortAllocation{}).Where("node_id = ? AND port = ?", nodeId, port).Count(&count).Error
+	if err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, pufferpanel.ErrPortTaken(port)
+	}
+
+	//the unique index still catches two servers reserving the same port at once
+	allocation := &models.PortAllocation{NodeID: nodeId, Port: port, IP: ip, ServerIdentifier: serverId, Name: name}
+	return allocation, ps.DB.Create(allocation).Error
+}
+
+// Allocate gives the server the first free port from the node's pools
+func (ps *Port) Allocate(nodeId uint, serverId, name string) (*models.PortAllocation, error) {
+	pools, err := ps.GetPools(nodeId)
+	if err != nil {
+		return nil, err
+	}
+
+	var used []uint16
+	err = ps.DB.Model(&models.PortAllocation{}).Where("node_id = ?", nodeId).Pluck("port", &used).Error
+	if err != nil {
+		return nil, err
+	}
+	taken := make(map[uint16]bool, len(used))
+	for _, v := range used {
+		taken[v] = true
+	}
+
+	for _, pool := range pools {
+		for port := uint32(pool.PortStart); port <= uint32(pool.PortEnd); port++ {
+			if taken[uint16(port)] {
+				continue
+			}
+			allocation := &models.PortAllocation{NodeID: nodeId, Port: uint16(port), IP: pool.IP, ServerIdentifier: serverId, Name: name}
+			return allocation, ps.DB.Create(allocation).Error
+		}
+	}
+
+	return nil, pufferpanel.ErrNoPortAvailable
+}
+
+// AllocateForServer gives a new server its ports. The port asked for by the server itself is reserved as "port",
+// and every other name gets the next free port from the node's pools. If the node has pools, "port" is always given
+func (ps *Port) AllocateForServer(nodeId uint, serverId string, names []string, ip string, port uint16) ([]*models.PortAllocation, error) {
+	result := make([]*models.PortAllocation, 0, len(names)+1)
+
+	if port != 0 {
+		allocation, err := ps.Reserve(nodeId, serverId, "port", ip, port)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, allocation)
+	} else {
+		pools, err := ps.GetPools(nodeId)
+		if err != nil {
+			return nil, err
+		}
+		if len(pools) > 0 && !pufferpanel.ContainsString(names, "port") {
+			names = append([]string{"port"}, names...)
+		}
+	}
+
+	for _, name := range names {
+		if port != 0 && name == "port" {
+			continue
+		}
+		allocation, err := ps.Allocate(nodeId, serverId, name)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, allocation)
+	}
+
+	return result, nil
+}
+
+// Release frees every port the server was given
+func (ps *Port) Release(serverId string) error {
+	return ps.DB.Where("server_identifier = ?", serverId).Delete(&models.PortAllocation{}).Error
+}
+
+// CanMove checks no server on the node has any of the server's ports
+func (ps *Port) CanMove(serverId string, nodeId uint) error {
+	ports := ps.DB.Model(&models.PortAllocation{}).Select("port").Where("server_identifier = ?", serverId)
+
+	var conflicts []uint16
+	err := ps.DB.Model(&models.PortAllocation{}).Where("node_id = ? AND server_identifier <> ? AND port IN (?)", nodeId, serverId, ports).Pluck("port", &conflicts).Error
+	if err != nil {
+		return err
+	}
+	if len(conflicts) > 0 {
+		return pufferpanel.ErrPortTaken(conflicts[0])
+	}
+	return nil
+}
+
+// Move takes the server's ports with it to another node, which fails if a server there already has one of them
+func (ps *Port) Move(serverId string, nodeId uint) error {
+	if err := ps.CanMove(serverId, nodeId); err != nil {
+		return err
+	}
+
+	return ps.DB.Model(&models.PortAllocation{}).Where("server_identifier = ?", serverId).UpdateColumn("node_id", nodeId).Error
+}
+
+// ToServerPorts is what the daemon is told about the ports, so it can check they are free before starting
+func ToServerPorts(allocations []*models.PortAllocation) []pufferpanel.ServerPort {
+	result := make([]pufferpanel.ServerPort, len(allocations))
+	for k, v := range allocations {
+		result[k] = pufferpanel.ServerPort{Name: v.Name, IP: v.IP, Port: v.Port}
+	}
+	return result
+}
@@ -0,0 +1,53 @@
+package services
+
+import (
+	"github.com/pufferpanel/pufferpanel/v2"
+	"github.com/pufferpanel/pufferpanel/v2/models"
+	"testing"
+)
+
+func TestPort_AllocateForServer(t *testing.T) {
+	db := prepareTestDatabase(t, "port", &models.PortPool{}, &models.PortAllocation{})
+
+	ps := &Port{DB: db}
+
+	if err := ps.CreatePool(&models.PortPool{NodeID: 1, IP: "10.0.0.1", PortStart: 25565, PortEnd: 25567}); err != nil {
+		t.Fatalf("CreatePool() error = %v", err)
+	}
+	if err := ps.CreatePool(&models.PortPool{NodeID: 1, IP: "10.0.0.1", PortStart: 25567, PortEnd: 25570}); err != pufferpanel.ErrPortPoolOverlap {
+		t.Errorf("CreatePool() error = %v, want %v", err, pufferpanel.ErrPortPoolOverlap)
+	}
+
+	ports, err := ps.AllocateForServer(1, "first", []string{"query", "rcon"}, "0.0.0.0", 0)
+	if err != nil {
+		t.Fatalf("AllocateForServer() error = %v", err)
+	}
+	if len(ports) != 3 || ports[0].Name != "port" || ports[0].Port != 25565 || ports[2].Port != 25567 || ports[0].IP != "10.0.0.1" {
+		t.Errorf("AllocateForServer() = %+v, want port, query and rcon from the pool", ports)
+	}
+
+	if _, err = ps.AllocateForServer(1, "second", nil, "0.0.0.0", 0); err != pufferpanel.ErrNoPortAvailable {
+		t.Errorf("AllocateForServer() error = %v, want %v", err, pufferpanel.ErrNoPortAvailable)
+	}
+
+	_, err = ps.AllocateForServer(1, "third", nil, "0.0.0.0", 25566)
+	if e, ok := err.(*pufferpanel.Error); !ok || !e.Is(pufferpanel.ErrPortTaken(0)) {
+		t.Errorf("AllocateForServer() error = %v, want ErrPortTaken", err)
+	}
+
+	//the same port is free on another node
+	if _, err = ps.AllocateForServer(2, "fourth", nil, "0.0.0.0", 25566); err != nil {
+		t.Errorf("AllocateForServer() error = %v", err)
+	}
+
+	if err = ps.Move("fourth", 1); err == nil {
+		t.Errorf("Move() allowed a server onto a port which is taken")
+	}
+
+	if err = ps.Release("first"); err != nil {
+		t.Fatalf("Release() error = %v", err)
+	}
+	if err = ps.Move("fourth", 1); err != nil {
+		t.Errorf("Move() error = %v", err)
+	}
+}
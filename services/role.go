@@ -0,0 +1,173 @@
+/*
+ Copyright 2023 Padduck, LLC
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+  	http://www.apache.org/licenses/LICENSE-2.0
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+*/
+
+package services
+
+import (
+	"github.com/pufferpanel/pufferpanel/v2"
+	"github.com/pufferpanel/pufferpanel/v2/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type Role struct {
+	DB *gorm.DB
+}
+
+func (rs *Role) GetAll() ([]*models.Role, error) {
+	roles := &models.Roles{}
+	err := rs.DB.Order("name").Find(roles).Error
+	return *roles, err
+}
+
+func (rs *Role) Get(id uint) (*models.Role, error) {
+	model := &models.Role{}
+
+	err := rs.DB.Where(&models.Role{ID: id}).First(model).Error
+	if err != nil && err == gorm.ErrRecordNotFound {
+		return nil, pufferpanel.ErrRoleNotFound
+	}
+	return model, err
+}
+
+func (rs *Role) GetByName(name string) (*models.Role, error) {
+	model := &models.Role{}
+
+	err := rs.DB.Where(&models.Role{Name: name}).First(model).Error
+	if err != nil && err == gorm.ErrRecordNotFound {
+		return nil, pufferpanel.ErrRoleNotFound
+	}
+	return model, err
+}
+
+func (rs *Role) Create(model *models.Role) error {
+	var count int64
+	err := rs.DB.Model(&models.Role{}).Where(&models.Role{Name: model.Name}).Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return pufferpanel.ErrRoleExists
+	}
+
+	return rs.DB.Create(model).Error
+}
+
+func (rs *Role) Update(model *models.Role) error {
+	if model.BuiltIn {
+		return pufferpanel.ErrRoleBuiltIn
+	}
+
+	var count int64
+	err := rs.DB.Model(&models.Role{}).Where("name = ? AND id <> ?", model.Name, model.ID).Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return pufferpanel.ErrRoleExists
+	}
+
+	return rs.DB.Save(model).Error
+}
+
+// Delete removes the role and every assignment of it
+func (rs *Role) Delete(model *models.Role) error {
+	if model.BuiltIn {
+		return pufferpanel.ErrRoleBuiltIn
+	}
+
+	return rs.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Delete(&models.RoleAssignment{}, "role_id = ?", model.ID).Error
+		if err != nil {
+			return err
+		}
+		return tx.Delete(model).Error
+	})
+}
+
+func (rs *Role) GetAssignments(roleId uint) ([]*models.RoleAssignment, error) {
+	assignments := &models.RoleAssignments{}
+
+	err := rs.DB.Preload(clause.Associations).Where(&models.RoleAssignment{RoleId: roleId}).Find(assignments).Error
+	return *assignments, err
+}
+
+// GetAssignmentsForUser gets the roles a user has been given, for a single server or globally.
+// If serverId is nil, only global assignments are returned
+func (rs *Role) GetAssignmentsForUser(userId uint, serverId *string) ([]*models.RoleAssignment, error) {
+	assignments := &models.RoleAssignments{}
+
+	query := rs.DB.Preload("Role").Where("user_id = ?", userId)
+	if serverId == nil || *serverId == "" {
+		query = query.Where("server_identifier IS NULL")
+	} else {
+		query = query.Where("server_identifier = ?", *serverId)
+	}
+
+	err := query.Find(assignments).Error
+	return *assignments, err
+}
+
+// GetAllAssignmentsForUser gets every role a user has been given, on any server
+func (rs *Role) GetAllAssignmentsForUser(userId uint) ([]*models.RoleAssignment, error) {
+	assignments := &models.RoleAssignments{}
+
+	err := rs.DB.Preload("Role").Where(&models.RoleAssignment{UserId: userId}).Find(assignments).Error
+	return *assignments, err
+}
+
+// Assign gives the user the role. Assigning a role the user already has is not an error
+func (rs *Role) Assign(roleId, userId uint, serverId *string) error {
+	if serverId != nil && *serverId == "" {
+		serverId = nil
+	}
+
+	existing, err := rs.GetAssignmentsForUser(userId, serverId)
+	if err != nil {
+		return err
+	}
+	for _, v := range existing {
+		if v.RoleId == roleId {
+			return nil
+		}
+	}
+
+	return rs.DB.Omit(clause.Associations).Create(&models.RoleAssignment{
+		RoleId:           roleId,
+		UserId:           userId,
+		ServerIdentifier: serverId,
+	}).Error
+}
+
+func (rs *Role) Unassign(roleId, userId uint, serverId *string) error {
+	query := rs.DB.Where("role_id = ? AND user_id = ?", roleId, userId)
+	if serverId == nil || *serverId == "" {
+		query = query.Where("server_identifier IS NULL")
+	} else {
+		query = query.Where("server_identifier = ?", *serverId)
+	}
+
+	return query.Delete(&models.RoleAssignment{}).Error
+}
+
+// UnassignAll removes every role the user has been given for the server, or globally if serverId is nil
+func (rs *Role) UnassignAll(userId uint, serverId *string) error {
+	query := rs.DB.Where("user_id = ?", userId)
+	if serverId == nil || *serverId == "" {
+		query = query.Where("server_identifier IS NULL")
+	} else {
+		query = query.Where("server_identifier = ?", *serverId)
+	}
+
+	return query.Delete(&models.RoleAssignment{}).Error
+}
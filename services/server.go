@@ -14,10 +14,16 @@
 package services
 
 import (
+	"bytes"
+	"encoding/json"
+	"github.com/pufferpanel/pufferpanel/v2"
 	"github.com/pufferpanel/pufferpanel/v2/models"
 	uuid2 "github.com/satori/go.uuid"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
+	"io"
+	"net/http"
+	"strconv"
 	"strings"
 )
 
@@ -48,9 +54,23 @@ func (ss *Server) Search(searchCriteria ServerSearch) (records []*models.Server,
 	}
 
 	if searchCriteria.Username != "" {
-		query = query.Joins("JOIN permissions p ON servers.identifier = p.server_identifier AND p.view_server = '1'")
-		query = query.Joins("JOIN users ON p.user_id = users.id")
-		query = query.Where("users.username = ?", searchCriteria.Username)
+		var viewRoles []uint
+		viewRoles, err = ss.rolesWithScope(pufferpanel.ScopeServersView)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		direct := ss.DB.Table("permissions p").Select("p.server_identifier").
+			Joins("JOIN users u ON p.user_id = u.id").
+			Where("p.view_server = '1' AND u.username = ?", searchCriteria.Username)
+		roles := ss.DB.Table("role_assignments ra").Select("ra.server_identifier").
+			Joins("JOIN users u ON ra.user_id = u.id").
+			Where("u.username = ? AND ra.role_id IN ?", searchCriteria.Username, viewRoles)
+		teams := ss.DB.Table("servers ts").Select("ts.identifier").
+			Joins("JOIN team_members tm ON ts.team_id = tm.team_id").
+			Joins("JOIN users u ON tm.user_id = u.id").
+			Where("u.username = ? AND tm.role_id IN ?", searchCriteria.Username, viewRoles)
+		query = query.Where("servers.identifier IN (?) OR servers.identifier IN (?) OR servers.identifier IN (?)", direct, roles, teams)
 	}
 
 	nameFilter := strings.Replace(searchCriteria.Name, "*", "%", -1)
@@ -70,6 +90,24 @@ func (ss *Server) Search(searchCriteria ServerSearch) (records []*models.Server,
 	return
 }
 
+// rolesWithScope gets the ids of the roles granting the scope. Scopes are stored joined in one column, so they are
+// checked once read rather than matched on in a query, where one scope would match another starting the same way
+func (ss *Server) rolesWithScope(scope pufferpanel.Scope) ([]uint, error) {
+	var roles models.Roles
+	err := ss.DB.Find(&roles).Error
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]uint, 0)
+	for _, v := range roles {
+		if pufferpanel.ContainsScope(v.Scopes, scope) {
+			ids = append(ids, v.ID)
+		}
+	}
+	return ids, nil
+}
+
 func (ss *Server) Get(id string) (*models.Server, error) {
 	if id == "" {
 		return nil, gorm.ErrRecordNotFound
@@ -86,6 +124,44 @@ func (ss *Server) Get(id string) (*models.Server, error) {
 	return model, nil
 }
 
+// GetOwner gets who the server belongs to on its node, so servers of the same owner can share a network. This is the
+// team the server is in, otherwise the first user given access to it, or empty if there is neither
+func (ss *Server) GetOwner(server *models.Server) (string, error) {
+	if server.TeamId != nil {
+		return "team-" + strconv.FormatUint(uint64(*server.TeamId), 10), nil
+	}
+
+	var users []uint
+	err := ss.DB.Model(&models.Permissions{}).
+		Where("server_identifier = ? AND user_id IS NOT NULL", server.Identifier).
+		Order("id").Limit(1).Pluck("user_id", &users).Error
+	if err != nil || len(users) == 0 {
+		return "", err
+	}
+	return "user-" + strconv.FormatUint(uint64(users[0]), 10), nil
+}
+
+// UpdateOwner tells the node who the server belongs to now, after it moved in or out of a team
+func (ss *Server) UpdateOwner(server *models.Server) error {
+	owner, err := ss.GetOwner(server)
+	if err != nil {
+		return err
+	}
+
+	token, err := GenerateOAuthForServer(server.Identifier, pufferpanel.ScopeServersEditAdmin)
+	if err != nil {
+		return err
+	}
+	headers := http.Header{}
+	headers.Set("Authorization", "Bearer "+token)
+
+	data, _ := json.Marshal(&pufferpanel.ServerOwner{Owner: owner})
+	body := io.NopCloser(bytes.NewReader(data))
+
+	ns := &Node{DB: ss.DB}
+	return callNodeFor(ns, &server.Node, http.MethodPost, "/daemon/server/"+server.Identifier+"/owner", body, headers, http.StatusNoContent, nil)
+}
+
 func (ss *Server) Update(model *models.Server) error {
 	res := ss.DB.Omit(clause.Associations).Save(model)
 	return res.Error
@@ -104,11 +180,21 @@ func (ss *Server) Delete(id string) error {
 		return err
 	}
 
+	err = ss.DB.Delete(models.RoleAssignment{}, "server_identifier = ?", id).Error
+	if err != nil {
+		return err
+	}
+
 	err = ss.DB.Delete(models.Client{}, "server_id = ?", id).Error
 	if err != nil {
 		return err
 	}
 
+	err = ss.DB.Delete(models.PortAllocation{}, "server_identifier = ?", id).Error
+	if err != nil {
+		return err
+	}
+
 	err = ss.DB.Delete(model).Error
 	if err != nil {
 		return err
@@ -0,0 +1,151 @@
+package services
+
+import (
+	"github.com/pufferpanel/pufferpanel/v2"
+	"github.com/pufferpanel/pufferpanel/v2/models"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestServer_GetOwner(t *testing.T) {
+	db := prepareTestDatabase(t, "serverowner", &models.Node{}, &models.Team{}, &models.Server{}, &models.User{},
+		&models.Client{}, &models.Permissions{}, &models.Role{}, &models.RoleAssignment{})
+
+	ss := &Server{DB: db}
+	ps := &Permission{DB: db}
+
+	first := &models.User{Username: "ownerfirst", Email: "first@owner.com", HashedPassword: "x"}
+	second := &models.User{Username: "ownersecond", Email: "second@owner.com", HashedPassword: "x"}
+	for _, v := range []*models.User{first, second} {
+		if err := db.Create(v).Error; err != nil {
+			t.Fatalf("create user error = %v", err)
+		}
+	}
+
+	team := &models.Team{Name: "owners"}
+	if err := db.Create(team).Error; err != nil {
+		t.Fatalf("create team error = %v", err)
+	}
+
+	shared := &models.Server{Name: "shared", Identifier: "owner001", Type: "generic"}
+	teamed := &models.Server{Name: "teamed", Identifier: "owner002", Type: "generic", TeamId: &team.ID}
+	orphan := &models.Server{Name: "orphan", Identifier: "owner003", Type: "generic"}
+	for _, v := range []*models.Server{shared, teamed, orphan} {
+		if err := db.Omit("Node", "Team").Create(v).Error; err != nil {
+			t.Fatalf("create server error = %v", err)
+		}
+	}
+
+	for _, server := range []*models.Server{shared, teamed} {
+		for _, user := range []*models.User{first, second} {
+			perm, err := ps.GetForUserAndServer(user.ID, &server.Identifier)
+			if err != nil {
+				t.Fatalf("GetForUserAndServer() error = %v", err)
+			}
+			perm.SetDefaults()
+			if err = ps.UpdatePermissions(perm); err != nil {
+				t.Fatalf("UpdatePermissions() error = %v", err)
+			}
+		}
+	}
+
+	firstOwner := "user-" + strconv.FormatUint(uint64(first.ID), 10)
+	teamOwner := "team-" + strconv.FormatUint(uint64(team.ID), 10)
+
+	tests := []struct {
+		name   string
+		server *models.Server
+		want   string
+	}{
+		{name: "first user", server: shared, want: firstOwner},
+		{name: "team", server: teamed, want: teamOwner},
+		{name: "nobody", server: orphan, want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ss.GetOwner(tt.server)
+			if err != nil {
+				t.Fatalf("GetOwner() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("GetOwner() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("leaving the team", func(t *testing.T) {
+		left := *teamed
+		left.TeamId = nil
+		got, err := ss.GetOwner(&left)
+		if err != nil {
+			t.Fatalf("GetOwner() error = %v", err)
+		}
+		if got != firstOwner {
+			t.Errorf("GetOwner() = %v, want %v", got, firstOwner)
+		}
+	})
+}
+
+func TestServer_Search(t *testing.T) {
+	db := prepareTestDatabase(t, "serversearch", &models.Node{}, &models.Team{}, &models.TeamMember{}, &models.Server{},
+		&models.User{}, &models.Client{}, &models.Permissions{}, &models.Role{}, &models.RoleAssignment{})
+
+	ss := &Server{DB: db}
+
+	user := &models.User{Username: "searcher", Email: "searcher@search.com", HashedPassword: "x"}
+	if err := db.Create(user).Error; err != nil {
+		t.Fatalf("create user error = %v", err)
+	}
+
+	viewer := &models.Role{Name: "viewer", Scopes: []pufferpanel.Scope{pufferpanel.ScopeServersView}}
+	admin := &models.Role{Name: "admin", Scopes: []pufferpanel.Scope{pufferpanel.ScopeServersAdmin}}
+	lookalike := &models.Role{Name: "lookalike", Scopes: []pufferpanel.Scope{"servers.viewer", "servers.administrator"}}
+	for _, v := range []*models.Role{viewer, admin, lookalike} {
+		if err := db.Create(v).Error; err != nil {
+			t.Fatalf("create role error = %v", err)
+		}
+	}
+
+	team := &models.Team{Name: "searchers"}
+	if err := db.Create(team).Error; err != nil {
+		t.Fatalf("create team error = %v", err)
+	}
+	if err := db.Omit("Team", "User", "Role").Create(&models.TeamMember{TeamId: team.ID, UserId: user.ID, RoleId: viewer.ID}).Error; err != nil {
+		t.Fatalf("create team member error = %v", err)
+	}
+
+	servers := []*models.Server{
+		{Name: "viewed", Identifier: "search01", Type: "generic"},
+		{Name: "administered", Identifier: "search02", Type: "generic"},
+		{Name: "lookalike", Identifier: "search03", Type: "generic"},
+		{Name: "teamed", Identifier: "search04", Type: "generic", TeamId: &team.ID},
+		{Name: "unrelated", Identifier: "search05", Type: "generic"},
+	}
+	for _, v := range servers {
+		if err := db.Omit("Node", "Team").Create(v).Error; err != nil {
+			t.Fatalf("create server error = %v", err)
+		}
+	}
+
+	for i, role := range []*models.Role{viewer, admin, lookalike} {
+		assignment := &models.RoleAssignment{RoleId: role.ID, UserId: user.ID, ServerIdentifier: &servers[i].Identifier}
+		if err := db.Omit("Role", "User", "Server").Create(assignment).Error; err != nil {
+			t.Fatalf("create role assignment error = %v", err)
+		}
+	}
+
+	records, total, err := ss.Search(ServerSearch{Username: user.Username, PageSize: 10, Page: 1})
+	if err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+
+	got := make([]string, 0)
+	for _, v := range records {
+		got = append(got, v.Identifier)
+	}
+	want := []string{"search02", "search04", "search01"}
+	if total != int64(len(want)) || !reflect.DeepEqual(got, want) {
+		t.Errorf("Search() = %v (%d), want %v", got, total, want)
+	}
+}
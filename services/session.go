@@ -0,0 +1,248 @@
+/*
+ Copyright 2023 Padduck, LLC
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+  	http://www.apache.org/licenses/LICENSE-2.0
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+*/
+
+package services
+
+import (
+	"github.com/pufferpanel/pufferpanel/v2"
+	"github.com/pufferpanel/pufferpanel/v2/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// SessionExpiration is how long a session lasts without being refreshed
+const SessionExpiration = 30 * 24 * time.Hour
+
+// how long the middleware trusts a session lookup before checking the database again
+const sessionCacheDuration = 30 * time.Second
+
+type Session struct {
+	DB *gorm.DB
+}
+
+type sessionCacheEntry struct {
+	userId  uint
+	active  bool
+	expires time.Time
+}
+
+var sessionCache = make(map[uint]sessionCacheEntry)
+var sessionCacheLocker sync.RWMutex
+
+// Create starts a new session for the user. The returned refresh token is what the client uses to continue the
+// session, only the hash of it is stored
+func (ss *Session) Create(userId uint, userAgent, ipAddress string) (*models.Session, string, error) {
+	token, err := pufferpanel.GenerateRandomString(48)
+	if err != nil {
+		return nil, "", err
+	}
+
+	now := time.Now()
+	session := &models.Session{
+		UserId:    userId,
+		UserAgent: truncate(userAgent, 255),
+		IpAddress: truncate(ipAddress, 64),
+		LastUsed:  now,
+		ExpiresAt: now.Add(SessionExpiration),
+	}
+	session.SetRefreshToken(token)
+
+	//clean up what this user has left behind while we're here
+	err = ss.DB.Delete(&models.Session{}, "user_id = ? AND expires_at < ?", userId, now).Error
+	if err != nil {
+		return nil, "", err
+	}
+
+	err = ss.DB.Omit(clause.Associations).Create(session).Error
+	if err != nil {
+		return nil, "", err
+	}
+	return session, token, nil
+}
+
+// Refresh exchanges a refresh token for a new one, extending the session. The old token can no longer be used
+func (ss *Session) Refresh(refreshToken, userAgent, ipAddress string) (*models.Session, string, error) {
+	session := &models.Session{}
+	err := ss.DB.Where(&models.Session{HashedRefreshToken: models.HashRefreshToken(refreshToken)}).First(session).Error
+	if err != nil && err == gorm.ErrRecordNotFound {
+		return nil, "", pufferpanel.ErrInvalidSession
+	} else if err != nil {
+		return nil, "", err
+	}
+
+	if session.IsExpired() {
+		err = ss.Revoke(session)
+		if err != nil {
+			return nil, "", err
+		}
+		return nil, "", pufferpanel.ErrSessionExpired
+	}
+
+	token, err := pufferpanel.GenerateRandomString(48)
+	if err != nil {
+		return nil, "", err
+	}
+
+	now := time.Now()
+	oldHash := session.HashedRefreshToken
+	session.SetRefreshToken(token)
+	session.UserAgent = truncate(userAgent, 255)
+	session.IpAddress = truncate(ipAddress, 64)
+	session.LastUsed = now
+	session.ExpiresAt = now.Add(SessionExpiration)
+
+	//only swap the token if nobody else has already used the old one
+	res := ss.DB.Model(&models.Session{}).
+		Where("id = ? AND refresh_token = ?", session.ID, oldHash).
+		Updates(map[string]interface{}{
+			"refresh_token": session.HashedRefreshToken,
+			"user_agent":    session.UserAgent,
+			"ip_address":    session.IpAddress,
+			"last_used":     session.LastUsed,
+			"expires_at":    session.ExpiresAt,
+		})
+	if res.Error != nil {
+		return nil, "", res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, "", pufferpanel.ErrInvalidSession
+	}
+
+	return session, token, nil
+}
+
+// Touch records that the session was used to issue a new token
+func (ss *Session) Touch(session *models.Session) error {
+	session.LastUsed = time.Now()
+	return ss.DB.Model(&models.Session{}).Where("id = ?", session.ID).Update("last_used", session.LastUsed).Error
+}
+
+func (ss *Session) Get(id uint) (*models.Session, error) {
+	session := &models.Session{}
+	err := ss.DB.Where(&models.Session{ID: id}).First(session).Error
+	if err != nil && err == gorm.ErrRecordNotFound {
+		return nil, pufferpanel.ErrSessionNotFound
+	}
+	return session, err
+}
+
+func (ss *Session) GetForUser(userId uint) ([]*models.Session, error) {
+	sessions := &models.Sessions{}
+	err := ss.DB.Where(&models.Session{UserId: userId}).Where("expires_at > ?", time.Now()).Order("last_used DESC").Find(sessions).Error
+	return *sessions, err
+}
+
+// IsActive checks if tokens issued for the session should still be accepted
+func (ss *Session) IsActive(sessionId, userId uint) (bool, error) {
+	sessionCacheLocker.RLock()
+	entry, exists := sessionCache[sessionId]
+	sessionCacheLocker.RUnlock()
+
+	if exists && time.Now().Before(entry.expires) {
+		return entry.active && entry.userId == userId, nil
+	}
+
+	session, err := ss.Get(sessionId)
+	if err != nil && err != pufferpanel.ErrSessionNotFound {
+		return false, err
+	}
+
+	entry = sessionCacheEntry{expires: time.Now().Add(sessionCacheDuration)}
+	if session != nil {
+		entry.userId = session.UserId
+		entry.active = !session.IsExpired()
+	}
+	setSessionCache(sessionId, entry)
+
+	return entry.active && entry.userId == userId, nil
+}
+
+// GetActiveSession gets the id of the session the token was issued for.
+// If that session has been revoked or has expired, ErrInvalidSession is returned
+func (ss *Session) GetActiveSession(token *pufferpanel.Token) (uint, error) {
+	sessionId, err := strconv.ParseUint(token.Claims.ID, 10, 32)
+	if err != nil {
+		return 0, pufferpanel.ErrInvalidSession
+	}
+	userId, err := strconv.ParseUint(token.Claims.Subject, 10, 32)
+	if err != nil {
+		return 0, pufferpanel.ErrInvalidSession
+	}
+
+	active, err := ss.IsActive(uint(sessionId), uint(userId))
+	if err != nil {
+		return 0, err
+	}
+	if !active {
+		return 0, pufferpanel.ErrInvalidSession
+	}
+	return uint(sessionId), nil
+}
+
+func (ss *Session) Revoke(session *models.Session) error {
+	err := ss.DB.Delete(&models.Session{}, "id = ?", session.ID).Error
+	if err != nil {
+		return err
+	}
+	revokeSessionCache(session.ID)
+	return nil
+}
+
+// RevokeAllForUser ends every session the user has, except the one with the id of keep if it is not 0
+func (ss *Session) RevokeAllForUser(userId uint, keep uint) error {
+	var ids []uint
+	err := ss.DB.Model(&models.Session{}).Where("user_id = ? AND id <> ?", userId, keep).Pluck("id", &ids).Error
+	if err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	err = ss.DB.Delete(&models.Session{}, "id IN ?", ids).Error
+	if err != nil {
+		return err
+	}
+
+	for _, v := range ids {
+		revokeSessionCache(v)
+	}
+	return nil
+}
+
+func revokeSessionCache(sessionId uint) {
+	setSessionCache(sessionId, sessionCacheEntry{expires: time.Now().Add(sessionCacheDuration)})
+}
+
+func setSessionCache(sessionId uint, entry sessionCacheEntry) {
+	sessionCacheLocker.Lock()
+	defer sessionCacheLocker.Unlock()
+
+	now := time.Now()
+	for k, v := range sessionCache {
+		if now.After(v.expires) {
+			delete(sessionCache, k)
+		}
+	}
+	sessionCache[sessionId] = entry
+}
+
+func truncate(value string, length int) string {
+	if len(value) > length {
+		return value[:length]
+	}
+	return value
+}
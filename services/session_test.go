@@ -0,0 +1,110 @@
+package services
+
+import (
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/pufferpanel/pufferpanel/v2"
+	"github.com/pufferpanel/pufferpanel/v2/models"
+	"strconv"
+	"testing"
+)
+
+func TestSession_Lifecycle(t *testing.T) {
+	db := prepareTestDatabase(t, "sessions", &models.User{}, &models.Session{})
+
+	ss := &Session{DB: db}
+
+	user := &models.User{Username: "sessiontest", Email: "session@test.com", HashedPassword: "x"}
+	if err := db.Create(user).Error; err != nil {
+		t.Fatalf("create user error = %v", err)
+	}
+
+	session, refreshToken, err := ss.Create(user.ID, "test agent", "127.0.0.1")
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if session.HashedRefreshToken == refreshToken {
+		t.Errorf("Create() stored the raw refresh token")
+	}
+
+	t.Run("refresh", func(t *testing.T) {
+		refreshed, newToken, err := ss.Refresh(refreshToken, "other agent", "127.0.0.2")
+		if err != nil {
+			t.Fatalf("Refresh() error = %v", err)
+		}
+		if refreshed.ID != session.ID || refreshed.IpAddress != "127.0.0.2" {
+			t.Errorf("Refresh() = %+v, want same session with new metadata", refreshed)
+		}
+
+		//refresh tokens can only be used once
+		if _, _, err = ss.Refresh(refreshToken, "", ""); err != pufferpanel.ErrInvalidSession {
+			t.Errorf("Refresh() reused error = %v, want %v", err, pufferpanel.ErrInvalidSession)
+		}
+		refreshToken = newToken
+	})
+
+	t.Run("token", func(t *testing.T) {
+		token := sessionToken(user.ID, session.ID)
+		id, err := ss.GetActiveSession(token)
+		if err != nil || id != session.ID {
+			t.Errorf("GetActiveSession() = %d, %v, want %d", id, err, session.ID)
+		}
+
+		//a token for someone else cannot borrow this session
+		if _, err = ss.GetActiveSession(sessionToken(user.ID+1, session.ID)); err != pufferpanel.ErrInvalidSession {
+			t.Errorf("GetActiveSession() other user error = %v, want %v", err, pufferpanel.ErrInvalidSession)
+		}
+	})
+
+	t.Run("revokeAll", func(t *testing.T) {
+		other, _, err := ss.Create(user.ID, "second device", "127.0.0.3")
+		if err != nil {
+			t.Fatalf("Create() error = %v", err)
+		}
+
+		if err = ss.RevokeAllForUser(user.ID, session.ID); err != nil {
+			t.Fatalf("RevokeAllForUser() error = %v", err)
+		}
+
+		if _, err = ss.GetActiveSession(sessionToken(user.ID, other.ID)); err != pufferpanel.ErrInvalidSession {
+			t.Errorf("GetActiveSession() revoked error = %v, want %v", err, pufferpanel.ErrInvalidSession)
+		}
+		if _, err = ss.GetActiveSession(sessionToken(user.ID, session.ID)); err != nil {
+			t.Errorf("GetActiveSession() kept error = %v", err)
+		}
+
+		sessions, err := ss.GetForUser(user.ID)
+		if err != nil || len(sessions) != 1 {
+			t.Errorf("GetForUser() = %d sessions, %v, want 1", len(sessions), err)
+		}
+	})
+
+	t.Run("revoke", func(t *testing.T) {
+		//make sure the cache knows the session before it is revoked
+		if _, err := ss.GetActiveSession(sessionToken(user.ID, session.ID)); err != nil {
+			t.Fatalf("GetActiveSession() error = %v", err)
+		}
+
+		if err := ss.Revoke(session); err != nil {
+			t.Fatalf("Revoke() error = %v", err)
+		}
+
+		if _, err := ss.GetActiveSession(sessionToken(user.ID, session.ID)); err != pufferpanel.ErrInvalidSession {
+			t.Errorf("GetActiveSession() error = %v, want %v", err, pufferpanel.ErrInvalidSession)
+		}
+		if _, _, err := ss.Refresh(refreshToken, "", ""); err != pufferpanel.ErrInvalidSession {
+			t.Errorf("Refresh() error = %v, want %v", err, pufferpanel.ErrInvalidSession)
+		}
+	})
+}
+
+func sessionToken(userId, sessionId uint) *pufferpanel.Token {
+	return &pufferpanel.Token{
+		Claims: &pufferpanel.Claim{
+			RegisteredClaims: jwt.RegisteredClaims{
+				Audience: jwt.ClaimStrings{"session"},
+				Subject:  strconv.Itoa(int(userId)),
+				ID:       strconv.Itoa(int(sessionId)),
+			},
+		},
+	}
+}
@@ -45,25 +45,17 @@ func (s *DatabaseSFTPAuthorization) Validate(username, password string) (perms *
 	}
 
 	ss := &Permission{DB: db}
-	serverPerms, err := ss.GetForUserAndServer(user.ID, &serverId)
+	serverScopes, err := ss.GetScopesForUserAndServer(user.ID, &serverId)
 	if err != nil {
 		return nil, errors.New("incorrect username or password")
 	}
 
-	userPerms, err := ss.GetForUser(user.ID)
+	isAdmin, err := ss.IsAdmin(user.ID)
 	if err != nil {
 		return nil, errors.New("incorrect username or password")
 	}
 
-	isAdmin := false
-	for _, p := range userPerms {
-		if p.Admin {
-			isAdmin = true
-			break
-		}
-	}
-
-	if !serverPerms.SFTPServer && !isAdmin {
+	if !pufferpanel.ContainsScope(serverScopes, pufferpanel.ScopeServersSFTP) && !isAdmin {
 		return nil, errors.New("incorrect username or password")
 	}
 
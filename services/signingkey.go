@@ -0,0 +1,88 @@
+/*
+ Copyright 2023 Padduck, LLC
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+  	http://www.apache.org/licenses/LICENSE-2.0
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+*/
+
+package services
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"github.com/pufferpanel/pufferpanel/v2"
+	"github.com/pufferpanel/pufferpanel/v2/models"
+	"gorm.io/gorm"
+	"time"
+)
+
+type SigningKey struct {
+	DB *gorm.DB
+}
+
+// GetAll gets the keys tokens can still be signed with, newest first. Retired keys are included until they have
+// been retired for longer than the overlap
+func (sk *SigningKey) GetAll(overlap time.Duration) ([]*models.SigningKey, error) {
+	keys := &models.SigningKeys{}
+	err := sk.DB.Where("retired_at IS NULL OR retired_at > ?", time.Now().Add(-overlap)).Order("created_at DESC").Find(keys).Error
+	return *keys, err
+}
+
+func (sk *SigningKey) Create(key *ecdsa.PrivateKey) (*models.SigningKey, error) {
+	model := &models.SigningKey{
+		ID: pufferpanel.NewJWK(&key.PublicKey).KeyId,
+	}
+	err := model.SetKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	err = sk.DB.Create(model).Error
+	return model, err
+}
+
+// Rotate replaces the current key with a new one once it is older than the interval, or straight away if force is
+// set. An interval of 0 disables scheduled rotation. Keys which have been retired for longer than the overlap are
+// removed
+func (sk *SigningKey) Rotate(interval, overlap time.Duration, force bool) (rotated bool, err error) {
+	now := time.Now()
+
+	current := &models.SigningKey{}
+	err = sk.DB.Where("retired_at IS NULL").Order("created_at DESC").First(current).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return
+	}
+	missing := err == gorm.ErrRecordNotFound
+
+	if force || missing || (interval > 0 && current.CreatedAt.Before(now.Add(-interval))) {
+		var key *ecdsa.PrivateKey
+		key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return
+		}
+
+		err = sk.DB.Transaction(func(tx *gorm.DB) error {
+			err := tx.Model(&models.SigningKey{}).Where("retired_at IS NULL").Update("retired_at", now).Error
+			if err != nil {
+				return err
+			}
+			txs := &SigningKey{DB: tx}
+			_, err = txs.Create(key)
+			return err
+		})
+		if err != nil {
+			return
+		}
+		rotated = true
+	}
+
+	err = sk.DB.Delete(&models.SigningKey{}, "retired_at < ?", now.Add(-overlap)).Error
+	return
+}
@@ -0,0 +1,72 @@
+package services
+
+import (
+	"github.com/pufferpanel/pufferpanel/v2"
+	"github.com/pufferpanel/pufferpanel/v2/models"
+	"testing"
+	"time"
+)
+
+func TestSigningKey_Rotate(t *testing.T) {
+	db := prepareTestDatabase(t, "signingkeys", &models.SigningKey{})
+
+	sk := &SigningKey{DB: db}
+	interval := 24 * time.Hour
+	overlap := time.Hour
+
+	rotated, err := sk.Rotate(interval, overlap, false)
+	if err != nil || !rotated {
+		t.Fatalf("Rotate() = %v, %v, want first key created", rotated, err)
+	}
+
+	keys, err := sk.GetAll(overlap)
+	if err != nil || len(keys) != 1 {
+		t.Fatalf("GetAll() = %d keys, %v, want 1", len(keys), err)
+	}
+	first := keys[0]
+
+	key, err := first.GetKey()
+	if err != nil {
+		t.Fatalf("GetKey() error = %v", err)
+	}
+	jwk := pufferpanel.NewJWK(&key.PublicKey)
+	if jwk.KeyId != first.ID {
+		t.Errorf("key id = %s, want thumbprint %s", first.ID, jwk.KeyId)
+	}
+	publicKey, err := jwk.PublicKey()
+	if err != nil || !publicKey.Equal(&key.PublicKey) {
+		t.Errorf("PublicKey() did not round trip, error = %v", err)
+	}
+
+	//the key is not due yet
+	if rotated, err = sk.Rotate(interval, overlap, false); err != nil || rotated {
+		t.Errorf("Rotate() = %v, %v, want no rotation", rotated, err)
+	}
+
+	//the old key is retired, but still accepted during the overlap
+	if rotated, err = sk.Rotate(interval, overlap, true); err != nil || !rotated {
+		t.Fatalf("Rotate() = %v, %v, want rotation", rotated, err)
+	}
+	keys, err = sk.GetAll(overlap)
+	if err != nil || len(keys) != 2 {
+		t.Fatalf("GetAll() = %d keys, %v, want 2", len(keys), err)
+	}
+	for _, v := range keys {
+		if (v.ID == first.ID) != (v.RetiredAt != nil) {
+			t.Errorf("key %s retired = %v, want only the first key retired", v.ID, v.RetiredAt)
+		}
+	}
+
+	//once the overlap has passed, the old key is removed
+	err = db.Model(&models.SigningKey{}).Where("id = ?", first.ID).Update("retired_at", time.Now().Add(-2*overlap)).Error
+	if err != nil {
+		t.Fatalf("update error = %v", err)
+	}
+	if _, err = sk.Rotate(interval, overlap, false); err != nil {
+		t.Fatalf("Rotate() error = %v", err)
+	}
+	var count int64
+	if err = db.Model(&models.SigningKey{}).Count(&count).Error; err != nil || count != 1 {
+		t.Errorf("keys left = %d, %v, want 1", count, err)
+	}
+}
@@ -0,0 +1,352 @@
+/*
+ Copyright 2023 Padduck, LLC
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+  	http://www.apache.org/licenses/LICENSE-2.0
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+*/
+
+package services
+
+import (
+	"github.com/pufferpanel/pufferpanel/v2"
+	"github.com/pufferpanel/pufferpanel/v2/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"strings"
+	"time"
+)
+
+const InviteExpiration = 7 * 24 * time.Hour
+
+type Team struct {
+	DB *gorm.DB
+}
+
+func (ts *Team) GetAll() ([]*models.Team, error) {
+	teams := &models.Teams{}
+	err := ts.DB.Order("name").Find(teams).Error
+	return *teams, err
+}
+
+// GetForUser gets the teams the user is a member of
+func (ts *Team) GetForUser(userId uint) ([]*models.Team, error) {
+	teams := &models.Teams{}
+	err := ts.DB.Joins("JOIN team_members tm ON tm.team_id = teams.id").Where("tm.user_id = ?", userId).Order("name").Find(teams).Error
+	return *teams, err
+}
+
+func (ts *Team) Get(id uint) (*models.Team, error) {
+	model := &models.Team{}
+
+	err := ts.DB.Where(&models.Team{ID: id}).First(model).Error
+	if err != nil && err == gorm.ErrRecordNotFound {
+		return nil, pufferpanel.ErrTeamNotFound
+	}
+	return model, err
+}
+
+func (ts *Team) Create(model *models.Team) error {
+	var count int64
+	err := ts.DB.Model(&models.Team{}).Where(&models.Team{Name: model.Name}).Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return pufferpanel.ErrTeamExists
+	}
+
+	return ts.DB.Create(model).Error
+}
+
+func (ts *Team) Update(model *models.Team) error {
+	var count int64
+	err := ts.DB.Model(&models.Team{}).Where("name = ? AND id <> ?", model.Name, model.ID).Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return pufferpanel.ErrTeamExists
+	}
+
+	return ts.DB.Save(model).Error
+}
+
+// Delete removes the team, its members and invites. Servers the team owned are kept, but no longer have an owner
+// Delete removes the team. Its servers are kept, and any without a user of their own are given to the user with the
+// id of owner
+func (ts *Team) Delete(model *models.Team, owner uint) error {
+	return ts.DB.Transaction(func(tx *gorm.DB) error {
+		txs := &Team{DB: tx}
+		servers, err := txs.GetServers(model.ID)
+		if err != nil {
+			return err
+		}
+		for _, v := range servers {
+			err = txs.RemoveServer(v, owner)
+			if err != nil {
+				return err
+			}
+		}
+
+		err = tx.Delete(&models.TeamInvite{}, "team_id = ?", model.ID).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Delete(&models.TeamMember{}, "team_id = ?", model.ID).Error
+		if err != nil {
+			return err
+		}
+		return tx.Delete(model).Error
+	})
+}
+
+func (ts *Team) GetMembers(teamId uint) ([]*models.TeamMember, error) {
+	members := &models.TeamMembers{}
+	err := ts.DB.Preload(clause.Associations).Where(&models.TeamMember{TeamId: teamId}).Find(members).Error
+	return *members, err
+}
+
+// GetMember gets the user's membership of the team, or nil if they are not a member
+func (ts *Team) GetMember(teamId, userId uint) (*models.TeamMember, error) {
+	member := &models.TeamMember{}
+	err := ts.DB.Preload("Role").Where(&models.TeamMember{TeamId: teamId, UserId: userId}).First(member).Error
+	if err != nil && err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	return member, err
+}
+
+func (ts *Team) IsManager(teamId, userId uint) (bool, error) {
+	member, err := ts.GetMember(teamId, userId)
+	if err != nil || member == nil {
+		return false, err
+	}
+	return member.Manager, nil
+}
+
+// SetMember adds the user to the team, or changes their role if they are already a member
+func (ts *Team) SetMember(team *models.Team, userId, roleId uint, manager bool) error {
+	member, err := ts.GetMember(team.ID, userId)
+	if err != nil {
+		return err
+	}
+
+	if member == nil {
+		if team.MaxMembers > 0 {
+			var count int64
+			err = ts.DB.Model(&models.TeamMember{}).Where(&models.TeamMember{TeamId: team.ID}).Count(&count).Error
+			if err != nil {
+				return err
+			}
+			if count >= int64(team.MaxMembers) {
+				return pufferpanel.ErrTeamMemberLimit
+			}
+		}
+
+		member = &models.TeamMember{
+			TeamId: team.ID,
+			UserId: userId,
+		}
+	}
+
+	member.RoleId = roleId
+	member.Manager = manager
+	return ts.DB.Omit(clause.Associations).Save(member).Error
+}
+
+func (ts *Team) RemoveMember(teamId, userId uint) error {
+	return ts.DB.Delete(&models.TeamMember{}, "team_id = ? AND user_id = ?", teamId, userId).Error
+}
+
+// GetServers gets the servers the team owns
+func (ts *Team) GetServers(teamId uint) ([]*models.Server, error) {
+	servers := make([]*models.Server, 0)
+	err := ts.DB.Preload(clause.Associations).Where("team_id = ?", teamId).Find(&servers).Error
+	return servers, err
+}
+
+// SetServerTeam moves the server into the team, or out of any team if team is nil
+func (ts *Team) SetServerTeam(server *models.Server, team *models.Team) error {
+	if team == nil {
+		err := ts.DB.Table("servers").Where("identifier = ?", server.Identifier).Update("team_id", nil).Error
+		if err != nil {
+			return err
+		}
+		server.TeamId = nil
+		return nil
+	}
+
+	if server.TeamId != nil && *server.TeamId == team.ID {
+		return nil
+	}
+
+	//the team is locked while its servers are counted, so two servers cannot both take its last place
+	err := ts.DB.Transaction(func(tx *gorm.DB) error {
+		locked := &models.Team{}
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(locked, team.ID).Error
+		if err != nil {
+			return err
+		}
+
+		err = (&Team{DB: tx}).CanAddServer(locked)
+		if err != nil {
+			return err
+		}
+		return tx.Table("servers").Where("identifier = ?", server.Identifier).Update("team_id", team.ID).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	server.TeamId = &team.ID
+	return nil
+}
+
+// RemoveServer takes the server out of the team. If no user has access to the server of their own, it would be left
+// without an owner, so it is given to the user with the id of owner
+func (ts *Team) RemoveServer(server *models.Server, owner uint) error {
+	return ts.DB.Transaction(func(tx *gorm.DB) error {
+		err := (&Team{DB: tx}).SetServerTeam(server, nil)
+		if err != nil {
+			return err
+		}
+
+		var count int64
+		err = tx.Model(&models.Permissions{}).Where("server_identifier = ? AND user_id IS NOT NULL", server.Identifier).Count(&count).Error
+		if err != nil || count > 0 {
+			return err
+		}
+
+		ps := &Permission{DB: tx}
+		perm, err := ps.GetForUserAndServer(owner, &server.Identifier)
+		if err != nil {
+			return err
+		}
+		perm.SetDefaults()
+		return ps.UpdatePermissions(perm)
+	})
+}
+
+// CanAddServer checks if the team has room for another server
+func (ts *Team) CanAddServer(team *models.Team) error {
+	if team.MaxServers == 0 {
+		return nil
+	}
+
+	var count int64
+	err := ts.DB.Model(&models.Server{}).Where("team_id = ?", team.ID).Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count >= int64(team.MaxServers) {
+		return pufferpanel.ErrTeamServerLimit
+	}
+	return nil
+}
+
+// CreateInvite creates an invite for the email. The returned token is what the recipient uses to accept it, only
+// the hash of it is stored
+func (ts *Team) CreateInvite(team *models.Team, email string, roleId uint, manager bool) (*models.TeamInvite, string, error) {
+	token, err := pufferpanel.GenerateRandomString(32)
+	if err != nil {
+		return nil, "", err
+	}
+
+	invite := &models.TeamInvite{
+		TeamId:    team.ID,
+		Email:     email,
+		RoleId:    roleId,
+		Manager:   manager,
+		ExpiresAt: time.Now().Add(InviteExpiration),
+	}
+	invite.SetToken(token)
+
+	err = ts.DB.Omit(clause.Associations).Create(invite).Error
+	return invite, token, err
+}
+
+func (ts *Team) GetInvites(teamId uint) ([]*models.TeamInvite, error) {
+	invites := &models.TeamInvites{}
+	err := ts.DB.Where(&models.TeamInvite{TeamId: teamId}).Where("expires_at > ?", time.Now()).Find(invites).Error
+	return *invites, err
+}
+
+func (ts *Team) DeleteInvite(teamId, inviteId uint) error {
+	return ts.DB.Delete(&models.TeamInvite{}, "team_id = ? AND id = ?", teamId, inviteId).Error
+}
+
+// AcceptInvite adds the user to the team the invite is for. The invite must have been sent to the user's email
+func (ts *Team) AcceptInvite(token string, user *models.User) (*models.Team, error) {
+	invite := &models.TeamInvite{}
+	err := ts.DB.Preload("Team").Where(&models.TeamInvite{HashedToken: models.HashInviteToken(token)}).First(invite).Error
+	if err != nil && err == gorm.ErrRecordNotFound {
+		return nil, pufferpanel.ErrInviteInvalid
+	} else if err != nil {
+		return nil, err
+	}
+
+	if invite.IsExpired() || !strings.EqualFold(invite.Email, user.Email) {
+		return nil, pufferpanel.ErrInviteInvalid
+	}
+
+	err = ts.DB.Transaction(func(tx *gorm.DB) error {
+		txs := &Team{DB: tx}
+		err := txs.SetMember(&invite.Team, user.ID, invite.RoleId, invite.Manager)
+		if err != nil {
+			return err
+		}
+		return tx.Delete(invite).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &invite.Team, nil
+}
+
+// GetScopesForServer gets the scopes the user has on the server through the team that owns it
+func (ts *Team) GetScopesForServer(userId uint, serverId string) ([]pufferpanel.Scope, error) {
+	member := &models.TeamMember{}
+	err := ts.DB.Preload("Role").
+		Joins("JOIN servers s ON s.team_id = team_members.team_id").
+		Where("s.identifier = ? AND team_members.user_id = ?", serverId, userId).
+		First(member).Error
+	if err != nil && err == gorm.ErrRecordNotFound {
+		return []pufferpanel.Scope{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return member.Role.Scopes, nil
+}
+
+// GetScopesForUser gets the scopes the user has on every server owned by a team they are in
+func (ts *Team) GetScopesForUser(userId uint) (map[string][]pufferpanel.Scope, error) {
+	result := map[string][]pufferpanel.Scope{}
+
+	members := &models.TeamMembers{}
+	err := ts.DB.Preload("Role").Where(&models.TeamMember{UserId: userId}).Find(members).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for _, member := range *members {
+		var servers []string
+		err = ts.DB.Model(&models.Server{}).Where("team_id = ?", member.TeamId).Pluck("identifier", &servers).Error
+		if err != nil {
+			return nil, err
+		}
+
+		for _, v := range servers {
+			result[v] = mergeScopes(result[v], member.Role.Scopes)
+		}
+	}
+
+	return result, nil
+}
@@ -0,0 +1,162 @@
+package services
+
+import (
+	"github.com/pufferpanel/pufferpanel/v2"
+	"github.com/pufferpanel/pufferpanel/v2/models"
+	"testing"
+)
+
+func TestTeam_MembersAndServers(t *testing.T) {
+	db := prepareTestDatabase(t, "teams", &models.Node{}, &models.Team{}, &models.Server{}, &models.User{},
+		&models.Permissions{}, &models.Role{}, &models.RoleAssignment{}, &models.TeamMember{}, &models.TeamInvite{})
+
+	ts := &Team{DB: db}
+	rs := &Role{DB: db}
+	ps := &Permission{DB: db}
+
+	owner := &models.User{Username: "teamowner", Email: "owner@team.com", HashedPassword: "x"}
+	invited := &models.User{Username: "teaminvited", Email: "Invited@team.com", HashedPassword: "x"}
+	for _, v := range []*models.User{owner, invited} {
+		if err := db.Create(v).Error; err != nil {
+			t.Fatalf("create user error = %v", err)
+		}
+	}
+
+	role := &models.Role{Name: "team-viewer", Scopes: []pufferpanel.Scope{pufferpanel.ScopeServersView, pufferpanel.ScopeServersConsole}}
+	if err := rs.Create(role); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	team := &models.Team{Name: "QA", MaxServers: 1, MaxMembers: 2}
+	if err := ts.Create(team); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	if err := ts.SetMember(team, owner.ID, role.ID, true); err != nil {
+		t.Fatalf("SetMember() error = %v", err)
+	}
+
+	first := &models.Server{Name: "first", Identifier: "team0001", Type: "generic"}
+	second := &models.Server{Name: "second", Identifier: "team0002", Type: "generic"}
+	for _, v := range []*models.Server{first, second} {
+		if err := db.Omit("Node", "Team").Create(v).Error; err != nil {
+			t.Fatalf("create server error = %v", err)
+		}
+	}
+
+	t.Run("serverQuota", func(t *testing.T) {
+		if err := ts.SetServerTeam(first, team); err != nil {
+			t.Fatalf("SetServerTeam() error = %v", err)
+		}
+		if err := ts.SetServerTeam(second, team); err != pufferpanel.ErrTeamServerLimit {
+			t.Errorf("SetServerTeam() error = %v, want %v", err, pufferpanel.ErrTeamServerLimit)
+		}
+	})
+
+	t.Run("teamScopes", func(t *testing.T) {
+		scopes, err := ps.GetScopesForUserAndServer(owner.ID, &first.Identifier)
+		if err != nil {
+			t.Fatalf("GetScopesForUserAndServer() error = %v", err)
+		}
+		if !pufferpanel.ContainsExactScope(scopes, pufferpanel.ScopeServersConsole) {
+			t.Errorf("GetScopesForUserAndServer() = %v, missing team scopes", scopes)
+		}
+
+		scopes, err = ps.GetScopesForUserAndServer(owner.ID, &second.Identifier)
+		if err != nil {
+			t.Fatalf("GetScopesForUserAndServer() error = %v", err)
+		}
+		if len(scopes) != 0 {
+			t.Errorf("GetScopesForUserAndServer() = %v, want none for server outside team", scopes)
+		}
+	})
+
+	t.Run("invite", func(t *testing.T) {
+		invite, token, err := ts.CreateInvite(team, "invited@team.com", role.ID, false)
+		if err != nil {
+			t.Fatalf("CreateInvite() error = %v", err)
+		}
+		if invite.HashedToken == token {
+			t.Errorf("CreateInvite() stored the raw token")
+		}
+
+		if _, err = ts.AcceptInvite(token, owner); err != pufferpanel.ErrInviteInvalid {
+			t.Errorf("AcceptInvite() with other email error = %v, want %v", err, pufferpanel.ErrInviteInvalid)
+		}
+
+		joined, err := ts.AcceptInvite(token, invited)
+		if err != nil {
+			t.Fatalf("AcceptInvite() error = %v", err)
+		}
+		if joined.ID != team.ID {
+			t.Errorf("AcceptInvite() team = %d, want %d", joined.ID, team.ID)
+		}
+
+		if _, err = ts.AcceptInvite(token, invited); err != pufferpanel.ErrInviteInvalid {
+			t.Errorf("AcceptInvite() reused error = %v, want %v", err, pufferpanel.ErrInviteInvalid)
+		}
+
+		scopes, err := ps.GetScopesForUser(invited.ID)
+		if err != nil {
+			t.Fatalf("GetScopesForUser() error = %v", err)
+		}
+		if !pufferpanel.ContainsExactScope(scopes[first.Identifier], pufferpanel.ScopeServersView) {
+			t.Errorf("GetScopesForUser() = %v, missing team server", scopes)
+		}
+	})
+
+	t.Run("memberQuota", func(t *testing.T) {
+		extra := &models.User{Username: "teamextra", Email: "extra@team.com", HashedPassword: "x"}
+		if err := db.Create(extra).Error; err != nil {
+			t.Fatalf("create user error = %v", err)
+		}
+		if err := ts.SetMember(team, extra.ID, role.ID, false); err != pufferpanel.ErrTeamMemberLimit {
+			t.Errorf("SetMember() error = %v, want %v", err, pufferpanel.ErrTeamMemberLimit)
+		}
+	})
+
+	t.Run("serverQuotaFromDatabase", func(t *testing.T) {
+		//the limit is read again when the server is added, so a copy loaded earlier does not get around it
+		stale := *team
+		stale.MaxServers = 0
+		if err := ts.SetServerTeam(second, &stale); err != pufferpanel.ErrTeamServerLimit {
+			t.Errorf("SetServerTeam() error = %v, want %v", err, pufferpanel.ErrTeamServerLimit)
+		}
+	})
+
+	t.Run("removeServer", func(t *testing.T) {
+		if err := ts.RemoveServer(first, invited.ID); err != nil {
+			t.Fatalf("RemoveServer() error = %v", err)
+		}
+		if first.TeamId != nil {
+			t.Errorf("RemoveServer() left the server in team %d", *first.TeamId)
+		}
+
+		//only the team had access, so the user taking it out is given it
+		perm, err := ps.GetForUserAndServer(invited.ID, &first.Identifier)
+		if err != nil {
+			t.Fatalf("GetForUserAndServer() error = %v", err)
+		}
+		if perm.ID == 0 || !perm.ViewServer || !perm.EditServerUsers {
+			t.Errorf("RemoveServer() did not give the server to the user, permissions = %+v", perm)
+		}
+	})
+
+	t.Run("removeServerWithOwner", func(t *testing.T) {
+		if err := ts.SetServerTeam(first, team); err != nil {
+			t.Fatalf("SetServerTeam() error = %v", err)
+		}
+		if err := ts.Delete(team, owner.ID); err != nil {
+			t.Fatalf("Delete() error = %v", err)
+		}
+
+		//the server still has a user of its own, so nobody else is given it
+		perm, err := ps.GetForUserAndServer(owner.ID, &first.Identifier)
+		if err != nil {
+			t.Fatalf("GetForUserAndServer() error = %v", err)
+		}
+		if perm.ID != 0 {
+			t.Errorf("Delete() gave the server to another user, permissions = %+v", perm)
+		}
+	})
+}
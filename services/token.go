@@ -17,19 +17,24 @@ import (
 	"bytes"
 	"crypto/ecdsa"
 	"crypto/elliptic"
-	"crypto/rand"
 	"crypto/x509"
+	"encoding/json"
 	"encoding/pem"
 	"errors"
+	"fmt"
+	"github.com/go-co-op/gocron"
 	"github.com/golang-jwt/jwt/v4"
 	"github.com/pufferpanel/pufferpanel/v2"
 	"github.com/pufferpanel/pufferpanel/v2/config"
+	"github.com/pufferpanel/pufferpanel/v2/database"
 	"github.com/pufferpanel/pufferpanel/v2/logging"
 	"github.com/pufferpanel/pufferpanel/v2/models"
+	"github.com/pufferpanel/pufferpanel/v2/oauth2"
+	uuid "github.com/satori/go.uuid"
 	"github.com/spf13/cast"
-	"gorm.io/gorm"
 	"io"
 	"io/ioutil"
+	"math/big"
 	"net/http"
 	"os"
 	"strconv"
@@ -39,33 +44,67 @@ import (
 )
 
 var signingMethod = jwt.SigningMethodES256
+
+// how long to wait before asking for keys again when a token has a key id we do not know
+const keyRefreshLimit = 10 * time.Second
+
 var privateKey *ecdsa.PrivateKey
-var publicKey *ecdsa.PublicKey
+var privateKeyId string
+var publicKeys = map[string]*ecdsa.PublicKey{}
 var locker sync.Mutex
 var timer time.Time
+var lastRefresh time.Time
+
+// when the node last got the keys from the panel
+var keysLoadedAt time.Time
 
 func GetPublicKey() *ecdsa.PublicKey {
 	ValidateTokenLoaded()
-	if privateKey != nil {
-		return &privateKey.PublicKey
-	} else {
-		return publicKey
+	locker.Lock()
+	defer locker.Unlock()
+	key, _ := lookupKey("")
+	return key
+}
+
+// GetJWKS gets the public keys tokens may be signed with, so nodes can validate them
+func GetJWKS() pufferpanel.JWKS {
+	ValidateTokenLoaded()
+	locker.Lock()
+	defer locker.Unlock()
+	jwks := pufferpanel.JWKS{Keys: make([]pufferpanel.JWK, 0, len(publicKeys))}
+	for kid, v := range publicKeys {
+		if kid == "" {
+			continue
+		}
+		jwks.Keys = append(jwks.Keys, pufferpanel.NewJWK(v))
 	}
+	return jwks
 }
 
 func Generate(claims jwt.Claims) (string, error) {
 	ValidateTokenLoaded()
+	locker.Lock()
+	key, kid := privateKey, privateKeyId
+	locker.Unlock()
+
+	if key == nil {
+		return "", errors.New("signing key not loaded")
+	}
+
 	token := jwt.NewWithClaims(signingMethod, claims)
-	return token.SignedString(privateKey)
+	token.Header["kid"] = kid
+	return token.SignedString(key)
 }
 
-func GenerateSession(id uint) (string, error) {
+// GenerateSession creates a token for the session. The session id is carried in the token so it can be revoked
+func GenerateSession(userId, sessionId uint) (string, error) {
 	claims := &pufferpanel.Claim{
 		RegisteredClaims: jwt.RegisteredClaims{
 			Audience:  jwt.ClaimStrings{"session"},
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(1 * time.Hour)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			Subject:   strconv.Itoa(int(id)),
+			Subject:   strconv.Itoa(int(userId)),
+			ID:        strconv.Itoa(int(sessionId)),
 		},
 	}
 
@@ -78,11 +117,13 @@ func GenerateOAuthForClient(client *models.Client) (string, error) {
 			Audience:  jwt.ClaimStrings{"oauth2"},
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(1 * time.Hour)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ID:        uuid.NewV4().String(),
 		},
 		PanelClaims: pufferpanel.PanelClaims{
 			Scopes: map[string][]pufferpanel.Scope{
 				client.ServerId.String: client.Scopes,
 			},
+			ClientId: client.ClientId,
 		},
 	}
 
@@ -93,17 +134,92 @@ func GenerateOAuthForClient(client *models.Client) (string, error) {
 	return Generate(claims)
 }
 
+// NodeClientId is the client id a node uses to get its tokens
+func NodeClientId(nodeId uint) string {
+	return ".node_" + strconv.Itoa(int(nodeId))
+}
+
+// NodeIdFromClientId gets which node a client id from NodeClientId belongs to
+func NodeIdFromClientId(clientId string) (uint, bool) {
+	if !strings.HasPrefix(clientId, ".node_") {
+		return 0, false
+	}
+	id, err := strconv.ParseUint(strings.TrimPrefix(clientId, ".node_"), 10, 32)
+	if err != nil || id == 0 {
+		return 0, false
+	}
+	return uint(id), true
+}
+
 func GenerateOAuthForNode(nodeId uint) (string, error) {
 	claims := &pufferpanel.Claim{
 		RegisteredClaims: jwt.RegisteredClaims{
 			Audience:  jwt.ClaimStrings{"oauth2"},
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(1 * time.Hour)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ID:        uuid.NewV4().String(),
 		},
 		PanelClaims: pufferpanel.PanelClaims{
 			Scopes: map[string][]pufferpanel.Scope{
 				"": {pufferpanel.ScopeOAuth2Auth},
 			},
+			ClientId: NodeClientId(nodeId),
+		},
+	}
+	return Generate(claims)
+}
+
+// GenerateOAuthForPanel creates a short-lived token the panel uses to ask nodes about themselves
+func GenerateOAuthForPanel(scopes ...pufferpanel.Scope) (string, error) {
+	claims := &pufferpanel.Claim{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Audience:  jwt.ClaimStrings{"oauth2"},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(1 * time.Minute)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ID:        uuid.NewV4().String(),
+		},
+		PanelClaims: pufferpanel.PanelClaims{
+			Scopes: map[string][]pufferpanel.Scope{
+				"": scopes,
+			},
+		},
+	}
+	return Generate(claims)
+}
+
+// GenerateOAuthForServer creates a short-lived token the panel uses to act on a server on its nodes
+func GenerateOAuthForServer(serverId string, scopes ...pufferpanel.Scope) (string, error) {
+	claims := &pufferpanel.Claim{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Audience:  jwt.ClaimStrings{"oauth2"},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(15 * time.Minute)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ID:        uuid.NewV4().String(),
+		},
+		PanelClaims: pufferpanel.PanelClaims{
+			Scopes: map[string][]pufferpanel.Scope{
+				serverId: scopes,
+			},
+		},
+	}
+	return Generate(claims)
+}
+
+// GenerateTransferToken creates the token the node receiving a server reads it from the source node with. The source
+// is signed into it, so the receiving node does not fetch from anywhere the panel did not send it
+func GenerateTransferToken(serverId, source string) (string, error) {
+	claims := &pufferpanel.Claim{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Audience:  jwt.ClaimStrings{"oauth2"},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(15 * time.Minute)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ID:        uuid.NewV4().String(),
+		},
+		PanelClaims: pufferpanel.PanelClaims{
+			Scopes: map[string][]pufferpanel.Scope{
+				serverId: {pufferpanel.ScopeServersTransfer},
+			},
+			TransferSource: source,
 		},
 	}
 	return Generate(claims)
@@ -111,165 +227,394 @@ func GenerateOAuthForNode(nodeId uint) (string, error) {
 
 func (ps *Permission) GenerateOAuthForUser(userId uint, serverId *string) (string, error) {
 	var err error
-	var permissions []*models.Permissions
+	var scopes map[string][]pufferpanel.Scope
 
 	if serverId == nil {
-		permissions, err = ps.GetForUser(userId)
+		scopes, err = ps.GetScopesForUser(userId)
+		if err != nil {
+			return "", err
+		}
 	} else {
-		var perm *models.Permissions
-		perm, err = ps.GetForUserAndServer(userId, serverId)
+		scopes = map[string][]pufferpanel.Scope{}
+
+		scopes[*serverId], err = ps.GetScopesForUserAndServer(userId, serverId)
 		if err != nil {
 			return "", err
 		}
-		permissions = []*models.Permissions{perm}
 
-		perm, err = ps.GetForUserAndServer(userId, nil)
-		if err != nil && gorm.ErrRecordNotFound != err {
+		var global []pufferpanel.Scope
+		global, err = ps.GetScopesForUserAndServer(userId, nil)
+		if err != nil {
 			return "", err
 		}
-		if perm.ID != 0 && gorm.ErrRecordNotFound != err {
-			permissions = append(permissions, perm)
+		if len(global) > 0 {
+			scopes[""] = global
 		}
 	}
 
+	claims := &pufferpanel.Claim{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Audience:  jwt.ClaimStrings{"oauth2"},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(1 * time.Hour)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ID:        uuid.NewV4().String(),
+		},
+		PanelClaims: pufferpanel.PanelClaims{
+			Scopes: scopes,
+		},
+	}
+
+	return Generate(claims)
+}
+
+// GenerateOAuthForApplication creates a token for an app the user authorized. The app gets what the user agreed to,
+// but never more than the user can do themselves
+func (ps *Permission) GenerateOAuthForApplication(app *models.Application, authorization *models.ApplicationAuthorization) (string, error) {
+	userScopes, err := ps.GetScopesForUser(authorization.UserId)
 	if err != nil {
 		return "", err
 	}
 
+	scopes := map[string][]pufferpanel.Scope{}
+	for serverId, v := range userScopes {
+		allowed := make([]pufferpanel.Scope, 0)
+		for _, scope := range authorization.Scopes {
+			if pufferpanel.ContainsScope(v, scope) {
+				allowed = append(allowed, scope)
+			}
+		}
+		if len(allowed) > 0 {
+			scopes[serverId] = allowed
+		}
+	}
+
 	claims := &pufferpanel.Claim{
 		RegisteredClaims: jwt.RegisteredClaims{
 			Audience:  jwt.ClaimStrings{"oauth2"},
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(1 * time.Hour)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ID:        uuid.NewV4().String(),
+			Subject:   strconv.Itoa(int(authorization.UserId)),
 		},
 		PanelClaims: pufferpanel.PanelClaims{
-			Scopes: map[string][]pufferpanel.Scope{},
+			Scopes:   scopes,
+			ClientId: app.ClientId,
 		},
 	}
 
-	for _, perm := range permissions {
-		var existing []pufferpanel.Scope
-		if perm.ServerIdentifier == nil {
-			existing = claims.PanelClaims.Scopes[""]
-		} else {
-			existing = claims.PanelClaims.Scopes[*perm.ServerIdentifier]
-		}
+	return Generate(claims)
+}
 
-		if existing == nil {
-			existing = make([]pufferpanel.Scope, 0)
-		}
+func ParseToken(token string) (*pufferpanel.Token, error) {
+	ValidateTokenLoaded()
+	return pufferpanel.ParseToken(getVerificationKey, token)
+}
 
-		existing = append(existing, perm.ToScopes()...)
+func ValidateTokenLoaded() {
+	locker.Lock()
+	defer locker.Unlock()
+	if timer.Before(time.Now()) {
+		reloadKeys()
+	}
+}
 
-		if perm.ServerIdentifier == nil {
-			claims.PanelClaims.Scopes[""] = existing
-		} else {
-			claims.PanelClaims.Scopes[*perm.ServerIdentifier] = existing
+// StartKeyRotation checks every hour if the signing key is due to be replaced
+func StartKeyRotation() {
+	s := gocron.NewScheduler(time.UTC)
+	_, err := s.Every(1).Hour().Do(func() {
+		err := RotateSigningKey(false)
+		if err != nil {
+			logging.Error.Printf("Error rotating signing key: %s", err)
 		}
+	})
+	if err != nil {
+		logging.Error.Printf("Error scheduling signing key rotation: %s", err)
+		return
 	}
+	s.StartAsync()
+}
 
-	return Generate(claims)
+// RotateSigningKey replaces the signing key if it is due, or straight away if force is set
+func RotateSigningKey(force bool) error {
+	db, err := database.GetConnection()
+	if err != nil {
+		return err
+	}
+
+	sk := &SigningKey{DB: db}
+	rotated, err := sk.Rotate(keyRotationInterval(), keyOverlap(), force)
+	if err != nil {
+		return err
+	}
+
+	locker.Lock()
+	defer locker.Unlock()
+	if rotated {
+		logging.Info.Printf("Token signing key rotated")
+	}
+	reloadKeys()
+	return nil
 }
 
-func ParseToken(token string) (*pufferpanel.Token, error) {
-	ValidateTokenLoaded()
-	return pufferpanel.ParseToken(publicKey, token)
+func keyRotationInterval() time.Duration {
+	return time.Duration(config.TokenRotationDays.Value()) * 24 * time.Hour
 }
 
-func ValidateTokenLoaded() {
+// keyOverlap is how long retired keys are still accepted. Tokens live for an hour, so keys must overlap at least that
+func keyOverlap() time.Duration {
+	overlap := time.Duration(config.TokenOverlapHours.Value()) * time.Hour
+	if overlap < time.Hour {
+		overlap = time.Hour
+	}
+	return overlap
+}
+
+// getVerificationKey gets the key for the id, asking for the keys again if we have not seen it before,
+// as the panel may have rotated to a new one
+func getVerificationKey(kid string) (*ecdsa.PublicKey, error) {
 	locker.Lock()
 	defer locker.Unlock()
-	//only load public if panel is disabled
-	if !config.PanelEnabled.Value() {
-		if publicKey == nil || timer.Before(time.Now()) {
-			loadPublic()
+
+	if key, exists := lookupKey(kid); exists {
+		return key, nil
+	}
+
+	if time.Since(lastRefresh) >= keyRefreshLimit {
+		reloadKeys()
+		if key, exists := lookupKey(kid); exists {
+			return key, nil
 		}
-	} else if privateKey == nil {
-		loadPrivate()
 	}
+
+	return nil, errors.New("unknown signing key")
 }
 
-func loadPrivate() {
-	var privKey *ecdsa.PrivateKey
-	privKeyFile, err := os.OpenFile(config.TokenPrivate.Value(), os.O_RDONLY, 0600)
-	defer pufferpanel.Close(privKeyFile)
-	if os.IsNotExist(err) {
-		privKey, err = generatePrivateKey()
-	} else if err == nil {
-		var buf bytes.Buffer
-		_, _ = io.Copy(&buf, privKeyFile)
-		block, _ := pem.Decode(buf.Bytes())
+// lookupKey gets the key for the id. Tokens without a key id were signed with the current key on the panel, or the
+// configured public key on nodes
+func lookupKey(kid string) (*ecdsa.PublicKey, bool) {
+	if kid == "" && privateKey != nil {
+		return &privateKey.PublicKey, true
+	}
+	key, exists := publicKeys[kid]
+	return key, exists && key != nil
+}
+
+func reloadKeys() {
+	lastRefresh = time.Now()
 
-		privKey, err = ecdsa.GenerateKey(elliptic.P256(), bytes.NewReader(block.Bytes))
+	var err error
+	//only load public if panel is disabled
+	if !config.PanelEnabled.Value() {
+		err = loadPublic()
+		timer = time.Now().Add(time.Hour)
+		//get the keys again soon after the panel is back, it may have rotated them while it was gone
+		if oauth2.IsDegraded() {
+			timer = time.Now().Add(keyRefreshLimit)
+		}
+	} else {
+		err = loadPrivate()
+		timer = time.Now().Add(time.Minute)
 	}
 
 	if err != nil {
 		logging.Error.Printf("Internal error on token service: %s", err)
-		return
+		timer = time.Now().Add(keyRefreshLimit)
 	}
-
-	privateKey = privKey
-	publicKey = &privateKey.PublicKey
-	return
 }
 
-func generatePrivateKey() (privKey *ecdsa.PrivateKey, err error) {
-	var key bytes.Buffer
-	privKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+func loadPrivate() error {
+	db, err := database.GetConnection()
 	if err != nil {
-		return
+		return err
 	}
 
-	privKeyEncoded, _ := x509.MarshalECPrivateKey(privKey)
-	privKeyFile, err := os.OpenFile(config.TokenPrivate.Value(), os.O_CREATE|os.O_WRONLY, 0600)
-	defer pufferpanel.Close(privKeyFile)
+	sk := &SigningKey{DB: db}
+	keys, err := sk.GetAll(keyOverlap())
 	if err != nil {
-		return
+		return err
 	}
-	err = pem.Encode(privKeyFile, &pem.Block{Type: "PRIVATE KEY", Bytes: privKeyEncoded})
-	if err != nil {
-		return
+
+	if len(keys) == 0 {
+		err = createFirstKey(sk)
+		if err != nil {
+			return err
+		}
+		keys, err = sk.GetAll(keyOverlap())
+		if err != nil {
+			return err
+		}
+	}
+
+	var active *models.SigningKey
+	var activeKey *ecdsa.PrivateKey
+	newKeys := map[string]*ecdsa.PublicKey{}
+	for _, v := range keys {
+		key, err := v.GetKey()
+		if err != nil {
+			logging.Error.Printf("Signing key %s is not valid: %s", v.ID, err)
+			continue
+		}
+		newKeys[v.ID] = &key.PublicKey
+		//keys are newest first, so the first one not retired is what we sign with
+		if activeKey == nil || (active.RetiredAt != nil && v.RetiredAt == nil) {
+			active, activeKey = v, key
+		}
 	}
-	err = pem.Encode(&key, &pem.Block{Type: "PRIVATE KEY", Bytes: privKeyEncoded})
+
+	if activeKey == nil {
+		return errors.New("no valid signing key")
+	}
+
+	privateKey = activeKey
+	privateKeyId = active.ID
+	publicKeys = newKeys
+	return nil
+}
+
+// createFirstKey brings in the key from the deprecated token.private file, so tokens and nodes using it keep
+// working. Earlier versions did not sign with the key in that file but with one derived from it, so that is the key
+// brought in. Tokens from before the upgrade carry no key id, and are checked against it until it is rotated out.
+// If there is not a file, a new key is made
+func createFirstKey(sk *SigningKey) error {
+	data, err := os.ReadFile(config.TokenPrivate.Value())
+	if err == nil {
+		var key *ecdsa.PrivateKey
+		block, _ := pem.Decode(data)
+		if block != nil {
+			key, err = legacySigningKey(block.Bytes)
+		} else {
+			err = errors.New("pem did not decode it")
+		}
+
+		if err == nil {
+			logging.Info.Printf("Imported the signing key from %s, which can be removed once nodes use the JWKS", config.TokenPrivate.Value())
+			_, err = sk.Create(key)
+			return err
+		}
+		logging.Error.Printf("Could not import %s, creating a new signing key: %s", config.TokenPrivate.Value(), err)
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	_, err = sk.Rotate(keyRotationInterval(), keyOverlap(), true)
+	return err
+}
+
+// legacySigningKey derives the key earlier versions signed with, which called ecdsa.GenerateKey with the contents of
+// token.private as the random source. GenerateKey no longer reads its source the same way from Go 1.20, so how Go
+// 1.19 turned the bytes into a key is done here
+func legacySigningKey(seed []byte) (*ecdsa.PrivateKey, error) {
+	curve := elliptic.P256()
+	params := curve.Params()
+
+	b := make([]byte, params.BitSize/8+8)
+	_, err := io.ReadFull(bytes.NewReader(seed), b)
 	if err != nil {
-		return
+		return nil, err
 	}
 
-	return
+	one := big.NewInt(1)
+	k := new(big.Int).SetBytes(b)
+	k.Mod(k, new(big.Int).Sub(params.N, one))
+	k.Add(k, one)
+
+	key := &ecdsa.PrivateKey{D: k}
+	key.PublicKey.Curve = curve
+	key.PublicKey.X, key.PublicKey.Y = curve.ScalarBaseMult(k.Bytes())
+	return key, nil
 }
 
-func loadPublic() {
+// loadPublic gets the keys from the panel's JWKS. If the panel does not have one, the configured public key is used.
+// While the panel cannot be reached, the keys it last gave are kept until the offline grace period runs out
+func loadPublic() error {
+	if oauth2.IsDegraded() && len(publicKeys) > 0 && oauth2.WithinGracePeriod(keysLoadedAt) {
+		return nil
+	}
+
+	url := oauth2.PanelUrl("/.well-known/jwks.json")
+	keys, err := readJWKS(url)
+	if err == nil {
+		publicKeys = keys
+		keysLoadedAt = time.Now()
+		return nil
+	}
+
+	if oauth2.IsDegraded() && len(publicKeys) > 0 && oauth2.WithinGracePeriod(keysLoadedAt) {
+		logging.Debug.Printf("Could not get keys from %s, using the ones from %s: %s", url, keysLoadedAt, err)
+		return nil
+	}
+	if !keysLoadedAt.IsZero() {
+		//the panel has been gone too long to trust what it last said
+		publicKeys = map[string]*ecdsa.PublicKey{}
+		keysLoadedAt = time.Time{}
+	}
+
+	logging.Debug.Printf("Could not get keys from %s, falling back to %s: %s", url, config.TokenPublic.Value(), err)
+
 	data, err := readPublicKey(config.TokenPublic.Value())
 	if err != nil {
-		logging.Error.Printf("Internal error on token service: %s", err)
-		return
+		return err
 	}
 
 	logging.Debug.Printf("Panel key pulled from %s: %s", config.TokenPublic.Value(), data)
 
 	block, _ := pem.Decode(data)
 	if block == nil {
-		logging.Error.Printf("Public key does not seem valid, as pem did not decode it")
-		return
+		return errors.New("public key does not seem valid, as pem did not decode it")
 	}
 	if block.Type != "PUBLIC KEY" {
-		logging.Error.Printf("Public key is not valid, is a private key instead")
-		return
+		return errors.New("public key is not valid, is a private key instead")
 	}
 
 	key, err := x509.ParsePKIXPublicKey(block.Bytes)
 	if err != nil {
-		logging.Error.Printf("Internal error on token service: %s", err)
-		return
+		return err
 	}
 
-	var ok bool
-	publicKey, ok = key.(*ecdsa.PublicKey)
+	publicKey, ok := key.(*ecdsa.PublicKey)
 	if !ok {
-		logging.Error.Printf("Internal error on token service: %s", errors.New("public key is not ECDSA"))
-		return
+		return errors.New("public key is not ECDSA")
+	}
+	publicKeys = map[string]*ecdsa.PublicKey{"": publicKey}
+	return nil
+}
+
+func readJWKS(url string) (map[string]*ecdsa.PublicKey, error) {
+	request, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := oauth2.CallPanel(request)
+	if err != nil {
+		return nil, err
+	}
+	defer pufferpanel.Close(response.Body)
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected response code %d", response.StatusCode)
+	}
+
+	jwks := &pufferpanel.JWKS{}
+	err = json.NewDecoder(response.Body).Decode(jwks)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := map[string]*ecdsa.PublicKey{}
+	for _, v := range jwks.Keys {
+		key, err := v.PublicKey()
+		if err != nil {
+			logging.Debug.Printf("Skipping key %s from panel: %s", v.KeyId, err)
+			continue
+		}
+		keys[v.KeyId] = key
+	}
+
+	if len(keys) == 0 {
+		return nil, errors.New("no usable keys")
 	}
-	timer = time.Now().Add(5 * time.Minute)
+	return keys, nil
 }
 
 func readPublicKey(path string) ([]byte, error) {
@@ -0,0 +1,80 @@
+package services
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"github.com/pufferpanel/pufferpanel/v2"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func TestToken_legacySigningKey(t *testing.T) {
+	seed := make([]byte, 121)
+	for i := range seed {
+		seed[i] = byte(i)
+	}
+
+	key, err := legacySigningKey(seed)
+	if err != nil {
+		t.Fatalf("legacySigningKey() error = %v", err)
+	}
+
+	//what go 1.19 gave for the first 40 bytes of the seed
+	want, _ := new(big.Int).SetString("c0e101208070605101155b315cb1c6f2586bfe1f3ca45251f4197ca0f3b3108", 16)
+	if key.D.Cmp(want) != 0 {
+		t.Errorf("legacySigningKey() D = %x, want %x", key.D, want)
+	}
+	if !key.Curve.IsOnCurve(key.X, key.Y) {
+		t.Errorf("legacySigningKey() public key is not on the curve")
+	}
+
+	again, err := legacySigningKey(seed)
+	if err != nil || !again.Equal(key) {
+		t.Errorf("legacySigningKey() gave a different key for the same seed")
+	}
+
+	hash := sha256.Sum256([]byte("token"))
+	signature, err := ecdsa.SignASN1(rand.Reader, key, hash[:])
+	if err != nil {
+		t.Fatalf("SignASN1() error = %v", err)
+	}
+	if !ecdsa.VerifyASN1(&key.PublicKey, hash[:], signature) {
+		t.Errorf("legacySigningKey() key does not verify what it signs")
+	}
+
+	_, err = legacySigningKey(seed[:39])
+	if err == nil {
+		t.Errorf("legacySigningKey() error = nil, want an error for a short seed")
+	}
+}
+
+func TestToken_GenerateTransferToken(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+	//use this key rather than loading them
+	locker.Lock()
+	privateKey, privateKeyId, publicKeys, timer = key, "transfer", map[string]*ecdsa.PublicKey{"transfer": &key.PublicKey}, time.Now().Add(time.Hour)
+	locker.Unlock()
+
+	raw, err := GenerateTransferToken("abcdef12", "https://node.example.com/daemon/server/abcdef12/transfer")
+	if err != nil {
+		t.Fatalf("GenerateTransferToken() error = %v", err)
+	}
+
+	token, err := ParseToken(raw)
+	if err != nil {
+		t.Fatalf("ParseToken() error = %v", err)
+	}
+	claims := token.Claims.PanelClaims
+	if claims.TransferSource != "https://node.example.com/daemon/server/abcdef12/transfer" {
+		t.Errorf("GenerateTransferToken() source = %s", claims.TransferSource)
+	}
+	if len(claims.Scopes) != 1 || len(claims.Scopes["abcdef12"]) != 1 || !pufferpanel.ContainsExactScope(claims.Scopes["abcdef12"], pufferpanel.ScopeServersTransfer) {
+		t.Errorf("GenerateTransferToken() scopes = %v, want only %s on the server", claims.Scopes, pufferpanel.ScopeServersTransfer)
+	}
+}
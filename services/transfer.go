@@ -0,0 +1,287 @@
+/*
+ Copyright 2023 Padduck, LLC
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+  	http://www.apache.org/licenses/LICENSE-2.0
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+*/
+
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/pufferpanel/pufferpanel/v2"
+	"github.com/pufferpanel/pufferpanel/v2/config"
+	"github.com/pufferpanel/pufferpanel/v2/database"
+	"github.com/pufferpanel/pufferpanel/v2/logging"
+	"github.com/pufferpanel/pufferpanel/v2/models"
+	"gorm.io/gorm"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// transfers are only kept in memory, the server stays on the source node until one completes
+var transfers = make(map[string]*models.TransferView)
+var transferLocker sync.RWMutex
+
+// StartTransfer begins moving a server to another node. The transfer runs in the background,
+// GetTransfer reports how it is going
+func (ss *Server) StartTransfer(server *models.Server, target *models.Node) (*models.TransferView, error) {
+	if server.NodeID == target.ID {
+		return nil, pufferpanel.ErrTransferSameNode
+	}
+
+	transferLocker.Lock()
+	existing, exists := transfers[server.Identifier]
+	if exists && existing.FinishedAt == nil {
+		transferLocker.Unlock()
+		return nil, pufferpanel.ErrTransferRunning
+	}
+
+	transfer := &models.TransferView{
+		ServerId:     server.Identifier,
+		SourceNodeId: server.NodeID,
+		TargetNodeId: target.ID,
+		Stage:        pufferpanel.TransferStageStopping,
+		StartedAt:    time.Now(),
+	}
+	transfers[server.Identifier] = transfer
+	result := *transfer
+	transferLocker.Unlock()
+
+	go func() {
+		defer pufferpanel.Recover()
+
+		db, err := database.GetConnection()
+		if err == nil {
+			service := &Server{DB: db}
+			err = service.Transfer(transfer, server, &server.Node, target)
+		}
+
+		if err != nil {
+			logging.Error.Printf("Error transferring server %s to node %d: %s", server.Identifier, target.ID, err)
+		}
+		finishTransfer(transfer, err)
+	}()
+
+	return &result, nil
+}
+
+// GetTransfer gets the progress of the last transfer of the server
+func (ss *Server) GetTransfer(serverId string) (*models.TransferView, error) {
+	transferLocker.RLock()
+	defer transferLocker.RUnlock()
+
+	transfer, exists := transfers[serverId]
+	if !exists {
+		return nil, pufferpanel.ErrTransferNotFound
+	}
+	result := *transfer
+	return &result, nil
+}
+
+// Transfer moves a server between nodes. The target pulls the files straight from the source, and the panel only
+// points the server at the target once it says everything arrived intact. If anything fails, the target copy is
+// removed and the server is started again where it was
+func (ss *Server) Transfer(transfer *models.TransferView, server *models.Server, source, target *models.Node) (err error) {
+	ns := &Node{DB: ss.DB}
+	path := "/daemon/server/" + server.Identifier
+
+	token, err := GenerateOAuthForServer(server.Identifier, pufferpanel.ScopeServersView, pufferpanel.ScopeServersStart,
+		pufferpanel.ScopeServersStop, pufferpanel.ScopeServersDelete, pufferpanel.ScopeServersTransfer)
+	if err != nil {
+		return
+	}
+	headers := http.Header{}
+	headers.Set("Authorization", "Bearer "+token)
+
+	//the target only gets to read the export from the source, it is not trusted with anything else on the server
+	sourceUrl, err := transferSourceUrl(source, path+"/transfer")
+	if err != nil {
+		return
+	}
+	exportToken, err := GenerateTransferToken(server.Identifier, sourceUrl)
+	if err != nil {
+		return
+	}
+
+	status := &pufferpanel.ServerRunning{}
+	err = callNodeFor(ns, source, http.MethodGet, path+"/status", nil, headers, http.StatusOK, status)
+	if err != nil {
+		return
+	}
+
+	if status.Running {
+		err = callNodeFor(ns, source, http.MethodPost, path+"/stop?wait", nil, headers, http.StatusNoContent, nil)
+		if err != nil {
+			return
+		}
+
+		defer func() {
+			if err != nil {
+				if e := callNodeFor(ns, source, http.MethodPost, path+"/start", nil, headers, http.StatusNoContent, nil); e != nil {
+					logging.Error.Printf("Error starting server %s after failed transfer: %s", server.Identifier, e)
+				}
+			}
+		}()
+	}
+
+	setTransferStage(transfer, pufferpanel.TransferStageTransferring)
+
+	//once the target has been asked, it may hold a copy which has to be removed if this fails
+	removeFromTarget := false
+	defer func() {
+		if err != nil && removeFromTarget {
+			if e := callNodeFor(ns, target, http.MethodDelete, path, nil, headers, http.StatusNoContent, nil); e != nil {
+				logging.Error.Printf("Error removing server %s from node %d after failed transfer: %s", server.Identifier, target.ID, e)
+			}
+		}
+	}()
+
+	data, _ := json.Marshal(&pufferpanel.TransferRequest{Source: sourceUrl, Token: exportToken})
+
+	requestHeaders := headers.Clone()
+	requestHeaders.Set("Content-Type", "application/json")
+	res, err := ns.CallNode(target, http.MethodPost, path+"/transfer", io.NopCloser(bytes.NewReader(data)), requestHeaders)
+	defer pufferpanel.CloseResponse(res)
+	if err != nil {
+		return
+	}
+	if res.StatusCode != http.StatusOK {
+		return readNodeError(res)
+	}
+	removeFromTarget = true
+
+	completed := false
+	decoder := json.NewDecoder(res.Body)
+	for !completed {
+		progress := pufferpanel.TransferProgress{}
+		err = decoder.Decode(&progress)
+		if err == io.EOF {
+			return fmt.Errorf("node %d stopped responding during the transfer", target.ID)
+		} else if err != nil {
+			return
+		}
+
+		if progress.Stage == pufferpanel.TransferStageFailed {
+			//the target cleans up after itself when it reports a failure
+			removeFromTarget = false
+			return pufferpanel.ErrTransferFailed(progress.Error)
+		}
+		setTransferProgress(transfer, progress)
+		completed = progress.Stage == pufferpanel.TransferStageComplete
+	}
+
+	setTransferStage(transfer, pufferpanel.TransferStageFinalizing)
+
+	var nodeId *uint
+	if !target.IsLocal() {
+		nodeId = &target.ID
+	}
+	err = ss.DB.Transaction(func(tx *gorm.DB) error {
+		ps := &Port{DB: tx}
+		if e := ps.Move(server.Identifier, target.ID); e != nil {
+			return e
+		}
+		return tx.Model(&models.Server{}).Where("identifier = ?", server.Identifier).UpdateColumn("node_id", nodeId).Error
+	})
+	if err != nil {
+		return
+	}
+	server.NodeID = target.ID
+	server.Node = *target
+
+	//nothing below can undo the transfer, the server now lives on the target
+	if e := callNodeFor(ns, source, http.MethodDelete, path, nil, headers, http.StatusNoContent, nil); e != nil {
+		logging.Error.Printf("Error removing server %s from node %d after transfer, it must be removed by hand: %s", server.Identifier, source.ID, e)
+	}
+
+	if status.Running {
+		if e := callNodeFor(ns, target, http.MethodPost, path+"/start", nil, headers, http.StatusNoContent, nil); e != nil {
+			logging.Error.Printf("Error starting server %s after transfer: %s", server.Identifier, e)
+		}
+	}
+	return nil
+}
+
+// transferSourceUrl is where the target node can reach the source from. The panel's own node is only known by the
+// panel's address, and a node using mutual TLS only lets the panel in on its private address
+func transferSourceUrl(node *models.Node, path string) (string, error) {
+	if node.IsLocal() {
+		return strings.TrimSuffix(config.MasterUrl.Value(), "/") + path, nil
+	}
+	if node.UsesMTLS() {
+		ssl, err := probeDaemonSSL(node.PublicHost, node.PublicPort)
+		if err != nil {
+			return "", err
+		}
+		scheme := "http"
+		if ssl {
+			scheme = "https"
+		}
+		return fmt.Sprintf("%s://%s%s", scheme, net.JoinHostPort(node.PublicHost, strconv.Itoa(int(node.PublicPort))), path), nil
+	}
+	return createNodeURL(node, path)
+}
+
+// callNodeFor calls the node, expecting the given status, and decoding the response into result if it is set
+func callNodeFor(ns *Node, node *models.Node, method, path string, body io.ReadCloser, headers http.Header, expected int, result interface{}) error {
+	res, err := ns.CallNode(node, method, path, body, headers)
+	defer pufferpanel.CloseResponse(res)
+	if err != nil {
+		return err
+	}
+
+	if res.StatusCode != expected {
+		return readNodeError(res)
+	}
+
+	if result != nil {
+		return json.NewDecoder(res.Body).Decode(result)
+	}
+	return nil
+}
+
+func readNodeError(res *http.Response) error {
+	msg, _ := io.ReadAll(res.Body)
+	return fmt.Errorf("node responded with [%d] %s", res.StatusCode, msg)
+}
+
+func setTransferProgress(transfer *models.TransferView, progress pufferpanel.TransferProgress) {
+	transferLocker.Lock()
+	defer transferLocker.Unlock()
+	transfer.Stage = progress.Stage
+	transfer.Bytes = progress.Bytes
+}
+
+func setTransferStage(transfer *models.TransferView, stage string) {
+	transferLocker.Lock()
+	defer transferLocker.Unlock()
+	transfer.Stage = stage
+}
+
+func finishTransfer(transfer *models.TransferView, err error) {
+	transferLocker.Lock()
+	defer transferLocker.Unlock()
+
+	now := time.Now()
+	transfer.FinishedAt = &now
+	if err != nil {
+		transfer.Stage = pufferpanel.TransferStageFailed
+		transfer.Error = err.Error()
+	} else {
+		transfer.Stage = pufferpanel.TransferStageComplete
+	}
+}
@@ -15,7 +15,9 @@ package services
 
 import (
 	"bytes"
+	"crypto/rand"
 	"encoding/base64"
+	"encoding/hex"
 	"github.com/pquerna/otp"
 	"github.com/pquerna/otp/totp"
 	"github.com/pufferpanel/pufferpanel/v2"
@@ -23,11 +25,14 @@ import (
 	"github.com/pufferpanel/pufferpanel/v2/models"
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"image"
 	"image/png"
 	"strings"
 )
 
+const RecoveryCodeCount = 10
+
 type User struct {
 	DB *gorm.DB
 }
@@ -58,7 +63,8 @@ func (us *User) GetById(id uint) (*models.User, error) {
 	return model, nil
 }
 
-func (us *User) Login(email string, password string) (user *models.User, sessionToken string, otpNeeded bool, err error) {
+// Login checks the user's credentials. If otpNeeded is returned, the login must be finished with their second factor
+func (us *User) Login(email string, password string) (user *models.User, otpNeeded bool, err error) {
 	user = &models.User{
 		Email: email,
 	}
@@ -79,16 +85,11 @@ func (us *User) Login(email string, password string) (user *models.User, session
 		return
 	}
 
-	if user.OtpActive {
-		otpNeeded = true
-		return
-	}
-
-	sessionToken, err = GenerateSession(user.ID)
+	otpNeeded, err = us.HasSecondFactor(user)
 	return
 }
 
-func (us *User) LoginOtp(email string, token string) (user *models.User, sessionToken string, err error) {
+func (us *User) LoginOtp(email string, token string) (user *models.User, err error) {
 	user = &models.User{
 		Email: email,
 	}
@@ -104,19 +105,42 @@ func (us *User) LoginOtp(email string, token string) (user *models.User, session
 		return
 	}
 
-	if !totp.Validate(token, user.OtpSecret) {
-		err = pufferpanel.ErrInvalidCredentials
-		return
+	//the token may either be from their authenticator app, or one of their recovery codes
+	valid := user.OtpActive && totp.Validate(token, user.OtpSecret)
+	if !valid {
+		valid, err = us.UseRecoveryCode(user.ID, token)
+		if err != nil {
+			return
+		}
 	}
 
-	sessionToken, err = GenerateSession(user.ID)
+	if !valid {
+		err = pufferpanel.ErrInvalidCredentials
+	}
 	return
 }
 
+// HasSecondFactor checks if the user has OTP or a security key set up
+func (us *User) HasSecondFactor(user *models.User) (bool, error) {
+	if user.OtpActive {
+		return true, nil
+	}
+	ws := &WebAuthn{DB: us.DB}
+	return ws.HasCredentials(user.ID)
+}
+
 func (us *User) IsValidCredentials(user *models.User, password string) bool {
 	return bcrypt.CompareHashAndPassword([]byte(user.HashedPassword), []byte(password)) == nil
 }
 
+// Reauthenticate checks the user is present before a change to how they log in, by their password or an OTP token
+func (us *User) Reauthenticate(user *models.User, password, token string) bool {
+	if password != "" && us.IsValidCredentials(user, password) {
+		return true
+	}
+	return token != "" && user.OtpActive && totp.Validate(token, user.OtpSecret)
+}
+
 func (us *User) GetByEmail(email string) (*models.User, error) {
 	model := &models.User{
 		Email: email,
@@ -134,13 +158,58 @@ func (us *User) Update(model *models.User) error {
 	return us.DB.Save(model).Error
 }
 
-func (us *User) Delete(model *models.User) (err error) {
-	return us.DB.Transaction(func(tx *gorm.DB) error {
-		us.DB.Delete(models.Permissions{}, "user_id = ?", model.ID)
-		us.DB.Delete(models.Client{}, "user_id = ?", model.ID)
-		us.DB.Delete(models.User{}, "id = ?", model.ID)
-		return nil
+// Delete removes the user and everything that is theirs. Their sessions are revoked too, so tokens already issued for
+// them stop working rather than lasting until the session cache expires
+func (us *User) Delete(model *models.User) error {
+	var sessions []uint
+	err := us.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&models.Session{}).Where("user_id = ?", model.ID).Pluck("id", &sessions).Error
+		if err != nil {
+			return err
+		}
+
+		owned := []interface{}{&models.Permissions{}, &models.RoleAssignment{}, &models.TeamMember{}, &models.Client{},
+			&models.WebAuthnCredential{}, &models.RecoveryCode{}, &models.Session{}}
+		for _, v := range owned {
+			err = tx.Delete(v, "user_id = ?", model.ID).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		authorizations := tx.Model(&models.ApplicationAuthorization{}).Select("id").Where("user_id = ?", model.ID)
+		err = tx.Delete(&models.ApplicationToken{}, "authorization_id IN (?)", authorizations).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Delete(&models.ApplicationAuthorization{}, "user_id = ?", model.ID).Error
+		if err != nil {
+			return err
+		}
+
+		as := &Application{DB: tx}
+		apps, err := as.GetForOwner(model.ID)
+		if err != nil {
+			return err
+		}
+		for _, v := range apps {
+			err = as.Delete(v)
+			if err != nil {
+				return err
+			}
+		}
+
+		return tx.Delete(&models.User{}, "id = ?", model.ID).Error
 	})
+	if err != nil {
+		return err
+	}
+
+	for _, v := range sessions {
+		revokeSessionCache(v)
+	}
+	clearIntrospectionCache()
+	return nil
 }
 
 func (us *User) Create(user *models.User) error {
@@ -206,18 +275,26 @@ func (us *User) StartOtpEnroll(userId uint) (secret string, img string, err erro
 	return
 }
 
-func (us *User) ValidateOtpEnroll(userId uint, token string) error {
+// ValidateOtpEnroll enables OTP for the user, and gives them a new set of recovery codes
+func (us *User) ValidateOtpEnroll(userId uint, token string) (recoveryCodes []string, err error) {
 	user, err := us.GetById(userId)
 	if err != nil {
-		return err
+		return
 	}
 
 	if !totp.Validate(token, user.OtpSecret) {
-		return pufferpanel.ErrInvalidCredentials
+		err = pufferpanel.ErrInvalidCredentials
+		return
 	}
 
 	user.OtpActive = true
-	return us.Update(user)
+	err = us.Update(user)
+	if err != nil {
+		return
+	}
+
+	recoveryCodes, err = us.GenerateRecoveryCodes(userId)
+	return
 }
 
 func (us *User) DisableOtp(userId uint, token string) error {
@@ -232,7 +309,70 @@ func (us *User) DisableOtp(userId uint, token string) error {
 
 	user.OtpSecret = ""
 	user.OtpActive = false
-	return us.Update(user)
+	err = us.Update(user)
+	if err != nil {
+		return err
+	}
+
+	return us.RemoveUnusedRecoveryCodes(user)
+}
+
+// GenerateRecoveryCodes replaces the user's recovery codes with new ones.
+// This is the only time the codes are available, only their hashes are stored
+func (us *User) GenerateRecoveryCodes(userId uint) ([]string, error) {
+	codes := make([]string, RecoveryCodeCount)
+	records := make([]*models.RecoveryCode, RecoveryCodeCount)
+
+	for i := range codes {
+		b := make([]byte, 5)
+		_, err := rand.Read(b)
+		if err != nil {
+			return nil, err
+		}
+		code := hex.EncodeToString(b)
+		codes[i] = code[:5] + "-" + code[5:]
+		records[i] = &models.RecoveryCode{UserId: userId, HashedCode: models.HashRecoveryCode(codes[i])}
+	}
+
+	err := us.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Delete(&models.RecoveryCode{}, "user_id = ?", userId).Error
+		if err != nil {
+			return err
+		}
+		return tx.Omit(clause.Associations).Create(&records).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// GetRecoveryCodeCount gets how many unused recovery codes the user has
+func (us *User) GetRecoveryCodeCount(userId uint) (count int64, err error) {
+	err = us.DB.Model(&models.RecoveryCode{}).Where(&models.RecoveryCode{UserId: userId}).Count(&count).Error
+	return
+}
+
+// UseRecoveryCode checks if the code is one of the user's recovery codes, and if so, removes it so it cannot be used again
+func (us *User) UseRecoveryCode(userId uint, code string) (bool, error) {
+	if strings.TrimSpace(code) == "" {
+		return false, nil
+	}
+
+	res := us.DB.Delete(&models.RecoveryCode{}, "user_id = ? AND code = ?", userId, models.HashRecoveryCode(code))
+	if res.Error != nil {
+		return false, res.Error
+	}
+	return res.RowsAffected > 0, nil
+}
+
+// RemoveUnusedRecoveryCodes deletes the user's recovery codes if they no longer have a second factor to recover
+func (us *User) RemoveUnusedRecoveryCodes(user *models.User) error {
+	hasSecondFactor, err := us.HasSecondFactor(user)
+	if err != nil || hasSecondFactor {
+		return err
+	}
+	return us.DB.Delete(&models.RecoveryCode{}, "user_id = ?", user.ID).Error
 }
 
 func (us *User) Search(usernameFilter, emailFilter string, pageSize, page uint) (*models.Users, int64, error) {
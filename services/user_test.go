@@ -0,0 +1,54 @@
+package services
+
+import (
+	"github.com/pufferpanel/pufferpanel/v2"
+	"github.com/pufferpanel/pufferpanel/v2/models"
+	"testing"
+)
+
+func TestUser_Delete(t *testing.T) {
+	db := prepareTestDatabase(t, "userdelete", &models.Node{}, &models.Team{}, &models.TeamMember{}, &models.Server{},
+		&models.User{}, &models.Client{}, &models.Permissions{}, &models.Role{}, &models.RoleAssignment{},
+		&models.WebAuthnCredential{}, &models.RecoveryCode{}, &models.Session{}, &models.Application{},
+		&models.ApplicationAuthorization{}, &models.ApplicationToken{})
+
+	us := &User{DB: db}
+	ss := &Session{DB: db}
+
+	user := &models.User{Username: "deleted", Email: "deleted@user.com", HashedPassword: "x"}
+	if err := us.Create(user); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	session, _, err := ss.Create(user.ID, "test agent", "127.0.0.1")
+	if err != nil {
+		t.Fatalf("Create() session error = %v", err)
+	}
+	//other tests have their own databases, but share the cache and the same session ids
+	sessionCacheLocker.Lock()
+	delete(sessionCache, session.ID)
+	sessionCacheLocker.Unlock()
+
+	//the cache now says the session is active
+	if _, err = ss.GetActiveSession(sessionToken(user.ID, session.ID)); err != nil {
+		t.Fatalf("GetActiveSession() error = %v", err)
+	}
+
+	if err = us.Delete(user); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+
+	if _, err = ss.GetActiveSession(sessionToken(user.ID, session.ID)); err != pufferpanel.ErrInvalidSession {
+		t.Errorf("GetActiveSession() error = %v, want %v", err, pufferpanel.ErrInvalidSession)
+	}
+
+	var count int64
+	db.Model(&models.User{}).Where("id = ?", user.ID).Count(&count)
+	if count != 0 {
+		t.Errorf("Delete() left the user")
+	}
+	db.Model(&models.Session{}).Where("user_id = ?", user.ID).Count(&count)
+	if count != 0 {
+		t.Errorf("Delete() left %d sessions", count)
+	}
+}
@@ -0,0 +1,332 @@
+/*
+ Copyright 2023 Padduck, LLC
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+  	http://www.apache.org/licenses/LICENSE-2.0
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+*/
+
+package services
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/pufferpanel/pufferpanel/v2"
+	"github.com/pufferpanel/pufferpanel/v2/config"
+	"github.com/pufferpanel/pufferpanel/v2/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const WebAuthnTimeout = 5 * time.Minute
+
+type WebAuthn struct {
+	DB *gorm.DB
+}
+
+// webAuthnUser is a user along with their credentials, as the WebAuthn library needs them
+type webAuthnUser struct {
+	user        *models.User
+	credentials []webauthn.Credential
+}
+
+// webAuthnSession is a ceremony which has been started, and until when it can be finished
+type webAuthnSession struct {
+	data    *webauthn.SessionData
+	expires time.Time
+}
+
+// pending ceremonies, keyed by ceremony and user. Each can only be used once
+var webAuthnSessions = make(map[string]webAuthnSession)
+var webAuthnSessionLocker sync.Mutex
+
+func (ws *WebAuthn) GetCredentials(userId uint) ([]*models.WebAuthnCredential, error) {
+	credentials := &models.WebAuthnCredentials{}
+	err := ws.DB.Where(&models.WebAuthnCredential{UserId: userId}).Order("id").Find(credentials).Error
+	return *credentials, err
+}
+
+func (ws *WebAuthn) GetCredential(userId, id uint) (*models.WebAuthnCredential, error) {
+	credential := &models.WebAuthnCredential{}
+	err := ws.DB.Where(&models.WebAuthnCredential{ID: id, UserId: userId}).First(credential).Error
+	if err != nil && err == gorm.ErrRecordNotFound {
+		return nil, pufferpanel.ErrWebAuthnNotFound
+	}
+	return credential, err
+}
+
+func (ws *WebAuthn) HasCredentials(userId uint) (bool, error) {
+	var count int64
+	err := ws.DB.Model(&models.WebAuthnCredential{}).Where(&models.WebAuthnCredential{UserId: userId}).Count(&count).Error
+	return count > 0, err
+}
+
+func (ws *WebAuthn) DeleteCredential(model *models.WebAuthnCredential) error {
+	return ws.DB.Delete(model).Error
+}
+
+// BeginRegistration creates the options the browser needs to register a new security key or passkey
+func (ws *WebAuthn) BeginRegistration(user *models.User) (*protocol.PublicKeyCredentialCreationOptions, error) {
+	relyingParty, err := getRelyingParty()
+	if err != nil {
+		return nil, err
+	}
+
+	wu, err := ws.getUser(user)
+	if err != nil {
+		return nil, err
+	}
+
+	exclusions := make([]protocol.CredentialDescriptor, len(wu.credentials))
+	for k, v := range wu.credentials {
+		exclusions[k] = v.Descriptor()
+	}
+
+	creation, session, err := relyingParty.BeginRegistration(wu,
+		webauthn.WithExclusions(exclusions),
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementPreferred),
+		webauthn.WithConveyancePreference(protocol.PreferNoAttestation))
+	if err != nil {
+		return nil, err
+	}
+
+	storeWebAuthnSession(webAuthnSessionKey("register", user.ID), session)
+	return &creation.Response, nil
+}
+
+// FinishRegistration validates the browser's response to BeginRegistration and stores the new credential
+func (ws *WebAuthn) FinishRegistration(user *models.User, response *models.WebAuthnAttestationResponse) (*models.WebAuthnCredential, error) {
+	session := consumeWebAuthnSession(webAuthnSessionKey("register", user.ID))
+	if session == nil {
+		return nil, pufferpanel.ErrWebAuthnInvalid
+	}
+
+	relyingParty, err := getRelyingParty()
+	if err != nil {
+		return nil, err
+	}
+
+	parsed, err := parseWebAuthnResponse(response.CredentialCreationResponse, protocol.ParseCredentialCreationResponseBody)
+	if err != nil {
+		return nil, pufferpanel.ErrWebAuthnInvalid
+	}
+
+	wu, err := ws.getUser(user)
+	if err != nil {
+		return nil, err
+	}
+
+	created, err := relyingParty.CreateCredential(wu, *session, parsed)
+	if err != nil {
+		return nil, pufferpanel.ErrWebAuthnInvalid
+	}
+
+	credentialId := base64.RawURLEncoding.EncodeToString(created.ID)
+
+	var count int64
+	err = ws.DB.Model(&models.WebAuthnCredential{}).Where(&models.WebAuthnCredential{CredentialId: credentialId}).Count(&count).Error
+	if err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, pufferpanel.ErrWebAuthnExists
+	}
+
+	name := strings.TrimSpace(response.Name)
+	if name == "" {
+		name = "Security key"
+	}
+	if len(name) > 100 {
+		name = name[:100]
+	}
+
+	credential := &models.WebAuthnCredential{
+		UserId:       user.ID,
+		CredentialId: credentialId,
+		PublicKey:    created.PublicKey,
+		SignCount:    created.Authenticator.SignCount,
+		Name:         name,
+	}
+	err = ws.DB.Omit(clause.Associations).Create(credential).Error
+	return credential, err
+}
+
+// BeginLogin creates the options the browser needs to prove the user has one of their registered credentials
+func (ws *WebAuthn) BeginLogin(user *models.User) (*protocol.PublicKeyCredentialRequestOptions, error) {
+	relyingParty, err := getRelyingParty()
+	if err != nil {
+		return nil, err
+	}
+
+	wu, err := ws.getUser(user)
+	if err != nil {
+		return nil, err
+	}
+	if len(wu.credentials) == 0 {
+		return nil, pufferpanel.ErrWebAuthnNotFound
+	}
+
+	assertion, session, err := relyingParty.BeginLogin(wu)
+	if err != nil {
+		return nil, err
+	}
+
+	storeWebAuthnSession(webAuthnSessionKey("login", user.ID), session)
+	return &assertion.Response, nil
+}
+
+// FinishLogin validates the browser's response to BeginLogin
+func (ws *WebAuthn) FinishLogin(user *models.User, response *models.WebAuthnAssertionResponse) error {
+	session := consumeWebAuthnSession(webAuthnSessionKey("login", user.ID))
+	if session == nil {
+		return pufferpanel.ErrWebAuthnInvalid
+	}
+
+	relyingParty, err := getRelyingParty()
+	if err != nil {
+		return err
+	}
+
+	parsed, err := parseWebAuthnResponse(response.CredentialAssertionResponse, protocol.ParseCredentialRequestResponseBody)
+	if err != nil {
+		return pufferpanel.ErrWebAuthnInvalid
+	}
+
+	wu, err := ws.getUser(user)
+	if err != nil {
+		return err
+	}
+
+	used, err := relyingParty.ValidateLogin(wu, *session, parsed)
+	if err != nil {
+		return pufferpanel.ErrWebAuthnInvalid
+	}
+
+	//a counter that does not go up means the credential may have been cloned
+	if used.Authenticator.CloneWarning {
+		return pufferpanel.ErrWebAuthnInvalid
+	}
+
+	credential := &models.WebAuthnCredential{}
+	err = ws.DB.Where(&models.WebAuthnCredential{UserId: user.ID, CredentialId: base64.RawURLEncoding.EncodeToString(used.ID)}).First(credential).Error
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	credential.SignCount = used.Authenticator.SignCount
+	credential.LastUsed = &now
+	return ws.DB.Omit(clause.Associations).Save(credential).Error
+}
+
+func (ws *WebAuthn) getUser(user *models.User) (*webAuthnUser, error) {
+	existing, err := ws.GetCredentials(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	wu := &webAuthnUser{user: user, credentials: make([]webauthn.Credential, 0, len(existing))}
+	for _, v := range existing {
+		id, err := base64.RawURLEncoding.DecodeString(v.CredentialId)
+		if err != nil {
+			continue
+		}
+		wu.credentials = append(wu.credentials, webauthn.Credential{
+			ID:            id,
+			PublicKey:     v.PublicKey,
+			Authenticator: webauthn.Authenticator{SignCount: v.SignCount},
+		})
+	}
+	return wu, nil
+}
+
+func (wu *webAuthnUser) WebAuthnID() []byte {
+	return []byte(strconv.FormatUint(uint64(wu.user.ID), 10))
+}
+
+func (wu *webAuthnUser) WebAuthnName() string {
+	return wu.user.Email
+}
+
+func (wu *webAuthnUser) WebAuthnDisplayName() string {
+	return wu.user.Username
+}
+
+func (wu *webAuthnUser) WebAuthnCredentials() []webauthn.Credential {
+	return wu.credentials
+}
+
+func (wu *webAuthnUser) WebAuthnIcon() string {
+	return ""
+}
+
+// getRelyingParty creates the relying party, which is identified by the master url
+func getRelyingParty() (*webauthn.WebAuthn, error) {
+	u, err := url.Parse(config.MasterUrl.Value())
+	if err != nil {
+		return nil, err
+	}
+
+	return webauthn.New(&webauthn.Config{
+		RPID:          u.Hostname(),
+		RPDisplayName: config.CompanyName.Value(),
+		RPOrigins:     []string{u.Scheme + "://" + u.Host},
+		Timeout:       int(WebAuthnTimeout / time.Millisecond),
+	})
+}
+
+// parseWebAuthnResponse checks and decodes what the browser sent. The library only parses responses from their json,
+// so the response is turned back into that
+func parseWebAuthnResponse[T, P any](response T, parse func(io.Reader) (*P, error)) (*P, error) {
+	data, err := json.Marshal(response)
+	if err != nil {
+		return nil, err
+	}
+	return parse(bytes.NewReader(data))
+}
+
+func webAuthnSessionKey(ceremony string, userId uint) string {
+	return fmt.Sprintf("%s:%d", ceremony, userId)
+}
+
+// storeWebAuthnSession keeps the ceremony until the browser finishes it, which has to be within WebAuthnTimeout
+func storeWebAuthnSession(key string, session *webauthn.SessionData) {
+	webAuthnSessionLocker.Lock()
+	defer webAuthnSessionLocker.Unlock()
+
+	now := time.Now()
+	for k, v := range webAuthnSessions {
+		if now.After(v.expires) {
+			delete(webAuthnSessions, k)
+		}
+	}
+	webAuthnSessions[key] = webAuthnSession{data: session, expires: now.Add(WebAuthnTimeout)}
+}
+
+// consumeWebAuthnSession gets the ceremony started for this key, and removes it so it cannot be replayed
+func consumeWebAuthnSession(key string) *webauthn.SessionData {
+	webAuthnSessionLocker.Lock()
+	defer webAuthnSessionLocker.Unlock()
+
+	session, exists := webAuthnSessions[key]
+	delete(webAuthnSessions, key)
+	if !exists || time.Now().After(session.expires) {
+		return nil
+	}
+	return session.data
+}
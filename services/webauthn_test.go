@@ -0,0 +1,296 @@
+package services
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/pufferpanel/pufferpanel/v2"
+	"github.com/pufferpanel/pufferpanel/v2/models"
+	"github.com/ugorji/go/codec"
+	"testing"
+)
+
+func TestWebAuthn_RegisterAndLogin(t *testing.T) {
+	db := prepareTestDatabase(t, "webauthn", &models.User{}, &models.WebAuthnCredential{}, &models.RecoveryCode{})
+
+	ws := &WebAuthn{DB: db}
+	us := &User{DB: db}
+
+	user := &models.User{Username: "webauthntest", Email: "webauthn@test.com", HashedPassword: "x"}
+	if err := db.Create(user).Error; err != nil {
+		t.Fatalf("create user error = %v", err)
+	}
+
+	authenticator := newSoftAuthenticator(t)
+
+	t.Run("register", func(t *testing.T) {
+		options, err := ws.BeginRegistration(user)
+		if err != nil {
+			t.Fatalf("BeginRegistration() error = %v", err)
+		}
+		if options.RelyingParty.ID != "localhost" {
+			t.Errorf("BeginRegistration() rp = %s, want localhost", options.RelyingParty.ID)
+		}
+
+		response := authenticator.register(t, options.Challenge.String(), "http://localhost:8080")
+		credential, err := ws.FinishRegistration(user, response)
+		if err != nil {
+			t.Fatalf("FinishRegistration() error = %v", err)
+		}
+		if credential.Name != "test key" {
+			t.Errorf("FinishRegistration() name = %s, want test key", credential.Name)
+		}
+
+		//the challenge can only be used once
+		if _, err = ws.FinishRegistration(user, response); err != pufferpanel.ErrWebAuthnInvalid {
+			t.Errorf("FinishRegistration() replay error = %v, want %v", err, pufferpanel.ErrWebAuthnInvalid)
+		}
+
+		hasSecondFactor, err := us.HasSecondFactor(user)
+		if err != nil || !hasSecondFactor {
+			t.Errorf("HasSecondFactor() = %v, %v, want true", hasSecondFactor, err)
+		}
+	})
+
+	t.Run("wrongOrigin", func(t *testing.T) {
+		options, err := ws.BeginRegistration(user)
+		if err != nil {
+			t.Fatalf("BeginRegistration() error = %v", err)
+		}
+
+		other := newSoftAuthenticator(t)
+		response := other.register(t, options.Challenge.String(), "https://evil.example.com")
+		if _, err = ws.FinishRegistration(user, response); err != pufferpanel.ErrWebAuthnInvalid {
+			t.Errorf("FinishRegistration() error = %v, want %v", err, pufferpanel.ErrWebAuthnInvalid)
+		}
+	})
+
+	t.Run("login", func(t *testing.T) {
+		options, err := ws.BeginLogin(user)
+		if err != nil {
+			t.Fatalf("BeginLogin() error = %v", err)
+		}
+		if len(options.AllowedCredentials) != 1 {
+			t.Fatalf("BeginLogin() allowCredentials = %v, want 1", options.AllowedCredentials)
+		}
+
+		if err = ws.FinishLogin(user, authenticator.login(t, options.Challenge.String())); err != nil {
+			t.Fatalf("FinishLogin() error = %v", err)
+		}
+
+		credentials, err := ws.GetCredentials(user.ID)
+		if err != nil {
+			t.Fatalf("GetCredentials() error = %v", err)
+		}
+		if credentials[0].SignCount != authenticator.signCount || credentials[0].LastUsed == nil {
+			t.Errorf("FinishLogin() did not record use, signCount = %d", credentials[0].SignCount)
+		}
+	})
+
+	t.Run("clonedCounter", func(t *testing.T) {
+		options, err := ws.BeginLogin(user)
+		if err != nil {
+			t.Fatalf("BeginLogin() error = %v", err)
+		}
+
+		//a clone would still be at the previous counter
+		authenticator.signCount--
+		if err = ws.FinishLogin(user, authenticator.login(t, options.Challenge.String())); err != pufferpanel.ErrWebAuthnInvalid {
+			t.Errorf("FinishLogin() error = %v, want %v", err, pufferpanel.ErrWebAuthnInvalid)
+		}
+	})
+
+	t.Run("badSignature", func(t *testing.T) {
+		options, err := ws.BeginLogin(user)
+		if err != nil {
+			t.Fatalf("BeginLogin() error = %v", err)
+		}
+
+		response := authenticator.login(t, options.Challenge.String())
+		other := newSoftAuthenticator(t)
+		other.credentialId = authenticator.credentialId
+		other.signCount = authenticator.signCount + 1
+		response.AssertionResponse.Signature = other.login(t, options.Challenge.String()).AssertionResponse.Signature
+		if err = ws.FinishLogin(user, response); err != pufferpanel.ErrWebAuthnInvalid {
+			t.Errorf("FinishLogin() error = %v, want %v", err, pufferpanel.ErrWebAuthnInvalid)
+		}
+	})
+}
+
+func TestUser_RecoveryCodes(t *testing.T) {
+	db := prepareTestDatabase(t, "webauthn", &models.User{}, &models.WebAuthnCredential{}, &models.RecoveryCode{})
+
+	us := &User{DB: db}
+
+	user := &models.User{Username: "recoverytest", Email: "recovery@test.com", HashedPassword: "x", OtpActive: true}
+	if err := db.Create(user).Error; err != nil {
+		t.Fatalf("create user error = %v", err)
+	}
+
+	codes, err := us.GenerateRecoveryCodes(user.ID)
+	if err != nil {
+		t.Fatalf("GenerateRecoveryCodes() error = %v", err)
+	}
+	if len(codes) != RecoveryCodeCount {
+		t.Fatalf("GenerateRecoveryCodes() = %d codes, want %d", len(codes), RecoveryCodeCount)
+	}
+
+	var stored []string
+	if err = db.Model(&models.RecoveryCode{}).Pluck("code", &stored).Error; err != nil {
+		t.Fatalf("read codes error = %v", err)
+	}
+	for _, v := range stored {
+		if v == codes[0] {
+			t.Errorf("GenerateRecoveryCodes() stored the raw code")
+		}
+	}
+
+	//codes are accepted regardless of case or separators, but only once
+	used, err := us.UseRecoveryCode(user.ID, " "+codes[0]+" ")
+	if err != nil || !used {
+		t.Errorf("UseRecoveryCode() = %v, %v, want true", used, err)
+	}
+	used, err = us.UseRecoveryCode(user.ID, codes[0])
+	if err != nil || used {
+		t.Errorf("UseRecoveryCode() reused = %v, %v, want false", used, err)
+	}
+
+	count, err := us.GetRecoveryCodeCount(user.ID)
+	if err != nil || count != RecoveryCodeCount-1 {
+		t.Errorf("GetRecoveryCodeCount() = %d, %v, want %d", count, err, RecoveryCodeCount-1)
+	}
+
+	//without a second factor, the codes have nothing to recover
+	user.OtpActive = false
+	if err = us.RemoveUnusedRecoveryCodes(user); err != nil {
+		t.Fatalf("RemoveUnusedRecoveryCodes() error = %v", err)
+	}
+	count, err = us.GetRecoveryCodeCount(user.ID)
+	if err != nil || count != 0 {
+		t.Errorf("GetRecoveryCodeCount() = %d, %v, want 0", count, err)
+	}
+}
+
+// COSE algorithm identifier and authenticator data flags the software authenticator uses
+const (
+	coseAlgES256        = -7
+	authDataUserPresent = 0x01
+	authDataAttested    = 0x40
+)
+
+var cborHandle = &codec.CborHandle{}
+
+// softAuthenticator is a software ES256 authenticator which acts like a browser and security key together
+type softAuthenticator struct {
+	key          *ecdsa.PrivateKey
+	credentialId []byte
+	signCount    uint32
+}
+
+func newSoftAuthenticator(t *testing.T) *softAuthenticator {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+	credentialId := make([]byte, 16)
+	_, _ = rand.Read(credentialId)
+	return &softAuthenticator{key: key, credentialId: credentialId}
+}
+
+func (a *softAuthenticator) register(t *testing.T, challenge, origin string) *models.WebAuthnAttestationResponse {
+	clientDataJSON := softClientData(t, "webauthn.create", challenge, origin)
+	authData := a.authData(t, true)
+
+	//packed self attestation, signed by the credential itself
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	signature := a.sign(t, append(append([]byte{}, authData...), clientDataHash[:]...))
+
+	var attestation []byte
+	err := codec.NewEncoderBytes(&attestation, cborHandle).Encode(map[string]interface{}{
+		"fmt":      "packed",
+		"attStmt":  map[string]interface{}{"alg": coseAlgES256, "sig": signature},
+		"authData": authData,
+	})
+	if err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+
+	response := &models.WebAuthnAttestationResponse{Name: "test key"}
+	response.ID = base64.RawURLEncoding.EncodeToString(a.credentialId)
+	response.RawID = a.credentialId
+	response.Type = "public-key"
+	response.AttestationResponse.ClientDataJSON = clientDataJSON
+	response.AttestationResponse.AttestationObject = attestation
+	return response
+}
+
+func (a *softAuthenticator) login(t *testing.T, challenge string) *models.WebAuthnAssertionResponse {
+	a.signCount++
+
+	clientDataJSON := softClientData(t, "webauthn.get", challenge, "http://localhost:8080")
+	authData := a.authData(t, false)
+	clientDataHash := sha256.Sum256(clientDataJSON)
+
+	response := &models.WebAuthnAssertionResponse{}
+	response.ID = base64.RawURLEncoding.EncodeToString(a.credentialId)
+	response.RawID = a.credentialId
+	response.Type = "public-key"
+	response.AssertionResponse.ClientDataJSON = clientDataJSON
+	response.AssertionResponse.AuthenticatorData = authData
+	response.AssertionResponse.Signature = a.sign(t, append(authData, clientDataHash[:]...))
+	return response
+}
+
+func (a *softAuthenticator) authData(t *testing.T, attested bool) []byte {
+	rpIdHash := sha256.Sum256([]byte("localhost"))
+	flags := byte(authDataUserPresent)
+	if attested {
+		flags |= authDataAttested
+	}
+
+	data := append(rpIdHash[:], flags)
+	data = binary.BigEndian.AppendUint32(data, a.signCount)
+	if !attested {
+		return data
+	}
+
+	//aaguid of all zeroes, then the credential id and key
+	data = append(data, make([]byte, 16)...)
+	data = binary.BigEndian.AppendUint16(data, uint16(len(a.credentialId)))
+	data = append(data, a.credentialId...)
+
+	var key []byte
+	err := codec.NewEncoderBytes(&key, cborHandle).Encode(map[int]interface{}{
+		1:  2,
+		3:  coseAlgES256,
+		-1: 1,
+		-2: a.key.X.FillBytes(make([]byte, 32)),
+		-3: a.key.Y.FillBytes(make([]byte, 32)),
+	})
+	if err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+	return append(data, key...)
+}
+
+func (a *softAuthenticator) sign(t *testing.T, data []byte) []byte {
+	hash := sha256.Sum256(data)
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, hash[:])
+	if err != nil {
+		t.Fatalf("SignASN1() error = %v", err)
+	}
+	return signature
+}
+
+func softClientData(t *testing.T, ceremony, challenge, origin string) []byte {
+	data, err := json.Marshal(&protocol.CollectedClientData{Type: protocol.CeremonyType(ceremony), Challenge: challenge, Origin: origin})
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	return data
+}
@@ -29,10 +29,14 @@ import (
 	"net"
 	"os"
 	"path/filepath"
+	"time"
 )
 
 var sftpServer net.Listener
 
+// how often open connections are checked to see if their login was revoked
+const revocationCheckInterval = 15 * time.Second
+
 var auth pufferpanel.SFTPAuthorization
 
 func Run() {
@@ -148,6 +152,10 @@ func handleConn(conn net.Conn, serverConfig *ssh.ServerConfig) error {
 	// The incoming Request channel must be serviced.
 	go PrintDiscardRequests(reqs)
 
+	if checker, ok := auth.(activeChecker); ok {
+		go watchRevocation(sc, checker)
+	}
+
 	// Service the incoming Channel channel.
 	for newChannel := range chans {
 		// Channels have a type, depending on the application level
@@ -192,6 +200,36 @@ func handleConn(conn net.Conn, serverConfig *ssh.ServerConfig) error {
 	return nil
 }
 
+// activeChecker is for authorizations which can tell when a login was revoked after it was made
+type activeChecker interface {
+	IsActive(perms *ssh.Permissions) bool
+}
+
+// watchRevocation closes the connection once the login it was made with is revoked
+func watchRevocation(sc *ssh.ServerConn, checker activeChecker) {
+	done := make(chan struct{})
+	go func() {
+		_ = sc.Wait()
+		close(done)
+	}()
+
+	ticker := time.NewTicker(revocationCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			if !checker.IsActive(sc.Permissions) {
+				logging.Info.Printf("SFTP login for %s was revoked, closing connection", sc.User())
+				_ = sc.Close()
+				return
+			}
+		}
+	}
+}
+
 func PrintDiscardRequests(in <-chan *ssh.Request) {
 	for req := range in {
 		if req.WantReply {
@@ -37,6 +37,17 @@ func ContainsScope(arr []Scope, value Scope) bool {
 	return false
 }
 
+// ContainsExactScope checks for the scope itself, without servers.admin standing in for it
+func ContainsExactScope(arr []Scope, value Scope) bool {
+	for _, v := range arr {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
 func GenerateRandomString(n int) (string, error) {
 	b := make([]byte, n)
 	_, err := rand.Read(b)
@@ -0,0 +1,366 @@
+/*
+ Copyright 2023 Padduck, LLC
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+  	http://www.apache.org/licenses/LICENSE-2.0
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+*/
+
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/pufferpanel/pufferpanel/v2"
+	"github.com/pufferpanel/pufferpanel/v2/middleware"
+	"github.com/pufferpanel/pufferpanel/v2/models"
+	"github.com/pufferpanel/pufferpanel/v2/response"
+	"github.com/pufferpanel/pufferpanel/v2/services"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// @Summary Get your applications
+// @Description Gets the third-party applications you have registered
+// @Accept json
+// @Produce json
+// @Success 200 {object} models.ApplicationsView
+// @Failure 400 {object} response.Error
+// @Failure 403 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Router /api/self/applications [get]
+func getApplications(c *gin.Context) {
+	user := c.MustGet("user").(*models.User)
+
+	db := middleware.GetDatabase(c)
+	as := &services.Application{DB: db}
+
+	apps, err := as.GetForOwner(user.ID)
+	if response.HandleError(c, err, http.StatusInternalServerError) {
+		return
+	}
+
+	c.JSON(http.StatusOK, models.FromApplications(apps))
+}
+
+// @Summary Register an application
+// @Description Registers a third-party application which users can authorize to act for them. Public applications, such as mobile apps, get no secret and must use PKCE alone
+// @Accept json
+// @Produce json
+// @Success 200 {object} models.CreatedApplication
+// @Failure 400 {object} response.Error
+// @Failure 403 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Param application body models.ApplicationView true "Application to register"
+// @Router /api/self/applications [post]
+func createApplication(c *gin.Context) {
+	user := c.MustGet("user").(*models.User)
+
+	db := middleware.GetDatabase(c)
+	as := &services.Application{DB: db}
+
+	view := &models.ApplicationView{}
+	err := c.BindJSON(view)
+	if response.HandleError(c, err, http.StatusBadRequest) {
+		return
+	}
+
+	err = view.Valid(false)
+	if response.HandleError(c, err, http.StatusBadRequest) {
+		return
+	}
+
+	app := &models.Application{OwnerId: user.ID}
+	view.CopyToModel(app)
+
+	secret, err := as.Create(app, view.Public)
+	if response.HandleError(c, err, http.StatusInternalServerError) {
+		return
+	}
+
+	c.JSON(http.StatusOK, &models.CreatedApplication{
+		ClientId:     app.ClientId,
+		ClientSecret: secret,
+	})
+}
+
+// @Summary Update an application
+// @Description Updates one of your applications. Narrowing its scopes does not change what users already authorized
+// @Accept json
+// @Produce json
+// @Success 204 {object} response.Empty
+// @Failure 400 {object} response.Error
+// @Failure 403 {object} response.Error
+// @Failure 404 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Param clientId path string true "Client id"
+// @Param application body models.ApplicationView true "Application information"
+// @Router /api/self/applications/{clientId} [put]
+func updateApplication(c *gin.Context) {
+	app, ok := getApplicationFromRequest(c)
+	if !ok {
+		return
+	}
+
+	db := middleware.GetDatabase(c)
+	as := &services.Application{DB: db}
+
+	view := &models.ApplicationView{}
+	err := c.BindJSON(view)
+	if response.HandleError(c, err, http.StatusBadRequest) {
+		return
+	}
+
+	err = view.Valid(true)
+	if response.HandleError(c, err, http.StatusBadRequest) {
+		return
+	}
+
+	view.CopyToModel(app)
+	err = as.Update(app)
+	if response.HandleError(c, err, http.StatusInternalServerError) {
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// @Summary Delete an application
+// @Description Deletes one of your applications. Every user who authorized it loses it
+// @Accept json
+// @Produce json
+// @Success 204 {object} response.Empty
+// @Failure 400 {object} response.Error
+// @Failure 403 {object} response.Error
+// @Failure 404 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Param clientId path string true "Client id"
+// @Router /api/self/applications/{clientId} [delete]
+func deleteApplication(c *gin.Context) {
+	app, ok := getApplicationFromRequest(c)
+	if !ok {
+		return
+	}
+
+	db := middleware.GetDatabase(c)
+	as := &services.Application{DB: db}
+
+	err := as.Delete(app)
+	if response.HandleError(c, err, http.StatusInternalServerError) {
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// @Summary Get your authorized applications
+// @Description Gets the applications you have let act for you, and what they can do
+// @Accept json
+// @Produce json
+// @Success 200 {object} models.ApplicationAuthorizationsView
+// @Failure 400 {object} response.Error
+// @Failure 403 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Router /api/self/authorizations [get]
+func getAuthorizations(c *gin.Context) {
+	user := c.MustGet("user").(*models.User)
+
+	db := middleware.GetDatabase(c)
+	as := &services.Application{DB: db}
+
+	authorizations, err := as.GetAuthorizationsForUser(user.ID)
+	if response.HandleError(c, err, http.StatusInternalServerError) {
+		return
+	}
+
+	c.JSON(http.StatusOK, models.FromApplicationAuthorizations(authorizations))
+}
+
+// @Summary Revoke an authorized application
+// @Description Stops an application from acting for you. It can no longer get new tokens
+// @Accept json
+// @Produce json
+// @Success 204 {object} response.Empty
+// @Failure 400 {object} response.Error
+// @Failure 403 {object} response.Error
+// @Failure 404 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Param id path uint true "Authorization id"
+// @Router /api/self/authorizations/{id} [delete]
+func deleteAuthorization(c *gin.Context) {
+	user := c.MustGet("user").(*models.User)
+
+	db := middleware.GetDatabase(c)
+	as := &services.Application{DB: db}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if response.HandleError(c, err, http.StatusBadRequest) {
+		return
+	}
+
+	authorization, err := as.GetAuthorizationForUser(user.ID, uint(id))
+	if err == pufferpanel.ErrAuthorizationNotFound {
+		response.HandleError(c, err, http.StatusNotFound)
+		return
+	}
+	if response.HandleError(c, err, http.StatusInternalServerError) {
+		return
+	}
+
+	err = as.Revoke(authorization)
+	if response.HandleError(c, err, http.StatusInternalServerError) {
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// @Summary Get an authorization request
+// @Description Gets what an application is asking to do, so it can be shown to you before you agree. Takes the query the application sent to /oauth2/authorize
+// @Accept json
+// @Produce json
+// @Success 200 {object} models.ConsentView
+// @Failure 400 {object} response.Error
+// @Failure 403 {object} response.Error
+// @Failure 404 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Router /api/self/authorize [get]
+func getAuthorizeRequest(c *gin.Context) {
+	user := c.MustGet("user").(*models.User)
+	if !requireSession(c) {
+		return
+	}
+
+	db := middleware.GetDatabase(c)
+	as := &services.Application{DB: db}
+	us := &services.User{DB: db}
+
+	request := &models.AuthorizeRequest{}
+	err := c.ShouldBindQuery(request)
+	if response.HandleError(c, err, http.StatusBadRequest) {
+		return
+	}
+
+	app, scopes, err := as.ValidateRequest(request)
+	if err == pufferpanel.ErrApplicationNotFound {
+		response.HandleError(c, err, http.StatusNotFound)
+		return
+	}
+	if response.HandleError(c, err, http.StatusBadRequest) {
+		return
+	}
+
+	existing, err := as.GetAuthorization(user.ID, app.ID)
+	if response.HandleError(c, err, http.StatusInternalServerError) {
+		return
+	}
+
+	owner, err := us.GetById(app.OwnerId)
+	if response.HandleError(c, err, http.StatusInternalServerError) {
+		return
+	}
+
+	authorized := existing != nil
+	for _, v := range scopes {
+		if existing != nil && !pufferpanel.ContainsScope(existing.Scopes, v) {
+			authorized = false
+		}
+	}
+
+	c.JSON(http.StatusOK, &models.ConsentView{
+		ClientId:    app.ClientId,
+		Name:        app.Name,
+		Description: app.Description,
+		Owner:       owner.Username,
+		RedirectUri: request.RedirectUri,
+		Scopes:      scopes,
+		Authorized:  authorized,
+	})
+}
+
+// @Summary Answer an authorization request
+// @Description Agrees to or denies what an application asked for. Gives where to send you back to the application
+// @Accept json
+// @Produce json
+// @Success 200 {object} models.AuthorizeResponse
+// @Failure 400 {object} response.Error
+// @Failure 403 {object} response.Error
+// @Failure 404 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Param request body models.AuthorizeRequest true "The request the application made, and if you approve it"
+// @Router /api/self/authorize [post]
+func answerAuthorizeRequest(c *gin.Context) {
+	user := c.MustGet("user").(*models.User)
+	if !requireSession(c) {
+		return
+	}
+
+	db := middleware.GetDatabase(c)
+	as := &services.Application{DB: db}
+
+	request := &models.AuthorizeRequest{}
+	err := c.BindJSON(request)
+	if response.HandleError(c, err, http.StatusBadRequest) {
+		return
+	}
+
+	app, scopes, err := as.ValidateRequest(request)
+	if err == pufferpanel.ErrApplicationNotFound {
+		response.HandleError(c, err, http.StatusNotFound)
+		return
+	}
+	if response.HandleError(c, err, http.StatusBadRequest) {
+		return
+	}
+
+	if !request.Approve {
+		c.JSON(http.StatusOK, &models.AuthorizeResponse{
+			RedirectUri: services.AuthorizeRedirect(request, url.Values{"error": {"access_denied"}}),
+		})
+		return
+	}
+
+	code, err := as.Authorize(user.ID, app, scopes, request.RedirectUri, request.CodeChallenge)
+	if response.HandleError(c, err, http.StatusInternalServerError) {
+		return
+	}
+
+	c.JSON(http.StatusOK, &models.AuthorizeResponse{
+		RedirectUri: services.AuthorizeRedirect(request, url.Values{"code": {code}}),
+	})
+}
+
+func getApplicationFromRequest(c *gin.Context) (*models.Application, bool) {
+	user := c.MustGet("user").(*models.User)
+
+	db := middleware.GetDatabase(c)
+	as := &services.Application{DB: db}
+
+	app, err := as.Get(c.Param("clientId"))
+	if err == nil && app.OwnerId != user.ID {
+		err = pufferpanel.ErrApplicationNotFound
+	}
+	if err == pufferpanel.ErrApplicationNotFound {
+		response.HandleError(c, err, http.StatusNotFound)
+		return nil, false
+	}
+	if response.HandleError(c, err, http.StatusInternalServerError) {
+		return nil, false
+	}
+	return app, true
+}
+
+// requireSession makes sure the user is logged in themselves. Apps and clients acting for the user may not agree to
+// let other apps in
+func requireSession(c *gin.Context) bool {
+	if c.GetUint("sessionId") == 0 {
+		response.HandleError(c, pufferpanel.ErrNoPermission, http.StatusForbidden)
+		return false
+	}
+	return true
+}
@@ -38,6 +38,12 @@ func RegisterRoutes(rg *gin.RouterGroup) {
 	registerSelf(rg.Group("/self", handlers.HasOAuth2Token))
 	registerSettings(rg.Group("/settings", handlers.HasOAuth2Token))
 	registerUserSettings(rg.Group("/userSettings", handlers.HasOAuth2Token))
+	registerRoles(rg.Group("/roles", handlers.HasOAuth2Token))
+	registerTeams(rg.Group("/teams", handlers.HasOAuth2Token))
 
 	rg.GET("/config", panelConfig)
+	//daemons joining the panel have no token yet, the join token is checked instead
+	rg.POST("/nodes/join", joinNode)
+	//nodes use their own token, which is not tied to a user
+	rg.POST("/nodes/events", receiveNodeEvents)
 }
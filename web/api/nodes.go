@@ -14,15 +14,17 @@
 package api
 
 import (
-	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/pufferpanel/pufferpanel/v2"
+	"github.com/pufferpanel/pufferpanel/v2/config"
+	"github.com/pufferpanel/pufferpanel/v2/logging"
 	"github.com/pufferpanel/pufferpanel/v2/middleware"
 	"github.com/pufferpanel/pufferpanel/v2/middleware/handlers"
 	"github.com/pufferpanel/pufferpanel/v2/models"
 	"github.com/pufferpanel/pufferpanel/v2/response"
 	"github.com/pufferpanel/pufferpanel/v2/services"
 	uuid "github.com/satori/go.uuid"
+	"gorm.io/gorm"
 	"net/http"
 	"strconv"
 	"strings"
@@ -38,6 +40,25 @@ func registerNodes(g *gin.RouterGroup) {
 	g.Handle("DELETE", "/:id", handlers.OAuth2Handler(pufferpanel.ScopeNodesEdit, false), deleteNode)
 	g.Handle("OPTIONS", "/:id", response.CreateOptions("PUT", "GET", "POST", "DELETE"))
 
+	g.Handle("GET", "/:id/info", handlers.OAuth2Handler(pufferpanel.ScopeNodesView, false), getNodeInfo)
+	g.Handle("OPTIONS", "/:id/info", response.CreateOptions("GET"))
+
+	g.Handle("GET", "/:id/ports", handlers.OAuth2Handler(pufferpanel.ScopeNodesView, false), getPortPools)
+	g.Handle("POST", "/:id/ports", handlers.OAuth2Handler(pufferpanel.ScopeNodesEdit, false), createPortPool)
+	g.Handle("OPTIONS", "/:id/ports", response.CreateOptions("GET", "POST"))
+
+	g.Handle("DELETE", "/:id/ports/:poolId", handlers.OAuth2Handler(pufferpanel.ScopeNodesEdit, false), deletePortPool)
+	g.Handle("OPTIONS", "/:id/ports/:poolId", response.CreateOptions("DELETE"))
+
+	g.Handle("GET", "/:id/allocations", handlers.OAuth2Handler(pufferpanel.ScopeNodesView, false), getPortAllocations)
+	g.Handle("OPTIONS", "/:id/allocations", response.CreateOptions("GET"))
+
+	g.Handle("POST", "/:id/join", handlers.OAuth2Handler(pufferpanel.ScopeNodesDeploy, false), createJoinToken)
+	g.Handle("OPTIONS", "/:id/join", response.CreateOptions("POST"))
+
+	g.Handle("POST", "/:id/certificate", handlers.OAuth2Handler(pufferpanel.ScopeNodesEdit, false), renewNodeCertificate)
+	g.Handle("OPTIONS", "/:id/certificate", response.CreateOptions("POST"))
+
 	g.Handle("GET", "/:id/deployment", handlers.OAuth2Handler(pufferpanel.ScopeNodesDeploy, false), deployNode)
 	g.Handle("OPTIONS", "/:id/deployment", response.CreateOptions("GET"))
 }
@@ -62,7 +83,15 @@ func getAllNodes(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, models.FromNodes(nodes))
+	result := models.FromNodes(nodes)
+	pls := &services.Placement{DB: db}
+	for k, v := range nodes {
+		if (*result)[k].Usage, err = pls.GetUsage(v); response.HandleError(c, err, http.StatusInternalServerError) {
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, result)
 }
 
 // @Summary Get node
@@ -92,6 +121,10 @@ func getNode(c *gin.Context) {
 	}
 
 	d := models.FromNode(node)
+	pls := &services.Placement{DB: db}
+	if d.Usage, err = pls.GetUsage(node); response.HandleError(c, err, http.StatusInternalServerError) {
+		return
+	}
 	c.JSON(http.StatusOK, d)
 }
 
@@ -207,6 +240,204 @@ func deleteNode(c *gin.Context) {
 	c.Status(http.StatusNoContent)
 }
 
+// @Summary Get node information
+// @Description Asks the node for its version and how loaded its host is
+// @Accept json
+// @Produce json
+// @Success 200 {object} pufferpanel.DaemonInfo
+// @Failure 400 {object} response.Error
+// @Failure 403 {object} response.Error
+// @Failure 404 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Failure 502 {object} response.Error
+// @Param id path string true "Node Id"
+// @Router /api/nodes/{id}/info [get]
+func getNodeInfo(c *gin.Context) {
+	var err error
+	db := middleware.GetDatabase(c)
+	ns := &services.Node{DB: db}
+
+	id, ok := validateId(c)
+	if !ok {
+		return
+	}
+
+	node, err := ns.Get(id)
+	if response.HandleError(c, err, http.StatusInternalServerError) {
+		return
+	}
+
+	info, err := ns.GetInfo(node)
+	if err != nil {
+		logging.Debug.Printf("Error getting info for node %d: %s", node.ID, err)
+		response.HandleError(c, pufferpanel.ErrNodeOffline, http.StatusBadGateway)
+		return
+	}
+
+	c.JSON(http.StatusOK, info)
+}
+
+// @Summary Get port pools
+// @Description Gets the ranges of ports servers on the node are given ports from
+// @Accept json
+// @Produce json
+// @Success 200 {object} models.PortPoolsView
+// @Failure 400 {object} response.Error
+// @Failure 403 {object} response.Error
+// @Failure 404 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Param id path string true "Node Id"
+// @Router /api/nodes/{id}/ports [get]
+func getPortPools(c *gin.Context) {
+	db := middleware.GetDatabase(c)
+	ns := &services.Node{DB: db}
+	ps := &services.Port{DB: db}
+
+	id, ok := validateId(c)
+	if !ok {
+		return
+	}
+
+	node, err := ns.Get(id)
+	if response.HandleError(c, err, http.StatusInternalServerError) {
+		return
+	}
+
+	pools, err := ps.GetPools(node.ID)
+	if response.HandleError(c, err, http.StatusInternalServerError) {
+		return
+	}
+
+	c.JSON(http.StatusOK, models.FromPortPools(pools))
+}
+
+// @Summary Create port pool
+// @Description Adds a range of ports on an IP which servers on the node are given ports from
+// @Accept json
+// @Produce json
+// @Success 200 {object} models.PortPoolView
+// @Failure 400 {object} response.Error
+// @Failure 403 {object} response.Error
+// @Failure 404 {object} response.Error
+// @Failure 409 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Param id path string true "Node Id"
+// @Param pool body models.PortPoolView true "Port pool"
+// @Router /api/nodes/{id}/ports [post]
+func createPortPool(c *gin.Context) {
+	var err error
+	db := middleware.GetDatabase(c)
+	ns := &services.Node{DB: db}
+	ps := &services.Port{DB: db}
+
+	id, ok := validateId(c)
+	if !ok {
+		return
+	}
+
+	viewModel := &models.PortPoolView{}
+	if err = c.BindJSON(viewModel); response.HandleError(c, err, http.StatusBadRequest) {
+		return
+	}
+
+	if err = viewModel.Valid(); response.HandleError(c, err, http.StatusBadRequest) {
+		return
+	}
+
+	node, err := ns.Get(id)
+	if response.HandleError(c, err, http.StatusInternalServerError) {
+		return
+	}
+
+	pool := &models.PortPool{NodeID: node.ID}
+	viewModel.CopyToModel(pool)
+	err = ps.CreatePool(pool)
+	if err == pufferpanel.ErrPortPoolOverlap {
+		response.HandleError(c, err, http.StatusConflict)
+		return
+	} else if response.HandleError(c, err, http.StatusInternalServerError) {
+		return
+	}
+
+	c.JSON(http.StatusOK, models.FromPortPool(pool))
+}
+
+// @Summary Delete port pool
+// @Description Removes a port pool from the node. Servers keep the ports they were given from it
+// @Accept json
+// @Produce json
+// @Success 204 {object} response.Empty
+// @Failure 400 {object} response.Error
+// @Failure 403 {object} response.Error
+// @Failure 404 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Param id path string true "Node Id"
+// @Param poolId path string true "Port pool Id"
+// @Router /api/nodes/{id}/ports/{poolId} [delete]
+func deletePortPool(c *gin.Context) {
+	db := middleware.GetDatabase(c)
+	ps := &services.Port{DB: db}
+
+	id, ok := validateId(c)
+	if !ok {
+		return
+	}
+
+	poolId, err := strconv.Atoi(c.Param("poolId"))
+	if err != nil || poolId <= 0 {
+		response.HandleError(c, pufferpanel.ErrPortPoolNotFound, http.StatusNotFound)
+		return
+	}
+
+	pool, err := ps.GetPool(id, uint(poolId))
+	if err == pufferpanel.ErrPortPoolNotFound {
+		response.HandleError(c, err, http.StatusNotFound)
+		return
+	} else if response.HandleError(c, err, http.StatusInternalServerError) {
+		return
+	}
+
+	if err = ps.DeletePool(pool); response.HandleError(c, err, http.StatusInternalServerError) {
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// @Summary Get port allocations
+// @Description Gets the ports which have been given to servers on the node
+// @Accept json
+// @Produce json
+// @Success 200 {object} models.PortAllocationsView
+// @Failure 400 {object} response.Error
+// @Failure 403 {object} response.Error
+// @Failure 404 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Param id path string true "Node Id"
+// @Router /api/nodes/{id}/allocations [get]
+func getPortAllocations(c *gin.Context) {
+	db := middleware.GetDatabase(c)
+	ns := &services.Node{DB: db}
+	ps := &services.Port{DB: db}
+
+	id, ok := validateId(c)
+	if !ok {
+		return
+	}
+
+	node, err := ns.Get(id)
+	if response.HandleError(c, err, http.StatusInternalServerError) {
+		return
+	}
+
+	allocations, err := ps.GetForNode(node.ID)
+	if response.HandleError(c, err, http.StatusInternalServerError) {
+		return
+	}
+
+	c.JSON(http.StatusOK, models.FromPortAllocations(allocations))
+}
+
 // @Summary Gets the data to deploy a node
 // @Description Gets the secret information needed to deploy a node.
 // @Accept json
@@ -233,12 +464,205 @@ func deployNode(c *gin.Context) {
 		return
 	}
 
-	data := &models.Deployment{
-		ClientId:     fmt.Sprintf(".node_%d", node.ID),
-		ClientSecret: node.Secret,
+	c.JSON(http.StatusOK, ns.GetDeployment(node))
+}
+
+// @Summary Create a join token
+// @Description Creates a token which a daemon can use once to join the panel as this node, using pufferpanel node join
+// @Accept json
+// @Produce json
+// @Success 200 {object} models.JoinTokenResponse
+// @Failure 400 {object} response.Error
+// @Failure 403 {object} response.Error
+// @Failure 404 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Param id path string true "Node Id"
+// @Router /api/nodes/{id}/join [post]
+func createJoinToken(c *gin.Context) {
+	db := middleware.GetDatabase(c)
+	ns := &services.Node{DB: db}
+
+	id, ok := validateId(c)
+	if !ok {
+		return
+	}
+
+	node, err := ns.Get(id)
+	if response.HandleError(c, err, http.StatusInternalServerError) {
+		return
+	}
+
+	joinToken, token, err := ns.CreateJoinToken(node)
+	if err == pufferpanel.ErrNodeInvalid {
+		response.HandleError(c, err, http.StatusBadRequest)
+		return
+	} else if response.HandleError(c, err, http.StatusInternalServerError) {
+		return
+	}
+
+	c.JSON(http.StatusOK, &models.JoinTokenResponse{Token: token, ExpiresAt: joinToken.ExpiresAt})
+}
+
+// @Summary Renew node certificate
+// @Description Has the node make a new key and gives it a new certificate, without waiting for the old one to get close to expiring
+// @Accept json
+// @Produce json
+// @Success 200 {object} models.NodeView
+// @Failure 400 {object} response.Error
+// @Failure 403 {object} response.Error
+// @Failure 404 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Failure 502 {object} response.Error
+// @Param id path string true "Node Id"
+// @Router /api/nodes/{id}/certificate [post]
+func renewNodeCertificate(c *gin.Context) {
+	db := middleware.GetDatabase(c)
+	ns := &services.Node{DB: db}
+
+	id, ok := validateId(c)
+	if !ok {
+		return
+	}
+
+	node, err := ns.Get(id)
+	if response.HandleError(c, err, http.StatusInternalServerError) {
+		return
+	}
+
+	if !node.UsesMTLS() {
+		response.HandleError(c, pufferpanel.ErrMTLSRequired, http.StatusBadRequest)
+		return
+	}
+
+	if err = ns.RenewCertificate(node); response.HandleError(c, err, http.StatusBadGateway) {
+		return
+	}
+
+	c.JSON(http.StatusOK, models.FromNode(node))
+}
+
+// @Summary Join a node
+// @Description Used by a daemon to join the panel with a join token. The token is used up, and the credentials for the node are returned
+// @Accept json
+// @Produce json
+// @Success 200 {object} models.NodeJoinResponse
+// @Failure 400 {object} response.Error
+// @Failure 403 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Param join body models.NodeJoinRequest true "Join request"
+// @Router /api/nodes/join [post]
+func joinNode(c *gin.Context) {
+	var err error
+	db := middleware.GetDatabase(c)
+	ns := &services.Node{DB: db}
+
+	request := &models.NodeJoinRequest{}
+	if err = c.BindJSON(request); response.HandleError(c, err, http.StatusBadRequest) {
+		return
+	}
+
+	if err = request.Valid(); response.HandleError(c, err, http.StatusBadRequest) {
+		return
+	}
+
+	//the token is used up by joining, so anything wrong with the request has to be found first
+	useMTLS := config.NodeMTLSEnabled.Value() && request.CertificateRequest != ""
+	if useMTLS {
+		_, err = pufferpanel.DecodeCertificateRequest([]byte(request.CertificateRequest))
+		if response.HandleError(c, err, http.StatusBadRequest) {
+			return
+		}
+	}
+
+	node, err := ns.Join(request)
+	if err == pufferpanel.ErrJoinTokenInvalid {
+		response.HandleError(c, err, http.StatusForbidden)
+		return
+	} else if response.HandleError(c, err, http.StatusInternalServerError) {
+		return
+	}
+
+	result := &models.NodeJoinResponse{
+		NodeId:     node.ID,
+		Deployment: *ns.GetDeployment(node),
+	}
+
+	if useMTLS {
+		cert, err := ns.IssueCertificate(node, []byte(request.CertificateRequest), request.MTLSPort)
+		if response.HandleError(c, err, http.StatusInternalServerError) {
+			return
+		}
+		ca, err := services.GetCertificateAuthority()
+		if response.HandleError(c, err, http.StatusInternalServerError) {
+			return
+		}
+		result.Certificate = string(pufferpanel.EncodeCertificate(cert))
+		result.CA = string(pufferpanel.EncodeCertificate(ca.Certificate))
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// @Summary Send node events
+// @Description Used by a daemon to tell the panel what happened on it, authenticated with the node's own access token
+// @Accept json
+// @Success 204 {object} nil
+// @Failure 400 {object} response.Error
+// @Failure 401 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Param events body []pufferpanel.PanelEvent true "Events"
+// @Router /api/nodes/events [post]
+func receiveNodeEvents(c *gin.Context) {
+	db := middleware.GetDatabase(c)
+	ns := &services.Node{DB: db}
+
+	nodeId, ok := getCallingNode(c, db)
+	if !ok {
+		return
+	}
+
+	events := make([]pufferpanel.PanelEvent, 0)
+	if err := c.BindJSON(&events); response.HandleError(c, err, http.StatusBadRequest) {
+		return
+	}
+
+	if err := ns.RecordEvents(nodeId, events); response.HandleError(c, err, http.StatusInternalServerError) {
+		return
 	}
 
-	c.JSON(http.StatusOK, data)
+	c.Status(http.StatusNoContent)
+}
+
+// getCallingNode works out which node sent the request from its access token
+func getCallingNode(c *gin.Context, db *gorm.DB) (uint, bool) {
+	auth := strings.TrimSpace(c.GetHeader("Authorization"))
+	if !strings.HasPrefix(auth, "Bearer ") {
+		response.HandleError(c, pufferpanel.ErrMissingAccessToken, http.StatusUnauthorized)
+		return 0, false
+	}
+
+	token, err := services.ParseToken(strings.TrimPrefix(auth, "Bearer "))
+	if err != nil || !token.Valid || !pufferpanel.ContainsExactScope(token.Claims.PanelClaims.Scopes[""], pufferpanel.ScopeOAuth2Auth) {
+		response.HandleError(c, pufferpanel.ErrTokenInvalid, http.StatusUnauthorized)
+		return 0, false
+	}
+
+	nodeId, ok := services.NodeIdFromClientId(token.Claims.PanelClaims.ClientId)
+	if !ok {
+		response.HandleError(c, pufferpanel.ErrTokenInvalid, http.StatusUnauthorized)
+		return 0, false
+	}
+
+	is := &services.Introspection{DB: db}
+	active, err := is.IsActive(token)
+	if response.HandleError(c, err, http.StatusInternalServerError) {
+		return 0, false
+	}
+	if !active {
+		response.HandleError(c, pufferpanel.ErrTokenInvalid, http.StatusUnauthorized)
+		return 0, false
+	}
+	return nodeId, true
 }
 
 func validateId(c *gin.Context) (uint, bool) {
@@ -0,0 +1,358 @@
+/*
+ Copyright 2023 Padduck, LLC
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+ 	http://www.apache.org/licenses/LICENSE-2.0
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/pufferpanel/pufferpanel/v2"
+	"github.com/pufferpanel/pufferpanel/v2/middleware"
+	"github.com/pufferpanel/pufferpanel/v2/middleware/handlers"
+	"github.com/pufferpanel/pufferpanel/v2/models"
+	"github.com/pufferpanel/pufferpanel/v2/response"
+	"github.com/pufferpanel/pufferpanel/v2/services"
+	"github.com/spf13/cast"
+	"gorm.io/gorm"
+	"net/http"
+)
+
+func registerRoles(g *gin.RouterGroup) {
+	g.Handle("GET", "", handlers.OAuth2Handler(pufferpanel.ScopeUsersView, false), getRoles)
+	g.Handle("POST", "", handlers.OAuth2Handler(pufferpanel.ScopeUsersEdit, false), createRole)
+	g.Handle("OPTIONS", "", response.CreateOptions("GET", "POST"))
+
+	g.Handle("GET", "/:id", handlers.OAuth2Handler(pufferpanel.ScopeUsersView, false), getRole)
+	g.Handle("PUT", "/:id", handlers.OAuth2Handler(pufferpanel.ScopeUsersEdit, false), updateRole)
+	g.Handle("DELETE", "/:id", handlers.OAuth2Handler(pufferpanel.ScopeUsersEdit, false), deleteRole)
+	g.Handle("OPTIONS", "/:id", response.CreateOptions("GET", "PUT", "DELETE"))
+
+	g.Handle("GET", "/:id/users", handlers.OAuth2Handler(pufferpanel.ScopeUsersView, false), getRoleUsers)
+	g.Handle("OPTIONS", "/:id/users", response.CreateOptions("GET"))
+
+	g.Handle("PUT", "/:id/users/:userId", handlers.OAuth2Handler(pufferpanel.ScopeUsersEdit, false), assignRole)
+	g.Handle("DELETE", "/:id/users/:userId", handlers.OAuth2Handler(pufferpanel.ScopeUsersEdit, false), unassignRole)
+	g.Handle("OPTIONS", "/:id/users/:userId", response.CreateOptions("PUT", "DELETE"))
+}
+
+// @Summary Get roles
+// @Description Gets all roles defined on the panel
+// @Accept json
+// @Produce json
+// @Success 200 {object} models.RolesView "Roles"
+// @Failure 400 {object} response.Error
+// @Failure 403 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Router /api/roles [get]
+func getRoles(c *gin.Context) {
+	db := middleware.GetDatabase(c)
+	rs := &services.Role{DB: db}
+
+	roles, err := rs.GetAll()
+	if response.HandleError(c, err, http.StatusInternalServerError) {
+		return
+	}
+
+	c.JSON(http.StatusOK, models.FromRoles(roles))
+}
+
+// @Summary Get role
+// @Description Gets a single role
+// @Accept json
+// @Produce json
+// @Success 200 {object} models.RoleView "Role"
+// @Failure 400 {object} response.Error
+// @Failure 403 {object} response.Error
+// @Failure 404 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Param id path uint true "Role Id"
+// @Router /api/roles/{id} [get]
+func getRole(c *gin.Context) {
+	role, ok := getRoleFromRequest(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, models.FromRole(role))
+}
+
+// @Summary Create role
+// @Description Creates a role
+// @Accept json
+// @Produce json
+// @Success 200 {object} models.RoleView "Role created"
+// @Failure 400 {object} response.Error
+// @Failure 403 {object} response.Error
+// @Failure 409 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Param role body models.RoleView true "Role information"
+// @Router /api/roles [post]
+func createRole(c *gin.Context) {
+	var err error
+	db := middleware.GetDatabase(c)
+	rs := &services.Role{DB: db}
+
+	viewModel := &models.RoleView{}
+	if err = c.BindJSON(viewModel); response.HandleError(c, err, http.StatusBadRequest) {
+		return
+	}
+
+	if err = viewModel.Valid(false); response.HandleError(c, err, http.StatusBadRequest) {
+		return
+	}
+
+	role := &models.Role{}
+	viewModel.CopyToModel(role)
+
+	err = rs.Create(role)
+	if err == pufferpanel.ErrRoleExists {
+		response.HandleError(c, err, http.StatusConflict)
+		return
+	} else if response.HandleError(c, err, http.StatusInternalServerError) {
+		return
+	}
+
+	c.JSON(http.StatusOK, models.FromRole(role))
+}
+
+// @Summary Update role
+// @Description Updates a role. Built in roles cannot be updated
+// @Accept json
+// @Produce json
+// @Success 204 {object} response.Empty
+// @Failure 400 {object} response.Error
+// @Failure 403 {object} response.Error
+// @Failure 404 {object} response.Error
+// @Failure 409 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Param id path uint true "Role Id"
+// @Param role body models.RoleView true "Role information"
+// @Router /api/roles/{id} [put]
+func updateRole(c *gin.Context) {
+	var err error
+	db := middleware.GetDatabase(c)
+	rs := &services.Role{DB: db}
+
+	viewModel := &models.RoleView{}
+	if err = c.BindJSON(viewModel); response.HandleError(c, err, http.StatusBadRequest) {
+		return
+	}
+
+	if err = viewModel.Valid(true); response.HandleError(c, err, http.StatusBadRequest) {
+		return
+	}
+
+	role, ok := getRoleFromRequest(c)
+	if !ok {
+		return
+	}
+
+	if role.BuiltIn {
+		response.HandleError(c, pufferpanel.ErrRoleBuiltIn, http.StatusBadRequest)
+		return
+	}
+
+	viewModel.CopyToModel(role)
+
+	err = rs.Update(role)
+	if err == pufferpanel.ErrRoleExists {
+		response.HandleError(c, err, http.StatusConflict)
+		return
+	} else if response.HandleError(c, err, http.StatusInternalServerError) {
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// @Summary Delete role
+// @Description Deletes a role and removes it from every user it was assigned to. Built in roles cannot be deleted
+// @Accept json
+// @Produce json
+// @Success 204 {object} response.Empty
+// @Failure 400 {object} response.Error
+// @Failure 403 {object} response.Error
+// @Failure 404 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Param id path uint true "Role Id"
+// @Router /api/roles/{id} [delete]
+func deleteRole(c *gin.Context) {
+	db := middleware.GetDatabase(c)
+	rs := &services.Role{DB: db}
+
+	role, ok := getRoleFromRequest(c)
+	if !ok {
+		return
+	}
+
+	err := rs.Delete(role)
+	if err == pufferpanel.ErrRoleBuiltIn {
+		response.HandleError(c, err, http.StatusBadRequest)
+		return
+	} else if response.HandleError(c, err, http.StatusInternalServerError) {
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// @Summary Get role users
+// @Description Gets the users a role has been assigned to, and which server if it is not global
+// @Accept json
+// @Produce json
+// @Success 200 {object} models.RoleAssignmentsView
+// @Failure 400 {object} response.Error
+// @Failure 403 {object} response.Error
+// @Failure 404 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Param id path uint true "Role Id"
+// @Router /api/roles/{id}/users [get]
+func getRoleUsers(c *gin.Context) {
+	db := middleware.GetDatabase(c)
+	rs := &services.Role{DB: db}
+
+	role, ok := getRoleFromRequest(c)
+	if !ok {
+		return
+	}
+
+	assignments, err := rs.GetAssignments(role.ID)
+	if response.HandleError(c, err, http.StatusInternalServerError) {
+		return
+	}
+
+	c.JSON(http.StatusOK, models.FromRoleAssignments(assignments))
+}
+
+// @Summary Assign role
+// @Description Assigns a role to a user, either globally or for the given server
+// @Accept json
+// @Produce json
+// @Success 204 {object} response.Empty
+// @Failure 400 {object} response.Error
+// @Failure 403 {object} response.Error
+// @Failure 404 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Param id path uint true "Role Id"
+// @Param userId path uint true "User Id"
+// @Param server query string false "Server to assign the role for"
+// @Router /api/roles/{id}/users/{userId} [put]
+func assignRole(c *gin.Context) {
+	db := middleware.GetDatabase(c)
+	rs := &services.Role{DB: db}
+
+	role, ok := getRoleFromRequest(c)
+	if !ok {
+		return
+	}
+
+	user, serverId, ok := getRoleTargetFromRequest(c)
+	if !ok {
+		return
+	}
+
+	err := rs.Assign(role.ID, user.ID, serverId)
+	if response.HandleError(c, err, http.StatusInternalServerError) {
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// @Summary Unassign role
+// @Description Removes a role from a user, either globally or for the given server
+// @Accept json
+// @Produce json
+// @Success 204 {object} response.Empty
+// @Failure 400 {object} response.Error
+// @Failure 403 {object} response.Error
+// @Failure 404 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Param id path uint true "Role Id"
+// @Param userId path uint true "User Id"
+// @Param server query string false "Server the role was assigned for"
+// @Router /api/roles/{id}/users/{userId} [delete]
+func unassignRole(c *gin.Context) {
+	db := middleware.GetDatabase(c)
+	rs := &services.Role{DB: db}
+
+	role, ok := getRoleFromRequest(c)
+	if !ok {
+		return
+	}
+
+	user, serverId, ok := getRoleTargetFromRequest(c)
+	if !ok {
+		return
+	}
+
+	err := rs.Unassign(role.ID, user.ID, serverId)
+	if response.HandleError(c, err, http.StatusInternalServerError) {
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func getRoleFromRequest(c *gin.Context) (*models.Role, bool) {
+	db := middleware.GetDatabase(c)
+	rs := &services.Role{DB: db}
+
+	id, ok := validateId(c)
+	if !ok {
+		return nil, false
+	}
+
+	role, err := rs.Get(id)
+	if err == pufferpanel.ErrRoleNotFound {
+		c.AbortWithStatus(http.StatusNotFound)
+		return nil, false
+	} else if response.HandleError(c, err, http.StatusInternalServerError) {
+		return nil, false
+	}
+
+	return role, true
+}
+
+func getRoleTargetFromRequest(c *gin.Context) (*models.User, *string, bool) {
+	db := middleware.GetDatabase(c)
+	us := &services.User{DB: db}
+	ss := &services.Server{DB: db}
+
+	userId, err := cast.ToUintE(c.Param("userId"))
+	if response.HandleError(c, err, http.StatusBadRequest) {
+		return nil, nil, false
+	}
+
+	user, err := us.GetById(userId)
+	if err != nil && err == gorm.ErrRecordNotFound {
+		c.AbortWithStatus(http.StatusNotFound)
+		return nil, nil, false
+	} else if response.HandleError(c, err, http.StatusInternalServerError) {
+		return nil, nil, false
+	}
+
+	serverId := c.Query("server")
+	if serverId == "" {
+		return user, nil, true
+	}
+
+	server, err := ss.Get(serverId)
+	if err != nil && err == gorm.ErrRecordNotFound {
+		response.HandleError(c, pufferpanel.ErrServerNotFound, http.StatusNotFound)
+		return nil, nil, false
+	} else if response.HandleError(c, err, http.StatusInternalServerError) {
+		return nil, nil, false
+	}
+
+	return user, &server.Identifier, true
+}
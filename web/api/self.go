@@ -24,6 +24,7 @@ import (
 	"github.com/pufferpanel/pufferpanel/v2/services"
 	uuid "github.com/satori/go.uuid"
 	"net/http"
+	"strconv"
 )
 
 func registerSelf(g *gin.RouterGroup) {
@@ -39,12 +40,51 @@ func registerSelf(g *gin.RouterGroup) {
 	g.Handle("DELETE", "/otp/:token", handlers.OAuth2Handler(pufferpanel.ScopeNone, false), disableOtp)
 	g.Handle("OPTIONS", "/otp/:token", response.CreateOptions("DELETE"))
 
+	g.Handle("POST", "/recovery", handlers.OAuth2Handler(pufferpanel.ScopeNone, false), regenerateRecoveryCodes)
+	g.Handle("OPTIONS", "/recovery", response.CreateOptions("POST"))
+
+	g.Handle("GET", "/webauthn", handlers.OAuth2Handler(pufferpanel.ScopeNone, false), getWebAuthnCredentials)
+	g.Handle("POST", "/webauthn", handlers.OAuth2Handler(pufferpanel.ScopeNone, false), startWebAuthnRegistration)
+	g.Handle("PUT", "/webauthn", handlers.OAuth2Handler(pufferpanel.ScopeNone, false), finishWebAuthnRegistration)
+	g.Handle("OPTIONS", "/webauthn", response.CreateOptions("GET", "POST", "PUT"))
+
+	g.Handle("DELETE", "/webauthn/:id", handlers.OAuth2Handler(pufferpanel.ScopeNone, false), deleteWebAuthnCredential)
+	g.Handle("OPTIONS", "/webauthn/:id", response.CreateOptions("DELETE"))
+
+	g.Handle("GET", "/sessions", handlers.OAuth2Handler(pufferpanel.ScopeNone, false), getSessions)
+	g.Handle("DELETE", "/sessions", handlers.OAuth2Handler(pufferpanel.ScopeNone, false), deleteOtherSessions)
+	g.Handle("OPTIONS", "/sessions", response.CreateOptions("GET", "DELETE"))
+
+	g.Handle("DELETE", "/sessions/:id", handlers.OAuth2Handler(pufferpanel.ScopeNone, false), deleteSession)
+	g.Handle("OPTIONS", "/sessions/:id", response.CreateOptions("DELETE"))
+
 	g.Handle("GET", "/oauth2", handlers.OAuth2Handler(pufferpanel.ScopeNone, false), getPersonalOAuth2Clients)
 	g.Handle("POST", "/oauth2", handlers.OAuth2Handler(pufferpanel.ScopeNone, false), createPersonalOAuth2Client)
 	g.Handle("OPTIONS", "/oauth2", response.CreateOptions("GET", "POST"))
 
 	g.Handle("DELETE", "/oauth2/:clientId", handlers.OAuth2Handler(pufferpanel.ScopeNone, false), deletePersonalOAuth2Client)
 	g.Handle("OPTIONS", "/oauth2/:clientId", response.CreateOptions("DELETE"))
+
+	g.Handle("GET", "/applications", handlers.OAuth2Handler(pufferpanel.ScopeNone, false), getApplications)
+	g.Handle("POST", "/applications", handlers.OAuth2Handler(pufferpanel.ScopeNone, false), createApplication)
+	g.Handle("OPTIONS", "/applications", response.CreateOptions("GET", "POST"))
+
+	g.Handle("PUT", "/applications/:clientId", handlers.OAuth2Handler(pufferpanel.ScopeNone, false), updateApplication)
+	g.Handle("DELETE", "/applications/:clientId", handlers.OAuth2Handler(pufferpanel.ScopeNone, false), deleteApplication)
+	g.Handle("OPTIONS", "/applications/:clientId", response.CreateOptions("PUT", "DELETE"))
+
+	g.Handle("GET", "/authorizations", handlers.OAuth2Handler(pufferpanel.ScopeNone, false), getAuthorizations)
+	g.Handle("OPTIONS", "/authorizations", response.CreateOptions("GET"))
+
+	g.Handle("DELETE", "/authorizations/:id", handlers.OAuth2Handler(pufferpanel.ScopeNone, false), deleteAuthorization)
+	g.Handle("OPTIONS", "/authorizations/:id", response.CreateOptions("DELETE"))
+
+	g.Handle("GET", "/authorize", handlers.OAuth2Handler(pufferpanel.ScopeNone, false), getAuthorizeRequest)
+	g.Handle("POST", "/authorize", handlers.OAuth2Handler(pufferpanel.ScopeNone, false), answerAuthorizeRequest)
+	g.Handle("OPTIONS", "/authorize", response.CreateOptions("GET", "POST"))
+
+	g.Handle("POST", "/invites/:token", handlers.OAuth2Handler(pufferpanel.ScopeNone, false), acceptTeamInvite)
+	g.Handle("OPTIONS", "/invites/:token", response.CreateOptions("POST"))
 }
 
 // @Summary Get your user info
@@ -141,7 +181,14 @@ func updateSelf(c *gin.Context) {
 	}
 
 	if passwordChanged {
-		err := services.GetEmailService().SendEmail(user.Email, "passwordChanged", nil, true)
+		//keep this session, but log out everywhere else
+		ss := &services.Session{DB: db}
+		err := ss.RevokeAllForUser(user.ID, c.GetUint("sessionId"))
+		if response.HandleError(c, err, http.StatusInternalServerError) {
+			return
+		}
+
+		err = services.GetEmailService().SendEmail(user.Email, "passwordChanged", nil, true)
 		if err != nil {
 			logging.Error.Printf("Error sending email: %s\n", err)
 		}
@@ -153,6 +200,7 @@ func updateSelf(c *gin.Context) {
 func getOtpStatus(c *gin.Context) {
 	db := middleware.GetDatabase(c)
 	us := &services.User{DB: db}
+	ws := &services.WebAuthn{DB: db}
 
 	t, exist := c.Get("user")
 	user, ok := t.(*models.User)
@@ -167,8 +215,20 @@ func getOtpStatus(c *gin.Context) {
 		return
 	}
 
+	webAuthnEnabled, err := ws.HasCredentials(user.ID)
+	if response.HandleError(c, err, http.StatusInternalServerError) {
+		return
+	}
+
+	recoveryCodes, err := us.GetRecoveryCodeCount(user.ID)
+	if response.HandleError(c, err, http.StatusInternalServerError) {
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
-		"otpEnabled": otpEnabled,
+		"otpEnabled":      otpEnabled,
+		"webauthnEnabled": webAuthnEnabled,
+		"recoveryCodes":   recoveryCodes,
 	})
 }
 
@@ -214,7 +274,7 @@ func validateOtpEnroll(c *gin.Context) {
 		return
 	}
 
-	err = us.ValidateOtpEnroll(user.ID, request.Token)
+	recoveryCodes, err := us.ValidateOtpEnroll(user.ID, request.Token)
 	if err == pufferpanel.ErrInvalidCredentials {
 		response.HandleError(c, err, http.StatusBadRequest)
 		return
@@ -227,7 +287,7 @@ func validateOtpEnroll(c *gin.Context) {
 	if err != nil {
 		logging.Error.Printf("Error sending email: %s\n", err)
 	}
-	c.Status(http.StatusNoContent)
+	c.JSON(http.StatusOK, &RecoveryCodesResponse{RecoveryCodes: recoveryCodes})
 }
 
 func disableOtp(c *gin.Context) {
@@ -258,6 +318,245 @@ func disableOtp(c *gin.Context) {
 	c.Status(http.StatusNoContent)
 }
 
+// @Summary Regenerate recovery codes
+// @Description Replaces your recovery codes with new ones. Recovery codes can be used once each in place of your second factor
+// @Accept json
+// @Produce json
+// @Success 200 {object} api.RecoveryCodesResponse
+// @Failure 400 {object} response.Error
+// @Failure 403 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Param body body api.ReauthenticateRequest true "Current password or OTP token"
+// @Router /api/self/recovery [post]
+func regenerateRecoveryCodes(c *gin.Context) {
+	db := middleware.GetDatabase(c)
+	us := &services.User{DB: db}
+
+	t, exist := c.Get("user")
+	user, ok := t.(*models.User)
+
+	if !exist || !ok {
+		response.HandleError(c, pufferpanel.ErrUnknownError, http.StatusInternalServerError)
+		return
+	}
+
+	if !reauthenticate(c, us, user) {
+		return
+	}
+
+	hasSecondFactor, err := us.HasSecondFactor(user)
+	if response.HandleError(c, err, http.StatusInternalServerError) {
+		return
+	}
+	if !hasSecondFactor {
+		response.HandleError(c, pufferpanel.ErrSecondFactorRequired, http.StatusBadRequest)
+		return
+	}
+
+	recoveryCodes, err := us.GenerateRecoveryCodes(user.ID)
+	if response.HandleError(c, err, http.StatusInternalServerError) {
+		return
+	}
+
+	c.JSON(http.StatusOK, &RecoveryCodesResponse{RecoveryCodes: recoveryCodes})
+}
+
+// @Summary Get your security keys
+// @Description Gets the security keys and passkeys registered as your second factor
+// @Accept json
+// @Produce json
+// @Success 200 {object} models.WebAuthnCredentialsView
+// @Failure 400 {object} response.Error
+// @Failure 403 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Router /api/self/webauthn [get]
+func getWebAuthnCredentials(c *gin.Context) {
+	db := middleware.GetDatabase(c)
+	ws := &services.WebAuthn{DB: db}
+
+	t, exist := c.Get("user")
+	user, ok := t.(*models.User)
+
+	if !exist || !ok {
+		response.HandleError(c, pufferpanel.ErrUnknownError, http.StatusInternalServerError)
+		return
+	}
+
+	credentials, err := ws.GetCredentials(user.ID)
+	if response.HandleError(c, err, http.StatusInternalServerError) {
+		return
+	}
+
+	c.JSON(http.StatusOK, models.FromWebAuthnCredentials(credentials))
+}
+
+// @Summary Start security key registration
+// @Description Gets the options to pass to navigator.credentials.create. The registration must be finished within 5 minutes
+// @Accept json
+// @Produce json
+// @Success 200 {object} protocol.PublicKeyCredentialCreationOptions
+// @Failure 400 {object} response.Error
+// @Failure 403 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Router /api/self/webauthn [post]
+func startWebAuthnRegistration(c *gin.Context) {
+	db := middleware.GetDatabase(c)
+	ws := &services.WebAuthn{DB: db}
+
+	t, exist := c.Get("user")
+	user, ok := t.(*models.User)
+
+	if !exist || !ok {
+		response.HandleError(c, pufferpanel.ErrUnknownError, http.StatusInternalServerError)
+		return
+	}
+
+	options, err := ws.BeginRegistration(user)
+	if response.HandleError(c, err, http.StatusInternalServerError) {
+		return
+	}
+
+	c.JSON(http.StatusOK, options)
+}
+
+// @Summary Finish security key registration
+// @Description Registers the credential the browser created. If this is your first second factor, recovery codes are also returned
+// @Accept json
+// @Produce json
+// @Success 200 {object} api.WebAuthnRegisteredResponse
+// @Failure 400 {object} response.Error
+// @Failure 403 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Param credential body models.WebAuthnAttestationResponse true "Credential from the browser"
+// @Router /api/self/webauthn [put]
+func finishWebAuthnRegistration(c *gin.Context) {
+	db := middleware.GetDatabase(c)
+	us := &services.User{DB: db}
+	ws := &services.WebAuthn{DB: db}
+
+	t, exist := c.Get("user")
+	user, ok := t.(*models.User)
+
+	if !exist || !ok {
+		response.HandleError(c, pufferpanel.ErrUnknownError, http.StatusInternalServerError)
+		return
+	}
+
+	request := &models.WebAuthnAttestationResponse{}
+	err := c.BindJSON(request)
+	if response.HandleError(c, err, http.StatusBadRequest) {
+		return
+	}
+
+	hadSecondFactor, err := us.HasSecondFactor(user)
+	if response.HandleError(c, err, http.StatusInternalServerError) {
+		return
+	}
+
+	credential, err := ws.FinishRegistration(user, request)
+	if err == pufferpanel.ErrWebAuthnInvalid || err == pufferpanel.ErrWebAuthnExists {
+		response.HandleError(c, err, http.StatusBadRequest)
+		return
+	}
+	if response.HandleError(c, err, http.StatusInternalServerError) {
+		return
+	}
+
+	res := &WebAuthnRegisteredResponse{}
+	res.Credential = models.FromWebAuthnCredential(credential)
+
+	if !hadSecondFactor {
+		res.RecoveryCodes, err = us.GenerateRecoveryCodes(user.ID)
+		if response.HandleError(c, err, http.StatusInternalServerError) {
+			return
+		}
+	}
+
+	err = services.GetEmailService().SendEmail(user.Email, "webauthnAdded", map[string]interface{}{
+		"NAME": credential.Name,
+	}, true)
+	if err != nil {
+		logging.Error.Printf("Error sending email: %s\n", err)
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+// @Summary Remove a security key
+// @Accept json
+// @Produce json
+// @Success 204 {object} response.Empty
+// @Failure 400 {object} response.Error
+// @Failure 403 {object} response.Error
+// @Failure 404 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Param id path uint true "Security key id"
+// @Param body body api.ReauthenticateRequest true "Current password or OTP token"
+// @Router /api/self/webauthn/{id} [delete]
+func deleteWebAuthnCredential(c *gin.Context) {
+	db := middleware.GetDatabase(c)
+	us := &services.User{DB: db}
+	ws := &services.WebAuthn{DB: db}
+
+	t, exist := c.Get("user")
+	user, ok := t.(*models.User)
+
+	if !exist || !ok {
+		response.HandleError(c, pufferpanel.ErrUnknownError, http.StatusInternalServerError)
+		return
+	}
+
+	if !reauthenticate(c, us, user) {
+		return
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if response.HandleError(c, err, http.StatusBadRequest) {
+		return
+	}
+
+	credential, err := ws.GetCredential(user.ID, uint(id))
+	if err == pufferpanel.ErrWebAuthnNotFound {
+		response.HandleError(c, err, http.StatusNotFound)
+		return
+	}
+	if response.HandleError(c, err, http.StatusInternalServerError) {
+		return
+	}
+
+	err = ws.DeleteCredential(credential)
+	if response.HandleError(c, err, http.StatusInternalServerError) {
+		return
+	}
+
+	err = us.RemoveUnusedRecoveryCodes(user)
+	if response.HandleError(c, err, http.StatusInternalServerError) {
+		return
+	}
+
+	err = services.GetEmailService().SendEmail(user.Email, "webauthnRemoved", map[string]interface{}{
+		"NAME": credential.Name,
+	}, true)
+	if err != nil {
+		logging.Error.Printf("Error sending email: %s\n", err)
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// reauthenticate reads the password or OTP token from the body and checks it belongs to the user
+func reauthenticate(c *gin.Context, us *services.User, user *models.User) bool {
+	request := &ReauthenticateRequest{}
+	err := c.BindJSON(request)
+	if response.HandleError(c, err, http.StatusBadRequest) {
+		return false
+	}
+
+	if !us.Reauthenticate(user, request.Password, request.Token) {
+		response.HandleError(c, pufferpanel.ErrInvalidCredentials, http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
 // @Summary Gets registered oauth2 clients under this user
 // @Accept json
 // @Produce json
@@ -386,3 +685,152 @@ func deletePersonalOAuth2Client(c *gin.Context) {
 type ValidateOtpRequest struct {
 	Token string `json:"token"`
 }
+
+// ReauthenticateRequest proves the caller is the user, by their current password or an OTP token
+type ReauthenticateRequest struct {
+	Password string `json:"password,omitempty"`
+	Token    string `json:"token,omitempty"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
+type WebAuthnRegisteredResponse struct {
+	Credential    *models.WebAuthnCredentialView `json:"credential"`
+	RecoveryCodes []string                       `json:"recoveryCodes,omitempty"`
+}
+
+// @Summary Accept team invite
+// @Description Joins the team the invite was for. The invite must have been sent to your email
+// @Accept json
+// @Produce json
+// @Success 200 {object} models.TeamView
+// @Failure 400 {object} response.Error
+// @Failure 403 {object} response.Error
+// @Failure 404 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Param token path string true "Invite token"
+// @Router /api/self/invites/{token} [post]
+func acceptTeamInvite(c *gin.Context) {
+	db := middleware.GetDatabase(c)
+	ts := &services.Team{DB: db}
+
+	user := c.MustGet("user").(*models.User)
+
+	team, err := ts.AcceptInvite(c.Param("token"), user)
+	if err == pufferpanel.ErrInviteInvalid || err == pufferpanel.ErrTeamMemberLimit {
+		response.HandleError(c, err, http.StatusBadRequest)
+		return
+	} else if response.HandleError(c, err, http.StatusInternalServerError) {
+		return
+	}
+
+	c.JSON(http.StatusOK, models.FromTeam(team))
+}
+
+// @Summary Get your sessions
+// @Description Gets where you are logged in. The session making the request is marked as current
+// @Accept json
+// @Produce json
+// @Success 200 {object} models.SessionsView
+// @Failure 400 {object} response.Error
+// @Failure 403 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Router /api/self/sessions [get]
+func getSessions(c *gin.Context) {
+	db := middleware.GetDatabase(c)
+	ss := &services.Session{DB: db}
+
+	t, exist := c.Get("user")
+	user, ok := t.(*models.User)
+
+	if !exist || !ok {
+		response.HandleError(c, pufferpanel.ErrUnknownError, http.StatusInternalServerError)
+		return
+	}
+
+	sessions, err := ss.GetForUser(user.ID)
+	if response.HandleError(c, err, http.StatusInternalServerError) {
+		return
+	}
+
+	c.JSON(http.StatusOK, models.FromSessions(sessions, c.GetUint("sessionId")))
+}
+
+// @Summary Log out other sessions
+// @Description Ends every one of your sessions except the one making the request
+// @Accept json
+// @Produce json
+// @Success 204 {object} response.Empty
+// @Failure 400 {object} response.Error
+// @Failure 403 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Router /api/self/sessions [delete]
+func deleteOtherSessions(c *gin.Context) {
+	db := middleware.GetDatabase(c)
+	ss := &services.Session{DB: db}
+
+	t, exist := c.Get("user")
+	user, ok := t.(*models.User)
+
+	if !exist || !ok {
+		response.HandleError(c, pufferpanel.ErrUnknownError, http.StatusInternalServerError)
+		return
+	}
+
+	err := ss.RevokeAllForUser(user.ID, c.GetUint("sessionId"))
+	if response.HandleError(c, err, http.StatusInternalServerError) {
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// @Summary Log out a session
+// @Description Ends one of your sessions. This can be the one making the request
+// @Accept json
+// @Produce json
+// @Success 204 {object} response.Empty
+// @Failure 400 {object} response.Error
+// @Failure 403 {object} response.Error
+// @Failure 404 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Param id path uint true "Session id"
+// @Router /api/self/sessions/{id} [delete]
+func deleteSession(c *gin.Context) {
+	db := middleware.GetDatabase(c)
+	ss := &services.Session{DB: db}
+
+	t, exist := c.Get("user")
+	user, ok := t.(*models.User)
+
+	if !exist || !ok {
+		response.HandleError(c, pufferpanel.ErrUnknownError, http.StatusInternalServerError)
+		return
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if response.HandleError(c, err, http.StatusBadRequest) {
+		return
+	}
+
+	session, err := ss.Get(uint(id))
+	if err == nil && session.UserId != user.ID {
+		err = pufferpanel.ErrSessionNotFound
+	}
+	if err == pufferpanel.ErrSessionNotFound {
+		response.HandleError(c, err, http.StatusNotFound)
+		return
+	}
+	if response.HandleError(c, err, http.StatusInternalServerError) {
+		return
+	}
+
+	err = ss.Revoke(session)
+	if response.HandleError(c, err, http.StatusInternalServerError) {
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -47,6 +47,16 @@ func registerServers(g *gin.RouterGroup) {
 	g.Handle("PUT", "/:serverId/name/:name", handlers.OAuth2Handler(pufferpanel.ScopeServersEdit, true), middleware.HasTransaction, renameServer)
 	g.Handle("OPTIONS", "/:serverId", response.CreateOptions("PUT", "GET", "POST", "DELETE"))
 
+	g.Handle("POST", "/bulk", handlers.OAuth2Handler(pufferpanel.ScopeNone, false), startBulkAction)
+	g.Handle("OPTIONS", "/bulk", response.CreateOptions("POST"))
+
+	g.Handle("GET", "/bulk/:jobId", handlers.OAuth2Handler(pufferpanel.ScopeNone, false), getBulkJob)
+	g.Handle("OPTIONS", "/bulk/:jobId", response.CreateOptions("GET"))
+
+	g.Handle("GET", "/:serverId/transfer", handlers.OAuth2Handler(pufferpanel.ScopeServersTransfer, true), getServerTransfer)
+	g.Handle("POST", "/:serverId/transfer", handlers.OAuth2Handler(pufferpanel.ScopeServersTransfer, true), transferServer)
+	g.Handle("OPTIONS", "/:serverId/transfer", response.CreateOptions("GET", "POST"))
+
 	g.Handle("GET", "/:serverId/user", handlers.OAuth2Handler(pufferpanel.ScopeServersEditUsers, true), getServerUsers)
 	g.Handle("OPTIONS", "/:serverId/user", response.CreateOptions("GET"))
 
@@ -114,19 +124,11 @@ func searchServers(c *gin.Context) {
 
 	user := c.MustGet("user").(*models.User)
 
-	perms, err := ps.GetForUser(user.ID)
+	isAdmin, err := ps.IsAdmin(user.ID)
 	if response.HandleError(c, err, http.StatusInternalServerError) {
 		return
 	}
 
-	isAdmin := false
-	for _, p := range perms {
-		if p.Admin {
-			isAdmin = true
-			break
-		}
-	}
-
 	if !isAdmin && username != "" && user.Username != username {
 		c.JSON(http.StatusOK, &models.ServerSearchResponse{
 			Servers: []*models.ServerView{},
@@ -256,12 +258,34 @@ func createServer(c *gin.Context) {
 		return
 	}
 
-	node, err := ns.Get(postBody.NodeId)
+	pls := &services.Placement{DB: db}
+	allocation := services.AllocationFor(&postBody.Server)
 
-	if gorm.ErrRecordNotFound == err {
-		response.HandleError(c, pufferpanel.ErrNodeInvalid, http.StatusBadRequest)
-	} else if response.HandleError(c, err, http.StatusInternalServerError) {
-		return
+	var node *models.Node
+	if postBody.NodeId == nil {
+		node, err = pls.ChooseNode(allocation, postBody.Placement, postBody.Tags)
+		if err == pufferpanel.ErrNoNodeAvailable {
+			response.HandleError(c, err, http.StatusConflict)
+			return
+		} else if response.HandleError(c, err, http.StatusBadRequest) {
+			return
+		}
+	} else {
+		node, err = ns.Get(*postBody.NodeId)
+		if gorm.ErrRecordNotFound == err {
+			response.HandleError(c, pufferpanel.ErrNodeInvalid, http.StatusBadRequest)
+			return
+		} else if response.HandleError(c, err, http.StatusInternalServerError) {
+			return
+		}
+
+		err = pls.CanFit(node, allocation)
+		if err == pufferpanel.ErrNodeFull {
+			response.HandleError(c, err, http.StatusConflict)
+			return
+		} else if response.HandleError(c, err, http.StatusInternalServerError) {
+			return
+		}
 	}
 
 	port, err := getFromDataOrDefault(postBody.Variables, "port", uint16(0))
@@ -285,6 +309,57 @@ func createServer(c *gin.Context) {
 		IP:         ip.(string),
 		Port:       port.(uint16),
 		Type:       postBody.Type.Type,
+		Memory:     allocation.Memory,
+		Cpu:        allocation.Cpu,
+		Disk:       allocation.Disk,
+	}
+
+	if postBody.TeamId != 0 {
+		ts := &services.Team{DB: db}
+		team, err := ts.Get(postBody.TeamId)
+		if err == pufferpanel.ErrTeamNotFound {
+			response.HandleError(c, err, http.StatusBadRequest)
+			return
+		} else if response.HandleError(c, err, http.StatusInternalServerError) {
+			return
+		}
+
+		//only managers of the team may put servers in it
+		creator := c.MustGet("user").(*models.User)
+		isAdmin, err := ps.IsAdmin(creator.ID)
+		if response.HandleError(c, err, http.StatusInternalServerError) {
+			return
+		}
+		if !isAdmin {
+			isManager, err := ts.IsManager(team.ID, creator.ID)
+			if response.HandleError(c, err, http.StatusInternalServerError) {
+				return
+			}
+			if !isManager {
+				response.HandleError(c, pufferpanel.ErrNoPermission, http.StatusForbidden)
+				return
+			}
+		}
+
+		if err = ts.CanAddServer(team); response.HandleError(c, err, http.StatusBadRequest) {
+			return
+		}
+
+		server.TeamId = &team.ID
+	}
+
+	pos := &services.Port{DB: db}
+	ports, err := pos.AllocateForServer(node.ID, server.Identifier, postBody.PortNames, server.IP, server.Port)
+	if _, ok := err.(*pufferpanel.Error); ok {
+		response.HandleError(c, err, http.StatusConflict)
+		return
+	} else if response.HandleError(c, err, http.StatusInternalServerError) {
+		return
+	}
+	setPortVariables(&postBody.Server, ports)
+	if len(ports) > 0 {
+		server.IP = ports[0].IP
+		server.Port = ports[0].Port
 	}
 
 	users := make([]*models.User, len(postBody.Users))
@@ -317,6 +392,15 @@ func createServer(c *gin.Context) {
 		}
 	}
 
+	//servers of the same owner can share a network on the node
+	postBody.Server.Owner, err = ss.GetOwner(server)
+	if response.HandleError(c, err, http.StatusInternalServerError) {
+		return
+	}
+	if postBody.Server.Owner == "" {
+		postBody.Server.Owner = "user-" + strconv.FormatUint(uint64(c.MustGet("user").(*models.User).ID), 10)
+	}
+
 	data, _ := json.Marshal(postBody.Server)
 	reader := ioutil.NopCloser(bytes.NewReader(data))
 
@@ -700,8 +784,16 @@ func removeServerUser(c *gin.Context) {
 		return
 	}
 
-	err = ps.Remove(perms)
+	if perms.ID != 0 {
+		err = ps.Remove(perms)
+		if response.HandleError(c, err, http.StatusInternalServerError) {
+			return
+		}
+	}
 
+	//roles given for this server are access too, so they go with the user
+	rs := &services.Role{DB: db}
+	err = rs.UnassignAll(user.ID, &server.Identifier)
 	if response.HandleError(c, err, http.StatusInternalServerError) {
 		return
 	}
@@ -781,6 +873,213 @@ func renameServer(c *gin.Context) {
 	c.JSON(http.StatusNoContent, nil)
 }
 
+// @Summary Transfer a server
+// @Description Moves a server to another node. The server is stopped while its files are copied, and only moved once the new node has all of them. Progress can be followed with the GET endpoint
+// @Accept json
+// @Produce json
+// @Success 202 {object} models.TransferView
+// @Failure 400 {object} response.Error
+// @Failure 403 {object} response.Error
+// @Failure 404 {object} response.Error
+// @Failure 409 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Param id path string true "Server ID"
+// @Param transfer body models.TransferRequest true "Node to move the server to"
+// @Router /api/servers/{id}/transfer [post]
+func transferServer(c *gin.Context) {
+	db := middleware.GetDatabase(c)
+	ss := &services.Server{DB: db}
+	ns := &services.Node{DB: db}
+
+	server := c.MustGet("server").(*models.Server)
+
+	request := &models.TransferRequest{}
+	if err := c.BindJSON(request); response.HandleError(c, err, http.StatusBadRequest) {
+		return
+	}
+
+	target, err := ns.Get(request.NodeId)
+	if err != nil && errors.Is(err, gorm.ErrRecordNotFound) {
+		response.HandleError(c, pufferpanel.ErrNodeInvalid, http.StatusBadRequest)
+		return
+	} else if response.HandleError(c, err, http.StatusInternalServerError) {
+		return
+	}
+
+	pls := &services.Placement{DB: db}
+	err = pls.CanFit(target, server.GetAllocation())
+	if err == pufferpanel.ErrNodeFull {
+		response.HandleError(c, err, http.StatusConflict)
+		return
+	} else if response.HandleError(c, err, http.StatusInternalServerError) {
+		return
+	}
+
+	ps := &services.Port{DB: db}
+	err = ps.CanMove(server.Identifier, target.ID)
+	if _, ok := err.(*pufferpanel.Error); ok {
+		response.HandleError(c, err, http.StatusConflict)
+		return
+	} else if response.HandleError(c, err, http.StatusInternalServerError) {
+		return
+	}
+
+	transfer, err := ss.StartTransfer(server, target)
+	if err == pufferpanel.ErrTransferSameNode {
+		response.HandleError(c, err, http.StatusBadRequest)
+		return
+	} else if err == pufferpanel.ErrTransferRunning {
+		response.HandleError(c, err, http.StatusConflict)
+		return
+	} else if response.HandleError(c, err, http.StatusInternalServerError) {
+		return
+	}
+
+	c.JSON(http.StatusAccepted, transfer)
+}
+
+// @Summary Get server transfer
+// @Description Gets the progress of the last transfer of the server
+// @Accept json
+// @Produce json
+// @Success 200 {object} models.TransferView
+// @Failure 403 {object} response.Error
+// @Failure 404 {object} response.Error
+// @Param id path string true "Server ID"
+// @Router /api/servers/{id}/transfer [get]
+func getServerTransfer(c *gin.Context) {
+	db := middleware.GetDatabase(c)
+	ss := &services.Server{DB: db}
+
+	server := c.MustGet("server").(*models.Server)
+
+	transfer, err := ss.GetTransfer(server.Identifier)
+	if response.HandleError(c, err, http.StatusNotFound) {
+		return
+	}
+
+	c.JSON(http.StatusOK, transfer)
+}
+
+// @Summary Run a bulk action
+// @Description Runs an action on every server matching the filter, in the background. Servers the caller cannot run the action on are skipped
+// @Accept json
+// @Produce json
+// @Success 202 {object} models.BulkJobView
+// @Failure 400 {object} response.Error
+// @Failure 403 {object} response.Error
+// @Failure 404 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Param body body models.BulkActionRequest true "Filter and action"
+// @Router /api/servers/bulk [post]
+func startBulkAction(c *gin.Context) {
+	db := middleware.GetDatabase(c)
+	ss := &services.Server{DB: db}
+	ps := &services.Permission{DB: db}
+
+	user := c.MustGet("user").(*models.User)
+
+	request := &models.BulkActionRequest{}
+	if err := c.BindJSON(request); response.HandleError(c, err, http.StatusBadRequest) {
+		return
+	}
+	if err := request.Valid(); response.HandleError(c, err, http.StatusBadRequest) {
+		return
+	}
+
+	scopes, err := getCallerScopes(c, ps, user)
+	if response.HandleError(c, err, http.StatusInternalServerError) {
+		return
+	}
+
+	servers, err := ss.Filter(services.ServerFilter{
+		Identifiers: request.Servers,
+		NodeId:      request.NodeId,
+		Type:        request.Type,
+		NodeTag:     request.Tag,
+	})
+	if response.HandleError(c, err, http.StatusInternalServerError) {
+		return
+	}
+
+	isAdmin := pufferpanel.ContainsScope(scopes[""], pufferpanel.ScopeServersAdmin)
+	allowed := make([]*models.Server, 0)
+	skipped := 0
+	for _, v := range servers {
+		//servers the caller has nothing on are left out entirely, so they are not told about them
+		if !isAdmin && len(scopes[v.Identifier]) == 0 {
+			continue
+		}
+
+		permitted := isAdmin
+		if !permitted {
+			permitted = true
+			for _, scope := range models.BulkActionScopes[request.Action] {
+				permitted = permitted && pufferpanel.ContainsScope(scopes[v.Identifier], scope)
+			}
+		}
+
+		if permitted {
+			allowed = append(allowed, v)
+		} else {
+			skipped++
+		}
+	}
+
+	if len(allowed) == 0 {
+		response.HandleError(c, pufferpanel.ErrNoServersMatched, http.StatusNotFound)
+		return
+	}
+
+	job := ss.StartBulkAction(user.ID, allowed, skipped, request)
+	c.JSON(http.StatusAccepted, job)
+}
+
+// @Summary Get bulk job
+// @Description Gets the progress of a bulk action, with the result for each server
+// @Accept json
+// @Produce json
+// @Success 200 {object} models.BulkJobView
+// @Failure 403 {object} response.Error
+// @Failure 404 {object} response.Error
+// @Param jobId path string true "Job ID"
+// @Router /api/servers/bulk/{jobId} [get]
+func getBulkJob(c *gin.Context) {
+	db := middleware.GetDatabase(c)
+	ss := &services.Server{DB: db}
+	ps := &services.Permission{DB: db}
+
+	user := c.MustGet("user").(*models.User)
+
+	job, err := ss.GetBulkJob(c.Param("jobId"))
+	if response.HandleError(c, err, http.StatusNotFound) {
+		return
+	}
+
+	if job.UserId != user.ID {
+		isAdmin, err := ps.IsAdmin(user.ID)
+		if response.HandleError(c, err, http.StatusInternalServerError) {
+			return
+		}
+		if !isAdmin {
+			response.HandleError(c, pufferpanel.ErrBulkJobNotFound, http.StatusNotFound)
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, job)
+}
+
+// getCallerScopes gets what the caller can do on each server, with the global scopes under an empty key.
+// OAuth2 clients can only do what their token was given
+func getCallerScopes(c *gin.Context, ps *services.Permission, user *models.User) (map[string][]pufferpanel.Scope, error) {
+	token := c.MustGet("token").(*pufferpanel.Token)
+	if len(token.Claims.Audience) == 1 && token.Claims.Audience[0] == "oauth2" {
+		return token.Claims.PanelClaims.Scopes, nil
+	}
+	return ps.GetScopesForUser(user.ID)
+}
+
 /*// @Summary Gets available OAuth2 scopes for the calling user
 // @Description This allows a caller to see what scopes they have for a server, which can be used to generate a new OAuth2 client or just to know what they can do without making more calls
 // @Accept json
@@ -926,6 +1225,31 @@ func deleteOAuth2Client(c *gin.Context) {
 	c.Status(http.StatusNoContent)
 }
 
+// setPortVariables gives the server the ports it was allocated, each as a variable named after the port
+func setPortVariables(server *pufferpanel.Server, ports []*models.PortAllocation) {
+	if server.Variables == nil {
+		server.Variables = make(map[string]pufferpanel.Variable)
+	}
+
+	for _, v := range ports {
+		variable, exists := server.Variables[v.Name]
+		if !exists {
+			variable = pufferpanel.Variable{Type: pufferpanel.Type{Type: "integer"}, Display: v.Name, Internal: true}
+		}
+		variable.Value = v.Port
+		server.Variables[v.Name] = variable
+
+		if v.Name == "port" {
+			if ip, exists := server.Variables["ip"]; exists {
+				ip.Value = v.IP
+				server.Variables["ip"] = ip
+			}
+		}
+	}
+
+	server.Ports = services.ToServerPorts(ports)
+}
+
 func getFromData(variables map[string]pufferpanel.Variable, key string) interface{} {
 	for k, v := range variables {
 		if k == key {
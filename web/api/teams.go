@@ -0,0 +1,709 @@
+/*
+ Copyright 2023 Padduck, LLC
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+ 	http://www.apache.org/licenses/LICENSE-2.0
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/pufferpanel/pufferpanel/v2"
+	"github.com/pufferpanel/pufferpanel/v2/logging"
+	"github.com/pufferpanel/pufferpanel/v2/middleware"
+	"github.com/pufferpanel/pufferpanel/v2/middleware/handlers"
+	"github.com/pufferpanel/pufferpanel/v2/models"
+	"github.com/pufferpanel/pufferpanel/v2/response"
+	"github.com/pufferpanel/pufferpanel/v2/services"
+	"github.com/spf13/cast"
+	"gopkg.in/go-playground/validator.v9"
+	"gorm.io/gorm"
+	"net/http"
+)
+
+func registerTeams(g *gin.RouterGroup) {
+	g.Handle("GET", "", handlers.OAuth2Handler(pufferpanel.ScopeNone, false), getTeams)
+	g.Handle("POST", "", handlers.OAuth2Handler(pufferpanel.ScopeUsersEdit, false), createTeam)
+	g.Handle("OPTIONS", "", response.CreateOptions("GET", "POST"))
+
+	g.Handle("GET", "/:id", handlers.OAuth2Handler(pufferpanel.ScopeNone, false), getTeam)
+	g.Handle("PUT", "/:id", handlers.OAuth2Handler(pufferpanel.ScopeUsersEdit, false), updateTeam)
+	g.Handle("DELETE", "/:id", handlers.OAuth2Handler(pufferpanel.ScopeUsersEdit, false), deleteTeam)
+	g.Handle("OPTIONS", "/:id", response.CreateOptions("GET", "PUT", "DELETE"))
+
+	g.Handle("GET", "/:id/members", handlers.OAuth2Handler(pufferpanel.ScopeNone, false), getTeamMembers)
+	g.Handle("OPTIONS", "/:id/members", response.CreateOptions("GET"))
+
+	g.Handle("PUT", "/:id/members/:userId", handlers.OAuth2Handler(pufferpanel.ScopeNone, false), setTeamMember)
+	g.Handle("DELETE", "/:id/members/:userId", handlers.OAuth2Handler(pufferpanel.ScopeNone, false), removeTeamMember)
+	g.Handle("OPTIONS", "/:id/members/:userId", response.CreateOptions("PUT", "DELETE"))
+
+	g.Handle("GET", "/:id/invites", handlers.OAuth2Handler(pufferpanel.ScopeNone, false), getTeamInvites)
+	g.Handle("POST", "/:id/invites", handlers.OAuth2Handler(pufferpanel.ScopeNone, false), createTeamInvite)
+	g.Handle("OPTIONS", "/:id/invites", response.CreateOptions("GET", "POST"))
+
+	g.Handle("DELETE", "/:id/invites/:inviteId", handlers.OAuth2Handler(pufferpanel.ScopeNone, false), deleteTeamInvite)
+	g.Handle("OPTIONS", "/:id/invites/:inviteId", response.CreateOptions("DELETE"))
+
+	g.Handle("PUT", "/:id/servers/:serverId", handlers.OAuth2Handler(pufferpanel.ScopeNone, false), addTeamServer)
+	g.Handle("DELETE", "/:id/servers/:serverId", handlers.OAuth2Handler(pufferpanel.ScopeNone, false), removeTeamServer)
+	g.Handle("OPTIONS", "/:id/servers/:serverId", response.CreateOptions("PUT", "DELETE"))
+}
+
+// @Summary Get teams
+// @Description Gets the teams the user is in, or all teams if the user can view users
+// @Accept json
+// @Produce json
+// @Success 200 {object} models.TeamsView "Teams"
+// @Failure 400 {object} response.Error
+// @Failure 403 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Router /api/teams [get]
+func getTeams(c *gin.Context) {
+	db := middleware.GetDatabase(c)
+	ts := &services.Team{DB: db}
+	ps := &services.Permission{DB: db}
+
+	user := c.MustGet("user").(*models.User)
+
+	scopes, err := ps.GetScopesForUserAndServer(user.ID, nil)
+	if response.HandleError(c, err, http.StatusInternalServerError) {
+		return
+	}
+
+	var teams []*models.Team
+	if pufferpanel.ContainsScope(scopes, pufferpanel.ScopeUsersView) {
+		teams, err = ts.GetAll()
+	} else {
+		teams, err = ts.GetForUser(user.ID)
+	}
+	if response.HandleError(c, err, http.StatusInternalServerError) {
+		return
+	}
+
+	c.JSON(http.StatusOK, models.FromTeams(teams))
+}
+
+// @Summary Get team
+// @Description Gets a single team
+// @Accept json
+// @Produce json
+// @Success 200 {object} models.TeamView "Team"
+// @Failure 400 {object} response.Error
+// @Failure 403 {object} response.Error
+// @Failure 404 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Param id path uint true "Team Id"
+// @Router /api/teams/{id} [get]
+func getTeam(c *gin.Context) {
+	team, ok := getTeamFromRequest(c, false)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, models.FromTeam(team))
+}
+
+// @Summary Create team
+// @Description Creates a team
+// @Accept json
+// @Produce json
+// @Success 200 {object} models.TeamView "Team created"
+// @Failure 400 {object} response.Error
+// @Failure 403 {object} response.Error
+// @Failure 409 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Param team body models.TeamView true "Team information"
+// @Router /api/teams [post]
+func createTeam(c *gin.Context) {
+	var err error
+	db := middleware.GetDatabase(c)
+	ts := &services.Team{DB: db}
+
+	viewModel := &models.TeamView{}
+	if err = c.BindJSON(viewModel); response.HandleError(c, err, http.StatusBadRequest) {
+		return
+	}
+
+	if err = viewModel.Valid(false); response.HandleError(c, err, http.StatusBadRequest) {
+		return
+	}
+
+	team := &models.Team{}
+	viewModel.CopyToModel(team)
+
+	err = ts.Create(team)
+	if err == pufferpanel.ErrTeamExists {
+		response.HandleError(c, err, http.StatusConflict)
+		return
+	} else if response.HandleError(c, err, http.StatusInternalServerError) {
+		return
+	}
+
+	c.JSON(http.StatusOK, models.FromTeam(team))
+}
+
+// @Summary Update team
+// @Description Updates a team, including its quotas
+// @Accept json
+// @Produce json
+// @Success 204 {object} response.Empty
+// @Failure 400 {object} response.Error
+// @Failure 403 {object} response.Error
+// @Failure 404 {object} response.Error
+// @Failure 409 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Param id path uint true "Team Id"
+// @Param team body models.TeamView true "Team information"
+// @Router /api/teams/{id} [put]
+func updateTeam(c *gin.Context) {
+	var err error
+	db := middleware.GetDatabase(c)
+	ts := &services.Team{DB: db}
+
+	viewModel := &models.TeamView{}
+	if err = c.BindJSON(viewModel); response.HandleError(c, err, http.StatusBadRequest) {
+		return
+	}
+
+	if err = viewModel.Valid(true); response.HandleError(c, err, http.StatusBadRequest) {
+		return
+	}
+
+	team, ok := getTeamFromRequest(c, true)
+	if !ok {
+		return
+	}
+
+	viewModel.CopyToModel(team)
+
+	err = ts.Update(team)
+	if err == pufferpanel.ErrTeamExists {
+		response.HandleError(c, err, http.StatusConflict)
+		return
+	} else if response.HandleError(c, err, http.StatusInternalServerError) {
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// @Summary Delete team
+// @Description Deletes a team. Servers owned by the team are kept, but are no longer owned by a team. Servers no user has access to of their own are given to the caller
+// @Accept json
+// @Produce json
+// @Success 204 {object} response.Empty
+// @Failure 400 {object} response.Error
+// @Failure 403 {object} response.Error
+// @Failure 404 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Param id path uint true "Team Id"
+// @Router /api/teams/{id} [delete]
+func deleteTeam(c *gin.Context) {
+	db := middleware.GetDatabase(c)
+	ts := &services.Team{DB: db}
+
+	team, ok := getTeamFromRequest(c, true)
+	if !ok {
+		return
+	}
+
+	servers, err := ts.GetServers(team.ID)
+	if response.HandleError(c, err, http.StatusInternalServerError) {
+		return
+	}
+
+	user := c.MustGet("user").(*models.User)
+	err = ts.Delete(team, user.ID)
+	if response.HandleError(c, err, http.StatusInternalServerError) {
+		return
+	}
+
+	//the team is gone either way, so a node that cannot be told only keeps the old owner until it is reachable again
+	ss := &services.Server{DB: db}
+	for _, server := range servers {
+		server.TeamId = nil
+		if err = ss.UpdateOwner(server); err != nil {
+			logging.Error.Printf("Error updating owner of server %s: %s", server.Identifier, err)
+		}
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// @Summary Get team members
+// @Description Gets the members of a team and the role each has on the team's servers
+// @Accept json
+// @Produce json
+// @Success 200 {object} models.TeamMembersView
+// @Failure 400 {object} response.Error
+// @Failure 403 {object} response.Error
+// @Failure 404 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Param id path uint true "Team Id"
+// @Router /api/teams/{id}/members [get]
+func getTeamMembers(c *gin.Context) {
+	db := middleware.GetDatabase(c)
+	ts := &services.Team{DB: db}
+
+	team, ok := getTeamFromRequest(c, false)
+	if !ok {
+		return
+	}
+
+	members, err := ts.GetMembers(team.ID)
+	if response.HandleError(c, err, http.StatusInternalServerError) {
+		return
+	}
+
+	c.JSON(http.StatusOK, models.FromTeamMembers(members))
+}
+
+// @Summary Set team member
+// @Description Adds a user to the team, or changes the role of an existing member
+// @Accept json
+// @Produce json
+// @Success 204 {object} response.Empty
+// @Failure 400 {object} response.Error
+// @Failure 403 {object} response.Error
+// @Failure 404 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Param id path uint true "Team Id"
+// @Param userId path uint true "User Id"
+// @Param member body models.TeamMemberView true "Member information"
+// @Router /api/teams/{id}/members/{userId} [put]
+func setTeamMember(c *gin.Context) {
+	var err error
+	db := middleware.GetDatabase(c)
+	ts := &services.Team{DB: db}
+	us := &services.User{DB: db}
+
+	viewModel := &models.TeamMemberView{}
+	if err = c.BindJSON(viewModel); response.HandleError(c, err, http.StatusBadRequest) {
+		return
+	}
+
+	team, ok := getTeamFromRequest(c, true)
+	if !ok {
+		return
+	}
+
+	userId, err := cast.ToUintE(c.Param("userId"))
+	if response.HandleError(c, err, http.StatusBadRequest) {
+		return
+	}
+
+	user, err := us.GetById(userId)
+	if err != nil && err == gorm.ErrRecordNotFound {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	} else if response.HandleError(c, err, http.StatusInternalServerError) {
+		return
+	}
+
+	if !validateTeamRole(c, team, viewModel.RoleId) {
+		return
+	}
+
+	err = ts.SetMember(team, user.ID, viewModel.RoleId, viewModel.Manager)
+	if err == pufferpanel.ErrTeamMemberLimit {
+		response.HandleError(c, err, http.StatusBadRequest)
+		return
+	} else if response.HandleError(c, err, http.StatusInternalServerError) {
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// @Summary Remove team member
+// @Description Removes a user from the team. Members may always remove themselves
+// @Accept json
+// @Produce json
+// @Success 204 {object} response.Empty
+// @Failure 400 {object} response.Error
+// @Failure 403 {object} response.Error
+// @Failure 404 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Param id path uint true "Team Id"
+// @Param userId path uint true "User Id"
+// @Router /api/teams/{id}/members/{userId} [delete]
+func removeTeamMember(c *gin.Context) {
+	db := middleware.GetDatabase(c)
+	ts := &services.Team{DB: db}
+
+	userId, err := cast.ToUintE(c.Param("userId"))
+	if response.HandleError(c, err, http.StatusBadRequest) {
+		return
+	}
+
+	user := c.MustGet("user").(*models.User)
+
+	//leaving a team does not need management rights
+	team, ok := getTeamFromRequest(c, user.ID != userId)
+	if !ok {
+		return
+	}
+
+	err = ts.RemoveMember(team.ID, userId)
+	if response.HandleError(c, err, http.StatusInternalServerError) {
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// @Summary Get team invites
+// @Description Gets the invites for the team which have not been accepted or expired
+// @Accept json
+// @Produce json
+// @Success 200 {object} models.TeamInvitesView
+// @Failure 400 {object} response.Error
+// @Failure 403 {object} response.Error
+// @Failure 404 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Param id path uint true "Team Id"
+// @Router /api/teams/{id}/invites [get]
+func getTeamInvites(c *gin.Context) {
+	db := middleware.GetDatabase(c)
+	ts := &services.Team{DB: db}
+
+	team, ok := getTeamFromRequest(c, true)
+	if !ok {
+		return
+	}
+
+	invites, err := ts.GetInvites(team.ID)
+	if response.HandleError(c, err, http.StatusInternalServerError) {
+		return
+	}
+
+	c.JSON(http.StatusOK, models.FromTeamInvites(invites))
+}
+
+// @Summary Invite to team
+// @Description Sends an email inviting someone to join the team
+// @Accept json
+// @Produce json
+// @Success 200 {object} models.TeamInviteView
+// @Failure 400 {object} response.Error
+// @Failure 403 {object} response.Error
+// @Failure 404 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Param id path uint true "Team Id"
+// @Param invite body models.TeamInviteView true "Invite information"
+// @Router /api/teams/{id}/invites [post]
+func createTeamInvite(c *gin.Context) {
+	var err error
+	db := middleware.GetDatabase(c)
+	ts := &services.Team{DB: db}
+
+	viewModel := &models.TeamInviteView{}
+	if err = c.BindJSON(viewModel); response.HandleError(c, err, http.StatusBadRequest) {
+		return
+	}
+
+	if validator.New().Var(viewModel.Email, "required,email") != nil {
+		response.HandleError(c, pufferpanel.ErrFieldNotEmail("email"), http.StatusBadRequest)
+		return
+	}
+
+	team, ok := getTeamFromRequest(c, true)
+	if !ok {
+		return
+	}
+
+	if !validateTeamRole(c, team, viewModel.RoleId) {
+		return
+	}
+
+	invite, token, err := ts.CreateInvite(team, viewModel.Email, viewModel.RoleId, viewModel.Manager)
+	if response.HandleError(c, err, http.StatusInternalServerError) {
+		return
+	}
+
+	es := services.GetEmailService()
+	err = es.SendEmail(invite.Email, "teamInvite", map[string]interface{}{
+		"Team":  team,
+		"Token": token,
+		"Email": invite.Email,
+	}, true)
+	if err != nil {
+		//since we don't want to tell the user it failed, we'll log and move on
+		logging.Error.Printf("Error sending email: %s\n", err)
+	}
+
+	c.JSON(http.StatusOK, (*models.FromTeamInvites([]*models.TeamInvite{invite}))[0])
+}
+
+// @Summary Delete team invite
+// @Description Withdraws an invite to the team
+// @Accept json
+// @Produce json
+// @Success 204 {object} response.Empty
+// @Failure 400 {object} response.Error
+// @Failure 403 {object} response.Error
+// @Failure 404 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Param id path uint true "Team Id"
+// @Param inviteId path uint true "Invite Id"
+// @Router /api/teams/{id}/invites/{inviteId} [delete]
+func deleteTeamInvite(c *gin.Context) {
+	db := middleware.GetDatabase(c)
+	ts := &services.Team{DB: db}
+
+	team, ok := getTeamFromRequest(c, true)
+	if !ok {
+		return
+	}
+
+	inviteId, err := cast.ToUintE(c.Param("inviteId"))
+	if response.HandleError(c, err, http.StatusBadRequest) {
+		return
+	}
+
+	err = ts.DeleteInvite(team.ID, inviteId)
+	if response.HandleError(c, err, http.StatusInternalServerError) {
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// @Summary Add server to team
+// @Description Moves a server to be owned by the team. Requires managing the team and admin rights on the server
+// @Accept json
+// @Produce json
+// @Success 204 {object} response.Empty
+// @Failure 400 {object} response.Error
+// @Failure 403 {object} response.Error
+// @Failure 404 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Param id path uint true "Team Id"
+// @Param serverId path string true "Server Id"
+// @Router /api/teams/{id}/servers/{serverId} [put]
+func addTeamServer(c *gin.Context) {
+	db := middleware.GetDatabase(c)
+	ts := &services.Team{DB: db}
+
+	team, ok := getTeamFromRequest(c, true)
+	if !ok {
+		return
+	}
+
+	server, ok := getTeamServerFromRequest(c)
+	if !ok {
+		return
+	}
+
+	err := ts.SetServerTeam(server, team)
+	if err == pufferpanel.ErrTeamServerLimit {
+		response.HandleError(c, err, http.StatusBadRequest)
+		return
+	} else if response.HandleError(c, err, http.StatusInternalServerError) {
+		return
+	}
+
+	ss := &services.Server{DB: db}
+	err = ss.UpdateOwner(server)
+	if response.HandleError(c, err, http.StatusInternalServerError) {
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// @Summary Remove server from team
+// @Description Removes the server from the team, leaving it without a team. If no user has access to the server of their own, the caller is given it
+// @Accept json
+// @Produce json
+// @Success 204 {object} response.Empty
+// @Failure 400 {object} response.Error
+// @Failure 403 {object} response.Error
+// @Failure 404 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Param id path uint true "Team Id"
+// @Param serverId path string true "Server Id"
+// @Router /api/teams/{id}/servers/{serverId} [delete]
+func removeTeamServer(c *gin.Context) {
+	db := middleware.GetDatabase(c)
+	ts := &services.Team{DB: db}
+
+	team, ok := getTeamFromRequest(c, true)
+	if !ok {
+		return
+	}
+
+	server, ok := getTeamServerFromRequest(c)
+	if !ok {
+		return
+	}
+
+	if server.TeamId == nil || *server.TeamId != team.ID {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	//a server only the team could use would be left without an owner, so the user taking it out becomes it
+	user := c.MustGet("user").(*models.User)
+	err := ts.RemoveServer(server, user.ID)
+	if response.HandleError(c, err, http.StatusInternalServerError) {
+		return
+	}
+
+	ss := &services.Server{DB: db}
+	err = ss.UpdateOwner(server)
+	if response.HandleError(c, err, http.StatusInternalServerError) {
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// getTeamFromRequest loads the team from the id in the path. Users who can edit users may always access the team,
+// otherwise the user must be a member, or a manager if manage is set
+func getTeamFromRequest(c *gin.Context, manage bool) (*models.Team, bool) {
+	db := middleware.GetDatabase(c)
+	ts := &services.Team{DB: db}
+	ps := &services.Permission{DB: db}
+
+	id, ok := validateId(c)
+	if !ok {
+		return nil, false
+	}
+
+	team, err := ts.Get(id)
+	if err == pufferpanel.ErrTeamNotFound {
+		c.AbortWithStatus(http.StatusNotFound)
+		return nil, false
+	} else if response.HandleError(c, err, http.StatusInternalServerError) {
+		return nil, false
+	}
+
+	user := c.MustGet("user").(*models.User)
+
+	scopes, err := ps.GetScopesForUserAndServer(user.ID, nil)
+	if response.HandleError(c, err, http.StatusInternalServerError) {
+		return nil, false
+	}
+
+	if pufferpanel.ContainsScope(scopes, pufferpanel.ScopeUsersEdit) {
+		return team, true
+	}
+	if !manage && pufferpanel.ContainsScope(scopes, pufferpanel.ScopeUsersView) {
+		return team, true
+	}
+
+	member, err := ts.GetMember(team.ID, user.ID)
+	if response.HandleError(c, err, http.StatusInternalServerError) {
+		return nil, false
+	}
+
+	if member == nil {
+		c.AbortWithStatus(http.StatusNotFound)
+		return nil, false
+	}
+
+	if manage && !member.Manager {
+		c.AbortWithStatus(http.StatusForbidden)
+		return nil, false
+	}
+
+	return team, true
+}
+
+// getTeamServerFromRequest loads the server from the path, which the user must have admin rights on
+func getTeamServerFromRequest(c *gin.Context) (*models.Server, bool) {
+	db := middleware.GetDatabase(c)
+	ss := &services.Server{DB: db}
+	ps := &services.Permission{DB: db}
+
+	server, err := ss.Get(c.Param("serverId"))
+	if err != nil && err == gorm.ErrRecordNotFound {
+		c.AbortWithStatus(http.StatusNotFound)
+		return nil, false
+	} else if response.HandleError(c, err, http.StatusInternalServerError) {
+		return nil, false
+	}
+
+	user := c.MustGet("user").(*models.User)
+
+	scopes, err := ps.GetScopesForUserAndServer(user.ID, &server.Identifier)
+	if response.HandleError(c, err, http.StatusInternalServerError) {
+		return nil, false
+	}
+
+	if !pufferpanel.ContainsScope(scopes, pufferpanel.ScopeServersEditAdmin) {
+		isAdmin, err := ps.IsAdmin(user.ID)
+		if response.HandleError(c, err, http.StatusInternalServerError) {
+			return nil, false
+		}
+		if !isAdmin {
+			c.AbortWithStatus(http.StatusForbidden)
+			return nil, false
+		}
+	}
+
+	return server, true
+}
+
+// validateTeamRole checks the role can be given to members of the team by the caller. Only panel admins may give
+// roles with global scopes, anyone else can only give what they have themselves in the team
+func validateTeamRole(c *gin.Context, team *models.Team, roleId uint) bool {
+	db := middleware.GetDatabase(c)
+	rs := &services.Role{DB: db}
+	ps := &services.Permission{DB: db}
+	ts := &services.Team{DB: db}
+
+	if roleId == 0 {
+		response.HandleError(c, pufferpanel.ErrFieldRequired("roleId"), http.StatusBadRequest)
+		return false
+	}
+
+	role, err := rs.Get(roleId)
+	if err == pufferpanel.ErrRoleNotFound {
+		response.HandleError(c, err, http.StatusBadRequest)
+		return false
+	} else if response.HandleError(c, err, http.StatusInternalServerError) {
+		return false
+	}
+
+	user := c.MustGet("user").(*models.User)
+
+	isAdmin, err := ps.IsAdmin(user.ID)
+	if response.HandleError(c, err, http.StatusInternalServerError) {
+		return false
+	}
+	if isAdmin {
+		return true
+	}
+
+	scopes, err := ps.GetScopesForUserAndServer(user.ID, nil)
+	if response.HandleError(c, err, http.StatusInternalServerError) {
+		return false
+	}
+
+	member, err := ts.GetMember(team.ID, user.ID)
+	if response.HandleError(c, err, http.StatusInternalServerError) {
+		return false
+	}
+	if member != nil {
+		scopes = append(scopes, member.Role.Scopes...)
+	}
+
+	for _, v := range role.Scopes {
+		if v.IsGlobal() || !pufferpanel.ContainsExactScope(scopes, v) {
+			response.HandleError(c, pufferpanel.ErrRoleNotAllowed, http.StatusForbidden)
+			return false
+		}
+	}
+
+	return true
+}
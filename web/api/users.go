@@ -39,6 +39,9 @@ func registerUsers(g *gin.RouterGroup) {
 	g.Handle("GET", "/:id/perms", handlers.OAuth2Handler(pufferpanel.ScopeUsersView, false), getUserPerms)
 	g.Handle("PUT", "/:id/perms", handlers.OAuth2Handler(pufferpanel.ScopeUsersEdit, false), setUserPerms)
 	g.Handle("OPTIONS", "/:id/perms", response.CreateOptions("PUT", "GET"))
+
+	g.Handle("DELETE", "/:id/sessions", handlers.OAuth2Handler(pufferpanel.ScopeUsersEdit, false), logoutUser)
+	g.Handle("OPTIONS", "/:id/sessions", response.CreateOptions("DELETE"))
 }
 
 // @Summary Get users
@@ -202,6 +205,14 @@ func updateUser(c *gin.Context) {
 		return
 	}
 
+	//a new password means anyone using the old one should be logged out
+	if viewModel.Password != "" {
+		ss := &services.Session{DB: db}
+		if err = ss.RevokeAllForUser(user.ID, 0); response.HandleError(c, err, http.StatusInternalServerError) {
+			return
+		}
+	}
+
 	c.Status(http.StatusNoContent)
 }
 
@@ -241,6 +252,44 @@ func deleteUser(c *gin.Context) {
 	c.Status(http.StatusNoContent)
 }
 
+// @Summary Log out user everywhere
+// @Description Ends every session the user has. Their current tokens stop working, and they will need to log in again
+// @Accept json
+// @Produce json
+// @Success 204 {object} response.Empty
+// @Failure 400 {object} response.Error
+// @Failure 403 {object} response.Error
+// @Failure 404 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Param id path uint true "User ID"
+// @Router /api/users/{id}/sessions [delete]
+func logoutUser(c *gin.Context) {
+	db := middleware.GetDatabase(c)
+	us := &services.User{DB: db}
+	ss := &services.Session{DB: db}
+
+	var err error
+	var id uint
+	if id, err = cast.ToUintE(c.Param("id")); err != nil {
+		response.HandleError(c, err, http.StatusBadRequest)
+		return
+	}
+
+	user, err := us.GetById(id)
+	if err != nil && err == gorm.ErrRecordNotFound {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	} else if response.HandleError(c, err, http.StatusInternalServerError) {
+		return
+	}
+
+	if err = ss.RevokeAllForUser(user.ID, 0); response.HandleError(c, err, http.StatusInternalServerError) {
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
 // @Summary Gets user permissions
 // @Accept json
 // @Produce json
@@ -25,7 +25,10 @@ func RegisterRoutes(rg *gin.RouterGroup) {
 	})
 	rg.POST("login", middleware.NeedsDatabase, LoginPost)
 	rg.POST("otp", middleware.NeedsDatabase, OtpPost)
+	rg.POST("webauthn/start", middleware.NeedsDatabase, WebAuthnStart)
+	rg.POST("webauthn", middleware.NeedsDatabase, WebAuthnPost)
 	rg.POST("register", middleware.NeedsDatabase, RegisterPost)
 	rg.POST("reauth", handlers.AuthMiddleware, middleware.NeedsDatabase, Reauth)
+	rg.POST("refresh", middleware.NeedsDatabase, RefreshPost)
 	rg.GET("publickey", GetToken)
 }
@@ -18,6 +18,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/pufferpanel/pufferpanel/v2"
 	"github.com/pufferpanel/pufferpanel/v2/middleware"
+	"github.com/pufferpanel/pufferpanel/v2/models"
 	"github.com/pufferpanel/pufferpanel/v2/response"
 	"github.com/pufferpanel/pufferpanel/v2/services"
 	"net/http"
@@ -27,7 +28,7 @@ import (
 func LoginPost(c *gin.Context) {
 	db := middleware.GetDatabase(c)
 	us := &services.User{DB: db}
-	ps := &services.Permission{DB: db}
+	ws := &services.WebAuthn{DB: db}
 
 	request := &LoginRequestData{}
 
@@ -36,89 +37,178 @@ func LoginPost(c *gin.Context) {
 		return
 	}
 
-	user, session, otpNeeded, err := us.Login(request.Email, request.Password)
+	user, otpNeeded, err := us.Login(request.Email, request.Password)
 	if response.HandleError(c, err, http.StatusBadRequest) {
 		return
 	}
 
 	if otpNeeded {
+		webAuthn, err := ws.HasCredentials(user.ID)
+		if response.HandleError(c, err, http.StatusInternalServerError) {
+			return
+		}
+
 		userSession := sessions.Default(c)
 		userSession.Set("user", user.Email)
 		userSession.Set("time", time.Now().Unix())
 		userSession.Save()
 		c.JSON(http.StatusOK, &LoginOtpResponse{
 			OtpNeeded: true,
+			Otp:       user.OtpActive,
+			WebAuthn:  webAuthn,
 		})
 		return
 	}
 
-	perms, err := ps.GetForUserAndServer(user.ID, nil)
-	if response.HandleError(c, err, http.StatusInternalServerError) {
+	completeLogin(c, user)
+}
+
+func OtpPost(c *gin.Context) {
+	db := middleware.GetDatabase(c)
+	us := &services.User{DB: db}
+
+	request := &OtpRequestData{}
+
+	err := c.BindJSON(request)
+	if response.HandleError(c, err, http.StatusBadRequest) {
 		return
 	}
 
-	data := &LoginResponse{}
-	data.Session = session
-	data.Scopes = perms.ToScopes()
+	email, ok := getPendingLogin(c)
+	if !ok {
+		return
+	}
 
-	secure := false
-	if c.Request.TLS != nil {
-		secure = true
+	user, err := us.LoginOtp(email, request.Token)
+	if response.HandleError(c, err, http.StatusBadRequest) {
+		return
 	}
-	//TODO: Change to httponly=true when UI is able to use it properly
-	c.SetCookie("puffer_auth", session, int(time.Hour/time.Second), "/", "", secure, false)
 
-	c.JSON(http.StatusOK, data)
+	completeLogin(c, user)
 }
 
-func OtpPost(c *gin.Context) {
+// WebAuthnStart gets the options to pass to navigator.credentials.get for a login that is waiting on its second factor
+func WebAuthnStart(c *gin.Context) {
 	db := middleware.GetDatabase(c)
 	us := &services.User{DB: db}
-	ps := &services.Permission{DB: db}
+	ws := &services.WebAuthn{DB: db}
 
-	request := &OtpRequestData{}
+	email, ok := getPendingLogin(c)
+	if !ok {
+		return
+	}
+
+	user, err := us.GetByEmail(email)
+	if response.HandleError(c, err, http.StatusBadRequest) {
+		return
+	}
+
+	options, err := ws.BeginLogin(user)
+	if response.HandleError(c, err, http.StatusBadRequest) {
+		return
+	}
+
+	c.JSON(http.StatusOK, options)
+}
+
+func WebAuthnPost(c *gin.Context) {
+	db := middleware.GetDatabase(c)
+	us := &services.User{DB: db}
+	ws := &services.WebAuthn{DB: db}
+
+	request := &models.WebAuthnAssertionResponse{}
 
 	err := c.BindJSON(request)
 	if response.HandleError(c, err, http.StatusBadRequest) {
 		return
 	}
 
+	email, ok := getPendingLogin(c)
+	if !ok {
+		return
+	}
+
+	user, err := us.GetByEmail(email)
+	if response.HandleError(c, err, http.StatusBadRequest) {
+		return
+	}
+
+	err = ws.FinishLogin(user, request)
+	if response.HandleError(c, err, http.StatusBadRequest) {
+		return
+	}
+
+	completeLogin(c, user)
+}
+
+// getPendingLogin gets the email of the user who passed the password check but still needs their second factor
+func getPendingLogin(c *gin.Context) (string, bool) {
 	userSession := sessions.Default(c)
-	email := userSession.Get("user").(string)
-	timestamp := userSession.Get("time").(int64)
+	email, _ := userSession.Get("user").(string)
+	timestamp, _ := userSession.Get("time").(int64)
 
 	if email == "" {
 		response.HandleError(c, pufferpanel.ErrInvalidSession, http.StatusBadRequest)
-		return
+		return "", false
 	}
 
 	if timestamp < time.Now().Unix()-300 {
 		userSession.Clear()
 		userSession.Save()
 		response.HandleError(c, pufferpanel.ErrSessionExpired, http.StatusBadRequest)
+		return "", false
+	}
+
+	return email, true
+}
+
+// completeLogin starts a new session for the user, now that they have proven who they are
+func completeLogin(c *gin.Context, user *models.User) {
+	db := middleware.GetDatabase(c)
+	ss := &services.Session{DB: db}
+
+	session, refreshToken, err := ss.Create(user.ID, c.Request.UserAgent(), c.ClientIP())
+	if response.HandleError(c, err, http.StatusInternalServerError) {
 		return
 	}
 
-	user, session, err := us.LoginOtp(email, request.Token)
-	if response.HandleError(c, err, http.StatusBadRequest) {
+	//the second factor has been used, so the pending login is done
+	userSession := sessions.Default(c)
+	userSession.Clear()
+	_ = userSession.Save()
+
+	sendSession(c, user, session, refreshToken)
+}
+
+// sendSession issues a token for the session. The refresh token is only included when it has changed
+func sendSession(c *gin.Context, user *models.User, session *models.Session, refreshToken string) {
+	db := middleware.GetDatabase(c)
+	ps := &services.Permission{DB: db}
+
+	scopes, err := ps.GetScopesForUserAndServer(user.ID, nil)
+	if response.HandleError(c, err, http.StatusInternalServerError) {
 		return
 	}
 
-	perms, err := ps.GetForUserAndServer(user.ID, nil)
+	token, err := services.GenerateSession(user.ID, session.ID)
 	if response.HandleError(c, err, http.StatusInternalServerError) {
 		return
 	}
 
 	data := &LoginResponse{}
-	data.Session = session
-	data.Scopes = perms.ToScopes()
+	data.Session = token
+	data.RefreshToken = refreshToken
+	data.Scopes = scopes
 
 	secure := false
 	if c.Request.TLS != nil {
 		secure = true
 	}
 	//TODO: Change to httponly=true when UI is able to use it properly
-	c.SetCookie("puffer_auth", session, int(time.Hour/time.Second), "/", "", secure, false)
+	c.SetCookie("puffer_auth", token, int(time.Hour/time.Second), "/", "", secure, false)
+	if refreshToken != "" {
+		c.SetCookie("puffer_refresh", refreshToken, int(services.SessionExpiration/time.Second), "/auth", "", secure, true)
+	}
 
 	c.JSON(http.StatusOK, data)
 }
@@ -130,11 +220,14 @@ type LoginRequestData struct {
 
 type LoginOtpResponse struct {
 	OtpNeeded bool `json:"otpNeeded"`
+	Otp       bool `json:"otp"`
+	WebAuthn  bool `json:"webauthn"`
 }
 
 type LoginResponse struct {
-	Session string              `json:"session"`
-	Scopes  []pufferpanel.Scope `json:"scopes,omitempty"`
+	Session      string              `json:"session"`
+	RefreshToken string              `json:"refreshToken,omitempty"`
+	Scopes       []pufferpanel.Scope `json:"scopes,omitempty"`
 }
 
 type OtpRequestData struct {
@@ -15,40 +15,71 @@ package auth
 
 import (
 	"github.com/gin-gonic/gin"
+	"github.com/pufferpanel/pufferpanel/v2"
 	"github.com/pufferpanel/pufferpanel/v2/middleware"
 	"github.com/pufferpanel/pufferpanel/v2/models"
 	"github.com/pufferpanel/pufferpanel/v2/response"
 	"github.com/pufferpanel/pufferpanel/v2/services"
 	"net/http"
-	"time"
 )
 
 func Reauth(c *gin.Context) {
 	db := middleware.GetDatabase(c)
-	ps := &services.Permission{DB: db}
+	ss := &services.Session{DB: db}
 
 	user, _ := c.MustGet("user").(*models.User)
 
-	perms, err := ps.GetForUserAndServer(user.ID, nil)
+	session, err := ss.Get(c.GetUint("sessionId"))
+	if err == pufferpanel.ErrSessionNotFound {
+		response.HandleError(c, pufferpanel.ErrInvalidSession, http.StatusUnauthorized)
+		return
+	}
 	if response.HandleError(c, err, http.StatusInternalServerError) {
 		return
 	}
 
-	session, err := services.GenerateSession(user.ID)
+	err = ss.Touch(session)
 	if response.HandleError(c, err, http.StatusInternalServerError) {
 		return
 	}
 
-	data := &LoginResponse{}
-	data.Session = session
-	data.Scopes = perms.ToScopes()
+	sendSession(c, user, session, "")
+}
+
+// RefreshPost continues a session using its refresh token, which can be sent in the body or as a cookie.
+// The refresh token is replaced each time it is used
+func RefreshPost(c *gin.Context) {
+	db := middleware.GetDatabase(c)
+	ss := &services.Session{DB: db}
+	us := &services.User{DB: db}
+
+	request := &RefreshRequestData{}
+	err := c.ShouldBindJSON(request)
+	if err != nil || request.RefreshToken == "" {
+		request.RefreshToken, _ = c.Cookie("puffer_refresh")
+	}
+	if request.RefreshToken == "" {
+		response.HandleError(c, pufferpanel.ErrInvalidSession, http.StatusBadRequest)
+		return
+	}
+
+	session, refreshToken, err := ss.Refresh(request.RefreshToken, c.Request.UserAgent(), c.ClientIP())
+	if err == pufferpanel.ErrInvalidSession || err == pufferpanel.ErrSessionExpired {
+		response.HandleError(c, err, http.StatusUnauthorized)
+		return
+	}
+	if response.HandleError(c, err, http.StatusInternalServerError) {
+		return
+	}
 
-	secure := false
-	if c.Request.TLS != nil {
-		secure = true
+	user, err := us.GetById(session.UserId)
+	if response.HandleError(c, err, http.StatusUnauthorized) {
+		return
 	}
-	c.SetCookie("puffer_auth", session, int(time.Hour/time.Second), "/", "", secure, false)
-	//c.SetCookie("puffer_auth", session, int(time.Hour/time.Second), "/", "", secure, true)
 
-	c.JSON(http.StatusOK, data)
+	sendSession(c, user, session, refreshToken)
+}
+
+type RefreshRequestData struct {
+	RefreshToken string `json:"refreshToken"`
 }
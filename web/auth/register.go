@@ -72,13 +72,19 @@ func RegisterPost(c *gin.Context) {
 
 	//TODO: Have this be an optional flag
 	token := ""
+	refreshToken := ""
 	if true {
 		err = services.GetEmailService().SendEmail(user.Email, "accountCreation", nil, true)
 		if err != nil {
 			logging.Error.Printf("Error sending email: %s", err.Error())
 		}
 
-		_, token, _, err = us.Login(user.Email, request.Password)
+		ss := &services.Session{DB: db}
+		var session *models.Session
+		session, refreshToken, err = ss.Create(user.ID, c.Request.UserAgent(), c.ClientIP())
+		if err == nil {
+			token, err = services.GenerateSession(user.ID, session.ID)
+		}
 		if err != nil {
 			logging.Error.Printf("Error trying to auto-login after register: %s", err.Error())
 		}
@@ -90,12 +96,13 @@ func RegisterPost(c *gin.Context) {
 		}
 	}
 
-	c.JSON(200, &registerResponse{Success: true, Token: token})
+	c.JSON(200, &registerResponse{Success: true, Token: token, RefreshToken: refreshToken})
 }
 
 type registerResponse struct {
-	Success bool   `json:"success"`
-	Token   string `json:"token,omitempty"`
+	Success      bool   `json:"success"`
+	Token        string `json:"token,omitempty"`
+	RefreshToken string `json:"refreshToken,omitempty"`
 }
 
 type registerRequestData struct {
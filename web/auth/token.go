@@ -9,6 +9,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/pufferpanel/pufferpanel/v2/logging"
 	"github.com/pufferpanel/pufferpanel/v2/services"
+	"net/http"
 )
 
 func GetToken(c *gin.Context) {
@@ -41,3 +42,14 @@ func GetToken(c *gin.Context) {
 
 	c.Data(200, "application/x-pem-file", buffer.Bytes())
 }
+
+// GetJWKS gets the public keys tokens are signed with
+// @Summary Get token signing keys
+// @Description Gets the keys tokens may be signed with as a JSON Web Key Set. Nodes use these to validate tokens
+// @Success 200 {object} pufferpanel.JWKS
+// @Router /.well-known/jwks.json [get]
+func GetJWKS(c *gin.Context) {
+	//a new key is used as soon as it is rotated in, so this must not be served stale
+	c.Header("Cache-Control", "no-cache")
+	c.JSON(http.StatusOK, services.GetJWKS())
+}
@@ -0,0 +1,170 @@
+/*
+ Copyright 2023 Padduck, LLC
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+  	http://www.apache.org/licenses/LICENSE-2.0
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+*/
+
+package daemon
+
+import (
+	"crypto/ecdsa"
+	"crypto/tls"
+	"crypto/x509"
+	"github.com/gin-gonic/gin"
+	"github.com/pufferpanel/pufferpanel/v2"
+	"github.com/pufferpanel/pufferpanel/v2/config"
+	"github.com/pufferpanel/pufferpanel/v2/logging"
+	"github.com/pufferpanel/pufferpanel/v2/middleware"
+	"github.com/pufferpanel/pufferpanel/v2/response"
+	"net/http"
+	"os"
+	"sync"
+)
+
+// the certificate is swapped when the panel renews it, without needing to restart the listener
+var certificate *tls.Certificate
+var pendingKey *ecdsa.PrivateKey
+var certificateLocker sync.Mutex
+
+func registerCertificateRoutes(e *gin.RouterGroup) {
+	e.POST("certificate/request", middleware.OAuth2Handler(pufferpanel.ScopeNodesDeploy, false), requireMTLS, requestCertificate)
+	e.Handle("OPTIONS", "certificate/request", response.CreateOptions("POST"))
+	e.PUT("certificate", middleware.OAuth2Handler(pufferpanel.ScopeNodesDeploy, false), requireMTLS, installCertificate)
+	e.Handle("OPTIONS", "certificate", response.CreateOptions("PUT"))
+}
+
+// MTLSConfig loads the node's certificate and the panel's CA, for the listener only the panel may connect to
+func MTLSConfig() (*tls.Config, error) {
+	data, err := os.ReadFile(config.DaemonMTLSCA.Value())
+	if err != nil {
+		return nil, err
+	}
+	ca, err := pufferpanel.DecodeCertificate(data)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+
+	cert, err := tls.LoadX509KeyPair(config.DaemonMTLSCert.Value(), config.DaemonMTLSKey.Value())
+	if err != nil {
+		return nil, err
+	}
+
+	certificateLocker.Lock()
+	certificate = &cert
+	certificateLocker.Unlock()
+
+	return pufferpanel.MutualServerTLS(pool, getCertificate), nil
+}
+
+func getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	certificateLocker.Lock()
+	defer certificateLocker.Unlock()
+	return certificate, nil
+}
+
+// requireMTLS only lets through requests which came in with the panel's client certificate
+func requireMTLS(c *gin.Context) {
+	if c.Request.TLS == nil || len(c.Request.TLS.VerifiedChains) == 0 {
+		response.HandleError(c, pufferpanel.ErrMTLSRequired, http.StatusForbidden)
+		return
+	}
+	c.Next()
+}
+
+// requireMTLSExceptExport keeps the plain listener from serving anything but the transfer export while mutual TLS is
+// on. Other nodes pull transfers from there without the panel's certificate, using a token only good for the export
+func requireMTLSExceptExport(c *gin.Context) {
+	if c.Request.Method == http.MethodGet && c.FullPath() == "/daemon/server/:id/transfer" {
+		c.Next()
+		return
+	}
+	requireMTLS(c)
+}
+
+// @Summary Request a new certificate
+// @Description Creates a new key for the node, and returns the request for the panel to sign. Only allowed over mutual TLS
+// @Produce json
+// @Success 200 {object} pufferpanel.CertificateRequest
+// @Failure 403 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Router /daemon/certificate/request [post]
+func requestCertificate(c *gin.Context) {
+	key, err := pufferpanel.GenerateCertificateKey()
+	if response.HandleError(c, err, http.StatusInternalServerError) {
+		return
+	}
+
+	request, err := pufferpanel.CreateCertificateRequest(key, config.ClientId.Value())
+	if response.HandleError(c, err, http.StatusInternalServerError) {
+		return
+	}
+
+	certificateLocker.Lock()
+	pendingKey = key
+	certificateLocker.Unlock()
+
+	c.JSON(http.StatusOK, &pufferpanel.CertificateRequest{Request: string(request)})
+}
+
+// @Summary Install a new certificate
+// @Description Replaces the node's certificate with one the panel signed for the last requested key. Only allowed over mutual TLS
+// @Accept json
+// @Success 204 {object} response.Empty
+// @Failure 400 {object} response.Error
+// @Failure 403 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Param certificate body pufferpanel.CertificateResponse true "Signed certificate"
+// @Router /daemon/certificate [put]
+func installCertificate(c *gin.Context) {
+	request := &pufferpanel.CertificateResponse{}
+	if err := c.BindJSON(request); response.HandleError(c, err, http.StatusBadRequest) {
+		return
+	}
+
+	cert, err := pufferpanel.DecodeCertificate([]byte(request.Certificate))
+	if response.HandleError(c, err, http.StatusBadRequest) {
+		return
+	}
+
+	certificateLocker.Lock()
+	defer certificateLocker.Unlock()
+
+	if pendingKey == nil || !pufferpanel.IsKeyFor(pendingKey, cert) {
+		response.HandleError(c, pufferpanel.ErrCertificateMismatch, http.StatusBadRequest)
+		return
+	}
+
+	err = WriteCertificate(pendingKey, cert)
+	if response.HandleError(c, err, http.StatusInternalServerError) {
+		return
+	}
+
+	certificate = &tls.Certificate{Certificate: [][]byte{cert.Raw}, PrivateKey: pendingKey, Leaf: cert}
+	pendingKey = nil
+	logging.Info.Printf("Installed new certificate, valid until %s", cert.NotAfter)
+
+	c.Status(http.StatusNoContent)
+}
+
+// WriteCertificate saves the node's key and certificate where the listener loads them from
+func WriteCertificate(key *ecdsa.PrivateKey, cert *x509.Certificate) error {
+	keyData, err := pufferpanel.EncodePrivateKey(key)
+	if err != nil {
+		return err
+	}
+
+	err = os.WriteFile(config.DaemonMTLSKey.Value(), keyData, 0600)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(config.DaemonMTLSCert.Value(), pufferpanel.EncodeCertificate(cert), 0644)
+}
@@ -21,17 +21,36 @@ import (
 	"github.com/docker/docker/client"
 	"github.com/gin-gonic/gin"
 	"github.com/pufferpanel/pufferpanel/v2"
+	"github.com/pufferpanel/pufferpanel/v2/config"
+	"github.com/pufferpanel/pufferpanel/v2/logging"
+	"github.com/pufferpanel/pufferpanel/v2/middleware"
+	"github.com/pufferpanel/pufferpanel/v2/oauth2"
+	"github.com/pufferpanel/pufferpanel/v2/programs"
 	"github.com/pufferpanel/pufferpanel/v2/response"
+	"github.com/shirou/gopsutil/cpu"
+	"github.com/shirou/gopsutil/disk"
+	"github.com/shirou/gopsutil/mem"
 	"net/http"
+	"runtime"
 	"time"
 )
 
+var startedAt = time.Now()
+
 func RegisterDaemonRoutes(e *gin.RouterGroup) {
+	//a panel on the same host calls its node in-process, without going through either listener
+	if config.DaemonMTLSEnabled.Value() && !config.PanelEnabled.Value() {
+		e.Use(requireMTLSExceptExport)
+	}
+
 	e.GET("", getStatusGET)
 	e.HEAD("", getStatusHEAD)
 	e.Handle("OPTIONS", "", response.CreateOptions("GET", "HEAD"))
 	e.GET("features", getFeatures)
+	e.GET("info", middleware.OAuth2Handler(pufferpanel.ScopeNodesView, false), getInfo)
+	e.Handle("OPTIONS", "info", response.CreateOptions("GET"))
 
+	registerCertificateRoutes(e)
 	RegisterServerRoutes(e)
 }
 
@@ -69,11 +88,78 @@ func getFeatures(c *gin.Context) {
 		features = append(features, "docker")
 	}
 
+	if testPodman() {
+		features = append(features, "podman")
+	}
+
 	c.JSON(http.StatusOK, Features{Features: features})
 }
 
+// @Summary Get node information
+// @Description Gets the version of the daemon, how loaded the host is, and if it can reach the panel
+// @Accept json
+// @Produce json
+// @Success 200 {object} pufferpanel.DaemonInfo "Node information"
+// @Failure 403 {object} response.Error
+// @Router /daemon/info [get]
+func getInfo(c *gin.Context) {
+	info := pufferpanel.DaemonInfo{
+		Version: pufferpanel.Version,
+		OS:      runtime.GOOS,
+		Arch:    runtime.GOARCH,
+		Uptime:  int64(time.Since(startedAt).Seconds()),
+		Servers: len(programs.GetAll()),
+		Host:    getHostInfo(),
+	}
+
+	//a node running with the panel has nothing to lose contact with
+	if !config.PanelEnabled.Value() {
+		info.Panel = oauth2.GetPanelStatus()
+	}
+
+	c.JSON(http.StatusOK, info)
+}
+
+// getHostInfo gets what it can about the host, anything the OS will not tell us is left empty
+func getHostInfo() pufferpanel.HostInfo {
+	info := pufferpanel.HostInfo{CpuCount: runtime.NumCPU()}
+
+	usage, err := cpu.Percent(250*time.Millisecond, false)
+	if err != nil {
+		logging.Debug.Printf("Error getting cpu usage: %s", err)
+	} else if len(usage) > 0 {
+		info.CpuUsage = usage[0]
+	}
+
+	memory, err := mem.VirtualMemory()
+	if err != nil {
+		logging.Debug.Printf("Error getting memory usage: %s", err)
+	} else {
+		info.MemoryTotal = memory.Total
+		info.MemoryUsed = memory.Used
+	}
+
+	usageStat, err := disk.Usage(config.ServersFolder.Value())
+	if err != nil {
+		logging.Debug.Printf("Error getting disk usage: %s", err)
+	} else {
+		info.DiskTotal = usageStat.Total
+		info.DiskUsed = usageStat.Used
+	}
+
+	return info
+}
+
 func testDocker() bool {
-	d, err := client.NewClientWithOpts(client.FromEnv)
+	return testContainerHost(client.FromEnv)
+}
+
+func testPodman() bool {
+	return testContainerHost(client.FromEnv, client.WithHost(pufferpanel.GetPodmanHost()))
+}
+
+func testContainerHost(opts ...client.Opt) bool {
+	d, err := client.NewClientWithOpts(opts...)
 	if err != nil {
 		return false
 	}
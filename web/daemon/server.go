@@ -71,6 +71,12 @@ func RegisterServerRoutes(e *gin.RouterGroup) {
 		l.POST("/:id/reload", middleware.OAuth2Handler(pufferpanel.ScopeServersEditAdmin, true), ReloadServer)
 		l.OPTIONS("/:id/reload", response.CreateOptions("POST"))
 
+		l.POST("/:id/environment", middleware.OAuth2Handler(pufferpanel.ScopeServersEditAdmin, true), SwitchEnvironment)
+		l.OPTIONS("/:id/environment", response.CreateOptions("POST"))
+
+		l.POST("/:id/owner", middleware.OAuth2Handler(pufferpanel.ScopeServersEditAdmin, true), SetServerOwner)
+		l.OPTIONS("/:id/owner", response.CreateOptions("POST"))
+
 		l.POST("/:id/start", middleware.OAuth2Handler(pufferpanel.ScopeServersStart, true), StartServer)
 		l.OPTIONS("/:id/start", response.CreateOptions("POST"))
 
@@ -101,6 +107,10 @@ func RegisterServerRoutes(e *gin.RouterGroup) {
 
 		l.POST("/:id/archive/*filename", middleware.OAuth2Handler(pufferpanel.ScopeServersFilesPut, true), Archive)
 		l.GET("/:id/extract/*filename", middleware.OAuth2Handler(pufferpanel.ScopeServersFilesPut, true), Extract)
+
+		l.GET("/:id/transfer", middleware.OAuth2Handler(pufferpanel.ScopeServersTransfer, true), SendTransfer)
+		l.POST("/:id/transfer", middleware.OAuth2Handler(pufferpanel.ScopeServersTransfer, false), ReceiveTransfer)
+		l.OPTIONS("/:id/transfer", response.CreateOptions("GET", "POST"))
 	}
 
 	p := e.Group("/socket")
@@ -129,6 +139,7 @@ func RegisterServerRoutes(e *gin.RouterGroup) {
 // @Failure 400 {object} response.Error
 // @Failure 403 {object} response.Empty
 // @Failure 404 {object} response.Empty
+// @Failure 409 {object} response.Error "A port of the server is in use"
 // @Failure 500 {object} response.Error
 // @Param id path string true "Server Identifier"
 // @Param wait query bool false "Wait for the operation to complete"
@@ -141,7 +152,9 @@ func StartServer(c *gin.Context) {
 
 	if wait {
 		err := server.Start()
-		if response.HandleError(c, err, http.StatusInternalServerError) {
+		if e, ok := err.(*pufferpanel.Error); ok && e.Is(pufferpanel.ErrPortInUse("", 0)) {
+			response.HandleError(c, err, http.StatusConflict)
+		} else if response.HandleError(c, err, http.StatusInternalServerError) {
 		} else {
 			c.Status(http.StatusNoContent)
 		}
@@ -503,6 +516,11 @@ func EditServerAdmin(c *gin.Context) {
 		return
 	}
 
+	err = pufferpanel.CheckNetworkBlock(replacement.Environment)
+	if response.HandleError(c, err, http.StatusBadRequest) {
+		return
+	}
+
 	//backup, just in case we break
 	backup := &pufferpanel.Server{}
 	backup.CopyFrom(server)
@@ -524,6 +542,81 @@ func EditServerAdmin(c *gin.Context) {
 	c.Status(http.StatusNoContent)
 }
 
+// @Summary Switches environment
+// @Description Moves a stopped server to another of its supported environments, keeping its files and variables
+// @Accept json
+// @Produce json
+// @Success 204 {object} response.Empty
+// @Failure 400 {object} response.Error
+// @Failure 403 {object} response.Empty
+// @Failure 404 {object} response.Empty
+// @Failure 409 {object} response.Error "Server is running"
+// @Failure 500 {object} response.Error
+// @Param id path string true "Server Identifier"
+// @Param environment body pufferpanel.Type true "Environment to switch to"
+// @Router /daemon/server/{id}/environment [post]
+func SwitchEnvironment(c *gin.Context) {
+	item, _ := c.MustGet("server").(*programs.Program)
+
+	request := &pufferpanel.Type{}
+	err := c.BindJSON(request)
+	if response.HandleError(c, err, http.StatusBadRequest) {
+		return
+	}
+
+	if running, _ := item.IsRunning(); running {
+		response.HandleError(c, pufferpanel.ErrProcessRunning, http.StatusConflict)
+		return
+	}
+
+	//only what the request asked for can be wrong with it, anything else went wrong on the node
+	err = item.SwitchEnvironment(request.Type)
+	if err == pufferpanel.ErrProcessRunning {
+		response.HandleError(c, err, http.StatusConflict)
+		return
+	} else if e, ok := err.(*pufferpanel.Error); ok && !e.Is(pufferpanel.ErrUnknownError) {
+		response.HandleError(c, err, http.StatusBadRequest)
+		return
+	} else if response.HandleError(c, err, http.StatusInternalServerError) {
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// @Summary Sets the server owner
+// @Description Sets who the server belongs to, which decides what network it shares with other servers. Applies the next time the server starts
+// @Accept json
+// @Produce json
+// @Success 204 {object} response.Empty
+// @Failure 400 {object} response.Error
+// @Failure 403 {object} response.Empty
+// @Failure 404 {object} response.Empty
+// @Failure 500 {object} response.Error
+// @Param id path string true "Server Identifier"
+// @Param owner body pufferpanel.ServerOwner true "New owner"
+// @Router /daemon/server/{id}/owner [post]
+func SetServerOwner(c *gin.Context) {
+	item, _ := c.MustGet("server").(*programs.Program)
+
+	request := &pufferpanel.ServerOwner{}
+	err := c.BindJSON(request)
+	if response.HandleError(c, err, http.StatusBadRequest) {
+		return
+	}
+
+	previous := item.Server.Owner
+	item.Server.Owner = request.Owner
+
+	err = programs.Save(item.Id())
+	if response.HandleError(c, err, http.StatusInternalServerError) {
+		item.Server.Owner = previous
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
 // @Summary Get file/list
 // @Description Gets a file or a file list from the server
 // @Accept json
@@ -764,7 +857,7 @@ func GetStatus(c *gin.Context) {
 
 	if response.HandleError(c, err, http.StatusInternalServerError) {
 	} else {
-		c.JSON(200, &pufferpanel.ServerRunning{Running: running})
+		c.JSON(200, &pufferpanel.ServerRunning{Running: running, Health: program.GetEnvironment().GetBase().GetHealth()})
 	}
 }
 
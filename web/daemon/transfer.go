@@ -0,0 +1,204 @@
+/*
+ Copyright 2023 Padduck, LLC
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+  	http://www.apache.org/licenses/LICENSE-2.0
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+*/
+
+package daemon
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/pufferpanel/pufferpanel/v2"
+	"github.com/pufferpanel/pufferpanel/v2/logging"
+	"github.com/pufferpanel/pufferpanel/v2/programs"
+	"github.com/pufferpanel/pufferpanel/v2/response"
+	"github.com/pufferpanel/pufferpanel/v2/services"
+	"io"
+	"net/http"
+	"os"
+	"time"
+)
+
+// how often the receiving node tells the panel how far along it is
+const transferProgressInterval = time.Second
+
+// @Summary Send server to another node
+// @Description Streams the server definition and its files as a tar, with the sha256 of the stream as a trailer. The server must be stopped
+// @Produce application/x-tar
+// @Success 200 {object} string "Transfer stream"
+// @Failure 403 {object} response.Empty
+// @Failure 404 {object} response.Empty
+// @Failure 409 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Param id path string true "Server Identifier"
+// @Router /daemon/server/{id}/transfer [get]
+func SendTransfer(c *gin.Context) {
+	//the export holds every file of the server, so only the token made for the transfer may read it
+	scopes := c.MustGet("scopes").([]pufferpanel.Scope)
+	if !pufferpanel.ContainsExactScope(scopes, pufferpanel.ScopeServersTransfer) {
+		response.HandleError(c, pufferpanel.CreateErrMissingScope(pufferpanel.ScopeServersTransfer), http.StatusForbidden)
+		return
+	}
+
+	server := c.MustGet("server").(*programs.Program)
+
+	running, err := server.IsRunning()
+	if response.HandleError(c, err, http.StatusInternalServerError) {
+		return
+	}
+	if running {
+		response.HandleError(c, pufferpanel.ErrServerRunning, http.StatusConflict)
+		return
+	}
+
+	hash := sha256.New()
+	c.Header("Trailer", pufferpanel.TransferChecksumHeader)
+	c.Header("Content-Type", "application/x-tar")
+	c.Status(http.StatusOK)
+
+	err = server.WriteTransfer(io.MultiWriter(c.Writer, hash))
+	if err != nil {
+		//too late to change the status, leaving out the checksum tells the other side it is incomplete
+		logging.Error.Printf("Error sending transfer of %s: %s", server.Id(), err)
+		return
+	}
+
+	c.Writer.Header().Set(pufferpanel.TransferChecksumHeader, hex.EncodeToString(hash.Sum(nil)))
+}
+
+// @Summary Receive server from another node
+// @Description Pulls a server from another node, reporting progress as a stream of JSON objects, one per line, until it completes or fails
+// @Accept json
+// @Produce application/x-ndjson
+// @Success 200 {object} pufferpanel.TransferProgress "Progress"
+// @Failure 400 {object} response.Error
+// @Failure 403 {object} response.Empty
+// @Failure 409 {object} response.Error
+// @Failure 502 {object} response.Error
+// @Param id path string true "Server Identifier"
+// @Param transfer body pufferpanel.TransferRequest true "Where to get the server from"
+// @Router /daemon/server/{id}/transfer [post]
+func ReceiveTransfer(c *gin.Context) {
+	serverId := c.Param("id")
+
+	if prg, _ := programs.Get(serverId); prg != nil {
+		response.HandleError(c, pufferpanel.ErrServerAlreadyExists, http.StatusConflict)
+		return
+	}
+
+	request := &pufferpanel.TransferRequest{}
+	err := c.BindJSON(request)
+	if response.HandleError(c, err, http.StatusBadRequest) {
+		return
+	}
+
+	//the export token is sent along to the source, so only a source the panel signed into it is fetched from
+	if !isTransferSource(request, serverId) {
+		response.HandleError(c, pufferpanel.ErrTransferSource, http.StatusBadRequest)
+		return
+	}
+
+	sourceRequest, err := http.NewRequest(http.MethodGet, request.Source, nil)
+	if response.HandleError(c, err, http.StatusBadRequest) {
+		return
+	}
+	sourceRequest.Header.Set("Authorization", "Bearer "+request.Token)
+
+	source, err := pufferpanel.Http().Do(sourceRequest)
+	defer pufferpanel.CloseResponse(source)
+	if response.HandleError(c, err, http.StatusBadGateway) {
+		return
+	}
+	if source.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(source.Body)
+		response.HandleError(c, fmt.Errorf("source node responded with [%d] %s", source.StatusCode, msg), http.StatusBadGateway)
+		return
+	}
+
+	//from here on, the panel is told how it went through the stream
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Status(http.StatusOK)
+	encoder := json.NewEncoder(c.Writer)
+	send := func(progress pufferpanel.TransferProgress) {
+		_ = encoder.Encode(progress)
+		c.Writer.Flush()
+	}
+	fail := func(err error) {
+		logging.Error.Printf("Error receiving transfer of %s: %s", serverId, err)
+		send(pufferpanel.TransferProgress{Stage: pufferpanel.TransferStageFailed, Error: err.Error()})
+	}
+
+	hash := sha256.New()
+	counter := &transferCounter{
+		reader: io.TeeReader(source.Body, hash),
+		report: func(n int64) {
+			send(pufferpanel.TransferProgress{Stage: pufferpanel.TransferStageTransferring, Bytes: n})
+		},
+	}
+
+	staging, definition, err := programs.ReceiveTransfer(serverId, counter)
+	if err != nil {
+		fail(err)
+		return
+	}
+
+	//the checksum is only there once the body has been read to the end
+	_, err = io.Copy(io.Discard, counter)
+	if err == nil && source.Trailer.Get(pufferpanel.TransferChecksumHeader) != hex.EncodeToString(hash.Sum(nil)) {
+		err = pufferpanel.ErrTransferChecksum
+	}
+	if err != nil {
+		_ = os.RemoveAll(staging)
+		fail(err)
+		return
+	}
+
+	send(pufferpanel.TransferProgress{Stage: pufferpanel.TransferStageFinalizing, Bytes: counter.total})
+	_, err = programs.CompleteTransfer(serverId, staging, definition)
+	if err != nil {
+		fail(err)
+		return
+	}
+
+	send(pufferpanel.TransferProgress{Stage: pufferpanel.TransferStageComplete, Bytes: counter.total})
+}
+
+// isTransferSource checks the source is the one the panel signed into the export token for this server
+func isTransferSource(request *pufferpanel.TransferRequest, serverId string) bool {
+	token, err := services.ParseToken(request.Token)
+	if err != nil || !token.Valid {
+		return false
+	}
+	claims := token.Claims.PanelClaims
+	return claims.TransferSource != "" && claims.TransferSource == request.Source &&
+		pufferpanel.ContainsExactScope(claims.Scopes[serverId], pufferpanel.ScopeServersTransfer)
+}
+
+// transferCounter counts what has been read, reporting it every so often
+type transferCounter struct {
+	reader     io.Reader
+	report     func(n int64)
+	total      int64
+	lastReport time.Time
+}
+
+func (tc *transferCounter) Read(p []byte) (int, error) {
+	n, err := tc.reader.Read(p)
+	tc.total += int64(n)
+	if time.Since(tc.lastReport) >= transferProgressInterval {
+		tc.lastReport = time.Now()
+		tc.report(tc.total)
+	}
+	return n, err
+}
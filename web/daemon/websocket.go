@@ -82,7 +82,7 @@ func listenOnSocket(conn *pufferpanel.Socket, server *programs.Program, scopes [
 					if err != nil {
 						running = false
 					}
-					msg := messages.Status{Running: running}
+					msg := messages.Status{Running: running, Health: server.GetEnvironment().GetBase().GetHealth()}
 					_ = pufferpanel.Write(conn, msg)
 				}
 			case "start":
@@ -65,6 +65,7 @@ func RegisterRoutes(e *gin.Engine) {
 		e.GET("/manifest.json", webManifest)
 		oauth2.RegisterRoutes(e.Group("/oauth2"))
 		auth.RegisterRoutes(e.Group("/auth"))
+		e.GET("/.well-known/jwks.json", auth.GetJWKS)
 
 		proxy.RegisterRoutes(e.Group("/proxy"))
 
@@ -0,0 +1,65 @@
+/*
+ Copyright 2023 Padduck, LLC
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+  	http://www.apache.org/licenses/LICENSE-2.0
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+*/
+
+package oauth2
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/pufferpanel/pufferpanel/v2/middleware"
+	"github.com/pufferpanel/pufferpanel/v2/models"
+	"github.com/pufferpanel/pufferpanel/v2/services"
+	"net/http"
+	"net/url"
+)
+
+// consentPath is the page in the UI which asks the user if they want to let the app in
+const consentPath = "/auth/authorize"
+
+func registerAuthorize(g *gin.RouterGroup) {
+	g.GET("/authorize", middleware.NeedsDatabase, handleAuthorizeRequest)
+}
+
+// handleAuthorizeRequest is where apps send users to start the authorization code flow. Once the request is known to
+// be good, the user is sent on to the UI to agree to it
+func handleAuthorizeRequest(c *gin.Context) {
+	request := &models.AuthorizeRequest{}
+	err := c.ShouldBindQuery(request)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, &oauth2TokenResponse{Error: "invalid_request", ErrorDescription: err.Error()})
+		return
+	}
+
+	db := middleware.GetDatabase(c)
+	if db == nil {
+		c.JSON(http.StatusInternalServerError, &oauth2TokenResponse{Error: "invalid_request", ErrorDescription: "database not available"})
+		return
+	}
+
+	as := &services.Application{DB: db}
+	app, _, err := as.ValidateRequest(request)
+
+	//without a known app and redirect, there is nowhere safe to send the user back to
+	if err != nil && app == nil {
+		c.JSON(http.StatusBadRequest, &oauth2TokenResponse{Error: "invalid_request", ErrorDescription: err.Error()})
+		return
+	}
+	if err != nil {
+		c.Redirect(http.StatusFound, services.AuthorizeRedirect(request, url.Values{
+			"error":             {services.AuthorizeErrorCode(err)},
+			"error_description": {err.Error()},
+		}))
+		return
+	}
+
+	c.Redirect(http.StatusFound, consentPath+"?"+c.Request.URL.RawQuery)
+}
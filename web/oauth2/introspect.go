@@ -0,0 +1,187 @@
+/*
+ Copyright 2023 Padduck, LLC
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+  	http://www.apache.org/licenses/LICENSE-2.0
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+*/
+
+package oauth2
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/pufferpanel/pufferpanel/v2"
+	"github.com/pufferpanel/pufferpanel/v2/logging"
+	"github.com/pufferpanel/pufferpanel/v2/middleware"
+	"github.com/pufferpanel/pufferpanel/v2/response"
+	"github.com/pufferpanel/pufferpanel/v2/services"
+	"gorm.io/gorm"
+	"net/http"
+	"strings"
+)
+
+func registerIntrospection(g *gin.RouterGroup) {
+	g.POST("/introspect", middleware.NeedsDatabase, handleIntrospectRequest)
+	g.OPTIONS("/introspect", response.CreateOptions("POST"))
+	g.POST("/revoke", middleware.NeedsDatabase, handleRevokeRequest)
+	g.OPTIONS("/revoke", response.CreateOptions("POST"))
+}
+
+// handleIntrospectRequest tells the caller if a token is active, as described by RFC 7662. Nodes may ask about any
+// token, other clients only about tokens issued to them
+func handleIntrospectRequest(c *gin.Context) {
+	var request oauth2IntrospectRequest
+	err := c.MustBindWith(&request, binding.FormPost)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, &oauth2TokenResponse{Error: "invalid_request", ErrorDescription: err.Error()})
+		return
+	}
+
+	db := middleware.GetDatabase(c)
+	clientId, trusted, ok := getIntrospectionCaller(c, db, request.ClientId, request.ClientSecret)
+	if !ok {
+		return
+	}
+
+	token, err := services.ParseToken(request.Token)
+	if err != nil || !token.Valid || (!trusted && token.Claims.PanelClaims.ClientId != clientId) {
+		c.JSON(http.StatusOK, &oauth2IntrospectResponse{Active: false})
+		return
+	}
+
+	is := &services.Introspection{DB: db}
+	active, err := is.IsActive(token)
+	if err != nil {
+		logging.Error.Printf("Error checking token: %s", err.Error())
+		c.JSON(http.StatusInternalServerError, &oauth2TokenResponse{Error: "server_error"})
+		return
+	}
+	if !active {
+		c.JSON(http.StatusOK, &oauth2IntrospectResponse{Active: false})
+		return
+	}
+
+	result := &oauth2IntrospectResponse{
+		Active:    true,
+		Scope:     services.FormatScopes(token.Claims.PanelClaims.Scopes),
+		ClientId:  token.Claims.PanelClaims.ClientId,
+		TokenType: "Bearer",
+		Subject:   token.Claims.Subject,
+		TokenId:   token.Claims.ID,
+	}
+	if token.Claims.ExpiresAt != nil {
+		result.ExpiresAt = token.Claims.ExpiresAt.Unix()
+	}
+	if token.Claims.IssuedAt != nil {
+		result.IssuedAt = token.Claims.IssuedAt.Unix()
+	}
+	if len(token.Claims.Audience) == 1 {
+		result.Audience = token.Claims.Audience[0]
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// handleRevokeRequest revokes an access token or a refresh token, as described by RFC 7009
+func handleRevokeRequest(c *gin.Context) {
+	var request oauth2IntrospectRequest
+	err := c.MustBindWith(&request, binding.FormPost)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, &oauth2TokenResponse{Error: "invalid_request", ErrorDescription: err.Error()})
+		return
+	}
+
+	db := middleware.GetDatabase(c)
+	clientId, trusted, ok := getIntrospectionCaller(c, db, request.ClientId, request.ClientSecret)
+	if !ok {
+		return
+	}
+
+	is := &services.Introspection{DB: db}
+	err = is.Revoke(request.Token, clientId, trusted)
+	if err == pufferpanel.ErrNoPermission {
+		c.JSON(http.StatusBadRequest, &oauth2TokenResponse{Error: "unauthorized_client"})
+		return
+	}
+	if err != nil {
+		logging.Error.Printf("Error revoking token: %s", err.Error())
+		c.JSON(http.StatusServiceUnavailable, &oauth2TokenResponse{Error: "server_error"})
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+// getIntrospectionCaller works out who is asking. Nodes use their access token and are trusted with any token.
+// Apps and clients give their credentials in the body or with basic auth
+func getIntrospectionCaller(c *gin.Context, db *gorm.DB, clientId, clientSecret string) (string, bool, bool) {
+	auth := strings.TrimSpace(c.GetHeader("Authorization"))
+	if strings.HasPrefix(auth, "Bearer ") {
+		token, err := services.ParseToken(strings.TrimPrefix(auth, "Bearer "))
+		//only node tokens are trusted this way, servers.admin is not enough to read every other token
+		if err == nil && token.Valid && isNodeToken(token) {
+			is := &services.Introspection{DB: db}
+			active, err := is.IsActive(token)
+			if err == nil && active {
+				return token.Claims.PanelClaims.ClientId, true, true
+			}
+		}
+		c.Header("WWW-Authenticate", "Bearer")
+		c.JSON(http.StatusUnauthorized, &oauth2TokenResponse{Error: "invalid_client"})
+		return "", false, false
+	}
+
+	if id, secret, ok := c.Request.BasicAuth(); ok {
+		clientId, clientSecret = id, secret
+	}
+
+	as := &services.Application{DB: db}
+	app, err := as.Get(clientId)
+	if err == nil && app.ValidateSecret(clientSecret) {
+		return app.ClientId, false, true
+	}
+
+	if err == pufferpanel.ErrApplicationNotFound {
+		os := &services.OAuth2{DB: db}
+		client, err := os.Get(clientId)
+		if err == nil && client.ID != 0 && client.ValidateSecret(clientSecret) {
+			return client.ClientId, false, true
+		}
+	}
+
+	c.JSON(http.StatusUnauthorized, &oauth2TokenResponse{Error: "invalid_client"})
+	return "", false, false
+}
+
+type oauth2IntrospectRequest struct {
+	Token         string `form:"token" binding:"required"`
+	TokenTypeHint string `form:"token_type_hint"`
+	ClientId      string `form:"client_id"`
+	ClientSecret  string `form:"client_secret"`
+}
+
+type oauth2IntrospectResponse struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	ClientId  string `json:"client_id,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+	IssuedAt  int64  `json:"iat,omitempty"`
+	Subject   string `json:"sub,omitempty"`
+	Audience  string `json:"aud,omitempty"`
+	TokenId   string `json:"jti,omitempty"`
+}
+
+func isNodeToken(token *pufferpanel.Token) bool {
+	if !pufferpanel.ContainsExactScope(token.Claims.PanelClaims.Scopes[""], pufferpanel.ScopeOAuth2Auth) {
+		return false
+	}
+	_, ok := services.NodeIdFromClientId(token.Claims.PanelClaims.ClientId)
+	return ok
+}
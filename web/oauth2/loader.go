@@ -19,6 +19,8 @@ func RegisterRoutes(rg *gin.RouterGroup) {
 	rg.Use(setHeaders)
 
 	registerTokens(rg)
+	registerAuthorize(rg)
+	registerIntrospection(rg)
 }
 
 func setHeaders(c *gin.Context) {
@@ -21,6 +21,7 @@ import (
 	"github.com/pufferpanel/pufferpanel/v2"
 	"github.com/pufferpanel/pufferpanel/v2/logging"
 	"github.com/pufferpanel/pufferpanel/v2/middleware"
+	"github.com/pufferpanel/pufferpanel/v2/models"
 	"github.com/pufferpanel/pufferpanel/v2/response"
 	"github.com/pufferpanel/pufferpanel/v2/services"
 	"gorm.io/gorm"
@@ -116,12 +117,12 @@ func handleTokenRequest(c *gin.Context) {
 					if client.ServerId.Valid {
 						serverId = &client.ServerId.String
 					}
-					perms, err := ps.GetForUserAndServer(client.UserId, serverId)
+					scopes, err := ps.GetScopesForUserAndServer(client.UserId, serverId)
 					if err != nil {
 						c.JSON(http.StatusBadRequest, &oauth2TokenResponse{Error: "invalid_request", ErrorDescription: err.Error()})
 						return
 					}
-					client.Scopes = perms.ToScopes()
+					client.Scopes = scopes
 				}
 
 				token, err := services.GenerateOAuthForClient(client)
@@ -181,38 +182,34 @@ func handleTokenRequest(c *gin.Context) {
 
 			//confirm user has access to this server
 			ps := &services.Permission{DB: db}
-			perms, err := ps.GetForUserAndServer(user.ID, &server.Identifier)
+			serverScopes, err := ps.GetScopesForUserAndServer(user.ID, &server.Identifier)
 			if err != nil {
 				c.JSON(http.StatusBadRequest, &oauth2TokenResponse{Error: "invalid_request", ErrorDescription: err.Error()})
 				return
 			}
-			if perms.ID == 0 || !perms.SFTPServer {
+			if !pufferpanel.ContainsScope(serverScopes, pufferpanel.ScopeServersSFTP) {
 				c.JSON(http.StatusBadRequest, &oauth2TokenResponse{Error: "invalid_request", ErrorDescription: "no access"})
 				return
 			}
 
 			//validate their credentials
-			user, jwtToken, optNeeded, err := us.Login(user.Email, request.Password)
+			//a second factor cannot be given over SFTP, so the password is all we can check
+			_, _, err = us.Login(user.Email, request.Password)
 			if err != nil {
 				c.JSON(http.StatusBadRequest, &oauth2TokenResponse{Error: "invalid_request", ErrorDescription: "no access"})
 				return
-			} else if optNeeded == false && jwtToken == "" {
-				//if they do not have opt enabled, but we don't have a token... it's still a bad login
+			}
+
+			jwtToken, err := ps.GenerateOAuthForUser(user.ID, &server.Identifier)
+			if err != nil {
+				logging.Error.Printf("Error generating token: %s", err.Error())
 				c.JSON(http.StatusBadRequest, &oauth2TokenResponse{Error: "invalid_request", ErrorDescription: "no access"})
 				return
-			} else if optNeeded == true {
-				//at this point, their login credentials were valid, and we need to shortcut because otp
-				jwtToken, err = services.GenerateSession(user.ID)
-				if err != nil {
-					logging.Error.Printf("Error generating token: %s", err.Error())
-					c.JSON(http.StatusBadRequest, &oauth2TokenResponse{Error: "invalid_request", ErrorDescription: "no access"})
-					return
-				}
 			}
 
 			mappedScopes := make([]string, 0)
 
-			for _, p := range perms.ToScopes() {
+			for _, p := range serverScopes {
 				mappedScopes = append(mappedScopes, server.Identifier+":"+string(p))
 			}
 
@@ -225,17 +222,105 @@ func handleTokenRequest(c *gin.Context) {
 				ExpiresIn:   expiresIn,
 			})
 		}
+	case "authorization_code":
+		{
+			app, ok := getApplicationClient(c, db, &request)
+			if !ok {
+				return
+			}
+
+			as := &services.Application{DB: db}
+			authorization, refreshToken, err := as.ExchangeCode(app, request.Code, request.RedirectUri, request.CodeVerifier)
+			if err != nil {
+				sendApplicationGrantError(c, err)
+				return
+			}
+
+			sendApplicationToken(c, db, app, authorization, refreshToken)
+		}
+	case "refresh_token":
+		{
+			app, ok := getApplicationClient(c, db, &request)
+			if !ok {
+				return
+			}
+
+			as := &services.Application{DB: db}
+			authorization, refreshToken, err := as.Refresh(app, request.RefreshToken)
+			if err != nil {
+				sendApplicationGrantError(c, err)
+				return
+			}
+
+			sendApplicationToken(c, db, app, authorization, refreshToken)
+		}
 	default:
 		c.JSON(http.StatusBadRequest, &oauth2TokenResponse{Error: "unsupported_grant_type", ErrorDescription: fmt.Sprintf("[%s] is not a valid grant type", request.GrantType)})
 	}
 }
 
+// getApplicationClient gets the third-party app making the request. Apps may authenticate in the body or with basic
+// auth, public apps have no secret to give
+func getApplicationClient(c *gin.Context, db *gorm.DB, request *oauth2TokenRequest) (*models.Application, bool) {
+	clientId, clientSecret := request.ClientId, request.ClientSecret
+	if id, secret, ok := c.Request.BasicAuth(); ok {
+		clientId, clientSecret = id, secret
+	}
+
+	as := &services.Application{DB: db}
+	app, err := as.Get(clientId)
+	if err == pufferpanel.ErrApplicationNotFound || (err == nil && !app.ValidateSecret(clientSecret)) {
+		c.JSON(http.StatusUnauthorized, &oauth2TokenResponse{Error: "invalid_client"})
+		return nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, &oauth2TokenResponse{Error: "invalid_request", ErrorDescription: err.Error()})
+		return nil, false
+	}
+	return app, true
+}
+
+func sendApplicationGrantError(c *gin.Context, err error) {
+	if err == pufferpanel.ErrInvalidGrant {
+		c.JSON(http.StatusBadRequest, &oauth2TokenResponse{Error: "invalid_grant", ErrorDescription: err.Error()})
+		return
+	}
+	c.JSON(http.StatusBadRequest, &oauth2TokenResponse{Error: "invalid_request", ErrorDescription: err.Error()})
+}
+
+func sendApplicationToken(c *gin.Context, db *gorm.DB, app *models.Application, authorization *models.ApplicationAuthorization, refreshToken string) {
+	ps := &services.Permission{DB: db}
+	token, err := ps.GenerateOAuthForApplication(app, authorization)
+	if err != nil {
+		logging.Error.Printf("Error generating token: %s", err.Error())
+		c.JSON(http.StatusBadRequest, &oauth2TokenResponse{Error: "invalid_request", ErrorDescription: err.Error()})
+		return
+	}
+
+	scopes := make([]string, len(authorization.Scopes))
+	for i, v := range authorization.Scopes {
+		scopes[i] = string(v)
+	}
+
+	c.JSON(http.StatusOK, &oauth2TokenResponse{
+		AccessToken:  token,
+		TokenType:    "Bearer",
+		Scope:        strings.Join(scopes, " "),
+		ExpiresIn:    expiresIn,
+		RefreshToken: refreshToken,
+	})
+}
+
 type oauth2TokenRequest struct {
 	GrantType    string `form:"grant_type"`
 	ClientId     string `form:"client_id"`
 	ClientSecret string `form:"client_secret"`
 	Username     string `form:"username"`
 	Password     string `form:"password"`
+	Code         string `form:"code"`
+	RedirectUri  string `form:"redirect_uri"`
+	CodeVerifier string `form:"code_verifier"`
+	RefreshToken string `form:"refresh_token"`
 }
 
 type oauth2TokenResponse struct {
@@ -243,6 +328,7 @@ type oauth2TokenResponse struct {
 	TokenType        string `json:"token_type,omitempty"`
 	ExpiresIn        int64  `json:"expires_in,omitempty"`
 	Scope            string `json:"scope,omitempty"`
+	RefreshToken     string `json:"refresh_token,omitempty"`
 	Error            string `json:"error,omitempty"`
 	ErrorDescription string `json:"error_description,omitempty"`
 }
@@ -69,6 +69,16 @@ func proxyServerRequest(c *gin.Context) {
 
 	//if a session-token, we need to convert it to an oauth2 token instead
 	if len(token.Claims.Audience) == 1 && token.Claims.Audience[0] == "session" {
+		sess := &services.Session{DB: db}
+		_, err = sess.GetActiveSession(token)
+		if err == pufferpanel.ErrInvalidSession {
+			response.HandleError(c, err, http.StatusUnauthorized)
+			return
+		}
+		if response.HandleError(c, err, http.StatusInternalServerError) {
+			return
+		}
+
 		newToken, err := ps.GenerateOAuthForUser(cast.ToUint(token.Claims.Subject), &s.Identifier)
 		if response.HandleError(c, err, http.StatusInternalServerError) {
 			return